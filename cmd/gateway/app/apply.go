@@ -0,0 +1,75 @@
+package app
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"harnsgateway/pkg/device"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/storage"
+	"text/tabwriter"
+)
+
+func newApplyCmd() *cobra.Command {
+	var filename string
+	var dryRun bool
+	mode := device.ManifestModeMerge
+	storageBackend := storage.Backend()
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply the devices manifest to the persisted configurations",
+		Long: `Reconcile the persisted devices against the YAML or JSON manifest by device code and print the changes.
+The devices absent from manifest are kept in "merge" mode and deleted in "replace" mode. Run with '--dry-run' to
+print the planned changes only. The gateway should be stopped, or pass '--devices-manifest' to the gateway to apply
+the manifest at startup.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := storage.SetBackend(storageBackend); err != nil {
+				return err
+			}
+			if len(filename) == 0 {
+				return fmt.Errorf("filename is required")
+			}
+			manifest, err := device.LoadManifest(filename)
+			if err != nil {
+				return err
+			}
+			store, err := generic.NewStore(storage.StoreGroupToString[storage.StoreGroupDevice], storage.Devices, generic.DeviceTypeObjectMap)
+			if err != nil {
+				return err
+			}
+			stopCh := make(chan struct{})
+			defer close(stopCh)
+			// the devices are changed in store only, the running gateway collects them after restarted
+			deviceMgr := device.NewManager(store, nil, nil, stopCh, device.WithCollect(false))
+			deviceMgr.Load()
+			changes, err := deviceMgr.ApplyManifest(manifest, &device.ManifestOptions{Mode: mode, DryRun: dryRun, Source: filename})
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "OPERATION\tDEVICE TYPE\tDEVICE CODE\tDEVICE ID\tRESULT")
+			failed := 0
+			for _, change := range changes {
+				result := change.Result
+				if result == device.ImportResultFailure {
+					failed++
+					result = fmt.Sprintf("%s: %s", result, change.Error)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", change.Operation, change.DeviceType, change.DeviceCode, change.DeviceId, result)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to apply %d devices of manifest %s", failed, filename)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&storageBackend, "storage-backend", "", storageBackend, "The storage backend of gateway, one of \"fs\", \"bolt\"")
+	cmd.Flags().StringVarP(&filename, "filename", "f", filename, "The YAML or JSON manifest of devices")
+	cmd.Flags().StringVarP(&mode, "manifest-mode", "", mode, "The mode of applying manifest, one of \"merge\", \"replace\"")
+	cmd.Flags().BoolVarP(&dryRun, "dry-run", "", dryRun, "Print the planned changes without changing any device")
+	return cmd
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"harnsgateway/pkg/backup"
+	"harnsgateway/pkg/storage"
+	"io"
+	"os"
+	"time"
+)
+
+func newBackupCmd() *cobra.Command {
+	var output string
+	storageBackend := storage.Backend()
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the gateway configurations into an archive",
+		Long: `Back up the gateway meta, devices and the other persisted configurations into a versioned tar.gz archive.
+The archive contains the secret of gateway and the credentials of sinks, keep it safe.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := storage.SetBackend(storageBackend); err != nil {
+				return err
+			}
+			if len(output) == 0 {
+				output = fmt.Sprintf("harnsgateway-%s.tar.gz", time.Now().UTC().Format("20060102150405"))
+			}
+			var w io.Writer = os.Stdout
+			if output != "-" {
+				f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			manifest, err := backup.Backup(w, storage.Path())
+			if err != nil {
+				return err
+			}
+			if output != "-" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d files of gateway %s into %s\n", manifest.Files, manifest.GatewayId, output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&storageBackend, "storage-backend", "", storageBackend, "The storage backend of gateway, one of \"fs\", \"bolt\"")
+	cmd.Flags().StringVarP(&output, "output", "o", output, "The archive file to write, '-' writes to stdout. Defaults to harnsgateway-{timestamp}.tar.gz")
+	return cmd
+}
+
+func newRestoreCmd() *cobra.Command {
+	var input string
+	storageBackend := storage.Backend()
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the gateway configurations from an archive",
+		Long: `Validate the archive and replace the persisted configurations with it, the configurations absent from archive are emptied.
+The gateway should be stopped, use 'POST /api/v1/restore' to restore a running gateway.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := storage.SetBackend(storageBackend); err != nil {
+				return err
+			}
+			var r io.Reader = os.Stdin
+			if input != "-" {
+				f, err := os.Open(input)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			manifest, err := backup.Restore(r, storage.Path())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Restored %d files of gateway %s backed up at %s\n", manifest.Files, manifest.GatewayId, manifest.CreatedAt.Format(time.RFC3339))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&storageBackend, "storage-backend", "", storageBackend, "The storage backend of gateway, one of \"fs\", \"bolt\"")
+	cmd.Flags().StringVarP(&input, "input", "i", input, "The archive file to restore, '-' reads from stdin")
+	_ = cmd.MarkFlagRequired("input")
+	return cmd
+}
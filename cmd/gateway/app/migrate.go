@@ -0,0 +1,29 @@
+package app
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"harnsgateway/pkg/storage"
+)
+
+func newMigrateCmd() *cobra.Command {
+	var overwrite bool
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the persisted configurations from files into the bolt database",
+		Long: `Copy the objects persisted as files under store path into the embedded bolt database in one transaction,
+then run the gateway with '--storage-backend=bolt'. The files are kept but no longer used by the bolt backend.
+The gateway should be stopped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := storage.Migrate(overwrite)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Migrated %d objects into %s\n", count, storage.DatabasePath())
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&overwrite, "overwrite", "", overwrite, "Drop the objects already in the bolt database")
+	return cmd
+}
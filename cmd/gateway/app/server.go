@@ -71,6 +71,7 @@ func NewGatewayCmd() *cobra.Command {
 	verflag.AddFlags(cleanFlagSet)
 	o.AddFlags(cleanFlagSet)
 	o.AddBaseFlags(cmd, cleanFlagSet)
+	cmd.AddCommand(newBackupCmd(), newRestoreCmd(), newMigrateCmd(), newApplyCmd())
 
 	return cmd
 }
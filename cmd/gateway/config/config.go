@@ -1,13 +1,27 @@
 package config
 
 import (
+	"harnsgateway/pkg/alarm"
+	"harnsgateway/pkg/backup"
 	"harnsgateway/pkg/device"
 	"harnsgateway/pkg/gateway"
+	"harnsgateway/pkg/northbound"
+	"harnsgateway/pkg/rule"
+	"harnsgateway/pkg/schedule"
+	"harnsgateway/pkg/script"
+	"harnsgateway/pkg/template"
 )
 
 type Config struct {
-	DeviceMgr  *device.Manager
-	GatewayMgr *gateway.Manager
-	CertFile   string
-	KeyFile    string
+	DeviceMgr   *device.Manager
+	GatewayMgr  *gateway.Manager
+	SinkMgr     *northbound.Manager
+	AlarmMgr    *alarm.Manager
+	RuleMgr     *rule.Manager
+	ScriptMgr   *script.Manager
+	ScheduleMgr *schedule.Manager
+	TemplateMgr *template.Manager
+	BackupMgr   *backup.Manager
+	CertFile    string
+	KeyFile     string
 }
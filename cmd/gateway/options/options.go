@@ -1,38 +1,76 @@
 package options
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/spf13/pflag"
 	"harnsgateway/cmd/gateway/config"
+	"harnsgateway/pkg/alarm"
+	"harnsgateway/pkg/backup"
 	"harnsgateway/pkg/device"
 	"harnsgateway/pkg/gateway"
 	"harnsgateway/pkg/generic"
 	baseoptions "harnsgateway/pkg/generic/options"
+	"harnsgateway/pkg/northbound"
+	"harnsgateway/pkg/rule"
+	"harnsgateway/pkg/schedule"
+	"harnsgateway/pkg/script"
 	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/template"
+	v1 "harnsgateway/pkg/v1"
 	"k8s.io/klog/v2"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
 type Options struct {
-	Port           string        `json:"port"`
-	Wait           time.Duration `json:"graceful-timeout"`
-	MqttBrokerUrls []string      `json:"mqtt-broker-urls"`
-	MqttUsername   string        `json:"mqtt-username"`
-	MqttPassword   string        `json:"mqtt-password"`
-	CertFile       string        `json:"cert-file"`
-	KeyFile        string        `json:"key-file"`
+	Port                     string        `json:"port"`
+	Wait                     time.Duration `json:"graceful-timeout"`
+	MqttBrokerUrls           []string      `json:"mqtt-broker-urls"`
+	MqttUsername             string        `json:"mqtt-username"`
+	MqttPassword             string        `json:"mqtt-password"`
+	MqttCaFile               string        `json:"mqtt-ca-file"`
+	MqttCertFile             string        `json:"mqtt-cert-file"`
+	MqttKeyFile              string        `json:"mqtt-key-file"`
+	MqttInsecureSkipVerify   bool          `json:"mqtt-insecure-skip-verify"`
+	MqttKeepAlive            time.Duration `json:"mqtt-keep-alive"`
+	MqttCleanSession         bool          `json:"mqtt-clean-session"`
+	MqttQos                  uint8         `json:"mqtt-qos"`
+	MqttRetain               bool          `json:"mqtt-retain"`
+	MqttLastWill             bool          `json:"mqtt-last-will"`
+	MqttAutoReconnect        bool          `json:"mqtt-auto-reconnect"`
+	MqttConnectRetry         bool          `json:"mqtt-connect-retry"`
+	MqttConnectTimeout       time.Duration `json:"mqtt-connect-timeout"`
+	MqttMaxReconnectInterval time.Duration `json:"mqtt-max-reconnect-interval"`
+	MetricsVariables         bool          `json:"metrics-variables"`
+	CertFile                 string        `json:"cert-file"`
+	KeyFile                  string        `json:"key-file"`
+	StorageBackend           string        `json:"storage-backend"`
+	ReloadDeviceFiles        bool          `json:"reload-device-files"`
+	DevicesManifest          string        `json:"devices-manifest"`
+	ManifestMode             string        `json:"manifest-mode"`
 	baseoptions.BaseOptions
 	// logs.BaseOptions
 }
 
 const (
-	_defaultPort         = "32200"
-	_defaultWait         = 15 * time.Second
-	_defaultMqttUsername = ""
-	_defaultMqttPassword = ""
+	_defaultPort                     = "32200"
+	_defaultWait                     = 15 * time.Second
+	_defaultMqttUsername             = ""
+	_defaultMqttPassword             = ""
+	_defaultMqttKeepAlive            = 30 * time.Second
+	_defaultMqttQos                  = 1
+	_defaultMqttConnectTimeout       = 30 * time.Second
+	_defaultMqttMaxReconnectInterval = 10 * time.Minute
 )
 
+const mqttStatusTopicFormat = "status/%s/v1"
+
 var (
 	_defaultMqttBrokerUrls = []string{"tcp://127.0.0.1:1883"}
 )
@@ -44,9 +82,29 @@ func NewDefaultOptions() *Options {
 		MqttBrokerUrls: _defaultMqttBrokerUrls,
 		MqttUsername:   _defaultMqttUsername,
 		MqttPassword:   _defaultMqttPassword,
-		BaseOptions:    baseoptions.NewDefaultBaseOptions(),
-		CertFile:       "",
-		KeyFile:        "",
+		// tls
+		MqttCaFile:             "",
+		MqttCertFile:           "",
+		MqttKeyFile:            "",
+		MqttInsecureSkipVerify: false,
+		// session
+		MqttKeepAlive:            _defaultMqttKeepAlive,
+		MqttCleanSession:         true,
+		MqttQos:                  _defaultMqttQos,
+		MqttRetain:               false,
+		MqttLastWill:             true,
+		MqttAutoReconnect:        true,
+		MqttConnectRetry:         false,
+		MqttConnectTimeout:       _defaultMqttConnectTimeout,
+		MqttMaxReconnectInterval: _defaultMqttMaxReconnectInterval,
+		MetricsVariables:         false,
+		BaseOptions:              baseoptions.NewDefaultBaseOptions(),
+		CertFile:                 "",
+		KeyFile:                  "",
+		StorageBackend:           storage.BackendFs,
+		ReloadDeviceFiles:        true,
+		DevicesManifest:          "",
+		ManifestMode:             device.ManifestModeMerge,
 		// BaseOptions: logs.NewOptions(),
 	}
 }
@@ -58,12 +116,40 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringSliceVarP(&o.MqttBrokerUrls, "mqtt-broker-urls", "", o.MqttBrokerUrls, "The MQTT device urls. The format should be scheme://host:port Where \"scheme\" is one of \"tcp\", \"ssl\", or \"ws\"")
 	fs.StringVarP(&o.MqttUsername, "mqtt-username", "u", o.MqttUsername, "The MQTT username")
 	fs.StringVarP(&o.MqttPassword, "mqtt-password", "p", o.MqttPassword, "The MQTT password")
+	fs.StringVarP(&o.MqttCaFile, "mqtt-ca-file", "", o.MqttCaFile, "The CA bundle file used to verify the MQTT broker certificate")
+	fs.StringVarP(&o.MqttCertFile, "mqtt-cert-file", "", o.MqttCertFile, "The client cert file for MQTT mutual TLS")
+	fs.StringVarP(&o.MqttKeyFile, "mqtt-key-file", "", o.MqttKeyFile, "The client key file for MQTT mutual TLS")
+	fs.BoolVarP(&o.MqttInsecureSkipVerify, "mqtt-insecure-skip-verify", "", o.MqttInsecureSkipVerify, "Skip to verify the MQTT broker certificate")
+	fs.DurationVar(&o.MqttKeepAlive, "mqtt-keep-alive", o.MqttKeepAlive, "The amount of time that the MQTT client should wait before sending a PING request to the broker")
+	fs.BoolVarP(&o.MqttCleanSession, "mqtt-clean-session", "", o.MqttCleanSession, "Whether to set the MQTT clean session flag in the connect message")
+	fs.Uint8VarP(&o.MqttQos, "mqtt-qos", "", o.MqttQos, "The QoS of published data, one of 0, 1, 2")
+	fs.BoolVarP(&o.MqttRetain, "mqtt-retain", "", o.MqttRetain, "Whether the broker should retain the published data")
+	fs.BoolVarP(&o.MqttLastWill, "mqtt-last-will", "", o.MqttLastWill, "Announce gateway online/offline to 'status/{gatewayId}/v1' by birth message and last will")
+	fs.BoolVarP(&o.MqttAutoReconnect, "mqtt-auto-reconnect", "", o.MqttAutoReconnect, "Whether to automatically reconnect to the MQTT broker when the connection is lost")
+	fs.BoolVarP(&o.MqttConnectRetry, "mqtt-connect-retry", "", o.MqttConnectRetry, "Whether to keep retrying the initial MQTT connection instead of failing at startup")
+	fs.DurationVar(&o.MqttConnectTimeout, "mqtt-connect-timeout", o.MqttConnectTimeout, "The amount of time that the MQTT client waits for a connection to be established")
+	fs.DurationVar(&o.MqttMaxReconnectInterval, "mqtt-max-reconnect-interval", o.MqttMaxReconnectInterval, "The maximum time that will be waited between MQTT reconnection attempts")
+	fs.BoolVarP(&o.MetricsVariables, "metrics-variables", "", o.MetricsVariables, "Export the latest variable values as gauges in '/metrics'")
 	fs.StringVarP(&o.CertFile, "cert-file", "", o.CertFile, "The Cert file")
 	fs.StringVarP(&o.KeyFile, "key-file", "", o.KeyFile, "The Key file")
+	fs.StringVarP(&o.StorageBackend, "storage-backend", "", o.StorageBackend, "The backend persisting configurations, one of \"fs\", \"bolt\". Run 'migrate' to move the configurations from \"fs\" to \"bolt\"")
+	fs.StringVarP(&o.DevicesManifest, "devices-manifest", "", o.DevicesManifest, "The YAML or JSON manifest of devices reconciled by device code at startup")
+	fs.StringVarP(&o.ManifestMode, "manifest-mode", "", o.ManifestMode, "The mode of applying devices manifest, one of \"merge\", \"replace\". The devices absent from manifest are deleted in \"replace\" mode")
+	fs.BoolVarP(&o.ReloadDeviceFiles, "reload-device-files", "", o.ReloadDeviceFiles, "Reload the device files edited on disk of \"fs\" storage backend, the invalid files are rejected")
 }
 
 func (o *Options) Config(stopCh <-chan struct{}) (*config.Config, error) {
 	c := &config.Config{}
+	// the manifest is validated before starting anything
+	var manifest []v1.DeviceType
+	if len(o.DevicesManifest) > 0 {
+		devices, err := device.LoadManifest(o.DevicesManifest)
+		if err != nil {
+			klog.ErrorS(err, "Failed to load devices manifest", "manifest", o.DevicesManifest)
+			return nil, err
+		}
+		manifest = devices
+	}
 	gatewayMgr := gateway.NewGatewayManager(stopCh)
 	gatewayMgr.Init()
 	c.GatewayMgr = gatewayMgr
@@ -79,17 +165,148 @@ func (o *Options) Config(stopCh <-chan struct{}) (*config.Config, error) {
 	mqttOption.SetPassword(o.MqttPassword)
 	mqttOption.SetOrderMatters(false)
 	mqttOption.SetClientID(fmt.Sprintf("gateway-id-%s", gatewayMeta.ID))
+	mqttOption.SetKeepAlive(o.MqttKeepAlive)
+	mqttOption.SetCleanSession(o.MqttCleanSession)
+	mqttOption.SetAutoReconnect(o.MqttAutoReconnect)
+	mqttOption.SetConnectRetry(o.MqttConnectRetry)
+	mqttOption.SetConnectTimeout(o.MqttConnectTimeout)
+	mqttOption.SetMaxReconnectInterval(o.MqttMaxReconnectInterval)
+	tlsConfig, err := o.mqttTLSConfig()
+	if err != nil {
+		klog.ErrorS(err, "Failed to load MQTT TLS config")
+		return nil, err
+	}
+	if tlsConfig != nil {
+		mqttOption.SetTLSConfig(tlsConfig)
+	}
+
+	statusTopic := fmt.Sprintf(mqttStatusTopicFormat, gatewayMeta.ID)
+	offline, _ := json.Marshal(&gateway.MqttStatusMessage{GatewayId: gatewayMeta.ID, Status: gateway.MqttOffline})
+	if o.MqttLastWill {
+		mqttOption.SetBinaryWill(statusTopic, offline, 1, true)
+	}
+
+	// the device manager is created after the client, and read by the callbacks of client goroutine
+	var commandMgr atomic.Pointer[device.Manager]
+	mqttOption.SetOnConnectHandler(func(client mqtt.Client) {
+		gatewayMgr.MqttConnected()
+		if o.MqttLastWill {
+			online, _ := json.Marshal(&gateway.MqttStatusMessage{
+				GatewayId: gatewayMeta.ID,
+				Status:    gateway.MqttOnline,
+				Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+			})
+			client.Publish(statusTopic, 1, true, online)
+		}
+		// subscriptions are lost when reconnected with clean session
+		if deviceMgr := commandMgr.Load(); deviceMgr != nil {
+			_ = deviceMgr.SubscribeCommand()
+		}
+	})
+	mqttOption.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		klog.V(1).InfoS("Lost connection of MQTT", "servers", o.MqttBrokerUrls, "err", err)
+		gatewayMgr.MqttConnectionLost(err)
+	})
+	mqttOption.SetReconnectingHandler(func(client mqtt.Client, options *mqtt.ClientOptions) {
+		gatewayMgr.MqttReconnecting()
+	})
 	mqttClient := mqtt.NewClient(mqttOption)
+	gatewayMgr.SetMqttServers(o.MqttBrokerUrls)
 	klog.V(1).InfoS("Connected to MQTT", "servers", o.MqttBrokerUrls)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+	if token := mqttClient.Connect(); o.MqttConnectRetry {
+		// the token will not complete until connected, keep retrying in background
+		klog.V(2).InfoS("Connecting to MQTT in background", "servers", o.MqttBrokerUrls)
+	} else if token.Wait() && token.Error() != nil {
 		klog.ErrorS(token.Error(), "Failed to connect MQTT", "servers", o.MqttBrokerUrls)
 		return nil, token.Error()
 	}
-	deviceMgr := device.NewManager(store, mqttClient, gatewayMeta, stopCh)
+	sinkMgr := northbound.NewManager(mqttClient, gatewayMeta, stopCh, northbound.WithDefaultMqtt(o.MqttQos, o.MqttRetain))
+	sinkMgr.Init()
+
+	alarmMgr := alarm.NewManager(mqttClient, gatewayMeta, stopCh)
+	ruleMgr := rule.NewManager(stopCh)
+	scriptMgr := script.NewManager()
+
+	mgrOpts := []device.Option{device.WithRouter(sinkMgr), device.WithObserver(alarmMgr, ruleMgr), device.WithProcessor(scriptMgr), device.WithVariableMetrics(o.MetricsVariables), device.WithFileReload(o.ReloadDeviceFiles)}
+	if o.MqttLastWill {
+		mgrOpts = append(mgrOpts, device.WithWillMessage(statusTopic, offline))
+	}
+	deviceMgr := device.NewManager(store, mqttClient, gatewayMeta, stopCh, mgrOpts...)
+	commandMgr.Store(deviceMgr)
+	scriptMgr.Init(deviceMgr)
 	deviceMgr.Init()
+	alarmMgr.Init(deviceMgr)
+	ruleMgr.Init(deviceMgr)
+	scheduleMgr := schedule.NewManager(stopCh)
+	scheduleMgr.Init(deviceMgr)
+	templateStore, _ := generic.NewStore(storage.StoreGroupToString[storage.StoreGroupTemplate], storage.Templates, template.TemplateTypeObjectMap)
+	templateMgr := template.NewManager(templateStore)
+	templateMgr.Init(deviceMgr)
+	backupMgr := backup.NewManager(storage.Path())
+	backupMgr.Init(deviceMgr)
+	if manifest != nil {
+		if err := applyManifest(deviceMgr, manifest, o.DevicesManifest, o.ManifestMode); err != nil {
+			return nil, err
+		}
+	}
 
 	c.DeviceMgr = deviceMgr
+	c.SinkMgr = sinkMgr
+	c.AlarmMgr = alarmMgr
+	c.RuleMgr = ruleMgr
+	c.ScriptMgr = scriptMgr
+	c.ScheduleMgr = scheduleMgr
+	c.TemplateMgr = templateMgr
+	c.BackupMgr = backupMgr
 	c.KeyFile = o.KeyFile
 	c.CertFile = o.CertFile
 	return c, nil
 }
+
+// applyManifest reconcile the devices against manifest, the manifest conflicted with devices fails the startup while
+// the devices failed to change are logged only, the gateway goes on with the others
+func applyManifest(deviceMgr *device.Manager, manifest []v1.DeviceType, path string, mode string) error {
+	changes, err := deviceMgr.ApplyManifest(manifest, &device.ManifestOptions{Mode: mode, Source: path})
+	if err != nil {
+		klog.ErrorS(err, "Failed to apply devices manifest", "manifest", path)
+		return err
+	}
+	for _, change := range changes {
+		switch {
+		case change.Result == device.ImportResultFailure:
+			klog.ErrorS(errors.New(change.Error), "Failed to apply device of manifest", "deviceCode", change.DeviceCode, "operation", change.Operation)
+		case change.Operation != device.ManifestOperationUnchanged:
+			klog.V(1).InfoS("Applied device of manifest", "deviceCode", change.DeviceCode, "deviceId", change.DeviceId, "operation", change.Operation)
+		}
+	}
+	return nil
+}
+
+func (o *Options) mqttTLSConfig() (*tls.Config, error) {
+	if len(o.MqttCaFile) == 0 && len(o.MqttCertFile) == 0 && !o.MqttInsecureSkipVerify {
+		return nil, nil
+	}
+
+	c := &tls.Config{
+		InsecureSkipVerify: o.MqttInsecureSkipVerify,
+	}
+	if len(o.MqttCaFile) != 0 {
+		ca, err := os.ReadFile(o.MqttCaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in %s", o.MqttCaFile)
+		}
+		c.RootCAs = pool
+	}
+	if len(o.MqttCertFile) != 0 && len(o.MqttKeyFile) != 0 {
+		x509KeyPair, err := tls.LoadX509KeyPair(o.MqttCertFile, o.MqttKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{x509KeyPair}
+	}
+	return c, nil
+}
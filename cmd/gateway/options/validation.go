@@ -1,10 +1,28 @@
 package options
 
+import (
+	"fmt"
+	"harnsgateway/pkg/device"
+	"harnsgateway/pkg/storage"
+)
+
 func Validate(o *Options) []error {
 	var errs []error
 	if err := o.BaseOptions.ValidateAndApply(); err != nil {
 		errs = append(errs, err)
 	}
+	if o.MqttQos > 2 {
+		errs = append(errs, fmt.Errorf("invalid mqtt-qos %d, must be one of 0, 1, 2", o.MqttQos))
+	}
+	if (len(o.MqttCertFile) == 0) != (len(o.MqttKeyFile) == 0) {
+		errs = append(errs, fmt.Errorf("mqtt-cert-file and mqtt-key-file must be specified together"))
+	}
+	if o.ManifestMode != device.ManifestModeMerge && o.ManifestMode != device.ManifestModeReplace {
+		errs = append(errs, fmt.Errorf("invalid manifest-mode %s, must be one of %s, %s", o.ManifestMode, device.ManifestModeMerge, device.ManifestModeReplace))
+	}
+	if err := storage.SetBackend(o.StorageBackend); err != nil {
+		errs = append(errs, err)
+	}
 
 	return errs
 }
@@ -0,0 +1,190 @@
+package alarm
+
+import (
+	"harnsgateway/pkg/utils/convutil"
+	"math"
+	"reflect"
+	"time"
+)
+
+// condition keeps the state of one alarm condition, the condition switches only after
+// the raw state holds for on-delay or off-delay.
+type condition struct {
+	name  string
+	limit *float64
+	// raw state of the latest evaluation
+	matched bool
+	// the time since raw state differs from active
+	pending time.Time
+	active  bool
+	alarmId string
+}
+
+// transition the condition switched to active or inactive
+type transition struct {
+	condition *condition
+	active    bool
+	value     interface{}
+}
+
+func (c *condition) update(now time.Time, matched bool, onDelay, offDelay time.Duration) bool {
+	c.matched = matched
+	if matched == c.active {
+		c.pending = time.Time{}
+		return false
+	}
+	if c.pending.IsZero() {
+		c.pending = now
+	}
+	delay := onDelay
+	if c.active {
+		delay = offDelay
+	}
+	if now.Sub(c.pending) < delay {
+		return false
+	}
+	c.active = matched
+	c.pending = time.Time{}
+	return true
+}
+
+// evaluator evaluates all conditions of definition with the values of variable
+type evaluator struct {
+	def        *Definition
+	conditions []*condition
+	lastValue  interface{}
+	lastNumber float64
+	lastTime   time.Time
+	lastChange time.Time
+}
+
+func newEvaluator(def *Definition, now time.Time) *evaluator {
+	e := &evaluator{def: def, lastChange: now}
+	switch def.AlarmType {
+	case AlarmTypeLimit:
+		for _, l := range []struct {
+			name  string
+			limit *float64
+		}{
+			{ConditionHighHigh, def.HighHigh},
+			{ConditionHigh, def.High},
+			{ConditionLow, def.Low},
+			{ConditionLowLow, def.LowLow},
+		} {
+			if l.limit != nil {
+				e.conditions = append(e.conditions, &condition{name: l.name, limit: l.limit})
+			}
+		}
+	case AlarmTypeBoolean:
+		e.conditions = append(e.conditions, &condition{name: ConditionBoolean})
+	case AlarmTypeRateOfChange:
+		limit := def.RateLimit
+		e.conditions = append(e.conditions, &condition{name: ConditionRateOfChange, limit: &limit})
+	case AlarmTypeStale:
+		e.conditions = append(e.conditions, &condition{name: ConditionStale})
+	}
+	return e
+}
+
+func (e *evaluator) getCondition(name string) *condition {
+	for _, c := range e.conditions {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (e *evaluator) delays() (time.Duration, time.Duration) {
+	return time.Duration(e.def.OnDelay) * time.Second, time.Duration(e.def.OffDelay) * time.Second
+}
+
+// evaluate the new value of variable
+func (e *evaluator) evaluate(now time.Time, value interface{}) []*transition {
+	number, isNumber := convutil.ToFloat64(value)
+	if _, ok := value.(bool); ok && e.def.AlarmType != AlarmTypeBoolean {
+		isNumber = false
+	}
+	if e.lastTime.IsZero() || !reflect.DeepEqual(value, e.lastValue) {
+		e.lastChange = now
+	}
+	rate, hasRate := 0.0, false
+	if isNumber && !e.lastTime.IsZero() && now.After(e.lastTime) {
+		if _, ok := convutil.ToFloat64(e.lastValue); ok {
+			rate = math.Abs(number-e.lastNumber) / now.Sub(e.lastTime).Seconds()
+			hasRate = true
+		}
+	}
+	e.lastValue, e.lastNumber, e.lastTime = value, number, now
+
+	onDelay, offDelay := e.delays()
+	deadband := e.def.Deadband
+	transitions := make([]*transition, 0)
+	for _, c := range e.conditions {
+		var matched bool
+		switch c.name {
+		case ConditionHighHigh, ConditionHigh:
+			if !isNumber {
+				continue
+			}
+			if c.active {
+				matched = number > *c.limit-deadband
+			} else {
+				matched = number > *c.limit
+			}
+		case ConditionLow, ConditionLowLow:
+			if !isNumber {
+				continue
+			}
+			if c.active {
+				matched = number < *c.limit+deadband
+			} else {
+				matched = number < *c.limit
+			}
+		case ConditionBoolean:
+			if !isNumber {
+				continue
+			}
+			alarmOn := true
+			if e.def.AlarmOn != nil {
+				alarmOn = *e.def.AlarmOn
+			}
+			matched = (number != 0) == alarmOn
+		case ConditionRateOfChange:
+			if !hasRate {
+				continue
+			}
+			if c.active {
+				matched = rate > *c.limit-deadband
+			} else {
+				matched = rate > *c.limit
+			}
+		case ConditionStale:
+			matched = e.stale(now)
+		}
+		if c.update(now, matched, onDelay, offDelay) {
+			transitions = append(transitions, &transition{condition: c, active: c.active, value: value})
+		}
+	}
+	return transitions
+}
+
+// tick switches the pending conditions whose delay elapsed and checks the stale value
+func (e *evaluator) tick(now time.Time) []*transition {
+	onDelay, offDelay := e.delays()
+	transitions := make([]*transition, 0)
+	for _, c := range e.conditions {
+		matched := c.matched
+		if c.name == ConditionStale {
+			matched = e.stale(now)
+		}
+		if c.update(now, matched, onDelay, offDelay) {
+			transitions = append(transitions, &transition{condition: c, active: c.active, value: e.lastValue})
+		}
+	}
+	return transitions
+}
+
+func (e *evaluator) stale(now time.Time) bool {
+	return now.Sub(e.lastChange) >= time.Duration(e.def.StaleTimeout)*time.Second
+}
@@ -0,0 +1,82 @@
+package alarm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluatorLimitHysteresis(t *testing.T) {
+	high := 80.0
+	e := newEvaluator(&Definition{AlarmType: AlarmTypeLimit, High: &high, Deadband: 5}, time.Now())
+	now := time.Now()
+
+	steps := []struct {
+		value  float64
+		active bool
+	}{
+		{70, false},
+		{81, true},
+		// inside deadband, keep active
+		{78, true},
+		{74, false},
+		{79, false},
+	}
+	for i, step := range steps {
+		e.evaluate(now.Add(time.Duration(i)*time.Second), step.value)
+		if got := e.getCondition(ConditionHigh).active; got != step.active {
+			t.Errorf("step %d value %v: active = %v, want %v", i, step.value, got, step.active)
+		}
+	}
+}
+
+func TestEvaluatorDelay(t *testing.T) {
+	on := true
+	e := newEvaluator(&Definition{AlarmType: AlarmTypeBoolean, AlarmOn: &on, OnDelay: 3, OffDelay: 2}, time.Now())
+	now := time.Now()
+
+	if ts := e.evaluate(now, true); len(ts) != 0 {
+		t.Fatalf("raised before on-delay")
+	}
+	if ts := e.tick(now.Add(2 * time.Second)); len(ts) != 0 {
+		t.Fatalf("raised before on-delay")
+	}
+	if ts := e.tick(now.Add(3 * time.Second)); len(ts) != 1 || !ts[0].active {
+		t.Fatalf("not raised after on-delay")
+	}
+	if ts := e.evaluate(now.Add(4*time.Second), false); len(ts) != 0 {
+		t.Fatalf("cleared before off-delay")
+	}
+	// the condition matches again, the off-delay restarts
+	e.evaluate(now.Add(5*time.Second), true)
+	if ts := e.evaluate(now.Add(6*time.Second), false); len(ts) != 0 {
+		t.Fatalf("cleared before off-delay")
+	}
+	if ts := e.tick(now.Add(8 * time.Second)); len(ts) != 1 || ts[0].active {
+		t.Fatalf("not cleared after off-delay")
+	}
+}
+
+func TestEvaluatorRateOfChangeAndStale(t *testing.T) {
+	now := time.Now()
+	roc := newEvaluator(&Definition{AlarmType: AlarmTypeRateOfChange, RateLimit: 10}, now)
+	roc.evaluate(now, int16(100))
+	if ts := roc.evaluate(now.Add(time.Second), int16(105)); len(ts) != 0 {
+		t.Errorf("raised with rate 5")
+	}
+	if ts := roc.evaluate(now.Add(2*time.Second), int16(125)); len(ts) != 1 || !ts[0].active {
+		t.Errorf("not raised with rate 20")
+	}
+
+	stale := newEvaluator(&Definition{AlarmType: AlarmTypeStale, StaleTimeout: 5}, now)
+	stale.evaluate(now, 1.5)
+	stale.evaluate(now.Add(3*time.Second), 1.5)
+	if ts := stale.tick(now.Add(4 * time.Second)); len(ts) != 0 {
+		t.Errorf("raised before stale timeout")
+	}
+	if ts := stale.tick(now.Add(5 * time.Second)); len(ts) != 1 || !ts[0].active {
+		t.Errorf("not raised after stale timeout")
+	}
+	if ts := stale.evaluate(now.Add(6*time.Second), 1.6); len(ts) != 1 || ts[0].active {
+		t.Errorf("not cleared after value changed")
+	}
+}
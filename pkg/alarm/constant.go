@@ -0,0 +1,43 @@
+package alarm
+
+import "time"
+
+const (
+	AlarmTypeLimit        = "limit"
+	AlarmTypeBoolean      = "boolean"
+	AlarmTypeRateOfChange = "rateOfChange"
+	AlarmTypeStale        = "stale"
+)
+
+// conditions raised by the alarm types, the limit type raises up to four conditions
+const (
+	ConditionHighHigh     = "highHigh"
+	ConditionHigh         = "high"
+	ConditionLow          = "low"
+	ConditionLowLow       = "lowLow"
+	ConditionBoolean      = "boolean"
+	ConditionRateOfChange = "rateOfChange"
+	ConditionStale        = "stale"
+)
+
+const (
+	StateActive       = "active"
+	StateAcknowledged = "acknowledged"
+	StateCleared      = "cleared"
+)
+
+const (
+	SeverityCritical = "critical"
+	SeverityMajor    = "major"
+	SeverityMinor    = "minor"
+	SeverityWarning  = "warning"
+)
+
+const (
+	alarmTopicFormat = "alarm/%s/v1/%s"
+	timestampFormat  = "2006-01-02T15:04:05.000Z"
+	observationSize  = 1000
+	maxClearedAlarms = 1000
+	tickInterval     = 1 * time.Second
+	mqttTimeout      = 1 * time.Second
+)
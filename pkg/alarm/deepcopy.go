@@ -0,0 +1,44 @@
+package alarm
+
+import "harnsgateway/pkg/runtime"
+
+func (in *Definition) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	out.HighHigh = copyFloat(in.HighHigh)
+	out.High = copyFloat(in.High)
+	out.Low = copyFloat(in.Low)
+	out.LowLow = copyFloat(in.LowLow)
+	if in.AlarmOn != nil {
+		b := *in.AlarmOn
+		out.AlarmOn = &b
+	}
+	return &out
+}
+
+func (in *Alarm) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	out.Limit = copyFloat(in.Limit)
+	if in.AckTime != nil {
+		t := *in.AckTime
+		out.AckTime = &t
+	}
+	if in.ClearTime != nil {
+		t := *in.ClearTime
+		out.ClearTime = &t
+	}
+	return &out
+}
+
+func copyFloat(in *float64) *float64 {
+	if in == nil {
+		return nil
+	}
+	f := *in
+	return &f
+}
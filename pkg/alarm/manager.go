@@ -0,0 +1,506 @@
+package alarm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/gateway"
+	"harnsgateway/pkg/metrics"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeviceGetter finds the device whose variables are watched
+type DeviceGetter interface {
+	GetDeviceById(id string, exploded bool) (runtime.Device, error)
+}
+
+type observation struct {
+	deviceId  string
+	timestamp time.Time
+	values    []runtime.PointData
+}
+
+// Manager evaluates the alarm definitions with the collected values,
+// raises, clears and persists alarms and publishes them to MQTT.
+type Manager struct {
+	gatewayMeta  *gateway.GatewayMeta
+	mqttClient   mqtt.Client
+	devices      DeviceGetter
+	mu           *sync.Mutex
+	definitions  map[string]*Definition
+	evaluators   map[string]*evaluator
+	alarms       map[string]*Alarm
+	client       storage.Storage
+	observations chan *observation
+	stopCh       <-chan struct{}
+}
+
+func NewManager(mqttClient mqtt.Client, gatewayMeta *gateway.GatewayMeta, stop <-chan struct{}) *Manager {
+	return &Manager{
+		gatewayMeta:  gatewayMeta,
+		mqttClient:   mqttClient,
+		mu:           &sync.Mutex{},
+		definitions:  make(map[string]*Definition, 0),
+		evaluators:   make(map[string]*evaluator, 0),
+		alarms:       make(map[string]*Alarm, 0),
+		observations: make(chan *observation, observationSize),
+		stopCh:       stop,
+	}
+}
+
+func (m *Manager) Init(devices DeviceGetter) {
+	m.devices = devices
+	m.client = storage.NewClient(storage.StoreGroupAlarm)
+
+	now := time.Now()
+	for _, data := range m.load(storage.AlarmDefinitions) {
+		def := &Definition{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(def); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal alarm definition", "err", err)
+			continue
+		}
+		m.definitions[def.ID] = def
+		if def.Enabled {
+			m.evaluators[def.ID] = newEvaluator(def, now)
+		}
+	}
+
+	for _, data := range m.load(storage.Alarms) {
+		alarm := &Alarm{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(alarm); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal alarm", "err", err)
+			continue
+		}
+		m.alarms[alarm.ID] = alarm
+		if alarm.State == StateCleared {
+			continue
+		}
+		// restore the active conditions, the alarm is cleared if the condition no longer exists
+		var c *condition
+		if e, ok := m.evaluators[alarm.DefinitionId]; ok {
+			c = e.getCondition(alarm.Condition)
+		}
+		if c == nil {
+			m.clearAlarm(alarm, now, nil)
+			continue
+		}
+		c.active = true
+		c.matched = true
+		c.alarmId = alarm.ID
+	}
+
+	go m.run()
+}
+
+// Observe queues the values of device, the values are dropped if the queue is full.
+func (m *Manager) Observe(device runtime.Device, timestamp time.Time, values []runtime.PointData) {
+	select {
+	case m.observations <- &observation{deviceId: device.GetID(), timestamp: timestamp, values: values}:
+	default:
+		klog.V(3).InfoS("Dropped values of alarm evaluation because of full queue", "deviceId", device.GetID())
+	}
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case o := <-m.observations:
+			m.evaluate(o)
+		case now := <-ticker.C:
+			m.tick(now)
+		}
+	}
+}
+
+func (m *Manager) evaluate(o *observation) {
+	values := make(map[string]interface{}, len(o.values))
+	for _, pd := range o.values {
+		values[pd.DataPointId] = pd.Value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, e := range m.evaluators {
+		if e.def.DeviceId != o.deviceId {
+			continue
+		}
+		value, ok := values[e.def.Variable]
+		if !ok {
+			continue
+		}
+		m.apply(m.definitions[id], e.evaluate(o.timestamp, value), o.timestamp)
+	}
+}
+
+func (m *Manager) tick(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, e := range m.evaluators {
+		// the values of deleted device will never come
+		if _, err := m.devices.GetDeviceById(e.def.DeviceId, false); err != nil {
+			continue
+		}
+		m.apply(m.definitions[id], e.tick(now), now)
+	}
+}
+
+// apply raise or clear the alarms of transitions, must be called with lock held
+func (m *Manager) apply(def *Definition, transitions []*transition, now time.Time) {
+	for _, t := range transitions {
+		if t.active {
+			m.raiseAlarm(def, t.condition, t.value, now)
+		} else if alarm, ok := m.alarms[t.condition.alarmId]; ok {
+			m.clearAlarm(alarm, now, t.value)
+			t.condition.alarmId = ""
+		}
+	}
+}
+
+func (m *Manager) raiseAlarm(def *Definition, c *condition, value interface{}, now time.Time) {
+	alarm := &Alarm{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    def.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: now,
+		},
+		DefinitionId: def.ID,
+		DeviceId:     def.DeviceId,
+		Variable:     def.Variable,
+		Condition:    c.name,
+		Severity:     def.Severity,
+		State:        StateActive,
+		Value:        value,
+		Limit:        copyFloat(c.limit),
+		Message:      def.Message,
+		ActiveTime:   now,
+	}
+	if _, err := m.client.Create(alarmKey(alarm.ID), alarm); err != nil {
+		klog.V(2).InfoS("Failed to store alarm", "definitionId", def.ID, "err", err)
+	}
+	m.alarms[alarm.ID] = alarm
+	c.alarmId = alarm.ID
+	klog.V(3).InfoS("Raised alarm", "alarmId", alarm.ID, "deviceId", def.DeviceId, "variable", def.Variable, "condition", c.name)
+	m.publish(alarm)
+}
+
+func (m *Manager) clearAlarm(alarm *Alarm, now time.Time, value interface{}) {
+	alarm.State = StateCleared
+	alarm.ClearTime = &now
+	alarm.ModTime = now
+	if value != nil {
+		alarm.Value = value
+	}
+	m.store(alarm)
+	klog.V(3).InfoS("Cleared alarm", "alarmId", alarm.ID, "deviceId", alarm.DeviceId, "variable", alarm.Variable, "condition", alarm.Condition)
+	m.publish(alarm)
+	m.pruneCleared()
+}
+
+// pruneCleared keep the latest cleared alarms only
+func (m *Manager) pruneCleared() {
+	cleared := make([]*Alarm, 0)
+	for _, alarm := range m.alarms {
+		if alarm.State == StateCleared {
+			cleared = append(cleared, alarm)
+		}
+	}
+	if len(cleared) <= maxClearedAlarms {
+		return
+	}
+	sort.Slice(cleared, func(i, j int) bool { return cleared[i].ClearTime.Before(*cleared[j].ClearTime) })
+	for _, alarm := range cleared[:len(cleared)-maxClearedAlarms] {
+		delete(m.alarms, alarm.ID)
+		if _, err := m.client.Delete(alarmKey(alarm.ID), ""); err != nil {
+			klog.V(2).InfoS("Failed to delete alarm", "alarmId", alarm.ID, "err", err)
+		}
+	}
+}
+
+func (m *Manager) store(alarm *Alarm) {
+	if _, err := m.client.Update(alarmKey(alarm.ID), alarm.GetVersion(), alarm); err != nil {
+		klog.V(2).InfoS("Failed to update alarm", "alarmId", alarm.ID, "err", err)
+	}
+}
+
+func (m *Manager) publish(alarm *Alarm) {
+	marshal, err := json.Marshal(alarm)
+	if err != nil {
+		klog.V(2).InfoS("Failed to marshal alarm", "alarmId", alarm.ID, "err", err)
+		return
+	}
+	topic := fmt.Sprintf(alarmTopicFormat, m.gatewayMeta.ID, alarm.DeviceId)
+	token := m.mqttClient.Publish(topic, 1, false, marshal)
+	go func() {
+		if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+			metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeAlarm, metrics.ResultSuccess).Inc()
+			klog.V(5).InfoS("Succeed to publish alarm", "topic", topic, "alarmId", alarm.ID)
+		} else {
+			metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeAlarm, metrics.ResultFailure).Inc()
+			klog.V(1).InfoS("Failed to publish alarm", "topic", topic, "err", token.Error())
+		}
+	}()
+}
+
+func (m *Manager) CreateDefinition(object *v1.AlarmDefinition) (*Definition, error) {
+	def := &Definition{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applyDefinition(def, object)
+	if err := m.validateDefinition(def); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(definitionKey(def.ID), def); err != nil {
+		klog.V(2).InfoS("Failed to store alarm definition", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.definitions[def.ID] = def
+	if def.Enabled {
+		m.evaluators[def.ID] = newEvaluator(def, time.Now())
+	}
+	return def.DeepCopyObject().(*Definition), nil
+}
+
+func (m *Manager) UpdateDefinitionById(id string, version string, object *v1.AlarmDefinition) (*Definition, error) {
+	old, err := m.GetDefinitionById(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	def := old.DeepCopyObject().(*Definition)
+	def.ModTime = time.Now()
+	applyDefinition(def, object)
+	if err := m.validateDefinition(def); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Update(definitionKey(id), version, def); err != nil {
+		klog.V(2).InfoS("Failed to update alarm definition", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// the conditions may be changed, clear the alarms raised by old conditions
+	m.clearDefinition(id)
+	m.definitions[id] = def
+	if def.Enabled {
+		m.evaluators[id] = newEvaluator(def, time.Now())
+	}
+	return def.DeepCopyObject().(*Definition), nil
+}
+
+func (m *Manager) DeleteDefinition(id string, version string) (*Definition, error) {
+	def, err := m.GetDefinitionById(id)
+	if err != nil {
+		return nil, err
+	}
+	if def.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.client.Delete(definitionKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete alarm definition", "definitionId", id, "err", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clearDefinition(id)
+	delete(m.definitions, id)
+	klog.V(2).InfoS("Deleted alarm definition", "definitionId", id)
+	return def, nil
+}
+
+// clearDefinition clear the active alarms and stop evaluating, must be called with lock held
+func (m *Manager) clearDefinition(id string) {
+	e, ok := m.evaluators[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	for _, c := range e.conditions {
+		if alarm, ok := m.alarms[c.alarmId]; ok && alarm.State != StateCleared {
+			m.clearAlarm(alarm, now, nil)
+		}
+	}
+	delete(m.evaluators, id)
+}
+
+func (m *Manager) ListDefinitions() ([]*Definition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defs := make([]*Definition, 0, len(m.definitions))
+	for _, def := range m.definitions {
+		defs = append(defs, def.DeepCopyObject().(*Definition))
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].ModTime.After(defs[j].ModTime) })
+	return defs, nil
+}
+
+func (m *Manager) GetDefinitionById(id string) (*Definition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	def, ok := m.definitions[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return def.DeepCopyObject().(*Definition), nil
+}
+
+// ListAlarms the latest alarms first
+func (m *Manager) ListAlarms(filter *AlarmFilter) ([]*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alarms := make([]*Alarm, 0)
+	for _, alarm := range m.alarms {
+		if len(filter.State) > 0 && alarm.State != filter.State {
+			continue
+		}
+		if len(filter.DeviceId) > 0 && alarm.DeviceId != filter.DeviceId {
+			continue
+		}
+		alarms = append(alarms, alarm.DeepCopyObject().(*Alarm))
+	}
+	sort.Slice(alarms, func(i, j int) bool { return alarms[i].ActiveTime.After(alarms[j].ActiveTime) })
+	return alarms, nil
+}
+
+func (m *Manager) GetAlarmById(id string) (*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alarm, ok := m.alarms[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return alarm.DeepCopyObject().(*Alarm), nil
+}
+
+// AcknowledgeAlarm the active alarm switches to acknowledged, the cleared alarm keeps cleared
+func (m *Manager) AcknowledgeAlarm(id string, object *v1.AlarmAcknowledgement) (*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alarm, ok := m.alarms[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if alarm.Acknowledged {
+		return alarm.DeepCopyObject().(*Alarm), nil
+	}
+
+	now := time.Now()
+	alarm.Acknowledged = true
+	alarm.AckTime = &now
+	alarm.ModTime = now
+	alarm.Comment = object.Comment
+	if alarm.State == StateActive {
+		alarm.State = StateAcknowledged
+	}
+	m.store(alarm)
+	klog.V(3).InfoS("Acknowledged alarm", "alarmId", id)
+	m.publish(alarm)
+	return alarm.DeepCopyObject().(*Alarm), nil
+}
+
+func (m *Manager) validateDefinition(def *Definition) error {
+	device, err := m.devices.GetDeviceById(def.DeviceId, true)
+	if err != nil {
+		return response.ErrDeviceNotFound(def.DeviceId)
+	}
+	if !runtime.HasVariable(device, def.Variable) {
+		return response.ErrResourceNotFound(def.Variable)
+	}
+	switch def.AlarmType {
+	case AlarmTypeLimit:
+		if def.HighHigh == nil && def.High == nil && def.Low == nil && def.LowLow == nil {
+			return response.ErrAlarmOptionRequired("highHigh|high|low|lowLow")
+		}
+	case AlarmTypeRateOfChange:
+		if def.RateLimit <= 0 {
+			return response.ErrAlarmOptionRequired("rateLimit")
+		}
+	case AlarmTypeStale:
+		if def.StaleTimeout == 0 {
+			return response.ErrAlarmOptionRequired("staleTimeout")
+		}
+	}
+	return nil
+}
+
+func (m *Manager) load(resource string) [][]byte {
+	result := make([][]byte, 0)
+	objs, _ := m.client.List(resource)
+	files, ok := objs.([]*storage.FileInfo)
+	if !ok {
+		return result
+	}
+	for _, file := range files {
+		data, err := m.client.Get(filepath.Join(resource, filepath.Base(file.Path)))
+		if err != nil {
+			continue
+		}
+		result = append(result, data.([]byte))
+	}
+	return result
+}
+
+func applyDefinition(def *Definition, object *v1.AlarmDefinition) {
+	def.Name = object.Name
+	def.DeviceId = object.DeviceId
+	def.Variable = object.Variable
+	def.AlarmType = object.AlarmType
+	def.Severity = object.Severity
+	def.Enabled = object.Enabled
+	def.HighHigh = object.HighHigh
+	def.High = object.High
+	def.Low = object.Low
+	def.LowLow = object.LowLow
+	def.AlarmOn = object.AlarmOn
+	def.RateLimit = object.RateLimit
+	def.StaleTimeout = object.StaleTimeout
+	def.Deadband = object.Deadband
+	def.OnDelay = object.OnDelay
+	def.OffDelay = object.OffDelay
+	def.Message = object.Message
+	if len(def.Severity) == 0 {
+		def.Severity = SeverityMajor
+	}
+}
+
+func definitionKey(id string) string {
+	return filepath.Join(storage.AlarmDefinitions, id)
+}
+
+func alarmKey(id string) string {
+	return filepath.Join(storage.Alarms, id)
+}
@@ -0,0 +1,167 @@
+package alarm
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/alarm-definitions", createDefinition(mgr))
+	group.DELETE("/alarm-definitions/:id", deleteDefinition(mgr))
+	group.PUT("/alarm-definitions/:id", updateDefinitionById(mgr))
+	group.GET("/alarm-definitions", listDefinitions(mgr))
+	group.GET("/alarm-definitions/:id", getDefinitionById(mgr))
+	group.GET("/alarms", listAlarms(mgr))
+	group.GET("/alarms/:id", getAlarmById(mgr))
+	group.POST("/alarms/:id/acknowledge", acknowledgeAlarm(mgr))
+}
+
+func createDefinition(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.AlarmDefinition{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse alarm definition", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		def, err := mgr.CreateDefinition(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, def.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, def.GetID()))
+		c.JSON(http.StatusCreated, def)
+	}
+}
+
+func deleteDefinition(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		def, err := mgr.DeleteDefinition(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, def)
+	}
+}
+
+func updateDefinitionById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.AlarmDefinition{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse alarm definition", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateDefinitionById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listDefinitions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defs, _ := mgr.ListDefinitions()
+		c.JSON(http.StatusOK, &ResponseModel{Definitions: defs})
+	}
+}
+
+func getDefinitionById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		def, err := mgr.GetDefinitionById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, def.GetVersion())
+		c.JSON(http.StatusOK, def)
+	}
+}
+
+func listAlarms(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alarms, _ := mgr.ListAlarms(&AlarmFilter{
+			State:    c.Query("state"),
+			DeviceId: c.Query("deviceId"),
+		})
+		c.JSON(http.StatusOK, &ResponseModel{Alarms: alarms})
+	}
+}
+
+func getAlarmById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		alarm, err := mgr.GetAlarmById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, alarm)
+	}
+}
+
+func acknowledgeAlarm(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.AlarmAcknowledgement{}
+		// the comment is optional
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(object); err != nil {
+				klog.V(3).InfoS("Failed to parse alarm acknowledgement", "err", err)
+				c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+				return
+			}
+		}
+
+		alarm, err := mgr.AcknowledgeAlarm(c.Param("id"), object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, alarm)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,57 @@
+package alarm
+
+import (
+	"harnsgateway/pkg/runtime"
+	"time"
+)
+
+// Definition the alarm conditions of one variable
+type Definition struct {
+	runtime.ObjectMeta
+	DeviceId     string   `json:"deviceId"`               // 设备id
+	Variable     string   `json:"variable"`               // 变量名称
+	AlarmType    string   `json:"alarmType"`              // limit、boolean、rateOfChange、stale
+	Severity     string   `json:"severity"`               // critical、major、minor、warning
+	Enabled      bool     `json:"enabled"`                // 是否启用
+	HighHigh     *float64 `json:"highHigh,omitempty"`     // 高高限
+	High         *float64 `json:"high,omitempty"`         // 高限
+	Low          *float64 `json:"low,omitempty"`          // 低限
+	LowLow       *float64 `json:"lowLow,omitempty"`       // 低低限
+	AlarmOn      *bool    `json:"alarmOn,omitempty"`      // 布尔报警 值等于alarmOn时报警
+	RateLimit    float64  `json:"rateLimit,omitempty"`    // 变化率上限(每秒)
+	StaleTimeout uint     `json:"staleTimeout,omitempty"` // 值未变化的超时时间(秒)
+	Deadband     float64  `json:"deadband,omitempty"`     // 死区
+	OnDelay      uint     `json:"onDelay,omitempty"`      // 报警延时(秒)
+	OffDelay     uint     `json:"offDelay,omitempty"`     // 恢复延时(秒)
+	Message      string   `json:"message,omitempty"`      // 报警信息
+}
+
+// Alarm raised by one condition of definition, the name is the name of definition
+type Alarm struct {
+	runtime.ObjectMeta
+	DefinitionId string      `json:"definitionId"`
+	DeviceId     string      `json:"deviceId"`
+	Variable     string      `json:"variable"`
+	Condition    string      `json:"condition"` // highHigh、high、low、lowLow、boolean、rateOfChange、stale
+	Severity     string      `json:"severity"`
+	State        string      `json:"state"`        // active、acknowledged、cleared
+	Acknowledged bool        `json:"acknowledged"` // 恢复前未确认的报警恢复后仍可确认
+	Value        interface{} `json:"value,omitempty"`
+	Limit        *float64    `json:"limit,omitempty"`
+	Message      string      `json:"message,omitempty"`
+	Comment      string      `json:"comment,omitempty"` // 确认备注
+	ActiveTime   time.Time   `json:"activeTime"`
+	AckTime      *time.Time  `json:"ackTime,omitempty"`
+	ClearTime    *time.Time  `json:"clearTime,omitempty"`
+}
+
+type ResponseModel struct {
+	Definitions interface{} `json:"definitions,omitempty"`
+	Alarms      interface{} `json:"alarms,omitempty"`
+}
+
+// AlarmFilter filter alarms by state and device, empty means all
+type AlarmFilter struct {
+	State    string
+	DeviceId string
+}
@@ -25,6 +25,7 @@ const (
 	DESC          = "desc"
 	ASC           = "asc"
 	Limit         = "limit"
+	Continue      = "continue"
 	Latest        = "latest"
 	Interval      = "interval"
 	OrphanRemoval = "orphanRemoval"
@@ -20,6 +20,30 @@ const (
 	ErrCodeDeviceNotConnect                   // 10012
 	ErrCodeDeviceOperatorUnSupported          // 10013
 	ErrCodeTooManyJsonPatchOperations         // 10014
+	ErrCodeDeviceActionFailed                 // 10015
+	ErrCodeSinkTypeUnSupported                // 10016
+	ErrCodeSinkOptionRequired                 // 10017
+	ErrCodeExpressionInvalid                  // 10018
+	ErrCodeVariableCircularReference          // 10019
+	ErrCodeTransformInvalid                   // 10020
+	ErrCodeAlarmOptionRequired                // 10021
+	ErrCodeRuleConditionInvalid               // 10022
+	ErrCodeScriptInvalid                      // 10023
+	ErrCodeAggregationInvalid                 // 10024
+	ErrCodeReadbackMismatch                   // 10025
+	ErrCodeScheduleInvalid                    // 10026
+	ErrCodeActionTimeout                      // 10027
+	ErrCodeConstraintInvalid                  // 10028
+	ErrCodeActionValueInvalid                 // 10029
+	ErrCodeTemplateInvalid                    // 10030
+	ErrCodeImportRowInvalid                   // 10031
+	ErrCodeBackupInvalid                      // 10032
+	ErrCodeRevisionInvalid                    // 10033
+	ErrCodeLabelInvalid                       // 10034
+	ErrCodeGroupInvalid                       // 10035
+	ErrCodeQueryInvalid                       // 10036
+	ErrCodeVariableDisabled                   // 10037
+	ErrCodeVariableInvalid                    // 10038
 )
 
 // !!! IMPORTANT PLEASE READ FIRST !!!
@@ -11,6 +11,30 @@ var errors = map[ErrCode]string{
 	ErrCodeDeviceNotConnect:           "Device [%s] not connect.",
 	ErrCodeDeviceOperatorUnSupported:  "Device operator [%s] not supported.",
 	ErrCodeTooManyJsonPatchOperations: "Json Patch operations exceeds %d.",
+	ErrCodeDeviceActionFailed:         "Device action failed: %s.",
+	ErrCodeSinkTypeUnSupported:        "Sink type [%s] unsupported.",
+	ErrCodeSinkOptionRequired:         "Sink option [%s] required.",
+	ErrCodeExpressionInvalid:          "Expression of variable [%s] invalid: %s.",
+	ErrCodeVariableCircularReference:  "Variable [%s] has circular reference.",
+	ErrCodeTransformInvalid:           "Transform of variable [%s] invalid: %s.",
+	ErrCodeAlarmOptionRequired:        "Alarm option [%s] required.",
+	ErrCodeRuleConditionInvalid:       "Condition of rule [%s] invalid: %s.",
+	ErrCodeScriptInvalid:              "Script [%s] invalid: %s.",
+	ErrCodeAggregationInvalid:         "Aggregation of device [%s] invalid: %s.",
+	ErrCodeReadbackMismatch:           "Readback of variable [%s] mismatched, expected %v but got %v.",
+	ErrCodeScheduleInvalid:            "Schedule [%s] invalid: %s.",
+	ErrCodeActionTimeout:              "Action of variable [%s] timeout after %s.",
+	ErrCodeConstraintInvalid:          "Constraint of variable [%s] invalid: %s.",
+	ErrCodeActionValueInvalid:         "Value [%v] of variable [%s] invalid: %s.",
+	ErrCodeTemplateInvalid:            "Template [%s] invalid: %s.",
+	ErrCodeImportRowInvalid:           "Row [%d] invalid: %s.",
+	ErrCodeBackupInvalid:              "Backup archive invalid: %s.",
+	ErrCodeRevisionInvalid:            "Revision [%d] invalid: %s.",
+	ErrCodeLabelInvalid:               "Labels of device [%s] invalid: %s.",
+	ErrCodeGroupInvalid:               "Group [%s] invalid: %s.",
+	ErrCodeQueryInvalid:               "Query [%s] invalid: %s.",
+	ErrCodeVariableDisabled:           "Variable [%s] disabled.",
+	ErrCodeVariableInvalid:            "Variable [%s] invalid: %s.",
 }
 
 // !!! IMPORTANT PLEASE READ FIRST !!!
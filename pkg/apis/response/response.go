@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type responseError struct {
@@ -144,6 +145,10 @@ func ErrResourceExists(resource string) *responseError {
 func ErrResourceNotFound(resource string) *responseError {
 	return generateError(ErrCodeResourceNotFound, resource)
 }
+func ErrVariableNotWritable(variable string) *responseError {
+	return generateError(ErrCodeVariableNotWritable, variable)
+}
+
 func ErrDeviceNotFound(resource string) *responseError {
 	return generateError(ErrCodeDeviceNotFound, resource)
 }
@@ -158,6 +163,102 @@ func ErrTooManyJsonPatchOperations(max int) *responseError {
 	return generateError(ErrCodeTooManyJsonPatchOperations, max)
 }
 
+func ErrDeviceActionFailed(err error) *responseError {
+	return generateErrorWrapper(ErrCodeDeviceActionFailed, err, err.Error())
+}
+
+func ErrSinkTypeUnSupported(sinkType string) *responseError {
+	return generateError(ErrCodeSinkTypeUnSupported, sinkType)
+}
+
+func ErrSinkOptionRequired(option string) *responseError {
+	return generateError(ErrCodeSinkOptionRequired, option)
+}
+
+func ErrExpressionInvalid(variable string, reason string) *responseError {
+	return generateError(ErrCodeExpressionInvalid, variable, reason)
+}
+
+func ErrVariableCircularReference(variable string) *responseError {
+	return generateError(ErrCodeVariableCircularReference, variable)
+}
+
+func ErrTransformInvalid(variable string, reason string) *responseError {
+	return generateError(ErrCodeTransformInvalid, variable, reason)
+}
+
+func ErrAlarmOptionRequired(option string) *responseError {
+	return generateError(ErrCodeAlarmOptionRequired, option)
+}
+
+func ErrRuleConditionInvalid(rule string, reason string) *responseError {
+	return generateError(ErrCodeRuleConditionInvalid, rule, reason)
+}
+
+func ErrScriptInvalid(script string, reason string) *responseError {
+	return generateError(ErrCodeScriptInvalid, script, reason)
+}
+
+func ErrAggregationInvalid(device string, reason string) *responseError {
+	return generateError(ErrCodeAggregationInvalid, device, reason)
+}
+
+func ErrReadbackMismatch(variable string, expected interface{}, actual interface{}) *responseError {
+	return generateError(ErrCodeReadbackMismatch, variable, expected, actual)
+}
+
+func ErrScheduleInvalid(schedule string, reason string) *responseError {
+	return generateError(ErrCodeScheduleInvalid, schedule, reason)
+}
+
+func ErrActionTimeout(variable string, timeout time.Duration) *responseError {
+	return generateError(ErrCodeActionTimeout, variable, timeout)
+}
+
+func ErrConstraintInvalid(variable string, reason string) *responseError {
+	return generateError(ErrCodeConstraintInvalid, variable, reason)
+}
+
+func ErrActionValueInvalid(variable string, value interface{}, reason string) *responseError {
+	return generateError(ErrCodeActionValueInvalid, value, variable, reason)
+}
+
+func ErrTemplateInvalid(template string, reason string) *responseError {
+	return generateError(ErrCodeTemplateInvalid, template, reason)
+}
+
+func ErrImportRowInvalid(row int, reason string) *responseError {
+	return generateError(ErrCodeImportRowInvalid, row, reason)
+}
+
+func ErrBackupInvalid(reason string) *responseError {
+	return generateError(ErrCodeBackupInvalid, reason)
+}
+
+func ErrRevisionInvalid(revision int, reason string) *responseError {
+	return generateError(ErrCodeRevisionInvalid, revision, reason)
+}
+
+func ErrLabelInvalid(device string, reason string) *responseError {
+	return generateError(ErrCodeLabelInvalid, device, reason)
+}
+
+func ErrGroupInvalid(group string, reason string) *responseError {
+	return generateError(ErrCodeGroupInvalid, group, reason)
+}
+
+func ErrQueryInvalid(query string, reason string) *responseError {
+	return generateError(ErrCodeQueryInvalid, query, reason)
+}
+
+func ErrVariableDisabled(variable string) *responseError {
+	return generateError(ErrCodeVariableDisabled, variable)
+}
+
+func ErrVariableInvalid(variable string, reason string) *responseError {
+	return generateError(ErrCodeVariableInvalid, variable, reason)
+}
+
 func ErrBooleanInvalid(infos ...string) *responseError {
 	if len(infos) == 1 {
 		infos = append(infos, "")
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/gateway"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/version"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewManifest the manifest of configurations under root, the gateway is described by its persisted meta
+func NewManifest(root string) *Manifest {
+	manifest := &Manifest{
+		Version:        ArchiveVersion,
+		GatewayVersion: version.Get().GitVersion,
+		CreatedAt:      time.Now().UTC(),
+	}
+	data, err := os.ReadFile(filepath.Join(root, storage.StoreGroupToString[storage.StoreGroupGateway], gateway.MetaKey))
+	if err == nil {
+		meta := &gateway.GatewayMeta{}
+		if err := json.Unmarshal(data, meta); err == nil {
+			manifest.GatewayId = meta.ID
+			manifest.GatewayName = meta.Name
+		}
+	}
+	return manifest
+}
+
+// Backup archive the configurations of the selected storage backend under root
+func Backup(w io.Writer, root string) (*Manifest, error) {
+	dir, release, err := snapshot(root)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	manifest := NewManifest(dir)
+	return manifest, Write(w, dir, manifest)
+}
+
+// Write archive the configurations under root as tar.gz with the manifest, the configurations not existing are skipped
+func Write(w io.Writer, root string, manifest *Manifest) error {
+	files, err := listFiles(root)
+	if err != nil {
+		return err
+	}
+	manifest.Files = len(files)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeEntry(tw, manifestName, data, manifest.CreatedAt); err != nil {
+		return err
+	}
+	for _, name := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := writeEntry(tw, path.Join(storeDir, name), data, info.ModTime()); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0640,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// listFiles the slash separated paths of configuration files relative to root
+func listFiles(root string) ([]string, error) {
+	files := make([]string, 0)
+	for _, c := range configurations {
+		entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(c)))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, path.Join(c, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Extract extract the configurations of archive into dir, the archive is validated before returning the manifest
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, response.ErrBackupInvalid("not gzip compressed")
+	}
+	defer gr.Close()
+
+	var manifest *Manifest
+	var total int64
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, response.ErrBackupInvalid(err.Error())
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, response.ErrBackupInvalid(fmt.Sprintf("unsupported entry %s", hdr.Name))
+		}
+		if total += hdr.Size; total > maxArchiveSize {
+			return nil, response.ErrBackupInvalid("too large")
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, response.ErrBackupInvalid(err.Error())
+		}
+
+		if hdr.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, response.ErrBackupInvalid("malformed manifest")
+			}
+			continue
+		}
+		name, ok := storeFile(hdr.Name)
+		if !ok {
+			return nil, response.ErrBackupInvalid(fmt.Sprintf("unknown entry %s", hdr.Name))
+		}
+		if !json.Valid(data) {
+			return nil, response.ErrBackupInvalid(fmt.Sprintf("malformed file %s", hdr.Name))
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0711); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, data, 0640); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case manifest == nil:
+		return nil, response.ErrBackupInvalid("manifest is required")
+	case manifest.Version < 1 || manifest.Version > ArchiveVersion:
+		return nil, response.ErrBackupInvalid(fmt.Sprintf("unsupported version %d", manifest.Version))
+	}
+	if err := validateDevices(dir); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// storeFile the path of configuration file relative to store path, the entries out of configurations are refused
+func storeFile(name string) (string, bool) {
+	if path.Clean(name) != name || !strings.HasPrefix(name, storeDir+"/") {
+		return "", false
+	}
+	rel := strings.TrimPrefix(name, storeDir+"/")
+	if strings.HasPrefix(path.Base(rel), ".") {
+		return "", false
+	}
+	for _, c := range configurations {
+		if path.Dir(rel) == c {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// validateDevices the devices should be decoded by the device type of file name like loading them from store
+func validateDevices(dir string) error {
+	entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(deviceConfiguration)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		index := strings.LastIndex(entry.Name(), ".")
+		if index <= 0 {
+			return response.ErrBackupInvalid(fmt.Sprintf("malformed device file %s", entry.Name()))
+		}
+		object, ok := generic.DeviceTypeObjectMap[entry.Name()[:index]]
+		if !ok {
+			return response.ErrBackupInvalid(fmt.Sprintf("unsupported device type of %s", entry.Name()))
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(deviceConfiguration), entry.Name()))
+		if err != nil {
+			return err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if err := decoder.Decode(reflect.New(reflect.TypeOf(object).Elem()).Interface()); err != nil {
+			return response.ErrBackupInvalid(fmt.Sprintf("device %s %v", entry.Name(), err))
+		}
+	}
+	return nil
+}
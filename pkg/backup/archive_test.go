@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0711); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteRestore(t *testing.T) {
+	source, target := t.TempDir(), t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"gateway/meta":                `{"id":"gw-1","name":"line 1"}`,
+		"device/devices/modbus.d1":    `{"id":"d1","deviceType":"modbus"}`,
+		"northbound/sinks/s1":         `{"id":"s1"}`,
+		"alarm/alarms/a1":             `{"id":"a1"}`,
+		"schedule/executions/e1":      `{"id":"e1"}`,
+		"template/templates/template": `{"id":"t1"}`,
+	})
+	writeFiles(t, target, map[string]string{
+		"device/devices/modbus.d2": `{"id":"d2","deviceType":"modbus"}`,
+		"rule/rules/r1":            `{"id":"r1"}`,
+		"alarm/alarms/a2":          `{"id":"a2"}`,
+		"gateway/revisions/v1":     `{"id":"v1"}`,
+	})
+
+	buf := &bytes.Buffer{}
+	manifest := NewManifest(source)
+	if err := Write(buf, source, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.GatewayId != "gw-1" || manifest.Files != 4 {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+
+	restored, err := Restore(bytes.NewReader(buf.Bytes()), target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.GatewayId != "gw-1" || restored.Version != ArchiveVersion {
+		t.Errorf("unexpected manifest %+v", restored)
+	}
+	for name, exist := range map[string]bool{
+		"gateway/meta":                true,
+		"device/devices/modbus.d1":    true,
+		"northbound/sinks/s1":         true,
+		"template/templates/template": true,
+		"device/devices/modbus.d2":    false,
+		"rule/rules/r1":               false,
+		"alarm/alarms/a1":             false,
+		"alarm/alarms/a2":             true,
+	} {
+		if _, err := os.Stat(filepath.Join(target, filepath.FromSlash(name))); (err == nil) != exist {
+			t.Errorf("file %s exists %v, want %v", name, err == nil, exist)
+		}
+	}
+	entries, _ := os.ReadDir(target)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), stagePrefix) {
+			t.Errorf("staging directory %s is left", entry.Name())
+		}
+	}
+}
+
+func TestExtractInvalid(t *testing.T) {
+	archive := func(entries map[string]string) *bytes.Buffer {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		for name, content := range entries {
+			_ = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0640, Size: int64(len(content))})
+			_, _ = tw.Write([]byte(content))
+		}
+		_ = tw.Close()
+		_ = gw.Close()
+		return buf
+	}
+	manifest := `{"version":1}`
+	for reason, entries := range map[string]map[string]string{
+		"manifest is required":    {"store/rule/rules/r1": `{}`},
+		"unsupported version 2":   {manifestName: `{"version":2}`},
+		"unknown entry":           {manifestName: manifest, "store/../../etc/passwd": `{}`},
+		"malformed file":          {manifestName: manifest, "store/rule/rules/r1": `{`},
+		"unsupported device type": {manifestName: manifest, "store/device/devices/bacnet.d1": `{}`},
+	} {
+		if _, err := Extract(archive(entries), t.TempDir()); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("Extract() = %v, want %s", err, reason)
+		}
+	}
+}
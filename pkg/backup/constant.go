@@ -0,0 +1,36 @@
+package backup
+
+import (
+	"harnsgateway/pkg/storage"
+	"path"
+)
+
+const (
+	// ArchiveVersion the format version of archive, the archives of newer version are refused
+	ArchiveVersion = 1
+
+	manifestName = "manifest.json"
+	storeDir     = "store"
+	// maxArchiveSize the max size of archive and of the files extracted from it
+	maxArchiveSize     = 64 << 20
+	archiveContentType = "application/gzip"
+	// stagePrefix the staged and replaced configurations are kept under store path to be renamed in one filesystem
+	stagePrefix = ".restore-"
+)
+
+// configurations the directories of persisted configurations relative to store path, the records such as actions,
+// alarms and executions are not backed up
+var configurations = []string{
+	path.Join(storage.StoreGroupToString[storage.StoreGroupDevice], storage.Devices),
+	storage.StoreGroupToString[storage.StoreGroupGateway],
+	path.Join(storage.StoreGroupToString[storage.StoreGroupNorthbound], storage.Sinks),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupAlarm], storage.AlarmDefinitions),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupRule], storage.Rules),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupScript], storage.Scripts),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupSchedule], storage.Recipes),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupSchedule], storage.Schedules),
+	path.Join(storage.StoreGroupToString[storage.StoreGroupTemplate], storage.Templates),
+}
+
+// deviceConfiguration the devices are reloaded after restoring, the others take effect after restart
+var deviceConfiguration = configurations[0]
@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"harnsgateway/pkg/runtime"
+	"io"
+	"k8s.io/klog/v2"
+	"os"
+	"sync"
+)
+
+// DeviceController the devices are reloaded after restoring
+type DeviceController interface {
+	Reload(replace func() error) error
+	ListDevices(filter *runtime.DeviceFilter, exploded bool) ([]runtime.Device, error)
+}
+
+type Manager struct {
+	mu      *sync.Mutex
+	root    string
+	devices DeviceController
+}
+
+// NewManager back up and restore the configurations under root, which is the store path of gateway
+func NewManager(root string) *Manager {
+	return &Manager{
+		mu:   &sync.Mutex{},
+		root: root,
+	}
+}
+
+func (m *Manager) Init(devices DeviceController) {
+	m.devices = devices
+}
+
+// Backup write the archive of all configurations
+func (m *Manager) Backup(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, err := Backup(w, m.root)
+	return err
+}
+
+// Restore validate the archive before stopping collection, then replace the configurations and reload the devices.
+// The other configurations changed by the archive take effect after restart.
+func (m *Manager) Restore(r io.Reader) (*RestoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	staged, manifest, err := stage(r, m.root)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staged)
+
+	current, release, err := snapshot(m.root)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	restartRequired := make([]string, 0)
+	for _, c := range changed(current, staged) {
+		if c != deviceConfiguration {
+			restartRequired = append(restartRequired, c)
+		}
+	}
+	if err := m.devices.Reload(func() error {
+		return swap(m.root, staged)
+	}); err != nil {
+		klog.V(1).InfoS("Failed to restore configurations", "err", err)
+		return nil, err
+	}
+
+	devices, _ := m.devices.ListDevices(&runtime.DeviceFilter{}, false)
+	klog.V(1).InfoS("Restored configurations", "gatewayId", manifest.GatewayId, "createdAt", manifest.CreatedAt, "devices", len(devices))
+	return &RestoreResult{
+		Manifest:        manifest,
+		Devices:         len(devices),
+		RestartRequired: restartRequired,
+	}, nil
+}
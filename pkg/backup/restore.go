@@ -0,0 +1,178 @@
+package backup
+
+import (
+	"bytes"
+	"harnsgateway/pkg/storage"
+	"io"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+)
+
+// Restore validate the archive and replace the configurations under root with it, the gateway should not be running
+func Restore(r io.Reader, root string) (*Manifest, error) {
+	staged, manifest, err := stage(r, root)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staged)
+	if err := swap(root, staged); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// snapshot the directory of configurations to compare and archive, the objects of bolt database are exported into
+// a staging directory under root which is removed by release
+func snapshot(root string) (dir string, release func(), err error) {
+	if storage.Backend() != storage.BackendBolt {
+		return root, func() {}, nil
+	}
+	if err := os.MkdirAll(root, 0711); err != nil {
+		return "", nil, err
+	}
+	if dir, err = os.MkdirTemp(root, stagePrefix); err != nil {
+		return "", nil, err
+	}
+	if err = storage.Export(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return dir, func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// swap replace the configurations of the selected storage backend with the staged ones, the watchers have to list
+// again as the changes are not published
+func swap(root, staged string) (err error) {
+	if storage.Backend() == storage.BackendBolt {
+		err = storage.Replace(staged, configurations)
+	} else {
+		err = replace(root, staged)
+	}
+	if err == nil {
+		storage.ResetWatches()
+	}
+	return err
+}
+
+// stage extract the archive into a staging directory under root
+func stage(r io.Reader, root string) (string, *Manifest, error) {
+	if err := os.MkdirAll(root, 0711); err != nil {
+		return "", nil, err
+	}
+	staged, err := os.MkdirTemp(root, stagePrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := Extract(r, staged)
+	if err != nil {
+		_ = os.RemoveAll(staged)
+		return "", nil, err
+	}
+	return staged, manifest, nil
+}
+
+// replace swap the configurations under root with the staged ones by renaming, the configurations absent from
+// archive are emptied. The replaced configurations are moved back if any renaming fails.
+func replace(root, staged string) error {
+	replaced, err := os.MkdirTemp(root, stagePrefix)
+	if err != nil {
+		return err
+	}
+
+	type move struct {
+		from, to string
+	}
+	moves := make([]move, 0, 2*len(configurations))
+	rename := func(from, to string) error {
+		if err := os.MkdirAll(filepath.Dir(to), 0711); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		moves = append(moves, move{from: from, to: to})
+		return nil
+	}
+	rollback := func() {
+		for i := len(moves) - 1; i >= 0; i-- {
+			if err := os.Rename(moves[i].to, moves[i].from); err != nil {
+				klog.V(1).InfoS("Failed to roll back configuration", "path", moves[i].from, "err", err)
+			}
+		}
+	}
+
+	for _, c := range configurations {
+		current := filepath.Join(root, filepath.FromSlash(c))
+		next := filepath.Join(staged, filepath.FromSlash(c))
+		if err := os.MkdirAll(next, 0711); err != nil {
+			rollback()
+			return err
+		}
+		if entries, err := os.ReadDir(current); err == nil {
+			// the nested resources are not configurations, e.g. the revisions of gateway, they are kept
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					continue
+				}
+				if err := rename(filepath.Join(current, entry.Name()), filepath.Join(next, entry.Name())); err != nil {
+					rollback()
+					return err
+				}
+			}
+			if err := rename(current, filepath.Join(replaced, filepath.FromSlash(c))); err != nil {
+				rollback()
+				return err
+			}
+		} else if !os.IsNotExist(err) {
+			rollback()
+			return err
+		}
+		if err := rename(next, current); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if err := os.RemoveAll(replaced); err != nil {
+		klog.V(2).InfoS("Failed to remove replaced configurations", "path", replaced, "err", err)
+	}
+	return nil
+}
+
+// changed the configurations differ between root and staged
+func changed(root, staged string) []string {
+	result := make([]string, 0)
+	for _, c := range configurations {
+		if !dirEqual(filepath.Join(root, filepath.FromSlash(c)), filepath.Join(staged, filepath.FromSlash(c))) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func dirEqual(d1, d2 string) bool {
+	files1, files2 := readFiles(d1), readFiles(d2)
+	if len(files1) != len(files2) {
+		return false
+	}
+	for name, data := range files1 {
+		if other, ok := files2[name]; !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func readFiles(dir string) map[string][]byte {
+	files := make(map[string][]byte)
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, entry.Name())); err == nil {
+			files[entry.Name()] = data
+		}
+	}
+	return files
+}
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis/response"
+	"io"
+	"k8s.io/klog/v2"
+	"net/http"
+	"time"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.GET("/backup", backup(mgr))
+	group.POST("/restore", restore(mgr))
+}
+
+func backup(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		buf := &bytes.Buffer{}
+		if err := mgr.Backup(buf); err != nil {
+			klog.V(2).InfoS("Failed to back up configurations", "err", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="harnsgateway-%s.tar.gz"`, time.Now().UTC().Format("20060102150405")))
+		c.Data(http.StatusOK, archiveContentType, buf.Bytes())
+	}
+}
+
+func restore(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		var body io.Reader = c.Request.Body
+		if c.ContentType() == "multipart/form-data" {
+			file, err := c.FormFile("file")
+			if err != nil {
+				klog.V(3).InfoS("Failed to get backup archive", "err", err)
+				c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+				return
+			}
+			f, err := file.Open()
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+		data, err := io.ReadAll(io.LimitReader(body, maxArchiveSize+1))
+		if err != nil || len(data) > maxArchiveSize {
+			klog.V(3).InfoS("Failed to read backup archive", "size", len(data), "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+
+		result, err := mgr.Restore(bytes.NewReader(data))
+		if err != nil {
+			if response.IsResponseError(err) {
+				c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,21 @@
+package backup
+
+import "time"
+
+// Manifest the description of archive, it is the first entry of archive
+type Manifest struct {
+	Version        int       `json:"version"`        // 归档格式版本
+	GatewayId      string    `json:"gatewayId"`      // 备份网关的ID
+	GatewayName    string    `json:"gatewayName"`    // 备份网关的名称
+	GatewayVersion string    `json:"gatewayVersion"` // 备份网关的程序版本
+	CreatedAt      time.Time `json:"createdAt"`
+	Files          int       `json:"files"` // 配置文件数量
+}
+
+// RestoreResult the result of restoring archive
+type RestoreResult struct {
+	Manifest *Manifest `json:"manifest"`
+	Devices  int       `json:"devices"` // 恢复后的设备数量
+	// the changed configurations which take effect after restart, e.g. northbound/sinks
+	RestartRequired []string `json:"restartRequired,omitempty"`
+}
@@ -0,0 +1,228 @@
+package device
+
+import (
+	"encoding/json"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/uuidutil"
+	"k8s.io/klog/v2"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type ActionOption func(*actionOptions)
+
+// WithRequester record who or what requested the action in audit trail
+func WithRequester(source string, requester string) ActionOption {
+	return func(o *actionOptions) {
+		o.source = source
+		o.requester = requester
+	}
+}
+
+// WithReadback re-read the variables after written and compare the values within tolerance
+func WithReadback(tolerance float64) ActionOption {
+	return func(o *actionOptions) {
+		o.readback = true
+		o.tolerance = tolerance
+	}
+}
+
+// WithActionTimeout bound the time of writing, and the time of reading back after written, zero means the default
+// timeout
+func WithActionTimeout(timeout time.Duration) ActionOption {
+	return func(o *actionOptions) {
+		if timeout > maxActionTimeout {
+			timeout = maxActionTimeout
+		}
+		if timeout > 0 {
+			o.timeout = timeout
+		}
+	}
+}
+
+type actionOptions struct {
+	source    string
+	requester string
+	readback  bool
+	tolerance float64
+	timeout   time.Duration
+}
+
+// ActionRecord the audit record of writing values to device
+type ActionRecord struct {
+	ID        string          `json:"id"`
+	DeviceId  string          `json:"deviceId"`
+	Source    string          `json:"source,omitempty"`    // 请求来源 api、mqtt、rule、schedule
+	Requester string          `json:"requester,omitempty"` // 请求者 客户端地址、请求ID、规则ID等
+	Readback  bool            `json:"readback,omitempty"`  // 是否回读校验
+	Timestamp time.Time       `json:"timestamp"`
+	Duration  string          `json:"duration"`
+	Result    string          `json:"result"`          // success、failure
+	Error     string          `json:"error,omitempty"` // 设备级别的错误 如设备未连接
+	Results   []*ActionResult `json:"results"`
+	err       error
+}
+
+// ActionResult the result of writing one variable
+type ActionResult struct {
+	Name          string      `json:"name"`
+	OldValue      interface{} `json:"oldValue"`                // 写入前的值
+	NewValue      interface{} `json:"newValue"`                // 写入的值
+	ReadbackValue interface{} `json:"readbackValue,omitempty"` // 回读的值
+	Result        string      `json:"result"`                  // success、failure、timeout、mismatch
+	Error         string      `json:"error,omitempty"`
+	err           error
+}
+
+// Err the errors of failed actions, nil if all actions succeed
+func (r *ActionRecord) Err() error {
+	if r.err != nil {
+		return response.NewMultiError(r.err)
+	}
+	errs := &response.MultiError{}
+	for _, result := range r.Results {
+		if result.err != nil {
+			errs.Add(result.err)
+		}
+	}
+	if errs.Len() > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (r *ActionRecord) fail(err error, result string) {
+	r.err = err
+	r.Error = err.Error()
+	for _, ar := range r.Results {
+		ar.Result = result
+	}
+}
+
+func (r *ActionRecord) finish() {
+	r.Duration = time.Since(r.Timestamp).String()
+	r.Result = ActionResultSuccess
+	if r.err != nil {
+		r.Result = ActionResultFailure
+		return
+	}
+	for _, ar := range r.Results {
+		if ar.Result != ActionResultSuccess {
+			r.Result = ActionResultFailure
+			return
+		}
+	}
+}
+
+// ActionFilter filter action records by source and result, empty means all
+type ActionFilter struct {
+	Source string
+	Result string
+	Limit  int
+}
+
+func (f *ActionFilter) match(r *ActionRecord) bool {
+	return (len(f.Source) == 0 || f.Source == r.Source) && (len(f.Result) == 0 || f.Result == r.Result)
+}
+
+// ListActionRecords the audit trail of writing values to device, the latest first
+func (m *Manager) ListActionRecords(id string, filter *ActionFilter) ([]*ActionRecord, error) {
+	if _, err := m.GetDeviceById(id, false); err != nil {
+		return nil, err
+	}
+	m.actionMu.Lock()
+	defer m.actionMu.Unlock()
+	records := m.actionRecords[id]
+	result := make([]*ActionRecord, 0)
+	for i := len(records) - 1; i >= 0; i-- {
+		if filter != nil && !filter.match(records[i]) {
+			continue
+		}
+		result = append(result, records[i])
+		if filter != nil && filter.Limit > 0 && len(result) >= filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// loadActionRecords load the persisted audit trail, must be called before collecting
+func (m *Manager) loadActionRecords() {
+	m.actionClient = storage.NewClient(storage.StoreGroupDevice)
+
+	objs, _ := m.actionClient.List(storage.Actions)
+	files, ok := objs.([]*storage.FileInfo)
+	if !ok {
+		return
+	}
+	m.actionMu.Lock()
+	defer m.actionMu.Unlock()
+	for _, file := range files {
+		data, err := m.actionClient.Get(filepath.Join(storage.Actions, filepath.Base(file.Path)))
+		if err != nil {
+			continue
+		}
+		record := &ActionRecord{}
+		if err := json.Unmarshal(data.([]byte), record); err != nil {
+			klog.V(3).InfoS("Failed to unmarshal action record", "file", file.Path, "err", err)
+			continue
+		}
+		m.actionRecords[record.DeviceId] = append(m.actionRecords[record.DeviceId], record)
+	}
+	for id, records := range m.actionRecords {
+		sort.Slice(records, func(i, j int) bool {
+			return records[i].Timestamp.Before(records[j].Timestamp)
+		})
+		m.actionRecords[id] = m.pruneActionRecords(records)
+	}
+}
+
+// recordAction persist the audit record and keep the latest records of device only
+func (m *Manager) recordAction(record *ActionRecord) {
+	record.ID = uuidutil.UUID()
+	if m.actionClient != nil {
+		if _, err := m.actionClient.Create(actionKey(record.ID), record); err != nil {
+			klog.V(2).InfoS("Failed to store action record", "deviceId", record.DeviceId, "err", err)
+		}
+	}
+	m.actionMu.Lock()
+	defer m.actionMu.Unlock()
+	m.actionRecords[record.DeviceId] = m.pruneActionRecords(append(m.actionRecords[record.DeviceId], record))
+}
+
+// pruneActionRecords must be called with lock held
+func (m *Manager) pruneActionRecords(records []*ActionRecord) []*ActionRecord {
+	if len(records) <= maxActionRecords {
+		return records
+	}
+	expired := len(records) - maxActionRecords
+	for _, record := range records[:expired] {
+		m.deleteActionRecord(record)
+	}
+	return append([]*ActionRecord{}, records[expired:]...)
+}
+
+// deleteActionRecords delete the audit trail of deleted device
+func (m *Manager) deleteActionRecords(id string) {
+	m.actionMu.Lock()
+	defer m.actionMu.Unlock()
+	for _, record := range m.actionRecords[id] {
+		m.deleteActionRecord(record)
+	}
+	delete(m.actionRecords, id)
+}
+
+func (m *Manager) deleteActionRecord(record *ActionRecord) {
+	if m.actionClient == nil {
+		return
+	}
+	if _, err := m.actionClient.Delete(actionKey(record.ID), ""); err != nil {
+		klog.V(3).InfoS("Failed to delete action record", "recordId", record.ID, "err", err)
+	}
+}
+
+func actionKey(id string) string {
+	return filepath.Join(storage.Actions, id)
+}
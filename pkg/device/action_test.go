@@ -0,0 +1,65 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"testing"
+	"time"
+)
+
+func TestActionRecordFinish(t *testing.T) {
+	record := &ActionRecord{
+		Timestamp: time.Now(),
+		Results: []*ActionResult{
+			{Name: "a", Result: ActionResultSuccess},
+			{Name: "b", Result: ActionResultSuccess},
+		},
+	}
+	record.finish()
+	if record.Result != ActionResultSuccess || record.Err() != nil {
+		t.Fatalf("expected success, got %s %v", record.Result, record.Err())
+	}
+
+	mismatch := response.ErrReadbackMismatch("b", 1, 2)
+	record.Results[1].Result = ActionResultMismatch
+	record.Results[1].err = mismatch
+	record.finish()
+	if record.Result != ActionResultFailure {
+		t.Fatalf("expected failure, got %s", record.Result)
+	}
+	if errs, ok := record.Err().(*response.MultiError); !ok || errs.Len() != 1 {
+		t.Fatalf("expected one error, got %v", record.Err())
+	}
+
+	record.fail(response.ErrDeviceNotConnect("d"), ActionResultFailure)
+	record.finish()
+	if record.Result != ActionResultFailure || len(record.Error) == 0 {
+		t.Fatalf("expected device error, got %s %s", record.Result, record.Error)
+	}
+	for _, ar := range record.Results {
+		if ar.Result != ActionResultFailure {
+			t.Fatalf("expected %s failure, got %s", ar.Name, ar.Result)
+		}
+	}
+}
+
+func TestValueEqual(t *testing.T) {
+	cases := []struct {
+		expected  interface{}
+		actual    interface{}
+		tolerance float64
+		equal     bool
+	}{
+		{26.5, float32(26.5), 0, true},
+		{26.5, 26.58, 0.1, true},
+		{26.5, 26.7, 0.1, false},
+		{int64(1), uint16(1), 0, true},
+		{true, true, 0, true},
+		{"on", "off", 0, false},
+		{1, nil, 0, false},
+	}
+	for _, c := range cases {
+		if got := valueEqual(c.expected, c.actual, c.tolerance); got != c.equal {
+			t.Errorf("valueEqual(%v, %v, %v) = %v, want %v", c.expected, c.actual, c.tolerance, got, c.equal)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"time"
+)
+
+const aggregateInterval = 1 * time.Second
+
+// validateAggregations the aggregated variables should exist
+func validateAggregations(device runtime.Device) error {
+	aggregations := device.GetAggregations()
+	if len(aggregations) == 0 {
+		return nil
+	}
+	if err := runtime.ValidateAggregations(aggregations); err != nil {
+		return response.ErrAggregationInvalid(device.GetName(), err.Error())
+	}
+	device.IndexDevice()
+	for _, a := range aggregations {
+		for _, v := range a.Variables {
+			if !runtime.HasVariable(device, v) {
+				return response.ErrResourceNotFound(v)
+			}
+		}
+	}
+	return nil
+}
+
+// setAggregator replace the aggregator of device, the samples of old windows are dropped
+func (m *Manager) setAggregator(device runtime.Device) {
+	if len(device.GetAggregations()) == 0 {
+		m.aggregators.Delete(device.GetID())
+		return
+	}
+	m.aggregators.Store(device.GetID(), runtime.NewWindowAggregator(device.GetAggregations(), time.Now()))
+}
+
+// aggregate keeps the samples of aggregated variables, returns the values to be published as raw series
+func (m *Manager) aggregate(deviceId string, timestamp time.Time, pds []runtime.PointData) []runtime.PointData {
+	wa, ok := m.aggregators.Load(deviceId)
+	if !ok {
+		return pds
+	}
+	return wa.(*runtime.WindowAggregator).Add(timestamp, pds)
+}
+
+// flushAggregations publish the aggregated values when windows end, the windows are closed by time
+// so the gaps of unconnected devices never stretch windows.
+func (m *Manager) flushAggregations() {
+	ticker := time.NewTicker(aggregateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case now := <-ticker.C:
+			m.aggregators.Range(func(key, value any) bool {
+				tsd := value.(*runtime.WindowAggregator).Flush(now)
+				if len(tsd) == 0 {
+					return true
+				}
+				if d, ok := m.devices.Load(key); ok {
+					m.publish(d.(runtime.Device), &runtime.PublishData{Payload: runtime.Payload{Data: tsd}})
+				}
+				return true
+			})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/metrics"
+	"harnsgateway/pkg/runtime"
+	"k8s.io/klog/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// CommandAction deliver variable values to device
+	CommandAction = "action"
+)
+
+// Command the message received from command topic 'cmd/{gatewayId}/v1/{deviceId}'
+type Command struct {
+	RequestId string                   `json:"requestId"`
+	Operation string                   `json:"operation"` // action、start、stop、restart
+	Actions   []map[string]interface{} `json:"actions,omitempty"`
+	Readback  bool                     `json:"readback,omitempty"`  // 写入后回读校验
+	Tolerance float64                  `json:"tolerance,omitempty"` // 回读校验的数值容差
+	Timeout   uint                     `json:"timeout,omitempty"`   // 写入与回读的超时时间(秒)
+}
+
+// CommandReply the message published to reply topic 'reply/{gatewayId}/v1/{deviceId}'
+type CommandReply struct {
+	RequestId string  `json:"requestId"`
+	DeviceId  string  `json:"deviceId"`
+	Operation string  `json:"operation"`
+	Success   bool    `json:"success"`
+	Timestamp string  `json:"timestamp"`
+	Errors    []error `json:"errors,omitempty"`
+}
+
+// SubscribeCommand subscribe command topic of all devices in gateway,
+// It should be called again when MQTT client reconnected.
+func (m *Manager) SubscribeCommand() error {
+	topic := fmt.Sprintf(commandTopicFormat, m.gatewayMeta.ID, "+")
+	token := m.mqttClient.Subscribe(topic, 1, m.onCommand)
+	if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+		klog.V(2).InfoS("Succeed to subscribe command topic", "topic", topic)
+		return nil
+	}
+	klog.V(1).InfoS("Failed to subscribe command topic", "topic", topic, "err", token.Error())
+	if token.Error() == nil {
+		return errors.New("subscribe command topic timeout")
+	}
+	return token.Error()
+}
+
+func (m *Manager) onCommand(client mqtt.Client, message mqtt.Message) {
+	deviceId := message.Topic()[strings.LastIndex(message.Topic(), "/")+1:]
+	reply := &CommandReply{DeviceId: deviceId}
+
+	var command Command
+	if err := json.Unmarshal(message.Payload(), &command); err != nil {
+		klog.V(2).InfoS("Failed to parse command", "topic", message.Topic(), "err", err)
+		m.replyCommand(reply, response.ErrMalformedJSON)
+		return
+	}
+	reply.RequestId = command.RequestId
+	reply.Operation = command.Operation
+	klog.V(4).InfoS("Received command", "deviceId", deviceId, "requestId", command.RequestId, "operation", command.Operation)
+
+	switch command.Operation {
+	case CommandAction:
+		opts := []ActionOption{
+			WithRequester(ActionSourceMqtt, command.RequestId),
+			WithActionTimeout(time.Duration(command.Timeout) * time.Second),
+		}
+		if command.Readback {
+			opts = append(opts, WithReadback(command.Tolerance))
+		}
+		m.replyCommand(reply, m.DeliverAction(deviceId, command.Actions, opts...))
+	default:
+		if _, ok := runtime.StringToDeviceStatusCh[command.Operation]; !ok {
+			m.replyCommand(reply, response.ErrDeviceOperatorUnSupported(command.Operation))
+			return
+		}
+		err := m.SwitchDeviceStatus(deviceId, command.Operation)
+		if os.IsNotExist(err) {
+			err = response.ErrDeviceNotFound(deviceId)
+		}
+		m.replyCommand(reply, err)
+	}
+}
+
+func (m *Manager) replyCommand(reply *CommandReply, err error) {
+	reply.Success = err == nil
+	reply.Timestamp = time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+	if err != nil {
+		var me *response.MultiError
+		if errors.As(err, &me) {
+			for _, e := range me.Errors() {
+				reply.Errors = append(reply.Errors, toResponseError(e))
+			}
+		} else {
+			reply.Errors = append(reply.Errors, toResponseError(err))
+		}
+	}
+
+	topic := fmt.Sprintf(replyTopicFormat, m.gatewayMeta.ID, reply.DeviceId)
+	marshal, _ := json.Marshal(reply)
+	token := m.mqttClient.Publish(topic, 1, false, marshal)
+	if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+		metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeReply, metrics.ResultSuccess).Inc()
+		klog.V(5).InfoS("Succeed to reply command", "topic", topic, "requestId", reply.RequestId)
+	} else {
+		metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeReply, metrics.ResultFailure).Inc()
+		klog.V(1).InfoS("Failed to reply command", "topic", topic, "requestId", reply.RequestId, "err", token.Error())
+	}
+}
+
+func toResponseError(err error) error {
+	if response.IsResponseError(err) {
+		return err
+	}
+	return response.ErrDeviceActionFailed(err)
+}
@@ -21,4 +21,35 @@ const (
 	maxJSONPatchOperations = 1000
 	mqttTimeout            = 1 * time.Second
 	heartBeatTimeInterval  = 15 * time.Second
+	commandTopicFormat     = "cmd/%s/v1/%s"
+	replyTopicFormat       = "reply/%s/v1/%s"
+	streamBufferSize       = 64
+	defaultActionTimeout   = 10 * time.Second
+	maxActionTimeout       = 5 * time.Minute
+	maxActionRecords       = 200
+	maxRevisions           = 50
+	staleTimeout           = 5 * time.Minute
+	maxImportSize          = 32 << 20
+	fileReloadDelay        = 500 * time.Millisecond
+	csvContentType         = "text/csv; charset=utf-8"
+	xlsxContentType        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	sseContentType         = "text/event-stream"
+	lastEventId            = "Last-Event-ID"
+	labelSelector          = "labelSelector"
+)
+
+// the sources of actions
+const (
+	ActionSourceApi      = "api"
+	ActionSourceMqtt     = "mqtt"
+	ActionSourceRule     = "rule"
+	ActionSourceSchedule = "schedule"
+)
+
+// the results of actions
+const (
+	ActionResultSuccess  = "success"
+	ActionResultFailure  = "failure"
+	ActionResultTimeout  = "timeout"
+	ActionResultMismatch = "mismatch"
 )
@@ -0,0 +1,49 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"sort"
+)
+
+// checkAction coerce the value written to variable by data type and check the constraint of variable,
+// all violations of the value are returned.
+func (m *Manager) checkAction(deviceId string, variable runtime.VariableValue, value interface{}) (interface{}, []error) {
+	c, ok := variable.(runtime.Constrainer)
+	if !ok {
+		return value, nil
+	}
+	name := variable.GetVariableName()
+	coerced, err := runtime.Coerce(c.GetDataType(), value)
+	if err != nil {
+		return nil, []error{response.ErrActionValueInvalid(name, value, err.Error())}
+	}
+	current, _ := m.latestValue(deviceId, name)
+	violations := c.GetConstraint().Check(coerced, current)
+	errs := make([]error, 0, len(violations))
+	for _, violation := range violations {
+		errs = append(errs, response.ErrActionValueInvalid(name, value, violation.Error()))
+	}
+	return coerced, errs
+}
+
+// checkRawActions check the raw values converted back by transform can be encoded to the data type of variables
+func (m *Manager) checkRawActions(device runtime.Device, actions map[string]interface{}, raw map[string]interface{}) []error {
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, 0)
+	for _, name := range names {
+		vv, _ := device.GetVariable(name)
+		c, ok := vv.(runtime.Constrainer)
+		if !ok {
+			continue
+		}
+		if err := runtime.CheckRaw(c.GetDataType(), raw[name]); err != nil {
+			errs = append(errs, response.ErrActionValueInvalid(name, actions[name], err.Error()))
+		}
+	}
+	return errs
+}
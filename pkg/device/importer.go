@@ -0,0 +1,382 @@
+package device
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ImportModeCreate = "create"
+	ImportModeUpsert = "upsert"
+
+	ImportOperationCreate    = "create"
+	ImportOperationUpdate    = "update"
+	ImportOperationUnchanged = "unchanged"
+
+	ImportResultSuccess = "success"
+	ImportResultFailure = "failure"
+)
+
+// ImportOptions the mode of importing devices, the devices are matched by device code in upsert mode
+type ImportOptions struct {
+	Mode   string
+	DryRun bool
+	// Author who imports the devices, recorded in the revisions of devices
+	Author string
+}
+
+// ImportResult the result of importing one device
+type ImportResult struct {
+	DeviceCode string `json:"deviceCode"`
+	DeviceId   string `json:"deviceId,omitempty"`
+	Row        int    `json:"row"`       // 设备所在的首行
+	Operation  string `json:"operation"` // create、update、unchanged
+	Result     string `json:"result"`    // success、failure 试运行时为空
+	Error      string `json:"error,omitempty"`
+}
+
+type importDevice struct {
+	row        int
+	code       string
+	deviceType reflect.Type
+	object     map[string]interface{}
+	// the device columns and the rows they are taken from
+	cells    map[string]string
+	cellRows map[string]int
+	// the rows of variables
+	variableRows []int
+	device       v1.DeviceType
+	existing     runtime.Device
+}
+
+// ImportDevices create or update the devices from the table, one variable per row and the rows of same device code
+// belong to one device. All rows are validated before any device is changed, and the row errors are returned at once.
+func (m *Manager) ImportDevices(rows [][]string, opts *ImportOptions) ([]*ImportResult, error) {
+	devices, errs := parseTable(rows)
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+
+	existing := make(map[string][]runtime.Device)
+	m.devices.Range(func(key, value any) bool {
+		d := value.(runtime.Device)
+		existing[d.GetDeviceCode()] = append(existing[d.GetDeviceCode()], d)
+		return true
+	})
+
+	results := make([]*ImportResult, 0, len(devices))
+	for _, d := range devices {
+		result := &ImportResult{DeviceCode: d.code, Row: d.row, Operation: ImportOperationCreate}
+		results = append(results, result)
+		if found := existing[d.code]; len(found) > 0 {
+			switch {
+			case opts.Mode != ImportModeUpsert:
+				errs.Add(response.ErrImportRowInvalid(d.row, fmt.Sprintf("device code %s exists", d.code)))
+				continue
+			case len(found) > 1:
+				errs.Add(response.ErrImportRowInvalid(d.row, fmt.Sprintf("device code %s is used by %d devices", d.code, len(found))))
+				continue
+			case found[0].GetDeviceType() != d.device.GetDeviceType():
+				errs.Add(response.ErrImportRowInvalid(d.row, fmt.Sprintf("device type of %s can not be changed", d.code)))
+				continue
+			}
+			d.existing = found[0]
+			result.DeviceId = found[0].GetID()
+			result.Operation = ImportOperationUpdate
+			if current, err := m.toObject(found[0]); err == nil && objectEqual(current, d.device) {
+				result.Operation = ImportOperationUnchanged
+				continue
+			}
+		}
+		// validate the device like creating or updating it, so that the dry run reports the same errors
+		if _, _, err := m.buildDevice(d.device, d.existing); err != nil {
+			errs.Add(response.ErrImportRowInvalid(d.row, fmt.Sprintf("device %s %v", d.code, err)))
+		}
+	}
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+	if opts.DryRun {
+		return results, nil
+	}
+
+	for i, d := range devices {
+		result := results[i]
+		result.Result = ImportResultSuccess
+		var err error
+		author := revision.WithAuthor(revision.SourceImport, opts.Author)
+		switch result.Operation {
+		case ImportOperationCreate:
+			var created runtime.Device
+			if created, err = m.CreateDevice(d.device, author); err == nil {
+				result.DeviceId = created.GetID()
+			}
+		case ImportOperationUpdate:
+			var current runtime.Device
+			if current, err = m.GetDeviceById(d.existing.GetID(), false); err == nil {
+				var updated runtime.Device
+				if updated, err = m.UpdateDeviceById(current.GetID(), current.GetVersion(), d.device, author); err == nil {
+					m.recollect(updated)
+				}
+			}
+		}
+		if err != nil {
+			klog.V(2).InfoS("Failed to import device", "deviceCode", d.code, "operation", result.Operation, "err", err)
+			result.Result = ImportResultFailure
+			result.Error = err.Error()
+		}
+	}
+	return results, nil
+}
+
+// parseTable group the rows by device code and build the device objects
+func parseTable(rows [][]string) ([]*importDevice, *response.MultiError) {
+	errs := &response.MultiError{}
+	if len(rows) == 0 {
+		errs.Add(response.ErrImportRowInvalid(1, "header is required"))
+		return nil, errs
+	}
+	header := make([]string, len(rows[0]))
+	for i, column := range rows[0] {
+		header[i] = strings.TrimSpace(column)
+	}
+	typeColumn, codeColumn := -1, -1
+	for i, column := range header {
+		switch column {
+		case "deviceType":
+			typeColumn = i
+		case "deviceCode":
+			codeColumn = i
+		}
+	}
+	if typeColumn < 0 || codeColumn < 0 {
+		errs.Add(response.ErrImportRowInvalid(1, "columns deviceType and deviceCode are required"))
+		return nil, errs
+	}
+
+	devices := make([]*importDevice, 0)
+	byCode := make(map[string]*importDevice)
+	for i, row := range rows[1:] {
+		number := i + 2
+		cell := func(column int) string {
+			if column < len(row) {
+				return strings.TrimSpace(row[column])
+			}
+			return ""
+		}
+		if len(strings.Join(row, "")) == 0 {
+			continue
+		}
+		code := cell(codeColumn)
+		if len(code) == 0 {
+			errs.Add(response.ErrImportRowInvalid(number, "deviceCode is required"))
+			continue
+		}
+		d, ok := byCode[code]
+		if !ok {
+			newObject, supported := generic.DeviceTypeMap[cell(typeColumn)]
+			if !supported {
+				errs.Add(response.ErrImportRowInvalid(number, fmt.Sprintf("unsupported device type %s", cell(typeColumn))))
+				continue
+			}
+			d = &importDevice{
+				row:        number,
+				code:       code,
+				deviceType: reflect.TypeOf(newObject()),
+				object:     map[string]interface{}{variablesField: []interface{}{}},
+				cells:      make(map[string]string),
+				cellRows:   make(map[string]int),
+			}
+			byCode[code] = d
+			devices = append(devices, d)
+		}
+		variableType, _ := field(indirect(d.deviceType), variablesField)
+		variable := make(map[string]interface{})
+		for column, name := range header {
+			value := cell(column)
+			if len(value) == 0 || len(name) == 0 {
+				continue
+			}
+			if strings.HasPrefix(name, variableColumnPrefix) {
+				path := strings.Split(strings.TrimPrefix(name, variableColumnPrefix), ".")
+				if err := setCell(variable, variableType.Elem(), path, value); err != nil {
+					errs.Add(response.ErrImportRowInvalid(number, err.Error()))
+				}
+				continue
+			}
+			// the device columns are taken from the first row of device, the following rows may leave them empty
+			if first, ok := d.cells[name]; ok {
+				if first != value {
+					errs.Add(response.ErrImportRowInvalid(number, fmt.Sprintf("column %s conflicts with row %d", name, d.cellRows[name])))
+				}
+				continue
+			}
+			d.cells[name] = value
+			d.cellRows[name] = number
+			if err := setCell(d.object, d.deviceType, strings.Split(name, "."), value); err != nil {
+				errs.Add(response.ErrImportRowInvalid(number, err.Error()))
+			}
+		}
+		if len(variable) > 0 {
+			d.object[variablesField] = append(d.object[variablesField].([]interface{}), variable)
+			d.variableRows = append(d.variableRows, number)
+		}
+	}
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+
+	for _, d := range devices {
+		object, err := newObject(d.object)
+		var fieldErrs validator.ValidationErrors
+		switch {
+		case errors.As(err, &fieldErrs):
+			for _, fe := range fieldErrs {
+				errs.Add(response.ErrImportRowInvalid(d.rowOf(fe.Namespace()), fe.Error()))
+			}
+		case err != nil:
+			errs.Add(response.ErrImportRowInvalid(d.row, fmt.Sprintf("device %s %v", d.code, err)))
+		default:
+			d.device = object
+		}
+	}
+	return devices, errs
+}
+
+var variableIndex = regexp.MustCompile(`\.Variables\[(\d+)\]`)
+
+// rowOf the row of the field failed to validate, the row of variable if the field belongs to variable
+func (d *importDevice) rowOf(namespace string) int {
+	if match := variableIndex.FindStringSubmatch(namespace); match != nil {
+		if i, err := strconv.Atoi(match[1]); err == nil && i < len(d.variableRows) {
+			return d.variableRows[i]
+		}
+	}
+	return d.row
+}
+
+// newObject decode the device object and validate its fields, the device is validated as a whole by buildDevice
+func newObject(object map[string]interface{}) (v1.DeviceType, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	deviceType, _ := object["deviceType"].(string)
+	d := generic.DeviceTypeMap[deviceType]()
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, err
+	}
+	if err := binding.Validator.ValidateStruct(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// toObject convert the device back to the object of creating device
+func (m *Manager) toObject(device runtime.Device) (v1.DeviceType, error) {
+	data, err := json.Marshal(device)
+	if err != nil {
+		return nil, err
+	}
+	object := generic.DeviceTypeMap[device.GetDeviceType()]()
+	if err := json.Unmarshal(data, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func objectEqual(o1, o2 v1.DeviceType) bool {
+	d1, err1 := json.Marshal(o1)
+	d2, err2 := json.Marshal(o2)
+	return err1 == nil && err2 == nil && bytes.Equal(d1, d2)
+}
+
+// ExportDevices export the devices as table, one variable per row, the devices are sorted by type and code
+func (m *Manager) ExportDevices(deviceType string) ([][]string, error) {
+	devices, err := m.ListDevices(&runtime.DeviceFilter{}, true)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(devices, func(i, j int) bool {
+		if devices[i].GetDeviceType() != devices[j].GetDeviceType() {
+			return devices[i].GetDeviceType() < devices[j].GetDeviceType()
+		}
+		return devices[i].GetDeviceCode() < devices[j].GetDeviceCode()
+	})
+
+	header := append([]string{}, leadingColumns...)
+	seen := make(map[string]bool)
+	for _, column := range header {
+		seen[column] = true
+	}
+	addColumns := func(columns []string) {
+		for _, column := range columns {
+			if !seen[column] {
+				seen[column] = true
+				header = append(header, column)
+			}
+		}
+	}
+
+	records := make([]map[string]string, 0)
+	for _, device := range devices {
+		if len(deviceType) > 0 && device.GetDeviceType() != deviceType {
+			continue
+		}
+		object, err := m.toObject(device)
+		if err != nil {
+			klog.V(2).InfoS("Failed to export device", "deviceId", device.GetID(), "err", err)
+			continue
+		}
+		t := reflect.TypeOf(object)
+		variableType, _ := field(indirect(t), variablesField)
+		addColumns(columns(indirect(t), ""))
+		addColumns(columns(indirect(variableType.Elem()), variableColumnPrefix))
+
+		data, _ := json.Marshal(object)
+		values := make(map[string]interface{})
+		_ = json.Unmarshal(data, &values)
+		cells := make(map[string]string)
+		flatten(values, t, "", cells)
+		variables, _ := values[variablesField].([]interface{})
+		if len(variables) == 0 {
+			records = append(records, cells)
+			continue
+		}
+		for _, v := range variables {
+			variable, _ := v.(map[string]interface{})
+			record := make(map[string]string, len(cells))
+			for key, value := range cells {
+				record[key] = value
+			}
+			flatten(variable, variableType.Elem(), variableColumnPrefix, record)
+			records = append(records, record)
+		}
+	}
+
+	rows := make([][]string, 0, len(records)+1)
+	rows = append(rows, header)
+	for _, record := range records {
+		row := make([]string, len(header))
+		for i, column := range header {
+			row[i] = record[column]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
@@ -1,8 +1,10 @@
 package device
 
 import (
+	"context"
 	"harnsgateway/pkg/runtime"
 	v1 "harnsgateway/pkg/v1"
+	"time"
 )
 
 type DeviceManager interface {
@@ -11,3 +13,20 @@ type DeviceManager interface {
 	UpdateValidation(deviceType v1.DeviceType, device runtime.Device) error
 	UpdateDevice(id string, deviceType v1.DeviceType, device runtime.Device) (runtime.Device, error)
 }
+
+// DataRouter delivers the data collected from device to northbound destinations
+type DataRouter interface {
+	Route(device runtime.Device, data *runtime.PublishData)
+	Shutdown(ctx context.Context) error
+}
+
+// DataObserver is notified with the values of device after each collection, including the virtual variables.
+// Observe should not block the collection.
+type DataObserver interface {
+	Observe(device runtime.Device, timestamp time.Time, values []runtime.PointData)
+}
+
+// DataProcessor transforms the values of device after each collection, before they are published and observed.
+type DataProcessor interface {
+	Process(device runtime.Device, values []runtime.PointData) []runtime.PointData
+}
@@ -0,0 +1,17 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+)
+
+// validateLabels the labels can be selected by label selector and the group is a valid hierarchy
+func validateLabels(device runtime.Device) error {
+	if err := runtime.ValidateLabels(device.GetLabels()); err != nil {
+		return response.ErrLabelInvalid(device.GetName(), err.Error())
+	}
+	if err := runtime.ValidateGroup(device.GetGroup()); err != nil {
+		return response.ErrGroupInvalid(device.GetGroup(), err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package device
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"sort"
+	"strings"
+)
+
+const (
+	// defaultDeviceSort the latest modified devices first
+	defaultDeviceSort = "modTime,desc"
+	maxListLimit      = 1000
+	// sortTimeLayout the fixed width layout keeps the order of time as text
+	sortTimeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+)
+
+// the fields of devices to sort by, the devices of same field are sorted by id
+var deviceSortKeys = map[string]func(d runtime.Device) string{
+	"id":            func(d runtime.Device) string { return d.GetID() },
+	"name":          func(d runtime.Device) string { return d.GetName() },
+	"deviceCode":    func(d runtime.Device) string { return d.GetDeviceCode() },
+	"deviceType":    func(d runtime.Device) string { return d.GetDeviceType() },
+	"deviceModel":   func(d runtime.Device) string { return d.GetDeviceModel() },
+	"collectStatus": func(d runtime.Device) string { return d.GetCollectStatus() },
+	"group":         func(d runtime.Device) string { return d.GetGroup() },
+	"modTime":       func(d runtime.Device) string { return d.GetModTime().UTC().Format(sortTimeLayout) },
+}
+
+// ListOptions the order and page of listing devices
+type ListOptions struct {
+	// Sort 排序 字段[,asc|desc] 例如 name,asc 默认modTime,desc
+	Sort string
+	// Limit 每页数量 0表示不分页
+	Limit int
+	// Continue 上一页返回的续查令牌
+	Continue string
+}
+
+// continueToken the position of last device of page, the next page starts after it
+type continueToken struct {
+	Sort string `json:"sort"`
+	Key  string `json:"key"`
+	Id   string `json:"id"`
+}
+
+type deviceOrder struct {
+	sort string
+	key  func(d runtime.Device) string
+	desc bool
+}
+
+func parseOrder(s string) (*deviceOrder, error) {
+	if len(s) == 0 {
+		s = defaultDeviceSort
+	}
+	field, direction, _ := strings.Cut(s, ",")
+	key, ok := deviceSortKeys[field]
+	if !ok {
+		return nil, response.ErrQueryInvalid(apis.Sort, "unsupported field "+field)
+	}
+	if len(direction) == 0 {
+		direction = apis.ASC
+	}
+	if direction != apis.ASC && direction != apis.DESC {
+		return nil, response.ErrQueryInvalid(apis.Sort, "unsupported direction "+direction)
+	}
+	return &deviceOrder{sort: field + "," + direction, key: key, desc: direction == apis.DESC}, nil
+}
+
+// before whether the device of (key, id) is in front of the other
+func (o *deviceOrder) before(key, id, otherKey, otherId string) bool {
+	if key != otherKey {
+		return (key < otherKey) != o.desc
+	}
+	return id != otherId && (id < otherId) != o.desc
+}
+
+// ListDevicePage list one page of devices matched the filter, the token to continue is empty at the last page
+func (m *Manager) ListDevicePage(filter *runtime.DeviceFilter, opts *ListOptions, exploded bool) ([]runtime.Device, string, error) {
+	order, err := parseOrder(opts.Sort)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.Limit < 0 || opts.Limit > maxListLimit {
+		return nil, "", response.ErrQueryInvalid(apis.Limit, "must be between 0 and 1000")
+	}
+	var after *continueToken
+	if len(opts.Continue) > 0 {
+		after, err = decodeContinue(opts.Continue)
+		if err != nil || after.Sort != order.sort {
+			return nil, "", response.ErrQueryInvalid(apis.Continue, "the token is malformed or not of the sort")
+		}
+	}
+
+	predicates := runtime.ParseTypeFilter(filter)
+	rds := make([]runtime.Device, 0)
+	keys := make(map[string]string)
+	m.devices.Range(func(_, value interface{}) bool {
+		d := value.(runtime.Device)
+		if !runtime.MatchPredicates(d, predicates) {
+			return true
+		}
+		key := order.key(d)
+		if after != nil && !order.before(after.Key, after.Id, key, d.GetID()) {
+			return true
+		}
+		keys[d.GetID()] = key
+		rds = append(rds, d)
+		return true
+	})
+	sort.Slice(rds, func(i, j int) bool {
+		return order.before(keys[rds[i].GetID()], rds[i].GetID(), keys[rds[j].GetID()], rds[j].GetID())
+	})
+
+	next := ""
+	if opts.Limit > 0 && len(rds) > opts.Limit {
+		rds = rds[:opts.Limit]
+		last := rds[len(rds)-1]
+		next = encodeContinue(&continueToken{Sort: order.sort, Key: keys[last.GetID()], Id: last.GetID()})
+	}
+	if !exploded {
+		for i := range rds {
+			rds[i] = m.foldDevice(rds[i])
+		}
+	}
+	return rds, next, nil
+}
+
+func encodeContinue(token *continueToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeContinue(s string) (*continueToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	token := &continueToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
@@ -0,0 +1,55 @@
+package device
+
+import (
+	"harnsgateway/pkg/runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestListDevicePage(t *testing.T) {
+	m := &Manager{devices: &sync.Map{}}
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		id := strconv.Itoa(i)
+		m.devices.Store(id, &runtime.DeviceMeta{
+			ObjectMeta: runtime.ObjectMeta{ID: id, Name: "meter", ModTime: start.Add(time.Duration(i) * time.Second)},
+			DeviceCode: "pm-" + id,
+			Labels:     map[string]string{"line": strconv.Itoa(i % 2)},
+		})
+	}
+
+	// the latest modified first by default
+	rds, next, err := m.ListDevicePage(&runtime.DeviceFilter{}, &ListOptions{Limit: 2}, true)
+	if err != nil || len(rds) != 2 || rds[0].GetID() != "4" || rds[1].GetID() != "3" || len(next) == 0 {
+		t.Fatalf("ListDevicePage() = %v, %q, %v", rds, next, err)
+	}
+	ids := ""
+	for len(next) > 0 {
+		rds, next, err = m.ListDevicePage(&runtime.DeviceFilter{}, &ListOptions{Limit: 2, Continue: next}, true)
+		if err != nil {
+			t.Fatalf("ListDevicePage() = %v", err)
+		}
+		for _, d := range rds {
+			ids += d.GetID()
+		}
+	}
+	if ids != "210" {
+		t.Errorf("expected the following pages 210, got %s", ids)
+	}
+
+	// the devices of same name are sorted by id
+	rds, _, _ = m.ListDevicePage(&runtime.DeviceFilter{LabelSelector: "line=1"}, &ListOptions{Sort: "name"}, true)
+	if len(rds) != 2 || rds[0].GetID() != "1" || rds[1].GetID() != "3" {
+		t.Errorf("unexpected devices %v", rds)
+	}
+
+	if _, _, err := m.ListDevicePage(&runtime.DeviceFilter{}, &ListOptions{Sort: "address"}, true); err == nil {
+		t.Errorf("expected unsupported sort")
+	}
+	_, next, _ = m.ListDevicePage(&runtime.DeviceFilter{}, &ListOptions{Limit: 1}, true)
+	if _, _, err := m.ListDevicePage(&runtime.DeviceFilter{}, &ListOptions{Sort: "name", Continue: next}, true); err == nil {
+		t.Errorf("expected continue token of other sort invalid")
+	}
+}
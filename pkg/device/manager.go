@@ -10,11 +10,16 @@ import (
 	"harnsgateway/pkg/apis/response"
 	"harnsgateway/pkg/gateway"
 	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/metrics"
+	"harnsgateway/pkg/revision"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
+	"harnsgateway/pkg/storage"
 	v1 "harnsgateway/pkg/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -22,9 +27,65 @@ import (
 
 type Option func(*Manager)
 
+// WithRouter route the collected data to northbound sinks instead of publishing to MQTT directly
+func WithRouter(router DataRouter) Option {
+	return func(m *Manager) {
+		m.router = router
+	}
+}
+
+// WithObserver notify the observers with the collected values of devices
+func WithObserver(observers ...DataObserver) Option {
+	return func(m *Manager) {
+		m.observers = append(m.observers, observers...)
+	}
+}
+
+// WithProcessor process the collected values of devices, including the virtual variables
+func WithProcessor(processor DataProcessor) Option {
+	return func(m *Manager) {
+		m.processor = processor
+	}
+}
+
+// WithVariableMetrics export the latest variable values as gauges
+func WithVariableMetrics(enabled bool) Option {
+	return func(m *Manager) {
+		m.variableMetrics = enabled
+	}
+}
+
+// WithFileReload reload the device files edited on disk
+func WithFileReload(enabled bool) Option {
+	return func(m *Manager) {
+		m.fileReload = enabled
+	}
+}
+
+// WithCollect disable collecting to change the devices in store only, e.g. applying manifest while the gateway is stopped
+func WithCollect(enabled bool) Option {
+	return func(m *Manager) {
+		m.collect = enabled
+	}
+}
+
+// WithWillMessage publish the will message before disconnected gracefully,
+// the broker only sends last will when the connection is lost unexpectedly.
+func WithWillMessage(topic string, payload []byte) Option {
+	return func(m *Manager) {
+		m.willTopic = topic
+		m.willPayload = payload
+	}
+}
+
 type Manager struct {
 	gatewayMeta      *gateway.GatewayMeta
 	mqttClient       mqtt.Client
+	router           DataRouter
+	observers        []DataObserver
+	processor        DataProcessor
+	willTopic        string
+	willPayload      []byte
 	mu               *sync.Mutex
 	deviceManager    map[string]DeviceManager
 	devices          *sync.Map
@@ -35,6 +96,19 @@ type Manager struct {
 	stopCh           <-chan struct{}
 	deviceStatusCh   chan string
 	closers          []runtime.LabeledCloser
+	streams          *streamHub
+	variableMetrics  bool
+	latestValues     *sync.Map
+	virtuals         *sync.Map
+	aggregators      *sync.Map
+	actionMu         *sync.Mutex
+	actionRecords    map[string][]*ActionRecord
+	actionClient     storage.Storage
+	revisions        *revision.History
+	fileReload       bool
+	files            *fileReloader
+	reloadMu         *sync.Mutex
+	collect          bool
 }
 
 func NewManager(store *generic.Store, mqttClient mqtt.Client, gatewayMeta *gateway.GatewayMeta, stop <-chan struct{}, opts ...Option) *Manager {
@@ -50,6 +124,14 @@ func NewManager(store *generic.Store, mqttClient mqtt.Client, gatewayMeta *gatew
 		store:            store,
 		stopCh:           stop,
 		deviceStatusCh:   make(chan string, 0),
+		streams:          newStreamHub(),
+		latestValues:     &sync.Map{},
+		virtuals:         &sync.Map{},
+		aggregators:      &sync.Map{},
+		actionMu:         &sync.Mutex{},
+		actionRecords:    make(map[string][]*ActionRecord),
+		reloadMu:         &sync.Mutex{},
+		collect:          true,
 	}
 	for _, opt := range opts {
 		opt(m)
@@ -58,12 +140,56 @@ func NewManager(store *generic.Store, mqttClient mqtt.Client, gatewayMeta *gatew
 }
 
 func (m *Manager) Init() {
+	m.Load()
+	m.loadActionRecords()
+	m.startCollect()
+	if m.fileReload {
+		m.startFileReload()
+	}
+
+	if err := m.SubscribeCommand(); err != nil {
+		klog.V(2).InfoS("Failed to receive command from MQTT", "err", err)
+	}
+
+	go m.heartBeatDetection()
+	go m.listeningDeviceStatusCh()
+	go m.flushAggregations()
+}
+
+// Load load the revisions and devices from store without starting anything
+func (m *Manager) Load() {
+	m.loadRevisions()
+	m.loadDevices()
+}
+
+// loadDevices load the devices from store with their virtual variables and aggregators
+func (m *Manager) loadDevices() {
 	devices, _ := m.store.LoadResource()
 	for _, object := range devices {
 		object.IndexDevice()
 		obj, _ := runtime.AccessorDevice(object)
 		m.devices.Store(obj.GetID(), obj)
+	}
+	m.devices.Range(func(key, value any) bool {
+		obj := value.(runtime.Device)
+		cvs, err := m.compileVirtualVariables(obj)
+		if err != nil {
+			klog.V(2).InfoS("Failed to compile virtual variables", "deviceId", obj.GetID(), "err", err)
+		} else if len(cvs) > 0 {
+			m.virtuals.Store(obj.GetID(), cvs)
+		}
+		m.setAggregator(obj)
+		return true
+	})
+	if m.revisions != nil {
+		m.snapshotRevisions()
+	}
+}
 
+// startCollect start collecting all devices, the unconnected devices are retried by heartbeat
+func (m *Manager) startCollect() {
+	m.devices.Range(func(key, value any) bool {
+		obj := value.(runtime.Device)
 		if err := m.readyCollect(obj); err != nil {
 			if errors.Is(err, constant.ErrConnectDevice) {
 				// 开启探测协程 15S一次
@@ -72,16 +198,34 @@ func (m *Manager) Init() {
 				klog.V(2).InfoS("Failed to start process collect device data", "deviceId", obj.GetID())
 			}
 		}
-	}
+		return true
+	})
+}
 
-	go m.heartBeatDetection()
-	go m.listeningDeviceStatusCh()
+// Reload stop collecting all devices and replace the store, then load the devices again and restart collection.
+// The devices are reloaded even if the replacement fails, so the collection goes on with the store left.
+func (m *Manager) Reload(replace func() error) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.devices.Range(func(key, value any) bool {
+		_ = m.cancelCollect(value.(runtime.Device))
+		m.devices.Delete(key)
+		m.virtuals.Delete(key)
+		m.aggregators.Delete(key)
+		m.latestValues.Delete(key)
+		return true
+	})
+	err := replace()
+	m.loadDevices()
+	m.startCollect()
+	m.files.resync()
+	klog.V(1).InfoS("Reloaded devices", "err", err)
+	return err
 }
 
-func (m *Manager) CreateDevice(object v1.DeviceType) (runtime.Device, error) {
-	device, err := m.deviceManager[object.GetDeviceType()].CreateDevice(object)
+func (m *Manager) CreateDevice(object v1.DeviceType, opts ...revision.Option) (runtime.Device, error) {
+	device, cvs, err := m.buildDevice(object, nil)
 	if err != nil {
-		klog.V(2).InfoS("Failed to create device", "error", err)
 		return nil, err
 	}
 
@@ -92,7 +236,12 @@ func (m *Manager) CreateDevice(object v1.DeviceType) (runtime.Device, error) {
 	}
 	rd := created.(runtime.Device)
 	m.devices.Store(rd.GetID(), rd)
+	if len(cvs) > 0 {
+		m.virtuals.Store(rd.GetID(), cvs)
+	}
+	m.setAggregator(rd)
 	_, _ = runtime.AccessorDevice(created)
+	m.recordRevision(rd, revision.OperationCreate, opts...)
 
 	if err = m.readyCollect(rd); err != nil {
 		if errors.Is(err, constant.ErrConnectDevice) {
@@ -128,7 +277,12 @@ func (m *Manager) DeleteDevice(id string, version string) (runtime.Device, error
 	}
 
 	klog.V(2).InfoS("Deleted device", "deviceId", device.GetID())
+	m.removeDevice(device)
+	return device, nil
+}
 
+// removeDevice stop collecting the device and drop its states, the store is not changed
+func (m *Manager) removeDevice(device runtime.Device) {
 	go func() {
 		if err := m.cancelCollect(device); err != nil {
 			klog.V(2).InfoS("Failed to cancel collect process", "deviceId", device.GetID())
@@ -136,10 +290,18 @@ func (m *Manager) DeleteDevice(id string, version string) (runtime.Device, error
 	}()
 
 	m.devices.Delete(device.GetID())
-	return device, nil
+	m.streams.closeDevice(device.GetID())
+	m.latestValues.Delete(device.GetID())
+	m.virtuals.Delete(device.GetID())
+	m.aggregators.Delete(device.GetID())
+	m.deleteActionRecords(device.GetID())
+	if m.revisions != nil {
+		m.revisions.Delete(device.GetID())
+	}
+	metrics.DeleteDevice(device.GetID())
 }
 
-func (m *Manager) UpdateDeviceById(id string, version string, newObj v1.DeviceType) (runtime.Device, error) {
+func (m *Manager) UpdateDeviceById(id string, version string, newObj v1.DeviceType, opts ...revision.Option) (runtime.Device, error) {
 	d, err := m.GetDeviceById(id, true)
 	if err != nil {
 		return nil, err
@@ -149,16 +311,8 @@ func (m *Manager) UpdateDeviceById(id string, version string, newObj v1.DeviceTy
 		return nil, apis.ErrMismatch
 	}
 
-	copied := d.DeepCopyObject()
-	cd := copied.(runtime.Device)
-
-	if err = m.deviceManager[d.GetDeviceType()].UpdateValidation(newObj, cd); err != nil {
-		return nil, err
-	}
-
-	device, err := m.deviceManager[d.GetDeviceType()].UpdateDevice(id, newObj, cd)
+	device, cvs, err := m.buildDevice(newObj, d)
 	if err != nil {
-		klog.V(2).InfoS("Failed to update device", "error", err)
 		return nil, err
 	}
 
@@ -169,40 +323,58 @@ func (m *Manager) UpdateDeviceById(id string, version string, newObj v1.DeviceTy
 	}
 	rd := updated.(runtime.Device)
 	m.devices.Store(rd.GetID(), updated)
+	if len(cvs) > 0 {
+		m.virtuals.Store(rd.GetID(), cvs)
+	} else {
+		m.virtuals.Delete(rd.GetID())
+	}
+	m.setAggregator(rd)
+	m.recordRevision(rd, revision.OperationUpdate, opts...)
 
 	return updated, nil
 }
 
-func (m *Manager) ListDevices(filter *runtime.DeviceFilter, exploded bool) ([]runtime.Device, error) {
-	rds := make([]runtime.Device, 0)
-	predicates := runtime.ParseTypeFilter(filter)
-
-	// descend
-	byModTime := func(d1, d2 runtime.Device) bool { return d1.GetModTime().Before(d2.GetModTime()) }
-	sorter := runtime.ByDevice(byModTime)
-
-	m.devices.Range(func(key, value interface{}) bool {
-		isMatch := true
-		v := value.(runtime.Device)
-		for _, p := range predicates {
-			if !p(v) {
-				isMatch = false
-				break
-			}
+// buildDevice validate the object and build the device created from it, or the copy of existing device updated by
+// it, nothing is stored
+func (m *Manager) buildDevice(object v1.DeviceType, existing runtime.Device) (runtime.Device, []*virtualVariable, error) {
+	var device runtime.Device
+	var err error
+	if existing == nil {
+		if device, err = m.deviceManager[object.GetDeviceType()].CreateDevice(object); err != nil {
+			klog.V(2).InfoS("Failed to create device", "error", err)
+			return nil, nil, err
 		}
-		if isMatch {
-			rds = sorter.Insert(rds, v)
+	} else {
+		cd := existing.DeepCopyObject().(runtime.Device)
+		if err = m.deviceManager[existing.GetDeviceType()].UpdateValidation(object, cd); err != nil {
+			return nil, nil, err
 		}
-		return true
-	})
-
-	if !exploded {
-		for i := range rds {
-			rds[i] = m.foldDevice(rds[i])
+		if device, err = m.deviceManager[existing.GetDeviceType()].UpdateDevice(existing.GetID(), object, cd); err != nil {
+			klog.V(2).InfoS("Failed to update device", "error", err)
+			return nil, nil, err
 		}
 	}
+	device.SetLabels(object.GetLabels())
+	device.SetGroup(object.GetGroup())
+	if err := validateLabels(device); err != nil {
+		return nil, nil, err
+	}
+	device.SetVirtualVariables(toVirtualVariables(object))
+	cvs, err := m.compileVirtualVariables(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	device.SetAggregations(object.GetAggregations())
+	if err := validateAggregations(device); err != nil {
+		return nil, nil, err
+	}
+	return device, cvs, nil
+}
 
-	return rds, nil
+// ListDevices list all devices matched the filter, the latest modified first
+func (m *Manager) ListDevices(filter *runtime.DeviceFilter, exploded bool) ([]runtime.Device, error) {
+	rds, _, err := m.ListDevicePage(filter, &ListOptions{}, exploded)
+	return rds, err
 }
 
 func (m *Manager) GetDeviceById(id string, exploded bool) (runtime.Device, error) {
@@ -231,53 +403,150 @@ func (m *Manager) SwitchDeviceStatus(id string, status string) error {
 	return nil
 }
 
-func (m *Manager) DeliverAction(id string, actions []map[string]interface{}) error {
+// DeliverAction writes the values to device, the errors of illegal actions, failed writes and failed readback are returned
+func (m *Manager) DeliverAction(id string, actions []map[string]interface{}, opts ...ActionOption) error {
+	record, err := m.WriteAction(id, actions, opts...)
+	if err != nil {
+		return err
+	}
+	return record.Err()
+}
+
+// WriteAction writes the values to device and records the audit trail, the error is returned only if the actions are illegal
+func (m *Manager) WriteAction(id string, actions []map[string]interface{}, opts ...ActionOption) (*ActionRecord, error) {
+	options := &actionOptions{timeout: defaultActionTimeout}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	device, err := m.GetDeviceById(id, true)
 	if err != nil {
 		klog.V(2).InfoS("Failed to find device", "deviceId", id)
-		return response.NewMultiError(response.ErrDeviceNotFound(id))
+		return nil, response.NewMultiError(response.ErrDeviceNotFound(id))
 	}
 
 	errs := &response.MultiError{}
+	seen := sets.NewString()
 	legalActions := make(map[string]interface{}, 0)
 	for _, item := range actions {
 		for k, v := range item {
-			if _, exist := legalActions[k]; exist {
+			if seen.Has(k) {
 				errs.Add(response.ErrResourceExists(k))
 				continue
 			}
-			if v, ok := device.GetVariable(k); !ok {
+			seen.Insert(k)
+			variable, ok := device.GetVariable(k)
+			if !ok {
 				errs.Add(response.ErrResourceNotFound(k))
 				continue
-			} else if v.GetVariableAccessMode() != constant.AccessModeReadWrite {
-				errs.Add(response.ErrResourceNotFound(k))
+			} else if variable.GetVariableAccessMode() != constant.AccessModeReadWrite {
+				errs.Add(response.ErrVariableNotWritable(k))
+				continue
+			} else if runtime.IsDisabled(variable) {
+				errs.Add(response.ErrVariableDisabled(k))
 				continue
 			}
-			legalActions[k] = v
+			value, violations := m.checkAction(id, variable, v)
+			if len(violations) > 0 {
+				errs.Add(violations...)
+				continue
+			}
+			legalActions[k] = value
 		}
 	}
 
 	if errs.Len() > 0 {
-		return errs
+		return nil, errs
 	}
 
 	if len(legalActions) == 0 {
-		return response.NewMultiError(response.ErrLegalActionNotFound)
+		return nil, response.NewMultiError(response.ErrLegalActionNotFound)
 	}
 
-	if device.GetCollectStatus() == runtime.CollectStatusToString[runtime.Unconnected] {
+	// the raw values encoded to frames
+	rawActions := make(map[string]interface{}, len(legalActions))
+	for k, v := range legalActions {
+		rawActions[k] = v
+	}
+	m.inverseTransform(device, rawActions)
+	if violations := m.checkRawActions(device, legalActions, rawActions); len(violations) > 0 {
+		return nil, response.NewMultiError(violations...)
+	}
+
+	record := &ActionRecord{
+		DeviceId:  id,
+		Source:    options.source,
+		Requester: options.requester,
+		Readback:  options.readback,
+		Timestamp: time.Now(),
+		Results:   make([]*ActionResult, 0, len(legalActions)),
+	}
+	for k, v := range legalActions {
+		old, _ := m.latestValue(id, k)
+		record.Results = append(record.Results, &ActionResult{Name: k, OldValue: old, NewValue: v, Result: ActionResultSuccess})
+	}
+	sort.Slice(record.Results, func(i, j int) bool {
+		return record.Results[i].Name < record.Results[j].Name
+	})
+	defer func() {
+		record.finish()
+		klog.V(3).InfoS("Delivered action", "deviceId", id, "source", record.Source, "requester", record.Requester, "result", record.Result)
+		m.recordAction(record)
+	}()
+
+	broker, exist := m.brokers[id]
+	if !exist || device.GetCollectStatus() == runtime.CollectStatusToString[runtime.Unconnected] {
 		klog.V(2).InfoS("Failed to connect device", "deviceId", id)
-		return response.NewMultiError(response.ErrDeviceNotConnect(id))
+		record.fail(response.ErrDeviceNotConnect(id), ActionResultFailure)
+		return record, nil
 	}
 
-	return m.brokers[id].DeliverAction(context.Background(), legalActions)
+	ctx, cancel := context.WithTimeout(context.Background(), options.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- broker.DeliverAction(ctx, rawActions)
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			klog.V(2).InfoS("Failed to deliver action", "deviceId", id, "err", err)
+			record.fail(response.ErrDeviceActionFailed(err), ActionResultFailure)
+			return record, nil
+		}
+	case <-ctx.Done():
+		klog.V(2).InfoS("Failed to deliver action in time", "deviceId", id, "timeout", options.timeout)
+		for _, ar := range record.Results {
+			ar.Result = ActionResultTimeout
+			ar.err = response.ErrActionTimeout(ar.Name, options.timeout)
+			ar.Error = ar.err.Error()
+		}
+		return record, nil
+	}
+
+	if options.readback {
+		// the values are read back within their own timeout after written
+		written := time.Now()
+		readbackCtx, readbackCancel := context.WithTimeout(context.Background(), options.timeout)
+		defer readbackCancel()
+		actual, mismatched := m.readback(readbackCtx, id, legalActions, options.tolerance, written)
+		for _, ar := range record.Results {
+			ar.ReadbackValue = actual[ar.Name]
+			if mismatched.Has(ar.Name) {
+				ar.Result = ActionResultMismatch
+				ar.err = response.ErrReadbackMismatch(ar.Name, ar.NewValue, ar.ReadbackValue)
+				ar.Error = ar.err.Error()
+			}
+		}
+	}
+	return record, nil
 }
 
 func (m Manager) cancelCollect(obj runtime.Device) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	// switch status
-	obj.SetCollectStatus(runtime.CollectStatusToString[runtime.Stopped])
+	m.setCollectStatus(obj, runtime.Stopped)
 	// delete heartBeat devices if exist
 	if _, exist := m.heartBeatDevices.Load(obj.GetID()); exist {
 		m.heartBeatDevices.Delete(obj.GetID())
@@ -291,20 +560,23 @@ func (m Manager) cancelCollect(obj runtime.Device) error {
 }
 
 func (m *Manager) readyCollect(obj runtime.Device) error {
+	if !m.collect {
+		return nil
+	}
 	broker, results, err := generic.DeviceTypeBrokerMap[obj.GetDeviceType()](obj)
 	if err != nil {
 		switch {
 		case errors.Is(err, constant.ErrConnectDevice):
-			obj.SetCollectStatus(runtime.CollectStatusToString[runtime.Unconnected])
+			m.setCollectStatus(obj, runtime.Unconnected)
 			return err
 		case errors.Is(err, constant.ErrDeviceEmptyVariable):
-			obj.SetCollectStatus(runtime.CollectStatusToString[runtime.EmptyVariable])
+			m.setCollectStatus(obj, runtime.EmptyVariable)
 			return nil
 		default:
 			return err
 		}
 	}
-	obj.SetCollectStatus(runtime.CollectStatusToString[runtime.Collecting])
+	m.setCollectStatus(obj, runtime.Collecting)
 	klog.V(2).InfoS("Succeed to collect data", "deviceId", obj.GetID())
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -329,31 +601,46 @@ func (m *Manager) readyCollect(obj runtime.Device) error {
 				if ok {
 					if v, ok := m.devices.Load(deviceId); ok {
 						if len(pvr.Err) == 0 {
-							if v.(runtime.Device).GetCollectStatus() != runtime.CollectStatusToString[runtime.Collecting] {
-								v.(runtime.Device).SetCollectStatus(runtime.CollectStatusToString[runtime.Collecting])
-							}
+							m.setCollectStatus(v.(runtime.Device), runtime.Collecting)
+						} else {
+							m.setCollectStatus(v.(runtime.Device), runtime.CollectingError)
+						}
+						// the variables of failed frames are published with bad quality as well
+						if len(pvr.VariableSlice) > 0 {
+							now := time.Now()
 							pds := make([]runtime.PointData, 0, len(pvr.VariableSlice))
 							for _, value := range pvr.VariableSlice {
-								pd := runtime.PointData{
-									DataPointId: value.GetVariableName(),
-									Value:       value.GetValue(),
+								pds = append(pds, m.pointData(v.(runtime.Device), value, now))
+							}
+							good, _ := splitUsable(pds)
+							pds = append(pds, m.evaluateVirtualVariables(deviceId, good)...)
+							if m.processor != nil {
+								pds = m.processor.Process(v.(runtime.Device), pds)
+							}
+							fillQuality(pds, now)
+							good, others := splitUsable(pds)
+							timestamp := now.UTC().Format("2006-01-02T15:04:05.000Z")
+							// the raw values of variables emitting aggregated series only are not published,
+							// the bad and stale values are published without aggregating
+							if raw := append(m.aggregate(deviceId, now, good), others...); len(raw) > 0 {
+								publishData := runtime.PublishData{Payload: runtime.Payload{Data: []runtime.TimeSeriesData{{
+									Timestamp: timestamp,
+									Values:    raw,
+								}}}}
+								m.publish(v.(runtime.Device), &publishData)
+							}
+							m.latestValues.Store(deviceId, m.mergeLatest(deviceId, now, good, others))
+							if len(good) > 0 {
+								for _, observer := range m.observers {
+									observer.Observe(v.(runtime.Device), now, good)
 								}
-								pds = append(pds, pd)
 							}
-							publishData := runtime.PublishData{Payload: runtime.Payload{Data: []runtime.TimeSeriesData{{
-								Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+							m.streams.broadcast(&StreamEvent{
+								Type:      StreamEventData,
+								DeviceId:  deviceId,
+								Timestamp: timestamp,
 								Values:    pds,
-							}}}}
-
-							marshal, _ := json.Marshal(publishData)
-							token := m.mqttClient.Publish(topic, 1, false, marshal)
-							if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
-								klog.V(5).InfoS("Succeed to publish MQTT", "topic", topic, "data", publishData)
-							} else {
-								klog.V(1).InfoS("Failed to publish MQTT", "topic", topic, "err", token.Error())
-							}
-						} else {
-							v.(runtime.Device).SetCollectStatus(runtime.CollectStatusToString[runtime.CollectingError])
+							})
 						}
 					} else {
 						klog.V(2).InfoS("Failed to load device", "deviceId", deviceId)
@@ -368,11 +655,41 @@ func (m *Manager) readyCollect(obj runtime.Device) error {
 	return nil
 }
 
+func (m *Manager) publish(device runtime.Device, publishData *runtime.PublishData) {
+	if m.router != nil {
+		m.router.Route(device, publishData)
+		return
+	}
+
+	marshal, _ := json.Marshal(publishData)
+	token := m.mqttClient.Publish(device.GetTopic(), 1, false, marshal)
+	if token.WaitTimeout(mqttTimeout) && token.Error() == nil {
+		metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeData, metrics.ResultSuccess).Inc()
+		klog.V(5).InfoS("Succeed to publish MQTT", "topic", device.GetTopic(), "data", publishData)
+	} else {
+		metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeData, metrics.ResultFailure).Inc()
+		klog.V(1).InfoS("Failed to publish MQTT", "topic", device.GetTopic(), "err", token.Error())
+	}
+}
+
 func (m *Manager) Shutdown(context context.Context) error {
 	for _, c := range m.brokers {
 		c.Destroy(context)
 	}
+	m.streams.closeAll()
+
+	if m.router != nil {
+		if err := m.router.Shutdown(context); err != nil {
+			klog.V(2).InfoS("Failed to flush northbound sinks", "err", err)
+		}
+	}
 
+	if len(m.willTopic) > 0 {
+		token := m.mqttClient.Publish(m.willTopic, 1, true, m.willPayload)
+		if !token.WaitTimeout(mqttTimeout) || token.Error() != nil {
+			klog.V(2).InfoS("Failed to publish will message", "topic", m.willTopic, "err", token.Error())
+		}
+	}
 	m.mqttClient.Disconnect(2000)
 	var errs []string
 	for i := len(m.closers); i > 0; i-- {
@@ -400,6 +717,8 @@ func (m *Manager) foldDevice(device runtime.Device) runtime.Device {
 		DeviceCode:    device.GetDeviceCode(),
 		DeviceType:    device.GetDeviceType(),
 		CollectStatus: device.GetCollectStatus(),
+		Labels:        device.GetLabels(),
+		Group:         device.GetGroup(),
 	}
 }
 
@@ -415,7 +734,9 @@ func (m *Manager) heartBeatDetection() {
 			resumeDevices := make([]string, 0, 0)
 			m.heartBeatDevices.Range(func(key, value any) bool {
 				d := value.(runtime.Device)
-				if err := m.readyCollect(d); err == nil {
+				err := m.readyCollect(d)
+				metrics.HeartbeatReconnects.WithLabelValues(d.GetID(), metrics.Result(err)).Inc()
+				if err == nil {
 					resumeDevices = append(resumeDevices, key.(string))
 					return true
 				}
@@ -522,3 +843,41 @@ func (m *Manager) switchDeviceStatus(device runtime.Device, status string) {
 		}
 	}
 }
+
+// restartCollect restart collecting the device with its latest definition
+func (m *Manager) restartCollect(device runtime.Device) {
+	_ = m.cancelCollect(device)
+	if err := m.readyCollect(device); err != nil {
+		if errors.Is(err, constant.ErrConnectDevice) {
+			m.heartBeatDevices.Store(device.GetID(), device)
+		} else {
+			klog.V(2).InfoS("Failed to start process collect device data", "deviceId", device.GetID())
+		}
+	}
+}
+
+// collecting whether the broker of device is running
+func (m *Manager) collecting(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.brokers[id]
+	return ok
+}
+
+// RecollectDevice restart collecting the device updated by other managers if it was collecting, see recollect
+func (m *Manager) RecollectDevice(device runtime.Device) {
+	m.recollect(device)
+}
+
+// recollect collect the device with its latest definition as before it is updated, the device collecting or waiting
+// for variables is restarted, the device waiting on heartbeat retries with the latest definition, and the device
+// stopped is left alone
+func (m *Manager) recollect(device runtime.Device) {
+	if m.collecting(device.GetID()) || device.GetCollectStatus() == runtime.CollectStatusToString[runtime.EmptyVariable] {
+		m.restartCollect(device)
+		return
+	}
+	if _, ok := m.heartBeatDevices.Load(device.GetID()); ok {
+		m.heartBeatDevices.Store(device.GetID(), device)
+	}
+}
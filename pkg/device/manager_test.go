@@ -0,0 +1,361 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/gateway"
+	"harnsgateway/pkg/generic"
+	modbus "harnsgateway/pkg/protocol/modbus/runtime"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+	"harnsgateway/pkg/storage"
+	v1 "harnsgateway/pkg/v1"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker records the devices collected by the brokers of test device type
+type fakeBroker struct {
+	device  runtime.Device
+	results chan *runtime.ParseVariableResult
+	once    sync.Once
+}
+
+func (b *fakeBroker) Collect(ctx context.Context) {}
+
+func (b *fakeBroker) Destroy(ctx context.Context) {
+	b.once.Do(func() { close(b.results) })
+}
+
+func (b *fakeBroker) DeliverAction(ctx context.Context, obj map[string]interface{}) error {
+	return nil
+}
+
+// newTestManager create the manager storing devices in temporary directory, the modbus devices are collected by fake
+// brokers
+func newTestManager(t *testing.T, opts ...Option) (*Manager, *sync.Map) {
+	storage.SetPath(t.TempDir())
+	store, _ := generic.NewStore(storage.StoreGroupToString[storage.StoreGroupDevice], storage.Devices, generic.DeviceTypeObjectMap)
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	brokers := &sync.Map{}
+	newBroker := generic.DeviceTypeBrokerMap["modbus"]
+	generic.DeviceTypeBrokerMap["modbus"] = func(object runtime.Device) (runtime.Broker, chan *runtime.ParseVariableResult, error) {
+		enabled := 0
+		for _, v := range object.(*modbus.ModBusDevice).Variables {
+			if !v.Disabled {
+				enabled++
+			}
+		}
+		if enabled == 0 {
+			return nil, nil, constant.ErrDeviceEmptyVariable
+		}
+		b := &fakeBroker{device: object, results: make(chan *runtime.ParseVariableResult)}
+		brokers.Store(object.GetID(), b)
+		return b, b.results, nil
+	}
+	t.Cleanup(func() { generic.DeviceTypeBrokerMap["modbus"] = newBroker })
+
+	m := NewManager(store, nil, &gateway.GatewayMeta{ObjectMeta: runtime.ObjectMeta{ID: "gateway"}}, stopCh, opts...)
+	m.Load()
+	return m, brokers
+}
+
+// testManifest the manifest of one modbus device collected in cycle
+func testManifest(t *testing.T, cycle uint) []v1.DeviceType {
+	devices, err := ParseManifest([]byte(fmt.Sprintf(`
+devices:
+  - deviceType: modbus
+    deviceCode: pm-1
+    name: meter 1
+    deviceModel: modbusTcp
+    collectorCycle: %d
+    address:
+      location: 10.0.0.11
+      option:
+        port: 502
+    slave: 1
+    memoryLayout: ABCD
+    variables:
+      - name: current
+        dataType: float32
+        address: 0
+        functionCode: 3
+        accessMode: r
+      - name: voltage
+        dataType: float32
+        address: 2
+        functionCode: 3
+        accessMode: r
+`, cycle)))
+	if err != nil {
+		t.Fatalf("ParseManifest() = %v", err)
+	}
+	return devices
+}
+
+func TestApplyManifestRecollect(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	if len(devices) != 1 {
+		t.Fatalf("expected device created by manifest, got %d", len(devices))
+	}
+	id := devices[0].GetID()
+
+	// the device collected before the manifest is applied collects the definition of manifest
+	changes, err := m.ApplyManifest(testManifest(t, 9), &ManifestOptions{Mode: ManifestModeMerge})
+	if err != nil || len(changes) != 1 || changes[0].Result != ImportResultSuccess {
+		t.Fatalf("ApplyManifest() = %v, %v", changes, err)
+	}
+	b, ok := brokers.Load(id)
+	if !ok {
+		t.Fatalf("expected device collected")
+	}
+	if cycle := b.(*fakeBroker).device.(*modbus.ModBusDevice).CollectorCycle; cycle != 9 {
+		t.Errorf("expected running broker collecting cycle 9 of manifest, got %d", cycle)
+	}
+
+	// the device stopped is left alone
+	d, _ := m.GetDeviceById(id, false)
+	_ = m.cancelCollect(d)
+	brokers.Delete(id)
+	if _, err := m.ApplyManifest(testManifest(t, 7), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	if _, ok := brokers.Load(id); ok || m.collecting(id) {
+		t.Errorf("expected stopped device not collected")
+	}
+}
+
+// fakeRouter records the published points
+type fakeRouter struct {
+	published chan []runtime.PointData
+}
+
+func (r *fakeRouter) Route(device runtime.Device, data *runtime.PublishData) {
+	r.published <- data.Payload.Data[0].Values
+}
+
+func (r *fakeRouter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// fakeObserver records the observed points
+type fakeObserver struct {
+	observed [][]runtime.PointData
+}
+
+func (o *fakeObserver) Observe(device runtime.Device, timestamp time.Time, values []runtime.PointData) {
+	o.observed = append(o.observed, values)
+}
+
+func TestCollectBadQuality(t *testing.T) {
+	router := &fakeRouter{published: make(chan []runtime.PointData, 1)}
+	observer := &fakeObserver{}
+	m, brokers := newTestManager(t, WithRouter(router), WithObserver(observer))
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	id := devices[0].GetID()
+	b, _ := brokers.Load(id)
+	collect := func(vvs ...runtime.VariableValue) []runtime.PointData {
+		b.(*fakeBroker).results <- &runtime.ParseVariableResult{VariableSlice: vvs}
+		published := <-router.published
+		// the empty result is received after the collected values are handled
+		b.(*fakeBroker).results <- &runtime.ParseVariableResult{}
+		return published
+	}
+	now := time.Now()
+
+	// the bad point is published but not observed
+	published := collect(
+		&modbus.Variable{Name: "current", Value: 1.5, ValueQuality: runtime.GoodQuality(now)},
+		&modbus.Variable{Name: "voltage", ValueQuality: runtime.BadQuality(runtime.ReasonCommFailure, now)},
+	)
+	if len(published) != 2 {
+		t.Fatalf("expected good and bad points published, got %v", published)
+	}
+	if len(observer.observed) != 1 || len(observer.observed[0]) != 1 || observer.observed[0][0].DataPointId != "current" {
+		t.Fatalf("expected good point observed only, got %v", observer.observed)
+	}
+	if _, ok := m.latestPoint(id, "voltage"); ok {
+		t.Errorf("expected bad point not kept as latest")
+	}
+
+	// the last value is published as stale, the latest keeps the last good point
+	published = collect(&modbus.Variable{Name: "current", ValueQuality: runtime.BadQuality(runtime.ReasonCommFailure, now)})
+	if len(published) != 1 || published[0].Reason != runtime.ReasonStale || published[0].Value != 1.5 {
+		t.Fatalf("expected stale point published, got %v", published)
+	}
+	if len(observer.observed) != 1 {
+		t.Errorf("expected stale point not observed, got %v", observer.observed)
+	}
+	if last, ok := m.latestPoint(id, "current"); !ok || last.Quality != runtime.QualityGood {
+		t.Errorf("expected last good point kept as latest, got %v", last)
+	}
+}
+
+func TestApplyVariablesStopped(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	id := devices[0].GetID()
+
+	// the device collecting is restarted with the disabled variable
+	updated, err := m.SetVariableDisabled(id, devices[0].GetVersion(), "voltage", true)
+	if err != nil {
+		t.Fatalf("SetVariableDisabled() = %v", err)
+	}
+	b, _ := brokers.Load(id)
+	if v, _ := b.(*fakeBroker).device.GetVariable("voltage"); !runtime.IsDisabled(v) {
+		t.Errorf("expected running broker collecting without disabled variable")
+	}
+
+	// the device stopped by operator is left alone
+	_ = m.cancelCollect(updated)
+	brokers.Delete(id)
+	updated, err = m.SetVariableDisabled(id, updated.GetVersion(), "voltage", false)
+	if err != nil {
+		t.Fatalf("SetVariableDisabled() = %v", err)
+	}
+	if _, ok := brokers.Load(id); ok || m.collecting(id) {
+		t.Errorf("expected stopped device not collected")
+	}
+	if status := updated.GetCollectStatus(); status != runtime.CollectStatusToString[runtime.Stopped] {
+		t.Errorf("expected device stopped, got %s", status)
+	}
+}
+
+func TestApplyVariablesEmpty(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	id := devices[0].GetID()
+	emptyVariable := runtime.CollectStatusToString[runtime.EmptyVariable]
+
+	// the device without enabled variable waits for variables
+	updated, err := m.SetVariableDisabled(id, devices[0].GetVersion(), "voltage", true)
+	if err == nil {
+		updated, err = m.SetVariableDisabled(id, updated.GetVersion(), "current", true)
+	}
+	if err != nil {
+		t.Fatalf("SetVariableDisabled() = %v", err)
+	}
+	if m.collecting(id) || updated.GetCollectStatus() != emptyVariable {
+		t.Fatalf("expected device waiting for variables, got %s", updated.GetCollectStatus())
+	}
+
+	// the device is collected once a variable is enabled again
+	brokers.Delete(id)
+	if updated, err = m.SetVariableDisabled(id, updated.GetVersion(), "current", false); err != nil {
+		t.Fatalf("SetVariableDisabled() = %v", err)
+	}
+	b, ok := brokers.Load(id)
+	if !ok || !m.collecting(id) {
+		t.Fatalf("expected device collected after variable enabled")
+	}
+	if v, _ := b.(*fakeBroker).device.GetVariable("current"); runtime.IsDisabled(v) {
+		t.Errorf("expected running broker collecting enabled variable")
+	}
+
+	// the variable added to device without enabled variable is collected
+	_, _ = m.SetVariableDisabled(id, updated.GetVersion(), "current", true)
+	d, _ := m.GetDeviceById(id, false)
+	if d.GetCollectStatus() != emptyVariable {
+		t.Fatalf("expected device waiting for variables, got %s", d.GetCollectStatus())
+	}
+	brokers.Delete(id)
+	variable := map[string]interface{}{"name": "power", "dataType": "float32", "address": 4, "functionCode": 3, "accessMode": "r"}
+	if _, err = m.CreateVariable(id, d.GetVersion(), variable); err != nil {
+		t.Fatalf("CreateVariable() = %v", err)
+	}
+	if b, ok = brokers.Load(id); !ok || !m.collecting(id) {
+		t.Fatalf("expected device collected after variable added")
+	}
+	if _, exist := b.(*fakeBroker).device.GetVariable("power"); !exist {
+		t.Errorf("expected running broker collecting added variable")
+	}
+}
+
+func TestRollbackDeviceStopped(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	if _, err := m.ApplyManifest(testManifest(t, 9), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	id := devices[0].GetID()
+	revisions, _ := m.ListRevisions(id)
+	first := revisions[len(revisions)-1].Revision
+
+	// the device stopped by operator is left alone
+	_ = m.cancelCollect(devices[0])
+	brokers.Delete(id)
+	updated, err := m.RollbackDevice(id, devices[0].GetVersion(), first)
+	if err != nil {
+		t.Fatalf("RollbackDevice() = %v", err)
+	}
+	if _, ok := brokers.Load(id); ok || m.collecting(id) {
+		t.Errorf("expected stopped device not collected after rollback")
+	}
+	if cycle := updated.(*modbus.ModBusDevice).CollectorCycle; cycle != 5 {
+		t.Errorf("expected device rolled back to cycle 5, got %d", cycle)
+	}
+}
+
+func TestImportDevicesRecollect(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ImportDevices(modbusRows[:3], &ImportOptions{Mode: ImportModeCreate}); err != nil {
+		t.Fatalf("ImportDevices() = %v", err)
+	}
+	rows := [][]string{modbusRows[0], append([]string{}, modbusRows[1]...), modbusRows[2]}
+	rows[1][4] = "9"
+	results, err := m.ImportDevices(rows, &ImportOptions{Mode: ImportModeUpsert})
+	if err != nil || results[0].Operation != ImportOperationUpdate || results[0].Result != ImportResultSuccess {
+		t.Fatalf("ImportDevices() = %v, %v", results, err)
+	}
+	b, _ := brokers.Load(results[0].DeviceId)
+	if cycle := b.(*fakeBroker).device.(*modbus.ModBusDevice).CollectorCycle; cycle != 9 {
+		t.Errorf("expected running broker collecting imported cycle 9, got %d", cycle)
+	}
+}
+
+func TestImportDevicesDryRunValidation(t *testing.T) {
+	m, _ := newTestManager(t)
+	if _, err := m.ImportDevices(modbusRows[:3], &ImportOptions{Mode: ImportModeCreate}); err != nil {
+		t.Fatalf("ImportDevices() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	version := devices[0].GetVersion()
+
+	header := append(append([]string{}, modbusRows[0]...), "variable.transform.fromUnit", "group")
+	rows := [][]string{
+		header,
+		// the unit is validated when updating device only
+		append(append([]string{}, modbusRows[1]...), "furlong", ""),
+		append(append([]string{}, modbusRows[2]...), "", ""),
+		// the group is validated when creating device only
+		append(append([]string{}, modbusRows[4]...), "", "plant-a//line-3"),
+	}
+	_, err := m.ImportDevices(rows, &ImportOptions{Mode: ImportModeUpsert, DryRun: true})
+	errs, ok := err.(*response.MultiError)
+	if !ok || errs.Len() != 2 {
+		t.Fatalf("expected invalid unit and group reported by dry run, got %v", err)
+	}
+	if d, _ := m.GetDeviceById(devices[0].GetID(), false); d.GetVersion() != version {
+		t.Errorf("expected device unchanged by dry run")
+	}
+}
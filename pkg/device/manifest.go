@@ -0,0 +1,221 @@
+package device
+
+import (
+	"encoding/json"
+	"fmt"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"sigs.k8s.io/yaml"
+	"sort"
+)
+
+const (
+	// ManifestModeMerge create and update the devices of manifest, the other devices are kept
+	ManifestModeMerge = "merge"
+	// ManifestModeReplace the devices are exactly the devices of manifest, the other devices are deleted
+	ManifestModeReplace = "replace"
+
+	ManifestOperationCreate    = "create"
+	ManifestOperationUpdate    = "update"
+	ManifestOperationDelete    = "delete"
+	ManifestOperationUnchanged = "unchanged"
+)
+
+// Manifest the devices declared for provisioning, in YAML or JSON
+type Manifest struct {
+	Devices []map[string]interface{} `json:"devices"` // 设备, 与创建设备的参数相同
+}
+
+// ManifestOptions the mode of applying manifest
+type ManifestOptions struct {
+	Mode   string
+	DryRun bool
+	// Source the manifest file, recorded in the revisions of devices
+	Source string
+}
+
+// ManifestChange the planned or applied change of one device
+type ManifestChange struct {
+	DeviceCode string `json:"deviceCode"`
+	DeviceType string `json:"deviceType"`
+	DeviceId   string `json:"deviceId,omitempty"`
+	Operation  string `json:"operation"` // create、update、delete、unchanged
+	Result     string `json:"result"`    // success、failure 试运行时为空
+	Error      string `json:"error,omitempty"`
+}
+
+type manifestDevice struct {
+	code     string
+	device   v1.DeviceType
+	existing runtime.Device
+}
+
+// LoadManifest read the manifest file and validate the fields of devices, see ParseManifest
+func LoadManifest(path string) ([]v1.DeviceType, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifest(data)
+}
+
+// ParseManifest parse the manifest in YAML or JSON, the device codes are required and unique. The errors of all
+// devices are returned at once, the devices are validated as a whole when applied.
+func ParseManifest(data []byte) ([]v1.DeviceType, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, err
+	}
+
+	errs := &response.MultiError{}
+	devices := make([]v1.DeviceType, 0, len(manifest.Devices))
+	seen := make(map[string]int)
+	for i, object := range manifest.Devices {
+		code, _ := object["deviceCode"].(string)
+		if len(code) == 0 {
+			errs.Add(fmt.Errorf("devices[%d]: deviceCode is required", i))
+			continue
+		}
+		if first, ok := seen[code]; ok {
+			errs.Add(fmt.Errorf("devices[%d]: device code %s is used by devices[%d]", i, code, first))
+			continue
+		}
+		seen[code] = i
+		deviceType, _ := object["deviceType"].(string)
+		if _, ok := generic.DeviceTypeMap[deviceType]; !ok {
+			errs.Add(fmt.Errorf("devices[%d]: unsupported device type %s", i, deviceType))
+			continue
+		}
+		d, err := newObject(object)
+		if err != nil {
+			errs.Add(fmt.Errorf("devices[%d]: %v", i, err))
+			continue
+		}
+		devices = append(devices, d)
+	}
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+	return devices, nil
+}
+
+// ApplyManifest reconcile the devices against the manifest by device code. All changes are planned and validated like
+// creating or updating the devices before any device is changed, and the devices conflicted with manifest or invalid
+// are returned as errors at once.
+func (m *Manager) ApplyManifest(devices []v1.DeviceType, opts *ManifestOptions) ([]*ManifestChange, error) {
+	if opts.Mode != ManifestModeMerge && opts.Mode != ManifestModeReplace {
+		return nil, fmt.Errorf("unsupported manifest mode %s, must be one of %s, %s", opts.Mode, ManifestModeMerge, ManifestModeReplace)
+	}
+	existing := make(map[string][]runtime.Device)
+	m.devices.Range(func(key, value any) bool {
+		d := value.(runtime.Device)
+		existing[d.GetDeviceCode()] = append(existing[d.GetDeviceCode()], d)
+		return true
+	})
+
+	errs := &response.MultiError{}
+	planned := make([]*manifestDevice, 0, len(devices))
+	changes := make([]*ManifestChange, 0, len(devices))
+	declared := make(map[string]bool, len(devices))
+	for _, object := range devices {
+		md := &manifestDevice{code: object.GetDeviceCode(), device: object}
+		change := &ManifestChange{DeviceCode: md.code, DeviceType: object.GetDeviceType(), Operation: ManifestOperationCreate}
+		declared[md.code] = true
+		if found := existing[md.code]; len(found) > 0 {
+			switch {
+			case len(found) > 1:
+				errs.Add(fmt.Errorf("device code %s is used by %d devices", md.code, len(found)))
+				continue
+			case found[0].GetDeviceType() != object.GetDeviceType():
+				errs.Add(fmt.Errorf("device type of %s can not be changed from %s", md.code, found[0].GetDeviceType()))
+				continue
+			}
+			md.existing = found[0]
+			change.DeviceId = found[0].GetID()
+			change.Operation = ManifestOperationUpdate
+			if current, err := m.toObject(found[0]); err == nil && objectEqual(current, object) {
+				change.Operation = ManifestOperationUnchanged
+			}
+		}
+		if change.Operation != ManifestOperationUnchanged {
+			if _, _, err := m.buildDevice(object, md.existing); err != nil {
+				errs.Add(fmt.Errorf("device %s: %v", md.code, err))
+				continue
+			}
+		}
+		planned = append(planned, md)
+		changes = append(changes, change)
+	}
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+
+	if opts.Mode == ManifestModeReplace {
+		removed := make([]runtime.Device, 0)
+		for code, found := range existing {
+			if !declared[code] {
+				removed = append(removed, found...)
+			}
+		}
+		sort.Slice(removed, func(i, j int) bool {
+			if removed[i].GetDeviceCode() != removed[j].GetDeviceCode() {
+				return removed[i].GetDeviceCode() < removed[j].GetDeviceCode()
+			}
+			return removed[i].GetID() < removed[j].GetID()
+		})
+		for _, d := range removed {
+			planned = append(planned, &manifestDevice{code: d.GetDeviceCode(), existing: d})
+			changes = append(changes, &ManifestChange{
+				DeviceCode: d.GetDeviceCode(),
+				DeviceType: d.GetDeviceType(),
+				DeviceId:   d.GetID(),
+				Operation:  ManifestOperationDelete,
+			})
+		}
+	}
+	if opts.DryRun {
+		return changes, nil
+	}
+
+	author := revision.WithAuthor(revision.SourceManifest, opts.Source)
+	for i, md := range planned {
+		change := changes[i]
+		change.Result = ImportResultSuccess
+		var err error
+		switch change.Operation {
+		case ManifestOperationCreate:
+			var created runtime.Device
+			if created, err = m.CreateDevice(md.device, author); err == nil {
+				change.DeviceId = created.GetID()
+			}
+		case ManifestOperationUpdate:
+			var current runtime.Device
+			if current, err = m.GetDeviceById(md.existing.GetID(), false); err == nil {
+				var updated runtime.Device
+				if updated, err = m.UpdateDeviceById(current.GetID(), current.GetVersion(), md.device, author); err == nil {
+					m.recollect(updated)
+				}
+			}
+		case ManifestOperationDelete:
+			var current runtime.Device
+			if current, err = m.GetDeviceById(md.existing.GetID(), false); err == nil {
+				_, err = m.DeleteDevice(current.GetID(), current.GetVersion())
+			}
+		}
+		if err != nil {
+			klog.V(2).InfoS("Failed to apply device of manifest", "deviceCode", md.code, "operation", change.Operation, "err", err)
+			change.Result = ImportResultFailure
+			change.Error = err.Error()
+		}
+	}
+	return changes, nil
+}
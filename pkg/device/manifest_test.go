@@ -0,0 +1,116 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	manifest := `
+devices:
+  - deviceType: modbus
+    deviceCode: pm-1
+    name: meter 1
+    deviceModel: PM800
+    collectorCycle: 5
+    address:
+      location: 10.0.0.11
+      option:
+        port: 502
+    slave: 1
+    memoryLayout: ABCD
+    variables:
+      - name: current
+        dataType: float32
+        address: 0
+        functionCode: 3
+        accessMode: r
+`
+	devices, err := ParseManifest([]byte(manifest))
+	if err != nil {
+		t.Fatalf("ParseManifest() = %v", err)
+	}
+	d, ok := devices[0].(*v1.ModBusDevice)
+	if len(devices) != 1 || !ok || d.GetDeviceCode() != "pm-1" || d.Address.Option.Port != 502 || len(d.Variables) != 1 {
+		t.Fatalf("unexpected devices %+v", devices)
+	}
+
+	_, err = ParseManifest([]byte(`{"devices": [{"deviceType": "bacnet", "deviceCode": "x"}, {"deviceType": "modbus"}, {"deviceType": "modbus", "deviceCode": "x"}]}`))
+	errs, ok := err.(*response.MultiError)
+	if !ok || errs.Len() != 3 {
+		t.Fatalf("ParseManifest() = %v", err)
+	}
+	expected := []string{"devices[0]: unsupported device type bacnet", "devices[1]: deviceCode is required", "devices[2]: device code x is used by devices[0]"}
+	for i, err := range errs.Errors() {
+		if !strings.HasPrefix(err.Error(), expected[i]) {
+			t.Errorf("error %d = %s, want %s", i, err, expected[i])
+		}
+	}
+}
+
+func TestApplyManifestInvalid(t *testing.T) {
+	m, _ := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	version := devices[0].GetVersion()
+
+	// the unit of variable is validated when updating device only
+	manifest, err := ParseManifest([]byte(`
+devices:
+  - deviceType: modbus
+    deviceCode: pm-2
+    name: meter 2
+    deviceModel: modbusTcp
+    collectorCycle: 5
+    address:
+      location: 10.0.0.12
+      option:
+        port: 502
+    slave: 2
+    memoryLayout: ABCD
+    variables:
+      - name: current
+        dataType: float32
+        address: 0
+        functionCode: 3
+        accessMode: r
+  - deviceType: modbus
+    deviceCode: pm-1
+    name: meter 1
+    deviceModel: modbusTcp
+    collectorCycle: 9
+    address:
+      location: 10.0.0.11
+      option:
+        port: 502
+    slave: 1
+    memoryLayout: ABCD
+    variables:
+      - name: current
+        dataType: float32
+        address: 0
+        functionCode: 3
+        accessMode: r
+        transform:
+          fromUnit: furlong
+`))
+	if err != nil {
+		t.Fatalf("ParseManifest() = %v", err)
+	}
+	for _, dryRun := range []bool{true, false} {
+		_, err = m.ApplyManifest(manifest, &ManifestOptions{Mode: ManifestModeMerge, DryRun: dryRun})
+		errs, ok := err.(*response.MultiError)
+		if !ok || errs.Len() != 1 || !strings.Contains(errs.Error(), "pm-1") {
+			t.Fatalf("expected invalid variable of pm-1 reported, dry run %t, got %v", dryRun, err)
+		}
+	}
+	devices, _ = m.ListDevices(&runtime.DeviceFilter{}, false)
+	if len(devices) != 1 || devices[0].GetVersion() != version {
+		t.Errorf("expected devices unchanged by invalid manifest, got %d devices", len(devices))
+	}
+}
@@ -0,0 +1,79 @@
+package device
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/utils/convutil"
+)
+
+var _ prometheus.Collector = (*collector)(nil)
+
+var (
+	collectStatusDesc = prometheus.NewDesc("harnsgateway_device_collect_status",
+		"Collect status of device, the value of current status is 1.", []string{"device_id", "device_name", "device_type", "status"}, nil)
+	poolSizeDesc = prometheus.NewDesc("harnsgateway_messenger_pool_size",
+		"Size of the messenger pool of device.", []string{"device_id"}, nil)
+	poolIdleDesc = prometheus.NewDesc("harnsgateway_messenger_pool_idle",
+		"Number of idle messengers in the pool of device.", []string{"device_id"}, nil)
+	variableValueDesc = prometheus.NewDesc("harnsgateway_variable_value",
+		"Latest value of numeric and boolean variable.", []string{"device_id", "variable"}, nil)
+)
+
+type collector struct {
+	mgr *Manager
+}
+
+// NewCollector exports the collect status and messenger pool of devices,
+// and the latest variable values if enabled by WithVariableMetrics.
+func NewCollector(mgr *Manager) prometheus.Collector {
+	return &collector{mgr: mgr}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectStatusDesc
+	ch <- poolSizeDesc
+	ch <- poolIdleDesc
+	ch <- variableValueDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.mgr.devices.Range(func(key, value any) bool {
+		d := value.(runtime.Device)
+		for _, status := range runtime.CollectStatusToString {
+			v := 0.0
+			if status == d.GetCollectStatus() {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(collectStatusDesc, prometheus.GaugeValue, v, d.GetID(), d.GetName(), d.GetDeviceType(), status)
+		}
+		return true
+	})
+
+	c.mgr.mu.Lock()
+	for id, broker := range c.mgr.brokers {
+		if p, ok := broker.(runtime.PoolStatsProvider); ok {
+			size, idle := p.PoolStats()
+			ch <- prometheus.MustNewConstMetric(poolSizeDesc, prometheus.GaugeValue, float64(size), id)
+			ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(idle), id)
+		}
+	}
+	c.mgr.mu.Unlock()
+
+	if !c.mgr.variableMetrics {
+		return
+	}
+	c.mgr.latestValues.Range(func(key, value any) bool {
+		// the series of repeated variable is exported once, otherwise the whole scrape fails
+		exported := make(map[string]struct{})
+		for _, pd := range value.([]runtime.PointData) {
+			if _, exist := exported[pd.DataPointId]; exist {
+				continue
+			}
+			if v, ok := convutil.ToFloat64(pd.Value); ok {
+				exported[pd.DataPointId] = struct{}{}
+				ch <- prometheus.MustNewConstMetric(variableValueDesc, prometheus.GaugeValue, v, key.(string), pd.DataPointId)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,40 @@
+package device
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"harnsgateway/pkg/runtime"
+	"testing"
+)
+
+func TestCollectorRepeatedVariable(t *testing.T) {
+	m, _ := newTestManager(t, WithVariableMetrics(true))
+	m.latestValues.Store("pm-1", []runtime.PointData{
+		{DataPointId: "current", Value: 1.5},
+		{DataPointId: "current", Value: 2.5},
+		{DataPointId: "voltage", Value: "unknown"},
+		{DataPointId: "voltage", Value: 220.0},
+	})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewCollector(m))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() = %v", err)
+	}
+	values := make(map[string]float64)
+	for _, family := range families {
+		if family.GetName() != "harnsgateway_variable_value" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "variable" {
+					values[label.GetValue()] = metric.GetGauge().GetValue()
+				}
+			}
+		}
+	}
+	if len(values) != 2 || values["current"] != 1.5 || values["voltage"] != 220 {
+		t.Errorf("expected first numeric value of each variable exported, got %v", values)
+	}
+}
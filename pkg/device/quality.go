@@ -0,0 +1,98 @@
+package device
+
+import (
+	"harnsgateway/pkg/runtime"
+	"time"
+)
+
+// pointData convert the collected variable to point with quality. The value failed to collect is replaced by
+// the last collected value as stale within staleTimeout, and the value clamped by transform is out of range.
+func (m *Manager) pointData(device runtime.Device, value runtime.VariableValue, now time.Time) runtime.PointData {
+	pd := runtime.PointData{DataPointId: value.GetVariableName(), ValueQuality: runtime.GoodQuality(now)}
+	if q, ok := value.(runtime.Qualifier); ok && len(q.GetQuality().Quality) > 0 {
+		pd.ValueQuality = q.GetQuality()
+	}
+
+	if pd.Quality == runtime.QualityBad {
+		if pd.Reason != runtime.ReasonCommFailure {
+			return pd
+		}
+		last, ok := m.latestPoint(device.GetID(), pd.DataPointId)
+		if !ok || last.Value == nil || last.Quality == runtime.QualityBad {
+			return pd
+		}
+		if timestamp, err := runtime.ParseTimestamp(last.SourceTimestamp); err != nil || now.Sub(timestamp) > staleTimeout {
+			return pd
+		}
+		pd.Value = last.Value
+		pd.ValueQuality = runtime.ValueQuality{Quality: runtime.QualityUncertain, Reason: runtime.ReasonStale, SourceTimestamp: last.SourceTimestamp}
+		setVariableQuality(device, pd)
+		return pd
+	}
+
+	v, clamped := m.transformValue(device, value)
+	pd.Value = v
+	if clamped && pd.Quality == runtime.QualityGood {
+		pd.Quality = runtime.QualityUncertain
+		pd.Reason = runtime.ReasonOutOfRange
+		setVariableQuality(device, pd)
+	}
+	return pd
+}
+
+// setVariableQuality keep the quality in the variable of device, shown in the device view
+func setVariableQuality(device runtime.Device, pd runtime.PointData) {
+	vv, exist := device.GetVariable(pd.DataPointId)
+	if !exist {
+		return
+	}
+	if q, ok := vv.(runtime.Qualifier); ok {
+		q.SetQuality(pd.ValueQuality)
+	}
+}
+
+// fillQuality the points computed by gateway, e.g. virtual variables and the points of scripts, are good at now
+func fillQuality(pds []runtime.PointData, now time.Time) {
+	for i := range pds {
+		if len(pds[i].Quality) == 0 {
+			pds[i].ValueQuality = runtime.GoodQuality(now)
+		}
+	}
+}
+
+// usable whether the point is fed to virtual variables, aggregators, rules and alarms, the bad and stale points are
+// published only
+func usable(pd runtime.PointData) bool {
+	return pd.Quality != runtime.QualityBad && pd.Reason != runtime.ReasonStale
+}
+
+// splitUsable split the points into the usable points and the others
+func splitUsable(pds []runtime.PointData) ([]runtime.PointData, []runtime.PointData) {
+	good := make([]runtime.PointData, 0, len(pds))
+	others := make([]runtime.PointData, 0)
+	for _, pd := range pds {
+		if usable(pd) {
+			good = append(good, pd)
+		} else {
+			others = append(others, pd)
+		}
+	}
+	return good, others
+}
+
+// mergeLatest the latest usable points of device, the variables failed to collect keep their last usable points
+// within staleTimeout
+func (m *Manager) mergeLatest(deviceId string, now time.Time, good []runtime.PointData, others []runtime.PointData) []runtime.PointData {
+	latest := make([]runtime.PointData, 0, len(good)+len(others))
+	latest = append(latest, good...)
+	for _, pd := range others {
+		last, ok := m.latestPoint(deviceId, pd.DataPointId)
+		if !ok {
+			continue
+		}
+		if timestamp, err := runtime.ParseTimestamp(last.SourceTimestamp); err == nil && now.Sub(timestamp) <= staleTimeout {
+			latest = append(latest, last)
+		}
+	}
+	return latest
+}
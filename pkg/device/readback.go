@@ -0,0 +1,78 @@
+package device
+
+import (
+	"context"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/utils/convutil"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"math"
+	"reflect"
+	"time"
+)
+
+const readbackInterval = 100 * time.Millisecond
+
+// GetLatestValue the latest collected value of variable, including the virtual variables
+func (m *Manager) GetLatestValue(id string, name string) (interface{}, bool) {
+	return m.latestValue(id, name)
+}
+
+// VerifyAction waits until the values of device collected after since equal the written values within tolerance,
+// the first mismatched variable is returned when ctx is done.
+func (m *Manager) VerifyAction(ctx context.Context, id string, values map[string]interface{}, tolerance float64, since time.Time) error {
+	actual, mismatched := m.readback(ctx, id, values, tolerance, since)
+	if mismatched.Len() == 0 {
+		return nil
+	}
+	name := mismatched.List()[0]
+	return response.ErrReadbackMismatch(name, values[name], actual[name])
+}
+
+// readback polls the collected values until all values collected after since equal the expected values within
+// tolerance or ctx is done, the values collected before since are mismatched. The latest collected values and the
+// mismatched variables are returned.
+func (m *Manager) readback(ctx context.Context, id string, values map[string]interface{}, tolerance float64, since time.Time) (map[string]interface{}, sets.String) {
+	// the timestamps of points are in milliseconds
+	since = since.Truncate(time.Millisecond)
+	ticker := time.NewTicker(readbackInterval)
+	defer ticker.Stop()
+	for {
+		actual := make(map[string]interface{}, len(values))
+		mismatched := sets.NewString()
+		for name, expected := range values {
+			pd, ok := m.latestPoint(id, name)
+			actual[name] = pd.Value
+			if !ok || !collectedSince(pd, since) || !valueEqual(expected, pd.Value, tolerance) {
+				mismatched.Insert(name)
+			}
+		}
+		if mismatched.Len() == 0 {
+			return actual, mismatched
+		}
+		select {
+		case <-ctx.Done():
+			return actual, mismatched
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectedSince whether the point is collected at or after since
+func collectedSince(pd runtime.PointData, since time.Time) bool {
+	timestamp, err := runtime.ParseTimestamp(pd.SourceTimestamp)
+	return err == nil && !timestamp.Before(since)
+}
+
+// valueEqual compare the numeric values within tolerance, the others must be equal
+func valueEqual(expected interface{}, actual interface{}, tolerance float64) bool {
+	if actual == nil {
+		return expected == nil
+	}
+	e, ok1 := convutil.ToFloat64(expected)
+	a, ok2 := convutil.ToFloat64(actual)
+	if ok1 && ok2 {
+		return math.Abs(e-a) <= tolerance
+	}
+	return reflect.DeepEqual(expected, actual)
+}
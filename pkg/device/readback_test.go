@@ -0,0 +1,32 @@
+package device
+
+import (
+	"context"
+	"harnsgateway/pkg/runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadbackAfterWritten(t *testing.T) {
+	m := &Manager{latestValues: &sync.Map{}}
+	written := time.Now()
+	// the value collected before written equals the written value
+	m.latestValues.Store("1", []runtime.PointData{{DataPointId: "setpoint", Value: 20.0, ValueQuality: runtime.GoodQuality(written.Add(-time.Second))}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*readbackInterval)
+	defer cancel()
+	if _, mismatched := m.readback(ctx, "1", map[string]interface{}{"setpoint": 20.0}, 0, written); !mismatched.Has("setpoint") {
+		t.Fatalf("expected value collected before written mismatched")
+	}
+
+	go func() {
+		time.Sleep(readbackInterval)
+		m.latestValues.Store("1", []runtime.PointData{{DataPointId: "setpoint", Value: 20.0, ValueQuality: runtime.GoodQuality(time.Now())}})
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*readbackInterval)
+	defer cancel()
+	if err := m.VerifyAction(ctx, "1", map[string]interface{}{"setpoint": 20.0}, 0, written); err != nil {
+		t.Fatalf("expected value collected after written matched, got %v", err)
+	}
+}
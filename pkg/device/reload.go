@@ -0,0 +1,306 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin/binding"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileRejection the device file edited on disk but refused, the device keeps its former configuration
+type FileRejection struct {
+	File      string    `json:"file"`
+	DeviceId  string    `json:"deviceId"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// fileReloader track the device files, the files written by gateway are recognized by the hash of their content
+type fileReloader struct {
+	mu         *sync.Mutex
+	dir        string
+	watcher    *fsnotify.Watcher
+	hashes     map[string][sha256.Size]byte
+	timers     map[string]*time.Timer
+	rejections map[string]*FileRejection
+}
+
+// startFileReload watch the device files edited on disk, only the files of fs storage backend can be edited
+func (m *Manager) startFileReload() {
+	if storage.Backend() != storage.BackendFs {
+		klog.V(2).InfoS("Skipped to reload device files", "backend", storage.Backend())
+		return
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.V(1).InfoS("Failed to watch device files", "err", err)
+		return
+	}
+	m.files = &fileReloader{
+		mu:         &sync.Mutex{},
+		dir:        filepath.Join(storage.Path(), m.store.Group, m.store.Resource),
+		watcher:    watcher,
+		hashes:     make(map[string][sha256.Size]byte),
+		timers:     make(map[string]*time.Timer),
+		rejections: make(map[string]*FileRejection),
+	}
+	m.files.resync()
+	go m.reloadFiles()
+}
+
+func (m *Manager) reloadFiles() {
+	defer m.files.watcher.Close()
+	written, _ := m.store.Watch(m.stopCh, "")
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case e, ok := <-written:
+			if !ok {
+				// the store is replaced or the changes are too many to keep up, read the files again
+				m.files.resync()
+				written, _ = m.store.Watch(m.stopCh, "")
+				continue
+			}
+			if e.Type != storage.Remove {
+				m.files.written(filepath.Base(e.Key), e.Data.([]byte))
+			}
+		case event, ok := <-m.files.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			name := filepath.Base(event.Name)
+			if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+				continue
+			}
+			// the file is usually written in several steps by editor or copy
+			m.files.debounce(name, func() {
+				m.reconcileFile(name)
+			})
+		case err, ok := <-m.files.watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.V(2).InfoS("Failed to watch device files", "err", err)
+		}
+	}
+}
+
+// reconcileFile create, update or remove the device by its file, the invalid file is rejected
+func (m *Manager) reconcileFile(name string) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return
+	}
+	deviceType, id := name[:i], name[i+1:]
+	data, err := os.ReadFile(filepath.Join(m.files.dir, name))
+	if os.IsNotExist(err) {
+		m.files.forget(name)
+		if v, ok := m.devices.Load(id); ok && v.(runtime.Device).GetDeviceType() == deviceType {
+			// the device is marshaled before its status is changed by stopping
+			removed, err := json.Marshal(v)
+			m.removeDevice(v.(runtime.Device))
+			if err == nil {
+				m.store.Notify(storage.Remove, name, removed)
+			}
+			klog.V(1).InfoS("Removed device of deleted file", "file", name, "deviceId", id)
+		}
+		return
+	} else if err != nil {
+		klog.V(2).InfoS("Failed to read device file", "file", name, "err", err)
+		return
+	}
+	if m.files.unchanged(name, data) {
+		return
+	}
+
+	d, cvs, err := m.validateFile(deviceType, id, name, data)
+	if err != nil {
+		m.files.reject(name, id, err)
+		klog.V(1).InfoS("Rejected device file", "file", name, "err", err)
+		return
+	}
+	m.files.written(name, data)
+
+	previous, exist := m.devices.Load(id)
+	if exist {
+		// the collect status of file may be stale, the device is collected as before
+		d.SetCollectStatus(previous.(runtime.Device).GetCollectStatus())
+	}
+	if len(d.GetVersion()) == 0 {
+		// the version is required to update by API, the watchers are notified by store
+		if _, err := m.store.Update(d); err != nil {
+			m.files.reject(name, id, err)
+			klog.V(1).InfoS("Rejected device file", "file", name, "err", err)
+			return
+		}
+	} else if exist {
+		m.store.Notify(storage.Update, name, data)
+	} else {
+		m.store.Notify(storage.Create, name, data)
+	}
+	d.IndexDevice()
+	rd, _ := runtime.AccessorDevice(d)
+	m.devices.Store(id, rd)
+	if len(cvs) > 0 {
+		m.virtuals.Store(id, cvs)
+	} else {
+		m.virtuals.Delete(id)
+	}
+	m.setAggregator(rd)
+	operation := revision.OperationCreate
+	if exist {
+		operation = revision.OperationUpdate
+	}
+	m.recordRevision(rd, operation, revision.WithAuthor(revision.SourceFile, name))
+	if exist {
+		m.recollect(rd)
+	} else {
+		m.restartCollect(rd)
+	}
+	klog.V(1).InfoS("Reloaded device file", "file", name, "deviceId", id, "operation", operation)
+}
+
+// validateFile validate the device of file like creating device by API
+func (m *Manager) validateFile(deviceType string, id string, name string, data []byte) (runtime.Device, []*virtualVariable, error) {
+	d, err := m.store.Decode(name, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.GetID() != id || d.GetDeviceType() != deviceType {
+		return nil, nil, fmt.Errorf("id %q and deviceType %q mismatch the file name", d.GetID(), d.GetDeviceType())
+	}
+	if v, ok := m.devices.Load(id); ok && v.(runtime.Device).GetDeviceType() != deviceType {
+		return nil, nil, fmt.Errorf("id %q is used by device of type %q", id, v.(runtime.Device).GetDeviceType())
+	}
+	object, err := m.toObject(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := binding.Validator.ValidateStruct(object); err != nil {
+		return nil, nil, err
+	}
+	if err := m.deviceManager[deviceType].UpdateValidation(object, d); err != nil {
+		return nil, nil, err
+	}
+	if err := validateLabels(d); err != nil {
+		return nil, nil, err
+	}
+	cvs, err := m.compileVirtualVariables(d)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := validateAggregations(d); err != nil {
+		return nil, nil, err
+	}
+	return d, cvs, nil
+}
+
+// ListFileRejections the device files refused, sorted by file name
+func (m *Manager) ListFileRejections() []*FileRejection {
+	result := make([]*FileRejection, 0)
+	if m.files == nil {
+		return result
+	}
+	m.files.mu.Lock()
+	defer m.files.mu.Unlock()
+	for _, r := range m.files.rejections {
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].File < result[j].File
+	})
+	return result
+}
+
+// resync watch the directory again and take the files as unchanged, e.g. after the directory is replaced by restoring
+func (r *fileReloader) resync() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_ = r.watcher.Remove(r.dir)
+	if err := r.watcher.Add(r.dir); err != nil {
+		klog.V(1).InfoS("Failed to watch device files", "dir", r.dir, "err", err)
+	}
+	r.hashes = make(map[string][sha256.Size]byte)
+	r.rejections = make(map[string]*FileRejection)
+	entries, _ := os.ReadDir(r.dir)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(r.dir, entry.Name())); err == nil {
+			r.hashes[entry.Name()] = sha256.Sum256(data)
+		}
+	}
+}
+
+func (r *fileReloader) debounce(name string, f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.timers[name]; ok {
+		t.Stop()
+	}
+	r.timers[name] = time.AfterFunc(fileReloadDelay, func() {
+		r.mu.Lock()
+		delete(r.timers, name)
+		r.mu.Unlock()
+		f()
+	})
+}
+
+// written take the content as the file written by gateway or accepted
+func (r *fileReloader) written(name string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hashes[name] = sha256.Sum256(data)
+	delete(r.rejections, name)
+}
+
+// unchanged the content is written by gateway or accepted, the former rejection is cleared if the file is reverted
+func (r *fileReloader) unchanged(name string, data []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if hash, ok := r.hashes[name]; ok && hash == sha256.Sum256(data) {
+		delete(r.rejections, name)
+		return true
+	}
+	return false
+}
+
+func (r *fileReloader) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.hashes, name)
+	delete(r.rejections, name)
+}
+
+func (r *fileReloader) reject(name string, id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejections[name] = &FileRejection{
+		File:      name,
+		DeviceId:  id,
+		Reason:    err.Error(),
+		Timestamp: time.Now(),
+	}
+}
@@ -0,0 +1,142 @@
+package device
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	modbus "harnsgateway/pkg/protocol/modbus/runtime"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileReloaderRejection(t *testing.T) {
+	r := &fileReloader{
+		mu:         &sync.Mutex{},
+		hashes:     make(map[string][sha256.Size]byte),
+		timers:     make(map[string]*time.Timer),
+		rejections: make(map[string]*FileRejection),
+	}
+	name := "modbus.1"
+	r.written(name, []byte("v1"))
+	if !r.unchanged(name, []byte("v1")) {
+		t.Fatalf("expected content written by gateway unchanged")
+	}
+	if r.unchanged(name, []byte("v2")) {
+		t.Fatalf("expected edited content changed")
+	}
+
+	r.reject(name, "1", errors.New("invalid"))
+	if r.rejections[name] == nil || r.rejections[name].Reason != "invalid" {
+		t.Fatalf("expected rejection, got %v", r.rejections[name])
+	}
+	// reverting the file clears the rejection
+	if !r.unchanged(name, []byte("v1")) || r.rejections[name] != nil {
+		t.Fatalf("expected rejection cleared after reverted")
+	}
+
+	r.reject(name, "1", errors.New("invalid"))
+	r.forget(name)
+	if len(r.hashes) != 0 || len(r.rejections) != 0 {
+		t.Fatalf("expected file forgotten, got %d hashes %d rejections", len(r.hashes), len(r.rejections))
+	}
+}
+
+// newTestReloader reconcile the device files of manager without watching them
+func newTestReloader(m *Manager) {
+	m.files = &fileReloader{
+		mu:         &sync.Mutex{},
+		dir:        filepath.Join(storage.Path(), m.store.Group, m.store.Resource),
+		hashes:     make(map[string][sha256.Size]byte),
+		timers:     make(map[string]*time.Timer),
+		rejections: make(map[string]*FileRejection),
+	}
+}
+
+func TestReconcileFile(t *testing.T) {
+	m, brokers := newTestManager(t)
+	if _, err := m.ApplyManifest(testManifest(t, 5), &ManifestOptions{Mode: ManifestModeMerge}); err != nil {
+		t.Fatalf("ApplyManifest() = %v", err)
+	}
+	newTestReloader(m)
+	devices, _ := m.ListDevices(&runtime.DeviceFilter{}, false)
+	id := devices[0].GetID()
+	name := "modbus." + id
+	data, err := os.ReadFile(filepath.Join(m.files.dir, name))
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	edit := func(name string, change func(object map[string]interface{})) {
+		object := make(map[string]interface{})
+		if err := json.Unmarshal(data, &object); err != nil {
+			t.Fatalf("Unmarshal() = %v", err)
+		}
+		change(object)
+		edited, _ := json.Marshal(object)
+		if err := os.WriteFile(filepath.Join(m.files.dir, name), edited, 0644); err != nil {
+			t.Fatalf("WriteFile() = %v", err)
+		}
+		m.reconcileFile(name)
+	}
+	cycleOf := func(id string) uint {
+		d, _ := m.GetDeviceById(id, true)
+		return d.(*modbus.ModBusDevice).CollectorCycle
+	}
+
+	// the device collecting is restarted with the edited file
+	edit(name, func(object map[string]interface{}) { object["collectorCycle"] = 9 })
+	b, ok := brokers.Load(id)
+	if !ok || b.(*fakeBroker).device.(*modbus.ModBusDevice).CollectorCycle != 9 || cycleOf(id) != 9 {
+		t.Fatalf("expected running broker collecting cycle 9 of file")
+	}
+
+	// the invalid file is rejected, the device keeps its former configuration
+	edit(name, func(object map[string]interface{}) {
+		object["collectorCycle"] = 7
+		object["variables"].([]interface{})[0].(map[string]interface{})["transform"] = map[string]interface{}{"fromUnit": "furlong"}
+	})
+	if rejections := m.ListFileRejections(); len(rejections) != 1 || rejections[0].DeviceId != id || cycleOf(id) != 9 {
+		t.Fatalf("expected invalid file rejected, got %v", rejections)
+	}
+
+	// the device stopped by operator is left alone
+	d, _ := m.GetDeviceById(id, true)
+	_ = m.cancelCollect(d)
+	brokers.Delete(id)
+	edit(name, func(object map[string]interface{}) { object["collectorCycle"] = 7 })
+	if _, ok := brokers.Load(id); ok || m.collecting(id) {
+		t.Errorf("expected stopped device not collected")
+	}
+	if d, _ = m.GetDeviceById(id, true); cycleOf(id) != 7 || d.GetCollectStatus() != runtime.CollectStatusToString[runtime.Stopped] {
+		t.Errorf("expected stopped device updated by file, got cycle %d status %s", cycleOf(id), d.GetCollectStatus())
+	}
+	if len(m.ListFileRejections()) != 0 {
+		t.Errorf("expected rejection cleared by valid file")
+	}
+
+	// the device of new file is created and collected
+	created := "modbus.pm-2"
+	edit(created, func(object map[string]interface{}) {
+		object["id"] = "pm-2"
+		object["deviceCode"] = "pm-2"
+	})
+	if _, ok := brokers.Load("pm-2"); !ok || !m.collecting("pm-2") {
+		t.Fatalf("expected device of new file collected")
+	}
+
+	// the device of deleted file is removed
+	if err := os.Remove(filepath.Join(m.files.dir, created)); err != nil {
+		t.Fatalf("Remove() = %v", err)
+	}
+	m.reconcileFile(created)
+	if _, err := m.GetDeviceById("pm-2", false); err == nil {
+		t.Errorf("expected device of deleted file removed")
+	}
+	if devices, _ = m.ListDevices(&runtime.DeviceFilter{}, false); len(devices) != 1 {
+		t.Errorf("expected other devices kept, got %d", len(devices))
+	}
+}
@@ -0,0 +1,100 @@
+package device
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin/binding"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"k8s.io/klog/v2"
+)
+
+// loadRevisions load the revision history, must be called before loading devices
+func (m *Manager) loadRevisions() {
+	m.revisions = revision.NewHistory(storage.StoreGroupDevice, maxRevisions)
+}
+
+// snapshotRevisions record the devices changed out of history as snapshots, e.g. created by older gateway or restored
+func (m *Manager) snapshotRevisions() {
+	m.devices.Range(func(key, value any) bool {
+		d := value.(runtime.Device)
+		if latest := m.revisions.Latest(d.GetID()); latest == nil || latest.Version != d.GetVersion() {
+			m.recordRevision(d, revision.OperationSnapshot)
+		}
+		return true
+	})
+}
+
+// recordRevision keep the device as the object of creating device
+func (m *Manager) recordRevision(device runtime.Device, operation string, opts ...revision.Option) {
+	if m.revisions == nil {
+		return
+	}
+	object, err := m.toObject(device)
+	if err != nil {
+		klog.V(2).InfoS("Failed to convert device to revision", "deviceId", device.GetID(), "err", err)
+		return
+	}
+	if _, err := m.revisions.Record(device.GetID(), device.GetVersion(), operation, object, opts...); err != nil {
+		klog.V(2).InfoS("Failed to record revision", "deviceId", device.GetID(), "err", err)
+	}
+}
+
+// ListRevisions the revisions of device without snapshots, the latest first
+func (m *Manager) ListRevisions(id string) ([]*revision.Revision, error) {
+	if _, err := m.GetDeviceById(id, false); err != nil {
+		return nil, err
+	}
+	return m.revisions.List(id), nil
+}
+
+// GetRevision the revision of device with snapshot
+func (m *Manager) GetRevision(id string, number int) (*revision.Revision, error) {
+	if _, err := m.GetDeviceById(id, false); err != nil {
+		return nil, err
+	}
+	return m.revisions.Get(id, number)
+}
+
+// DiffRevisions the changes from the revision to another, the current device is compared if to is zero
+func (m *Manager) DiffRevisions(id string, from int, to int) (*revision.Diff, error) {
+	d, err := m.GetDeviceById(id, true)
+	if err != nil {
+		return nil, err
+	}
+	current, err := m.toObject(d)
+	if err != nil {
+		return nil, err
+	}
+	return m.revisions.Diff(id, from, to, current)
+}
+
+// RollbackDevice update the device to the revision like updating device, then restart collecting the device if it
+// was collecting
+func (m *Manager) RollbackDevice(id string, version string, number int, opts ...revision.Option) (runtime.Device, error) {
+	d, err := m.GetDeviceById(id, true)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.revisions.Get(id, number)
+	if err != nil {
+		return nil, err
+	}
+	object := generic.DeviceTypeMap[d.GetDeviceType()]()
+	if err := json.Unmarshal(r.Object, object); err != nil {
+		return nil, response.ErrRevisionInvalid(number, err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(object); err != nil {
+		return nil, response.ErrRevisionInvalid(number, err.Error())
+	}
+
+	updated, err := m.UpdateDeviceById(id, version, object, append(opts, revision.WithRollback(number))...)
+	if err != nil {
+		return nil, err
+	}
+	m.recollect(updated)
+	klog.V(2).InfoS("Rolled back device", "deviceId", id, "revision", number)
+	return updated, nil
+}
@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 	"harnsgateway/pkg/apis"
 	"harnsgateway/pkg/apis/response"
 	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/revision"
 	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
 	"io"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
@@ -18,10 +21,14 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
 	group.POST("/devices", createDevice(mgr))
+	group.POST("/devices/import", importDevices(mgr))
+	group.GET("/devices/export", exportDevices(mgr))
+	group.GET("/devices/rejections", listFileRejections(mgr))
 	group.DELETE("/devices/:id", deleteDevice(mgr))
 	group.PATCH("/devices/:id", patchDeviceById(mgr))
 	group.PUT("/devices/:id", updateDeviceById(mgr))
@@ -29,6 +36,18 @@ func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
 	group.GET("/devices/:id", getDeviceById(mgr))
 	group.PUT("/devices/:id/:status", switchDeviceStatusById(mgr))
 	group.PUT("/devices/:id/action", controlDeviceById(mgr))
+	group.GET("/devices/:id/actions/history", listActionRecords(mgr))
+	group.GET("/devices/:id/revisions", listRevisions(mgr))
+	group.GET("/devices/:id/revisions/:revision", getRevision(mgr))
+	group.GET("/devices/:id/revisions/:revision/diff", diffRevisions(mgr))
+	group.POST("/devices/:id/revisions/:revision/rollback", rollbackDevice(mgr))
+	group.GET("/devices/:id/variables", listVariables(mgr))
+	group.POST("/devices/:id/variables", createVariable(mgr))
+	group.GET("/devices/:id/variables/:name", getVariable(mgr))
+	group.PUT("/devices/:id/variables/:name", updateVariable(mgr))
+	group.DELETE("/devices/:id/variables/:name", deleteVariable(mgr))
+	group.PUT("/devices/:id/variables/:name/disable", switchVariable(mgr, true))
+	group.PUT("/devices/:id/variables/:name/enable", switchVariable(mgr, false))
 
 }
 
@@ -56,7 +75,7 @@ func createDevice(mgr *Manager) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
 			return
 		}
-		d, err := mgr.CreateDevice(object)
+		d, err := mgr.CreateDevice(object, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
 
 		if err != nil {
 			c.JSON(http.StatusBadRequest, response.NewMultiError(err))
@@ -148,7 +167,7 @@ func patchDeviceById(mgr *Manager) gin.HandlerFunc {
 			return
 		}
 
-		updated, err := mgr.UpdateDeviceById(id, eTag, newObj)
+		updated, err := mgr.UpdateDeviceById(id, eTag, newObj, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
 		if err != nil {
 			switch {
 			case os.IsNotExist(err):
@@ -194,7 +213,7 @@ func updateDeviceById(mgr *Manager) gin.HandlerFunc {
 			return
 		}
 
-		updated, err := mgr.UpdateDeviceById(id, eTag, newObj)
+		updated, err := mgr.UpdateDeviceById(id, eTag, newObj, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
 		if err != nil {
 			switch {
 			case os.IsNotExist(err):
@@ -235,9 +254,79 @@ func listDevices(mgr *Manager) gin.HandlerFunc {
 			}
 			exploded, _ = strconv.ParseBool(query.Get("exploded"))
 		}
-		rds, _ := mgr.ListDevices(&filter, exploded)
+		if selector := query.Get(labelSelector); len(selector) > 0 {
+			filter.LabelSelector = selector
+		}
+		if _, err := runtime.ParseLabelSelector(filter.LabelSelector); err != nil {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrQueryInvalid(labelSelector, err.Error())))
+			return
+		}
+		if watch, _ := strconv.ParseBool(query.Get("watch")); watch {
+			watchDevices(c, mgr, &filter, exploded)
+			return
+		}
+		opts := &ListOptions{Sort: query.Get(apis.Sort), Continue: query.Get(apis.Continue)}
+		if limit := query.Get(apis.Limit); len(limit) > 0 {
+			var err error
+			if opts.Limit, err = strconv.Atoi(limit); err != nil {
+				c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrQueryInvalid(apis.Limit, "should be number")))
+				return
+			}
+		}
+		rds, next, err := mgr.ListDevicePage(&filter, opts, exploded)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+			return
+		}
 
-		c.JSON(http.StatusOK, &runtime.ResponseModel{Devices: rds})
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Devices: rds, Continue: next})
+	}
+}
+
+// watchDevices push the changes of devices by Server-Sent Events if accepted, otherwise by chunked JSON of one event
+// per line. Query 'revision' or header 'Last-Event-ID' resumes watching after the revision.
+func watchDevices(c *gin.Context, mgr *Manager, filter *runtime.DeviceFilter, exploded bool) {
+	rev := c.Query("revision")
+	if id := c.GetHeader(lastEventId); len(rev) == 0 && len(id) > 0 {
+		rev = id
+	}
+	events, err := mgr.WatchDevices(c.Request.Context().Done(), filter, exploded, rev)
+	if err != nil {
+		if errors.Is(err, storage.ErrRevisionExpired) {
+			c.Status(http.StatusGone)
+		} else {
+			c.Status(http.StatusBadRequest)
+		}
+		return
+	}
+
+	isSSE := strings.Contains(c.GetHeader("Accept"), sseContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	if !isSSE {
+		c.Header("Content-Type", "application/json")
+	}
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+		if isSSE {
+			c.Render(-1, sse.Event{Id: event.Revision, Event: event.Type, Data: event})
+			return true
+		}
+		if err := json.NewEncoder(w).Encode(event); err != nil {
+			klog.V(4).InfoS("Failed to write device event", "err", err)
+			return false
+		}
+		return true
+	})
+}
+
+// listFileRejections the device files edited on disk but refused
+func listFileRejections(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Rejections: mgr.ListFileRejections()})
 	}
 }
 
@@ -295,14 +384,359 @@ func controlDeviceById(mgr *Manager) gin.HandlerFunc {
 			return
 		}
 
-		err := mgr.DeliverAction(id, actions)
+		opts := []ActionOption{WithRequester(ActionSourceApi, c.ClientIP())}
+		query := c.Request.URL.Query()
+		if readback, _ := strconv.ParseBool(query.Get("readback")); readback {
+			tolerance, _ := strconv.ParseFloat(query.Get("tolerance"), 64)
+			opts = append(opts, WithReadback(tolerance))
+		}
+		if timeout, err := strconv.ParseUint(query.Get("timeout"), 10, 32); err == nil {
+			opts = append(opts, WithActionTimeout(time.Duration(timeout)*time.Second))
+		}
 
+		record, err := mgr.WriteAction(id, actions, opts...)
+		if err == nil {
+			err = record.Err()
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, err)
 			return
 		}
 
-		c.Status(http.StatusAccepted)
+		c.JSON(http.StatusAccepted, record)
+	}
+}
+
+func listActionRecords(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		id := c.Param("id")
+		query := c.Request.URL.Query()
+		filter := &ActionFilter{
+			Source: query.Get("source"),
+			Result: query.Get("result"),
+		}
+		filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+		records, err := mgr.ListActionRecords(id, filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Actions: records})
+	}
+}
+
+func importDevices(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		opts := &ImportOptions{Mode: c.DefaultQuery("mode", ImportModeCreate), Author: c.ClientIP()}
+		opts.DryRun, _ = strconv.ParseBool(c.Query("dryRun"))
+		if opts.Mode != ImportModeCreate && opts.Mode != ImportModeUpsert {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+
+		var body io.Reader = c.Request.Body
+		if c.ContentType() == "multipart/form-data" {
+			file, err := c.FormFile("file")
+			if err != nil {
+				klog.V(3).InfoS("Failed to get import file", "err", err)
+				c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+				return
+			}
+			f, err := file.Open()
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+		data, err := io.ReadAll(io.LimitReader(body, maxImportSize+1))
+		if err != nil || len(data) > maxImportSize {
+			klog.V(3).InfoS("Failed to read import file", "size", len(data), "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+
+		rows, err := readTable(data)
+		if err != nil {
+			klog.V(3).InfoS("Failed to parse import file", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+		results, err := mgr.ImportDevices(rows, opts)
+		if err != nil {
+			var errs *response.MultiError
+			if errors.As(err, &errs) {
+				c.JSON(http.StatusBadRequest, errs)
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Results: results})
+	}
+}
+
+func exportDevices(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := c.DefaultQuery("format", "csv")
+		if format != "csv" && format != "xlsx" {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+		rows, err := mgr.ExportDevices(c.Query("deviceType"))
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		if err := writeTable(buf, format, rows); err != nil {
+			klog.V(2).InfoS("Failed to export devices", "format", format, "err", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		contentType := csvContentType
+		if format == "xlsx" {
+			contentType = xlsxContentType
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="devices.%s"`, format))
+		c.Data(http.StatusOK, contentType, buf.Bytes())
+	}
+}
+
+func listRevisions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		revisions, err := mgr.ListRevisions(c.Param("id"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Revisions: revisions})
+	}
+}
+
+func getRevision(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		r, err := mgr.GetRevision(c.Param("id"), number)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func diffRevisions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		to, err := strconv.Atoi(c.DefaultQuery("to", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+		diff, err := mgr.DiffRevisions(c.Param("id"), from, to)
+		if err != nil {
+			if os.IsNotExist(err) {
+				c.Status(http.StatusNotFound)
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+func rollbackDevice(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		updated, err := mgr.RollbackDevice(c.Param("id"), eTag, number, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			switch {
+			case os.IsNotExist(err):
+				c.Status(http.StatusNotFound)
+			case errors.Is(err, apis.ErrMismatch):
+				c.Status(http.StatusPreconditionFailed)
+			default:
+				if response.IsResponseError(err) {
+					c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+				} else {
+					c.Status(http.StatusInternalServerError)
+				}
+			}
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listVariables(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		variables, err := mgr.ListVariables(c.Param("id"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, &runtime.ResponseModel{Variables: variables})
+	}
+}
+
+func getVariable(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		variable, err := mgr.GetVariable(c.Param("id"), c.Param("name"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, variable)
+	}
+}
+
+func createVariable(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		variable := make(map[string]interface{})
+		if err := json.NewDecoder(c.Request.Body).Decode(&variable); err != nil {
+			klog.V(3).InfoS("Failed to decode", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		id := c.Param("id")
+		updated, err := mgr.CreateVariable(id, eTag, variable, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			abortVariable(c, err)
+			return
+		}
+		name := variable[variableNameField].(string)
+		c.Header(apis.ETag, updated.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, name))
+		created, _ := mgr.GetVariable(id, name)
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+func updateVariable(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		variable := make(map[string]interface{})
+		if err := json.NewDecoder(c.Request.Body).Decode(&variable); err != nil {
+			klog.V(3).InfoS("Failed to decode", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		id, name := c.Param("id"), c.Param("name")
+		updated, err := mgr.UpdateVariable(id, eTag, name, variable, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			abortVariable(c, err)
+			return
+		}
+		c.Header(apis.ETag, updated.GetVersion())
+		v, _ := mgr.GetVariable(id, name)
+		c.JSON(http.StatusOK, v)
+	}
+}
+
+func switchVariable(mgr *Manager, disabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		id, name := c.Param("id"), c.Param("name")
+		updated, err := mgr.SetVariableDisabled(id, eTag, name, disabled, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			abortVariable(c, err)
+			return
+		}
+		c.Header(apis.ETag, updated.GetVersion())
+		v, _ := mgr.GetVariable(id, name)
+		c.JSON(http.StatusOK, v)
+	}
+}
+
+func deleteVariable(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		id, name := c.Param("id"), c.Param("name")
+		deleted, err := mgr.GetVariable(id, name)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		updated, err := mgr.DeleteVariable(id, eTag, name, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			abortVariable(c, err)
+			return
+		}
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, deleted)
+	}
+}
+
+// abortVariable respond the error of changing variable, the device or variable not found is 404
+func abortVariable(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	default:
+		if response.IsResponseError(err) {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+		} else {
+			c.Status(http.StatusInternalServerError)
+		}
 	}
 }
 
@@ -0,0 +1,179 @@
+package device
+
+import (
+	"harnsgateway/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StreamEventData   = "data"
+	StreamEventStatus = "status"
+)
+
+// StreamEvent the event pushed to the live data stream of device
+type StreamEvent struct {
+	Type          string              `json:"type"` // data、status
+	DeviceId      string              `json:"deviceId"`
+	Timestamp     string              `json:"timestamp"`
+	CollectStatus string              `json:"collectStatus,omitempty"`
+	Values        []runtime.PointData `json:"values,omitempty"`
+}
+
+// Subscriber receives the stream events of one device,
+// events are dropped when the subscriber can not keep up with collection.
+type Subscriber struct {
+	deviceId  string
+	variables sets.String
+	events    chan *StreamEvent
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+// Events the channel is closed when device deleted or subscriber unsubscribed
+func (s *Subscriber) Events() <-chan *StreamEvent {
+	return s.events
+}
+
+// Dropped the number of events dropped because of slow client
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscriber) offer(event *StreamEvent) {
+	if event.Type == StreamEventData && s.variables.Len() > 0 {
+		values := make([]runtime.PointData, 0, s.variables.Len())
+		for _, value := range event.Values {
+			if s.variables.Has(value.DataPointId) {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			return
+		}
+		filtered := *event
+		filtered.Values = values
+		event = &filtered
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+		klog.V(5).InfoS("Dropped stream event because of slow client", "deviceId", s.deviceId, "type", event.Type)
+	}
+}
+
+func (s *Subscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.events)
+	})
+}
+
+type streamHub struct {
+	mu          *sync.RWMutex
+	subscribers map[string]map[*Subscriber]struct{}
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		mu:          &sync.RWMutex{},
+		subscribers: make(map[string]map[*Subscriber]struct{}, 0),
+	}
+}
+
+func (h *streamHub) broadcast(event *StreamEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscribers[event.DeviceId] {
+		s.offer(event)
+	}
+}
+
+func (h *streamHub) add(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[s.deviceId]; !ok {
+		h.subscribers[s.deviceId] = make(map[*Subscriber]struct{}, 0)
+	}
+	h.subscribers[s.deviceId][s] = struct{}{}
+}
+
+func (h *streamHub) remove(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if subs, ok := h.subscribers[s.deviceId]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.subscribers, s.deviceId)
+		}
+	}
+	s.close()
+}
+
+func (h *streamHub) closeDevice(deviceId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers[deviceId] {
+		s.close()
+	}
+	delete(h.subscribers, deviceId)
+}
+
+func (h *streamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for deviceId, subs := range h.subscribers {
+		for s := range subs {
+			s.close()
+		}
+		delete(h.subscribers, deviceId)
+	}
+}
+
+// Subscribe the live data and status of device, only the given variables are pushed if not empty.
+func (m *Manager) Subscribe(deviceId string, variables []string) (*Subscriber, error) {
+	device, err := m.GetDeviceById(deviceId, false)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	s := &Subscriber{
+		deviceId:  deviceId,
+		variables: sets.NewString(variables...),
+		events:    make(chan *StreamEvent, streamBufferSize),
+	}
+	// the current status is the first event of stream
+	s.offer(&StreamEvent{
+		Type:          StreamEventStatus,
+		DeviceId:      deviceId,
+		Timestamp:     time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		CollectStatus: device.GetCollectStatus(),
+	})
+	m.streams.add(s)
+	klog.V(4).InfoS("Subscribed device stream", "deviceId", deviceId, "variables", variables)
+	return s, nil
+}
+
+func (m *Manager) Unsubscribe(s *Subscriber) {
+	m.streams.remove(s)
+	klog.V(4).InfoS("Unsubscribed device stream", "deviceId", s.deviceId, "dropped", s.Dropped())
+}
+
+// setCollectStatus switch the collect status of device and notify the subscribers if changed
+func (m *Manager) setCollectStatus(device runtime.Device, status runtime.CollectStatus) {
+	cs := runtime.CollectStatusToString[status]
+	if device.GetCollectStatus() == cs {
+		return
+	}
+	device.SetCollectStatus(cs)
+	m.streams.broadcast(&StreamEvent{
+		Type:          StreamEventStatus,
+		DeviceId:      device.GetID(),
+		Timestamp:     time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		CollectStatus: cs,
+	})
+}
@@ -0,0 +1,223 @@
+package device
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"harnsgateway/pkg/utils/xlsxutil"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// variableColumnPrefix the columns of variables, one variable per row
+	variableColumnPrefix = "variable."
+	// variablesField the field of variables in the device object
+	variablesField = "variables"
+)
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	utf8Bom  = []byte("\xef\xbb\xbf")
+)
+
+// the leading columns of exported table
+var leadingColumns = []string{"deviceType", "deviceCode", "name", "deviceModel"}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// field the json field of struct, the embedded structs are flattened
+func field(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && len(f.Tag.Get("json")) == 0 {
+			if ft, ok := field(indirect(f.Type), name); ok {
+				return ft, true
+			}
+			continue
+		}
+		if jsonName(f) == name {
+			return f.Type, true
+		}
+	}
+	return nil, false
+}
+
+// columns the leaf paths of struct in declaration order, the structs are flattened with dot
+func columns(t reflect.Type, prefix string) []string {
+	result := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && len(f.Tag.Get("json")) == 0 {
+			result = append(result, columns(indirect(f.Type), prefix)...)
+			continue
+		}
+		name := jsonName(f)
+		if len(name) == 0 || (len(prefix) == 0 && name == variablesField) {
+			continue
+		}
+		if isStruct(f.Type) {
+			result = append(result, columns(indirect(f.Type), prefix+name+".")...)
+		} else {
+			result = append(result, prefix+name)
+		}
+	}
+	return result
+}
+
+func jsonName(f reflect.StructField) string {
+	if len(f.PkgPath) > 0 {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; len(name) > 0 {
+		return name
+	}
+	return f.Name
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// isStruct the struct is flattened into columns unless it is decoded by itself
+func isStruct(t reflect.Type) bool {
+	t = indirect(t)
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(unmarshalerType)
+}
+
+// setCell set the value of cell into object by the column path
+func setCell(object map[string]interface{}, t reflect.Type, path []string, cell string) error {
+	ft, ok := field(indirect(t), path[0])
+	if !ok {
+		return fmt.Errorf("unknown column %s", path[0])
+	}
+	if len(path) == 1 {
+		v, err := parseCell(ft, cell)
+		if err != nil {
+			return fmt.Errorf("column %s %v", path[0], err)
+		}
+		object[path[0]] = v
+		return nil
+	}
+	if !isStruct(ft) {
+		return fmt.Errorf("unknown column %s", strings.Join(path, "."))
+	}
+	child, ok := object[path[0]].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		object[path[0]] = child
+	}
+	if err := setCell(child, ft, path[1:], cell); err != nil {
+		return fmt.Errorf("%s.%v", path[0], err)
+	}
+	return nil
+}
+
+// parseCell parse the text of cell by the type of field, the slices and maps are written as JSON
+func parseCell(t reflect.Type, cell string) (interface{}, error) {
+	t = indirect(t)
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return cell, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return cell, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return nil, fmt.Errorf("should be bool")
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return nil, fmt.Errorf("should be number")
+		}
+		return f, nil
+	case reflect.Interface:
+		var v interface{}
+		if err := json.Unmarshal([]byte(cell), &v); err == nil {
+			return v, nil
+		}
+		return cell, nil
+	default:
+		var v interface{}
+		if err := json.Unmarshal([]byte(cell), &v); err != nil {
+			return nil, fmt.Errorf("should be JSON")
+		}
+		return v, nil
+	}
+}
+
+// flatten the values of object into cells by the column paths
+func flatten(object map[string]interface{}, t reflect.Type, prefix string, cells map[string]string) {
+	for key, value := range object {
+		if len(prefix) == 0 && key == variablesField {
+			continue
+		}
+		ft, ok := field(indirect(t), key)
+		if !ok || value == nil {
+			continue
+		}
+		if child, ok := value.(map[string]interface{}); ok && isStruct(ft) {
+			flatten(child, ft, prefix+key+".", cells)
+			continue
+		}
+		cells[prefix+key] = formatCell(ft, value)
+	}
+}
+
+// formatCell the reverse of parseCell, the strings of interface which look like JSON are quoted
+func formatCell(t reflect.Type, value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if indirect(t).Kind() == reflect.Interface && json.Valid([]byte(v)) {
+			data, _ := json.Marshal(v)
+			return string(data)
+		}
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// readTable read the rows of CSV or the first worksheet of XLSX, the format is detected by content
+func readTable(data []byte) ([][]string, error) {
+	if bytes.HasPrefix(data, zipMagic) {
+		return xlsxutil.Read(bytes.NewReader(data), int64(len(data)))
+	}
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, utf8Bom)))
+	r.FieldsPerRecord = -1
+	return r.ReadAll()
+}
+
+// writeTable write the rows as CSV or XLSX, the CSV starts with BOM to be opened by spreadsheet correctly
+func writeTable(w io.Writer, format string, rows [][]string) error {
+	if format == "xlsx" {
+		return xlsxutil.Write(w, "devices", rows)
+	}
+	if _, err := w.Write(utf8Bom); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
@@ -0,0 +1,87 @@
+package device
+
+import (
+	"encoding/json"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var modbusRows = [][]string{
+	{"deviceType", "deviceCode", "name", "deviceModel", "collectorCycle", "address.location", "address.option.port", "slave", "memoryLayout", "variable.name", "variable.dataType", "variable.address", "variable.functionCode", "variable.accessMode", "variable.transform.offset"},
+	{"modbus", "pm-1", "meter 1", "PM800", "5", "10.0.0.11", "502", "1", "ABCD", "current", "float32", "0", "3", "r", "0.1"},
+	{"modbus", "pm-1", "", "", "", "", "", "", "", "voltage", "float32", "2", "3", "rw", ""},
+	{},
+	{"modbus", "pm-2", "meter 2", "PM800", "5", "10.0.0.12", "502", "2", "ABCD", "current", "float32", "0", "3", "r", ""},
+}
+
+func TestParseTable(t *testing.T) {
+	devices, errs := parseTable(modbusRows)
+	if errs.Len() > 0 {
+		t.Fatalf("parseTable() = %v", errs)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %d", len(devices))
+	}
+	d := devices[0].device.(*v1.ModBusDevice)
+	if d.Name != "meter 1" || d.Slave != 1 || d.Address.Option.Port != 502 || len(d.Variables) != 2 {
+		t.Fatalf("unexpected device %+v", d)
+	}
+	if v := d.Variables[0]; v.Transform == nil || v.Transform.Offset != 0.1 || *v.Address != 0 {
+		t.Errorf("unexpected variable %+v", v)
+	}
+	if devices[1].row != 5 || devices[0].variableRows[1] != 3 {
+		t.Errorf("unexpected rows %d %v", devices[1].row, devices[0].variableRows)
+	}
+}
+
+func TestParseTableErrors(t *testing.T) {
+	rows := [][]string{
+		modbusRows[0],
+		modbusRows[1],
+		{"modbus", "pm-1", "meter 2", "", "", "", "", "", "", "voltage", "float32", "x", "3", "rw", ""},
+		{"bacnet", "pm-3"},
+	}
+	_, errs := parseTable(rows)
+	expected := []string{"Row [3] invalid: column name conflicts with row 2.", "Row [3] invalid: column address should be number.", "Row [4] invalid: unsupported device type bacnet."}
+	if errs.Len() != len(expected) {
+		t.Fatalf("parseTable() = %v", errs)
+	}
+	for i, err := range errs.Errors() {
+		if !strings.Contains(err.Error(), expected[i]) {
+			t.Errorf("error %d = %s, want %s", i, err, expected[i])
+		}
+	}
+
+	// the variable failed to validate is reported with its own row
+	rows = [][]string{modbusRows[0], modbusRows[1], {"modbus", "pm-1", "", "", "", "", "", "", "", "voltage", "", "2", "3", "rw", ""}}
+	_, errs = parseTable(rows)
+	if errs.Len() != 1 || !strings.Contains(errs.Errors()[0].Error(), "Row [3] invalid") || !response.IsResponseError(errs.Errors()[0]) {
+		t.Fatalf("parseTable() = %v", errs)
+	}
+}
+
+func TestFlattenParse(t *testing.T) {
+	devices, errs := parseTable(modbusRows)
+	if errs.Len() > 0 {
+		t.Fatalf("parseTable() = %v", errs)
+	}
+	data, _ := json.Marshal(devices[0].device)
+	values := make(map[string]interface{})
+	_ = json.Unmarshal(data, &values)
+	cells := make(map[string]string)
+	flatten(values, reflect.TypeOf(devices[0].device), "", cells)
+	for column, cell := range map[string]string{"address.option.port": "502", "slave": "1", "memoryLayout": "ABCD", "name": "meter 1"} {
+		if cells[column] != cell {
+			t.Errorf("cell %s = %q, want %q", column, cells[column], cell)
+		}
+	}
+	if _, ok := cells[variablesField]; ok {
+		t.Error("variables should not be flattened into device columns")
+	}
+	if got := formatCell(reflect.TypeOf((*interface{})(nil)).Elem(), "1001"); got != `"1001"` {
+		t.Errorf("formatCell() = %s", got)
+	}
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/utils/convutil"
+)
+
+// transformValue convert the collected raw value to engineering value by the transform of variable,
+// the engineering value is also kept in the variable of device, and reports whether the value is clamped.
+func (m *Manager) transformValue(device runtime.Device, value runtime.VariableValue) (interface{}, bool) {
+	vv, exist := device.GetVariable(value.GetVariableName())
+	if !exist {
+		return value.GetValue(), false
+	}
+	t, ok := vv.(runtime.Transformer)
+	if !ok {
+		return value.GetValue(), false
+	}
+	transform := t.GetTransform()
+	if transform == nil {
+		return value.GetValue(), false
+	}
+	v, clamped := transform.ApplyWithRange(value.GetValue())
+	vv.SetValue(v)
+	return v, clamped
+}
+
+// inverseTransform convert the engineering values of actions back to raw values
+func (m *Manager) inverseTransform(device runtime.Device, actions map[string]interface{}) {
+	for name, value := range actions {
+		if _, ok := value.(bool); ok {
+			continue
+		}
+		f, ok := convutil.ToFloat64(value)
+		if !ok {
+			continue
+		}
+		vv, _ := device.GetVariable(name)
+		if t, ok := vv.(runtime.Transformer); ok && t.GetTransform() != nil {
+			actions[name] = t.GetTransform().Inverse(f)
+		}
+	}
+}
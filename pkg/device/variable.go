@@ -0,0 +1,183 @@
+package device
+
+import (
+	"encoding/json"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	"k8s.io/klog/v2"
+	"os"
+)
+
+const (
+	variableNameField     = "name"
+	variableDisabledField = "disabled"
+)
+
+// ListVariables list the variables of device with the latest values, in the order of device
+func (m *Manager) ListVariables(id string) ([]interface{}, error) {
+	d, err := m.GetDeviceById(id, true)
+	if err != nil {
+		return nil, err
+	}
+	object, err := toMap(d)
+	if err != nil {
+		return nil, err
+	}
+	variables, _ := object[variablesField].([]interface{})
+	if variables == nil {
+		variables = []interface{}{}
+	}
+	return variables, nil
+}
+
+// GetVariable get the variable of device with the latest value
+func (m *Manager) GetVariable(id string, name string) (interface{}, error) {
+	variables, err := m.ListVariables(id)
+	if err != nil {
+		return nil, err
+	}
+	i := indexOfVariable(variables, name)
+	if i < 0 {
+		return nil, os.ErrNotExist
+	}
+	return variables[i], nil
+}
+
+// CreateVariable add the variable to device, the variables existing are collected as before
+func (m *Manager) CreateVariable(id string, version string, variable map[string]interface{}, opts ...revision.Option) (runtime.Device, error) {
+	name, _ := variable[variableNameField].(string)
+	if len(name) == 0 {
+		return nil, response.ErrVariableInvalid(name, "name is required")
+	}
+	return m.updateVariables(id, version, name, func(variables []interface{}) ([]interface{}, error) {
+		if indexOfVariable(variables, name) >= 0 {
+			return nil, response.ErrResourceExists(name)
+		}
+		return append(variables, variable), nil
+	}, opts...)
+}
+
+// UpdateVariable replace the variable of device, the variable can not be renamed
+func (m *Manager) UpdateVariable(id string, version string, name string, variable map[string]interface{}, opts ...revision.Option) (runtime.Device, error) {
+	if newName, ok := variable[variableNameField].(string); ok && newName != name {
+		return nil, response.ErrVariableInvalid(name, "name can not be changed")
+	}
+	variable[variableNameField] = name
+	return m.updateVariables(id, version, name, func(variables []interface{}) ([]interface{}, error) {
+		i := indexOfVariable(variables, name)
+		if i < 0 {
+			return nil, os.ErrNotExist
+		}
+		variables[i] = variable
+		return variables, nil
+	}, opts...)
+}
+
+// SetVariableDisabled disable or enable the variable, the disabled variable is kept in device but not collected or written
+func (m *Manager) SetVariableDisabled(id string, version string, name string, disabled bool, opts ...revision.Option) (runtime.Device, error) {
+	return m.updateVariables(id, version, name, func(variables []interface{}) ([]interface{}, error) {
+		i := indexOfVariable(variables, name)
+		if i < 0 {
+			return nil, os.ErrNotExist
+		}
+		variable := variables[i].(map[string]interface{})
+		if disabled {
+			variable[variableDisabledField] = true
+		} else {
+			delete(variable, variableDisabledField)
+		}
+		return variables, nil
+	}, opts...)
+}
+
+// DeleteVariable delete the variable from device
+func (m *Manager) DeleteVariable(id string, version string, name string, opts ...revision.Option) (runtime.Device, error) {
+	return m.updateVariables(id, version, name, func(variables []interface{}) ([]interface{}, error) {
+		i := indexOfVariable(variables, name)
+		if i < 0 {
+			return nil, os.ErrNotExist
+		}
+		return append(variables[:i], variables[i+1:]...), nil
+	}, opts...)
+}
+
+// updateVariables update the device with the variables changed like updating device, then collect the changed
+// variable without restarting the other variables
+func (m *Manager) updateVariables(id string, version string, name string, change func([]interface{}) ([]interface{}, error), opts ...revision.Option) (runtime.Device, error) {
+	d, err := m.GetDeviceById(id, true)
+	if err != nil {
+		return nil, err
+	}
+	if version != d.GetVersion() {
+		return nil, apis.ErrMismatch
+	}
+	current, err := m.toObject(d)
+	if err != nil {
+		return nil, err
+	}
+	object, err := toMap(current)
+	if err != nil {
+		return nil, err
+	}
+	variables, _ := object[variablesField].([]interface{})
+	if variables, err = change(variables); err != nil {
+		return nil, err
+	}
+	object[variablesField] = variables
+	newObj, err := newObject(object)
+	if err != nil {
+		return nil, response.ErrVariableInvalid(name, err.Error())
+	}
+
+	updated, err := m.UpdateDeviceById(id, version, newObj, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.applyVariables(updated, []string{name})
+	return updated, nil
+}
+
+// applyVariables collect the changed variables of device, the broker rebuilds the data frames of the variables only
+// if supported, otherwise the device is restarted to collect. The device not collecting is left alone.
+func (m *Manager) applyVariables(device runtime.Device, names []string) {
+	m.mu.Lock()
+	broker, ok := m.brokers[device.GetID()]
+	m.mu.Unlock()
+	if !ok {
+		m.recollect(device)
+		return
+	}
+	if rebuilder, isRebuilder := broker.(runtime.VariableRebuilder); isRebuilder {
+		err := rebuilder.RebuildVariables(device, names)
+		if err == nil {
+			klog.V(2).InfoS("Rebuilt variables of device", "deviceId", device.GetID(), "variables", names)
+			return
+		}
+		klog.V(2).InfoS("Failed to rebuild variables of device, restart collecting", "deviceId", device.GetID(), "err", err)
+	}
+	m.restartCollect(device)
+}
+
+func indexOfVariable(variables []interface{}, name string) int {
+	for i, variable := range variables {
+		if v, ok := variable.(map[string]interface{}); ok && v[variableNameField] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// toMap convert the object to the map of its JSON fields
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	object := make(map[string]interface{})
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
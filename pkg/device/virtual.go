@@ -0,0 +1,238 @@
+package device
+
+import (
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/expression"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+// virtualVariable the compiled virtual variable of device
+type virtualVariable struct {
+	name string
+	expr *expression.Expression
+	// devices the referred device(id or code) to device id
+	devices map[string]string
+}
+
+// toVirtualVariables convert the virtual variables of request to runtime
+func toVirtualVariables(object v1.DeviceType) []*runtime.VirtualVariable {
+	vvs := object.GetVirtualVariables()
+	if len(vvs) == 0 {
+		return nil
+	}
+	result := make([]*runtime.VirtualVariable, 0, len(vvs))
+	for _, vv := range vvs {
+		result = append(result, &runtime.VirtualVariable{Name: vv.Name, Expression: vv.Expression})
+	}
+	return result
+}
+
+// compileVirtualVariables validate the virtual variables of device, all referred variables should exist and
+// there should be no circular reference across devices. The result is ordered by dependency.
+func (m *Manager) compileVirtualVariables(device runtime.Device) ([]*virtualVariable, error) {
+	vvs := device.GetVirtualVariables()
+	if len(vvs) == 0 {
+		return nil, nil
+	}
+	device.IndexDevice()
+
+	names := sets.NewString()
+	for _, vv := range vvs {
+		if _, exist := device.GetVariable(vv.Name); exist || names.Has(vv.Name) {
+			return nil, response.ErrResourceExists(vv.Name)
+		}
+		names.Insert(vv.Name)
+	}
+
+	compiled := make(map[string]*virtualVariable, len(vvs))
+	for _, vv := range vvs {
+		expr, err := expression.Parse(vv.Expression)
+		if err != nil {
+			return nil, response.ErrExpressionInvalid(vv.Name, err.Error())
+		}
+		cv := &virtualVariable{name: vv.Name, expr: expr, devices: make(map[string]string, 0)}
+		for _, ref := range expr.References() {
+			target := device
+			if len(ref.Device) > 0 {
+				if target = m.findReferredDevice(device, ref.Device); target == nil {
+					return nil, response.ErrExpressionInvalid(vv.Name, "device "+ref.Device+" not found")
+				}
+				cv.devices[ref.Device] = target.GetID()
+			}
+			if !runtime.HasVariable(target, ref.Variable) {
+				return nil, response.ErrExpressionInvalid(vv.Name, "variable "+ref.Variable+" not found")
+			}
+		}
+		compiled[vv.Name] = cv
+	}
+
+	// the dependencies between virtual variables of all devices
+	graph := make(map[string][]string, 0)
+	m.virtuals.Range(func(key, value any) bool {
+		if key.(string) == device.GetID() {
+			return true
+		}
+		for _, cv := range value.([]*virtualVariable) {
+			graph[virtualNode(key.(string), cv.name)] = cv.dependencies(key.(string), m.isVirtualVariable)
+		}
+		return true
+	})
+	isVirtual := func(deviceId string, name string) bool {
+		if deviceId == device.GetID() {
+			return names.Has(name)
+		}
+		return m.isVirtualVariable(deviceId, name)
+	}
+	for _, vv := range vvs {
+		graph[virtualNode(device.GetID(), vv.Name)] = compiled[vv.Name].dependencies(device.GetID(), isVirtual)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make(map[string]int, len(graph))
+	ordered := make([]*virtualVariable, 0, len(vvs))
+	var visit func(node string) bool
+	visit = func(node string) bool {
+		switch states[node] {
+		case visiting:
+			return false
+		case visited:
+			return true
+		}
+		states[node] = visiting
+		for _, dep := range graph[node] {
+			if !visit(dep) {
+				return false
+			}
+		}
+		states[node] = visited
+		if deviceId, name := splitVirtualNode(node); deviceId == device.GetID() {
+			ordered = append(ordered, compiled[name])
+		}
+		return true
+	}
+	for _, vv := range vvs {
+		if !visit(virtualNode(device.GetID(), vv.Name)) {
+			return nil, response.ErrVariableCircularReference(vv.Name)
+		}
+	}
+	return ordered, nil
+}
+
+// dependencies the virtual variables referred by expression
+func (v *virtualVariable) dependencies(deviceId string, isVirtual func(deviceId string, name string) bool) []string {
+	deps := make([]string, 0)
+	for _, ref := range v.expr.References() {
+		target := deviceId
+		if len(ref.Device) > 0 {
+			target = v.devices[ref.Device]
+		}
+		if isVirtual(target, ref.Variable) {
+			deps = append(deps, virtualNode(target, ref.Variable))
+		}
+	}
+	return deps
+}
+
+func (m *Manager) isVirtualVariable(deviceId string, name string) bool {
+	value, ok := m.virtuals.Load(deviceId)
+	if !ok {
+		return false
+	}
+	for _, cv := range value.([]*virtualVariable) {
+		if cv.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findReferredDevice find device by id or device code
+func (m *Manager) findReferredDevice(self runtime.Device, idOrCode string) runtime.Device {
+	if self.GetID() == idOrCode || self.GetDeviceCode() == idOrCode {
+		return self
+	}
+	if v, ok := m.devices.Load(idOrCode); ok {
+		return v.(runtime.Device)
+	}
+	var found runtime.Device
+	m.devices.Range(func(key, value any) bool {
+		d := value.(runtime.Device)
+		if d.GetID() != self.GetID() && d.GetDeviceCode() == idOrCode {
+			found = d
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func virtualNode(deviceId string, name string) string {
+	return deviceId + "/" + name
+}
+
+func splitVirtualNode(node string) (string, string) {
+	deviceId, name, _ := strings.Cut(node, "/")
+	return deviceId, name
+}
+
+// evaluateVirtualVariables compute the virtual variables of device after collection,
+// the variables of other devices are the latest collected values.
+func (m *Manager) evaluateVirtualVariables(deviceId string, pds []runtime.PointData) []runtime.PointData {
+	value, ok := m.virtuals.Load(deviceId)
+	if !ok {
+		return nil
+	}
+	cvs := value.([]*virtualVariable)
+	current := make(map[string]interface{}, len(pds)+len(cvs))
+	for _, pd := range pds {
+		current[pd.DataPointId] = pd.Value
+	}
+
+	results := make([]runtime.PointData, 0, len(cvs))
+	for _, cv := range cvs {
+		result, err := cv.expr.Evaluate(func(ref expression.Reference) (interface{}, bool) {
+			target := deviceId
+			if len(ref.Device) > 0 {
+				target = cv.devices[ref.Device]
+			}
+			if target == deviceId {
+				v, ok := current[ref.Variable]
+				return v, ok
+			}
+			return m.latestValue(target, ref.Variable)
+		})
+		if err != nil {
+			klog.V(4).InfoS("Failed to evaluate virtual variable", "deviceId", deviceId, "variable", cv.name, "err", err)
+			continue
+		}
+		current[cv.name] = result
+		results = append(results, runtime.PointData{DataPointId: cv.name, Value: result})
+	}
+	return results
+}
+
+func (m *Manager) latestValue(deviceId string, name string) (interface{}, bool) {
+	pd, ok := m.latestPoint(deviceId, name)
+	return pd.Value, ok
+}
+
+func (m *Manager) latestPoint(deviceId string, name string) (runtime.PointData, bool) {
+	value, ok := m.latestValues.Load(deviceId)
+	if !ok {
+		return runtime.PointData{}, false
+	}
+	for _, pd := range value.([]runtime.PointData) {
+		if pd.DataPointId == name {
+			return pd, true
+		}
+	}
+	return runtime.PointData{}, false
+}
@@ -0,0 +1,64 @@
+package device
+
+import (
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"k8s.io/klog/v2"
+)
+
+// WatchEvent the change of device pushed to watchers
+type WatchEvent struct {
+	Type     string         `json:"type"`     // Create、Update、Remove
+	Revision string         `json:"revision"` // 从该修订号继续监听
+	Device   runtime.Device `json:"device"`   // 删除时为删除前的设备
+}
+
+// WatchDevices watch the changes of devices matched the filter after the revision. Without revision the existing
+// devices are sent as created first. The channel is closed when stopped or the watcher can not keep up.
+func (m *Manager) WatchDevices(stopCh <-chan struct{}, filter *runtime.DeviceFilter, exploded bool, rev string) (<-chan *WatchEvent, error) {
+	var initial []runtime.Device
+	if len(rev) == 0 {
+		rev = storage.Revision()
+		initial, _ = m.ListDevices(filter, exploded)
+	}
+	in, err := m.store.Watch(stopCh, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	predicates := runtime.ParseTypeFilter(filter)
+	out := make(chan *WatchEvent, len(initial))
+	for _, d := range initial {
+		out <- &WatchEvent{Type: storage.Create.String(), Revision: rev, Device: d}
+	}
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-stopCh:
+				return
+			case e, ok := <-in:
+				if !ok {
+					return
+				}
+				d, err := m.store.Decode(e.Key, e.Data.([]byte))
+				if err != nil {
+					klog.V(3).InfoS("Failed to decode changed device", "key", e.Key, "err", err)
+					continue
+				}
+				if !runtime.MatchPredicates(d, predicates) {
+					continue
+				}
+				if !exploded {
+					d = m.foldDevice(d)
+				}
+				select {
+				case out <- &WatchEvent{Type: e.Type.String(), Revision: e.Revision, Device: d}:
+				case <-stopCh:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
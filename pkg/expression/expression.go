@@ -0,0 +1,396 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"harnsgateway/pkg/utils/convutil"
+	"math"
+	"strconv"
+)
+
+/**
+表达式语法与Go表达式一致
+运算符: + - * / % == != < <= > >= && || !
+函数:
+  abs(x) sqrt(x) pow(x, y) min(x, ...) max(x, ...) round(x) round(x, n)
+  cond(c, a, b)              条件c为真返回a 否则返回b
+  val("name")                引用本设备变量 用于变量名不是合法标识符的情况
+  ref("device", "name")      引用其他设备的变量 device为设备id或设备编码
+标识符引用本设备变量 例如 voltage * current * 0.001
+*/
+
+var (
+	ErrDivisionByZero = errors.New("division by zero")
+	ErrTypeMismatch   = errors.New("type mismatch")
+	ErrNotFinite      = errors.New("result is not finite")
+)
+
+// Reference the variable referred by expression, Device is empty when referring the same device
+type Reference struct {
+	Device   string
+	Variable string
+}
+
+// Resolver returns the latest value of referred variable
+type Resolver func(ref Reference) (interface{}, bool)
+
+type Expression struct {
+	src        string
+	root       ast.Expr
+	references []Reference
+}
+
+type function struct {
+	minArgs int
+	maxArgs int // -1 不限制
+}
+
+var functions = map[string]function{
+	"abs":   {1, 1},
+	"sqrt":  {1, 1},
+	"pow":   {2, 2},
+	"min":   {1, -1},
+	"max":   {1, -1},
+	"round": {1, 2},
+	"cond":  {3, 3},
+	"val":   {1, 1},
+	"ref":   {2, 2},
+}
+
+// Parse parses and validates the expression, only arithmetic, comparison, logical operators and
+// the functions above are allowed.
+func Parse(src string) (*Expression, error) {
+	root, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	e := &Expression{src: src, root: root}
+	if err = e.check(root); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Expression) String() string {
+	return e.src
+}
+
+// References the variables referred by expression
+func (e *Expression) References() []Reference {
+	return e.references
+}
+
+// Evaluate returns float64 or bool, the NaN and infinite results are errors
+func (e *Expression) Evaluate(resolve Resolver) (interface{}, error) {
+	result, err := e.eval(e.root, resolve)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := result.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return nil, ErrNotFinite
+	}
+	return result, nil
+}
+
+func (e *Expression) check(node ast.Expr) error {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind != token.INT && n.Kind != token.FLOAT {
+			return fmt.Errorf("unsupported literal %s", n.Value)
+		}
+	case *ast.Ident:
+		if n.Name != "true" && n.Name != "false" {
+			e.references = append(e.references, Reference{Variable: n.Name})
+		}
+	case *ast.ParenExpr:
+		return e.check(n.X)
+	case *ast.UnaryExpr:
+		switch n.Op {
+		case token.ADD, token.SUB, token.NOT:
+		default:
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		return e.check(n.X)
+	case *ast.BinaryExpr:
+		switch n.Op {
+		case token.ADD, token.SUB, token.MUL, token.QUO, token.REM,
+			token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ,
+			token.LAND, token.LOR:
+		default:
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		if err := e.check(n.X); err != nil {
+			return err
+		}
+		return e.check(n.Y)
+	case *ast.CallExpr:
+		ident, ok := n.Fun.(*ast.Ident)
+		if !ok {
+			return errors.New("unsupported function call")
+		}
+		f, ok := functions[ident.Name]
+		if !ok {
+			return fmt.Errorf("unsupported function %s", ident.Name)
+		}
+		if len(n.Args) < f.minArgs || (f.maxArgs >= 0 && len(n.Args) > f.maxArgs) {
+			return fmt.Errorf("wrong number of arguments for %s", ident.Name)
+		}
+		switch ident.Name {
+		case "val":
+			name, err := stringArg(n.Args[0])
+			if err != nil {
+				return err
+			}
+			e.references = append(e.references, Reference{Variable: name})
+		case "ref":
+			device, err := stringArg(n.Args[0])
+			if err != nil {
+				return err
+			}
+			name, err := stringArg(n.Args[1])
+			if err != nil {
+				return err
+			}
+			e.references = append(e.references, Reference{Device: device, Variable: name})
+		default:
+			for _, arg := range n.Args {
+				if err := e.check(arg); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported expression %T", node)
+	}
+	return nil
+}
+
+func (e *Expression) eval(node ast.Expr, resolve Resolver) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.BasicLit:
+		if n.Kind == token.INT {
+			i, err := strconv.ParseInt(n.Value, 0, 64)
+			return float64(i), err
+		}
+		return strconv.ParseFloat(n.Value, 64)
+	case *ast.Ident:
+		switch n.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return lookup(resolve, Reference{Variable: n.Name})
+	case *ast.ParenExpr:
+		return e.eval(n.X, resolve)
+	case *ast.UnaryExpr:
+		x, err := e.eval(n.X, resolve)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == token.NOT {
+			b, ok := x.(bool)
+			if !ok {
+				return nil, ErrTypeMismatch
+			}
+			return !b, nil
+		}
+		f, err := number(x)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == token.SUB {
+			return -f, nil
+		}
+		return f, nil
+	case *ast.BinaryExpr:
+		return e.evalBinary(n, resolve)
+	case *ast.CallExpr:
+		return e.evalCall(n, resolve)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", node)
+}
+
+func (e *Expression) evalBinary(n *ast.BinaryExpr, resolve Resolver) (interface{}, error) {
+	x, err := e.eval(n.X, resolve)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case token.LAND, token.LOR:
+		bx, ok := x.(bool)
+		if !ok {
+			return nil, ErrTypeMismatch
+		}
+		// short circuit
+		if (n.Op == token.LAND && !bx) || (n.Op == token.LOR && bx) {
+			return bx, nil
+		}
+		y, err := e.eval(n.Y, resolve)
+		if err != nil {
+			return nil, err
+		}
+		by, ok := y.(bool)
+		if !ok {
+			return nil, ErrTypeMismatch
+		}
+		return by, nil
+	}
+
+	y, err := e.eval(n.Y, resolve)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == token.EQL || n.Op == token.NEQ {
+		if bx, ok := x.(bool); ok {
+			by, ok := y.(bool)
+			if !ok {
+				return nil, ErrTypeMismatch
+			}
+			return (bx == by) == (n.Op == token.EQL), nil
+		}
+	}
+
+	fx, err := number(x)
+	if err != nil {
+		return nil, err
+	}
+	fy, err := number(y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case token.ADD:
+		return fx + fy, nil
+	case token.SUB:
+		return fx - fy, nil
+	case token.MUL:
+		return fx * fy, nil
+	case token.QUO:
+		if fy == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return fx / fy, nil
+	case token.REM:
+		if fy == 0 {
+			return nil, ErrDivisionByZero
+		}
+		return math.Mod(fx, fy), nil
+	case token.EQL:
+		return fx == fy, nil
+	case token.NEQ:
+		return fx != fy, nil
+	case token.LSS:
+		return fx < fy, nil
+	case token.LEQ:
+		return fx <= fy, nil
+	case token.GTR:
+		return fx > fy, nil
+	case token.GEQ:
+		return fx >= fy, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.Op)
+}
+
+func (e *Expression) evalCall(n *ast.CallExpr, resolve Resolver) (interface{}, error) {
+	name := n.Fun.(*ast.Ident).Name
+	switch name {
+	case "val":
+		v, _ := stringArg(n.Args[0])
+		return lookup(resolve, Reference{Variable: v})
+	case "ref":
+		device, _ := stringArg(n.Args[0])
+		v, _ := stringArg(n.Args[1])
+		return lookup(resolve, Reference{Device: device, Variable: v})
+	case "cond":
+		cond, err := e.eval(n.Args[0], resolve)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := cond.(bool)
+		if !ok {
+			return nil, ErrTypeMismatch
+		}
+		if b {
+			return e.eval(n.Args[1], resolve)
+		}
+		return e.eval(n.Args[2], resolve)
+	}
+
+	args := make([]float64, 0, len(n.Args))
+	for _, arg := range n.Args {
+		v, err := e.eval(arg, resolve)
+		if err != nil {
+			return nil, err
+		}
+		f, err := number(v)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, f)
+	}
+	switch name {
+	case "abs":
+		return math.Abs(args[0]), nil
+	case "sqrt":
+		return math.Sqrt(args[0]), nil
+	case "pow":
+		return math.Pow(args[0], args[1]), nil
+	case "min":
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	case "max":
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	case "round":
+		if len(args) == 1 {
+			return math.Round(args[0]), nil
+		}
+		p := math.Pow(10, math.Trunc(args[1]))
+		return math.Round(args[0]*p) / p, nil
+	}
+	return nil, fmt.Errorf("unsupported function %s", name)
+}
+
+func lookup(resolve Resolver, ref Reference) (interface{}, error) {
+	v, ok := resolve(ref)
+	if !ok {
+		if len(ref.Device) > 0 {
+			return nil, fmt.Errorf("value of variable %s of device %s not found", ref.Variable, ref.Device)
+		}
+		return nil, fmt.Errorf("value of variable %s not found", ref.Variable)
+	}
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	f, ok := convutil.ToFloat64(v)
+	if !ok {
+		return nil, ErrTypeMismatch
+	}
+	return f, nil
+}
+
+func number(v interface{}) (float64, error) {
+	f, ok := v.(float64)
+	if !ok {
+		return 0, ErrTypeMismatch
+	}
+	return f, nil
+}
+
+func stringArg(node ast.Expr) (string, error) {
+	lit, ok := node.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", errors.New("the argument should be string literal")
+	}
+	return strconv.Unquote(lit.Value)
+}
@@ -0,0 +1,79 @@
+package expression
+
+import (
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	values := map[Reference]interface{}{
+		{Variable: "voltage"}:                 int16(220),
+		{Variable: "current"}:                 float32(1.5),
+		{Variable: "running"}:                 true,
+		{Variable: "温度"}:                      25.5,
+		{Variable: "flow-rate"}:               uint16(3),
+		{Device: "meter", Variable: "energy"}: int64(1000),
+	}
+	resolve := func(ref Reference) (interface{}, bool) {
+		v, ok := values[ref]
+		return v, ok
+	}
+
+	cases := []struct {
+		src      string
+		expected interface{}
+	}{
+		{"voltage * current * 0.001", 0.33},
+		{"-voltage + 0x10", -204.0},
+		{"voltage > 200 && running", true},
+		{"!running || voltage < 100", false},
+		{"cond(running, 1, 0)", 1.0},
+		{"round(温度 / 3, 2)", 8.5},
+		{"val(\"flow-rate\") % 2", 1.0},
+		{"ref(\"meter\", \"energy\") / 10", 100.0},
+		{"max(1, voltage, 300) + min(2, abs(-1))", 301.0},
+		{"running == true", true},
+	}
+	for _, c := range cases {
+		e, err := Parse(c.src)
+		require.NoError(t, err, c.src)
+		v, err := e.Evaluate(resolve)
+		require.NoError(t, err, c.src)
+		if f, ok := c.expected.(float64); ok {
+			require.InDelta(t, f, v, 1e-9, c.src)
+		} else {
+			require.Equal(t, c.expected, v, c.src)
+		}
+	}
+}
+
+func TestParseReferences(t *testing.T) {
+	e, err := Parse("a + val(\"b-c\") * ref(\"device\", \"d\")")
+	require.NoError(t, err)
+	require.Equal(t, []Reference{{Variable: "a"}, {Variable: "b-c"}, {Device: "device", Variable: "d"}}, e.References())
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, src := range []string{"a +", "a = 1", "\"str\"", "os.Exit(1)", "exec(1)", "a[0]", "pow(1)", "ref(a, \"b\")", "a & b"} {
+		_, err := Parse(src)
+		require.Error(t, err, src)
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	resolve := func(ref Reference) (interface{}, bool) { return 0, ref.Variable == "zero" }
+	for _, src := range []string{"1 / zero", "missing + 1", "1 && true", "cond(1, 2, 3)"} {
+		e, err := Parse(src)
+		require.NoError(t, err, src)
+		_, err = e.Evaluate(resolve)
+		require.Error(t, err, src)
+	}
+
+	for _, src := range []string{"sqrt(-1)", "pow(10, 400)", "-pow(10, 400)", "nan + 1"} {
+		e, err := Parse(src)
+		require.NoError(t, err, src)
+		_, err = e.Evaluate(func(ref Reference) (interface{}, bool) { return math.NaN(), true })
+		require.ErrorIs(t, err, ErrNotFinite, src)
+	}
+}
@@ -0,0 +1,11 @@
+package gateway
+
+import "harnsgateway/pkg/runtime"
+
+func (in *GatewayMeta) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
@@ -1,6 +1,9 @@
 package gateway
 
-import "harnsgateway/pkg/runtime"
+import (
+	"harnsgateway/pkg/runtime"
+	"time"
+)
 
 type GatewayMeta struct {
 	Secret string `json:"secret"`
@@ -8,9 +11,11 @@ type GatewayMeta struct {
 }
 
 type ResponseModel struct {
-	Cpus  interface{} `json:"cpus,omitempty"`
-	Mem   interface{} `json:"mem,omitempty"`
-	Disks interface{} `json:"disk,omitempty"`
+	Cpus      interface{} `json:"cpus,omitempty"`
+	Mem       interface{} `json:"mem,omitempty"`
+	Disks     interface{} `json:"disk,omitempty"`
+	Mqtt      interface{} `json:"mqtt,omitempty"`
+	Revisions interface{} `json:"revisions,omitempty"`
 }
 
 type MemUsageInfo struct {
@@ -25,4 +30,27 @@ type DiskUsageInfo struct {
 	UsedPercent string
 }
 
-const gateway = "meta"
+type MqttConnectionInfo struct {
+	Servers              []string   `json:"servers"`
+	Connected            bool       `json:"connected"`
+	Reconnecting         bool       `json:"reconnecting"`
+	ReconnectCount       uint64     `json:"reconnectCount"`
+	LastConnectedTime    *time.Time `json:"lastConnectedTime,omitempty"`
+	LastDisconnectedTime *time.Time `json:"lastDisconnectedTime,omitempty"`
+	LastError            string     `json:"lastError,omitempty"`
+}
+
+// MqttStatusMessage birth and last will message of gateway
+type MqttStatusMessage struct {
+	GatewayId string `json:"gatewayId"`
+	Status    string `json:"status"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+const (
+	MqttOnline  = "online"
+	MqttOffline = "offline"
+)
+
+// MetaKey the key of gateway meta in the gateway store group
+const MetaKey = "meta"
@@ -7,11 +7,14 @@ import (
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
+	"harnsgateway/pkg/apis"
 	"harnsgateway/pkg/host"
+	"harnsgateway/pkg/revision"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/storage"
 	"harnsgateway/pkg/utils/randutil"
 	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
 	"k8s.io/klog/v2"
 	"os"
 	"strconv"
@@ -25,7 +28,11 @@ type Manager struct {
 	cpus        []float64
 	mux         *sync.RWMutex
 	gatewayMeta *GatewayMeta
+	mqttMux     *sync.RWMutex
+	mqttInfo    *MqttConnectionInfo
 	stopCh      <-chan struct{}
+	client      storage.Storage
+	revisions   *revision.History
 }
 
 func NewGatewayManager(stop <-chan struct{}, opts ...Option) *Manager {
@@ -33,6 +40,8 @@ func NewGatewayManager(stop <-chan struct{}, opts ...Option) *Manager {
 		cpus:        make([]float64, 0, 15),
 		mux:         &sync.RWMutex{},
 		gatewayMeta: &GatewayMeta{},
+		mqttMux:     &sync.RWMutex{},
+		mqttInfo:    &MqttConnectionInfo{},
 		stopCh:      stop,
 	}
 	for _, opt := range opts {
@@ -42,10 +51,10 @@ func NewGatewayManager(stop <-chan struct{}, opts ...Option) *Manager {
 }
 
 func (m *Manager) Init() {
-	client := &storage.FsClient{}
-	client.Init(storage.StoreGroupGateway)
+	client := storage.NewClient(storage.StoreGroupGateway)
+	m.client = client
 
-	gd, err := client.Get(gateway)
+	gd, err := client.Get(MetaKey)
 	if err != nil && os.IsNotExist(err) {
 		m.gatewayMeta = &GatewayMeta{
 			Secret: "",
@@ -57,13 +66,14 @@ func (m *Manager) Init() {
 			},
 		}
 		klog.V(3).InfoS("Gateway information not exist,been created automatically", "gatewayId", m.gatewayMeta.ID)
-		if _, err := client.Create(gateway, m.gatewayMeta); err != nil {
+		if _, err := client.Create(MetaKey, m.gatewayMeta); err != nil {
 			klog.V(2).InfoS("Failed to create gateway information", "err", err)
 		}
 	} else if err = json.NewDecoder(bytes.NewReader(gd.([]byte))).Decode(m.gatewayMeta); err != nil {
 		klog.V(2).InfoS("Failed to unmarshal gateway information", "err", err)
 		return
 	}
+	m.loadRevisions()
 
 	go m.collectCpu()
 }
@@ -72,8 +82,68 @@ func (m *Manager) GetGatewayMeta() (*GatewayMeta, error) {
 	return m.gatewayMeta, nil
 }
 
+// UpdateGatewayMeta update the editable gateway meta, the meta is updated in place as it is shared by other managers
+func (m *Manager) UpdateGatewayMeta(version string, object *v1.GatewayMeta, opts ...revision.Option) (*GatewayMeta, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if version != m.gatewayMeta.Version {
+		return nil, apis.ErrMismatch
+	}
+	updated := *m.gatewayMeta
+	updated.Name = object.Name
+	updated.ModTime = time.Now()
+	if _, err := m.client.Update(MetaKey, version, &updated); err != nil {
+		klog.V(2).InfoS("Failed to update gateway information", "err", err)
+		return nil, err
+	}
+	*m.gatewayMeta = updated
+	m.recordRevision(revision.OperationUpdate, opts...)
+	return m.gatewayMeta, nil
+}
+
+func (m *Manager) SetMqttServers(servers []string) {
+	m.mqttMux.Lock()
+	defer m.mqttMux.Unlock()
+	m.mqttInfo.Servers = servers
+}
+
+func (m *Manager) MqttConnected() {
+	m.mqttMux.Lock()
+	defer m.mqttMux.Unlock()
+	now := time.Now()
+	m.mqttInfo.Connected = true
+	m.mqttInfo.Reconnecting = false
+	m.mqttInfo.LastConnectedTime = &now
+}
+
+func (m *Manager) MqttConnectionLost(err error) {
+	m.mqttMux.Lock()
+	defer m.mqttMux.Unlock()
+	now := time.Now()
+	m.mqttInfo.Connected = false
+	m.mqttInfo.LastDisconnectedTime = &now
+	if err != nil {
+		m.mqttInfo.LastError = err.Error()
+	}
+}
+
+func (m *Manager) MqttReconnecting() {
+	m.mqttMux.Lock()
+	defer m.mqttMux.Unlock()
+	m.mqttInfo.Reconnecting = true
+	m.mqttInfo.ReconnectCount++
+}
+
+func (m *Manager) getGatewayMqtt() (*MqttConnectionInfo, error) {
+	m.mqttMux.RLock()
+	defer m.mqttMux.RUnlock()
+	info := *m.mqttInfo
+	return &info, nil
+}
+
 func (m *Manager) getGatewayCpu() (map[string]string, error) {
 	m.mux.RLock()
+	defer m.mux.RUnlock()
 	data := make(map[string]string, 0)
 	if len(m.cpus) == 0 {
 		data["1min"] = fmt.Sprintf("%0.0f%%", 0.0)
@@ -100,7 +170,6 @@ func (m *Manager) getGatewayCpu() (map[string]string, error) {
 		}
 		data["15min"] = fmt.Sprintf("%0.0f%%", count/float64(len(m.cpus)))
 	}
-	m.mux.RUnlock()
 	return data, nil
 }
 
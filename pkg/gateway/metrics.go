@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+	"harnsgateway/pkg/host"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+var _ prometheus.Collector = (*collector)(nil)
+
+var (
+	cpuUsageDesc = prometheus.NewDesc("harnsgateway_gateway_cpu_usage_percent",
+		"CPU usage of gateway in the latest minute.", nil, nil)
+	memoryDesc = prometheus.NewDesc("harnsgateway_gateway_memory_bytes",
+		"Memory of gateway.", []string{"type"}, nil)
+	diskDesc = prometheus.NewDesc("harnsgateway_gateway_disk_bytes",
+		"Disk of gateway.", []string{"path", "type"}, nil)
+	mqttConnectedDesc = prometheus.NewDesc("harnsgateway_mqtt_connected",
+		"Whether the gateway is connected to MQTT.", nil, nil)
+	mqttReconnectsDesc = prometheus.NewDesc("harnsgateway_mqtt_reconnects_total",
+		"Number of attempts to reconnect MQTT.", nil, nil)
+)
+
+type collector struct {
+	mgr *Manager
+}
+
+// NewCollector exports the CPU, memory, disk and MQTT connection of gateway
+func NewCollector(mgr *Manager) prometheus.Collector {
+	return &collector{mgr: mgr}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cpuUsageDesc
+	ch <- memoryDesc
+	ch <- diskDesc
+	ch <- mqttConnectedDesc
+	ch <- mqttReconnectsDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	c.mgr.mux.RLock()
+	if len(c.mgr.cpus) > 0 {
+		ch <- prometheus.MustNewConstMetric(cpuUsageDesc, prometheus.GaugeValue, c.mgr.cpus[len(c.mgr.cpus)-1])
+	}
+	c.mgr.mux.RUnlock()
+
+	if v, err := mem.VirtualMemory(); err == nil {
+		ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(v.Total), "total")
+		ch <- prometheus.MustNewConstMetric(memoryDesc, prometheus.GaugeValue, float64(v.Used), "used")
+	} else {
+		klog.V(4).InfoS("Failed to get gateway mem info", "err", err)
+	}
+
+	for _, path := range sets.NewString(host.GetOSDisk(), host.GetDataDisk()).List() {
+		usage, err := disk.Usage(path)
+		if err != nil {
+			klog.V(4).InfoS("Failed to get gateway disk info", "path", path, "err", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(diskDesc, prometheus.GaugeValue, float64(usage.Total), path, "total")
+		ch <- prometheus.MustNewConstMetric(diskDesc, prometheus.GaugeValue, float64(usage.Used), path, "used")
+	}
+
+	info, _ := c.mgr.getGatewayMqtt()
+	connected := 0.0
+	if info.Connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(mqttConnectedDesc, prometheus.GaugeValue, connected)
+	ch <- prometheus.MustNewConstMetric(mqttReconnectsDesc, prometheus.CounterValue, float64(info.ReconnectCount))
+}
@@ -0,0 +1,63 @@
+package gateway
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin/binding"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/storage"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+)
+
+const maxRevisions = 50
+
+// loadRevisions load the revision history, the gateway meta changed out of history is recorded as snapshot
+func (m *Manager) loadRevisions() {
+	m.revisions = revision.NewHistory(storage.StoreGroupGateway, maxRevisions)
+	if latest := m.revisions.Latest(m.gatewayMeta.ID); latest == nil || latest.Version != m.gatewayMeta.Version {
+		m.recordRevision(revision.OperationSnapshot)
+	}
+}
+
+// recordRevision keep the editable gateway meta, must be called with lock held or before serving
+func (m *Manager) recordRevision(operation string, opts ...revision.Option) {
+	object := &v1.GatewayMeta{Name: m.gatewayMeta.Name}
+	if _, err := m.revisions.Record(m.gatewayMeta.ID, m.gatewayMeta.Version, operation, object, opts...); err != nil {
+		klog.V(2).InfoS("Failed to record revision", "gatewayId", m.gatewayMeta.ID, "err", err)
+	}
+}
+
+// ListRevisions the revisions of gateway meta without snapshots, the latest first
+func (m *Manager) ListRevisions() []*revision.Revision {
+	return m.revisions.List(m.gatewayMeta.ID)
+}
+
+// GetRevision the revision of gateway meta with snapshot
+func (m *Manager) GetRevision(number int) (*revision.Revision, error) {
+	return m.revisions.Get(m.gatewayMeta.ID, number)
+}
+
+// DiffRevisions the changes from the revision to another, the current gateway meta is compared if to is zero
+func (m *Manager) DiffRevisions(from int, to int) (*revision.Diff, error) {
+	m.mux.RLock()
+	current := &v1.GatewayMeta{Name: m.gatewayMeta.Name}
+	m.mux.RUnlock()
+	return m.revisions.Diff(m.gatewayMeta.ID, from, to, current)
+}
+
+// RollbackGatewayMeta update the gateway meta to the revision
+func (m *Manager) RollbackGatewayMeta(version string, number int, opts ...revision.Option) (*GatewayMeta, error) {
+	r, err := m.revisions.Get(m.gatewayMeta.ID, number)
+	if err != nil {
+		return nil, err
+	}
+	object := &v1.GatewayMeta{}
+	if err := json.Unmarshal(r.Object, object); err != nil {
+		return nil, response.ErrRevisionInvalid(number, err.Error())
+	}
+	if err := binding.Validator.ValidateStruct(object); err != nil {
+		return nil, response.ErrRevisionInvalid(number, err.Error())
+	}
+	return m.UpdateGatewayMeta(version, object, append(opts, revision.WithRollback(number))...)
+}
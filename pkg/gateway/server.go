@@ -1,17 +1,30 @@
 package gateway
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/revision"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
 	"net/http"
+	"os"
+	"strconv"
 )
 
 func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
 	group.GET("/gatewayMeta", getGatewayMeta(mgr))
+	group.PUT("/gatewayMeta", updateGatewayMeta(mgr))
+	group.GET("/gatewayMeta/revisions", listRevisions(mgr))
+	group.GET("/gatewayMeta/revisions/:revision", getRevision(mgr))
+	group.GET("/gatewayMeta/revisions/:revision/diff", diffRevisions(mgr))
+	group.POST("/gatewayMeta/revisions/:revision/rollback", rollbackGatewayMeta(mgr))
 	group.GET("/gatewayCpu", getGatewayCpu(mgr))
 	group.GET("/gatewayMem", getGatewayMem(mgr))
 	group.GET("/gatewayDisk", getGatewayDisk(mgr))
+	group.GET("/gatewayMqtt", getGatewayMqtt(mgr))
 }
 
 func getGatewayMeta(mgr *Manager) gin.HandlerFunc {
@@ -54,3 +67,119 @@ func getGatewayDisk(mgr *Manager) gin.HandlerFunc {
 		c.JSON(http.StatusOK, ResponseModel{Disks: disks})
 	}
 }
+
+func getGatewayMqtt(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mqtt, err := mgr.getGatewayMqtt()
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, ResponseModel{Mqtt: mqtt})
+	}
+}
+
+func updateGatewayMeta(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		object := &v1.GatewayMeta{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse gateway meta", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		g, err := mgr.UpdateGatewayMeta(eTag, object, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, g.GetVersion())
+		c.JSON(http.StatusOK, g)
+	}
+}
+
+func listRevisions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ResponseModel{Revisions: mgr.ListRevisions()})
+	}
+}
+
+func getRevision(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		r, err := mgr.GetRevision(number)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func diffRevisions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		to, err := strconv.Atoi(c.DefaultQuery("to", "0"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrRequestBody))
+			return
+		}
+		diff, err := mgr.DiffRevisions(from, to)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, diff)
+	}
+}
+
+func rollbackGatewayMeta(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		g, err := mgr.RollbackGatewayMeta(eTag, number, revision.WithAuthor(revision.SourceApi, c.ClientIP()))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, g.GetVersion())
+		c.JSON(http.StatusOK, g)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
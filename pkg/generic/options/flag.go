@@ -89,13 +89,20 @@ func addHelpAndUsage(cmd *cobra.Command, fs *pflag.FlagSet) {
 
 	// ugly, but necessary, because Cobra's default UsageFunc and HelpFunc pollute the flagset with global flags
 	const usageFmt = "Usage:\n  %s\n\nFlags:\n%s"
+	flagUsages := func(c *cobra.Command) string {
+		// the subcommands parse their own flags
+		if c.HasParent() {
+			return c.LocalFlags().FlagUsagesWrapped(2)
+		}
+		return fs.FlagUsagesWrapped(2)
+	}
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
-		_, _ = fmt.Fprintf(cmd.OutOrStderr(), usageFmt, cmd.UseLine(), fs.FlagUsagesWrapped(2))
+		_, _ = fmt.Fprintf(cmd.OutOrStderr(), usageFmt, cmd.UseLine(), flagUsages(cmd))
 		return nil
 	})
 
 	cmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
-		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n"+usageFmt, cmd.Long, cmd.UseLine(), fs.FlagUsagesWrapped(2))
+		_, _ = fmt.Fprintf(cmd.OutOrStdout(), "%s\n\n"+usageFmt, cmd.Long, cmd.UseLine(), flagUsages(cmd))
 	})
 }
 
@@ -6,7 +6,7 @@ import (
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/storage"
 	"k8s.io/klog/v2"
-	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -29,9 +29,7 @@ func NewStore(group string, resource string, resourceType map[string]runtime.Dev
 		s.ResourceType[dt] = getTypeOfResource(object)
 	}
 
-	client := &storage.FsClient{}
-	client.Init(storage.StoreGroupFromString[group])
-	s.client = client
+	s.client = storage.NewClient(storage.StoreGroupFromString[group])
 
 	return s, nil
 }
@@ -78,27 +76,51 @@ func (s *Store) LoadResource() ([]runtime.Device, error) {
 	var ret []runtime.Device
 	if files, ok := objs.([]*storage.FileInfo); ok {
 		for _, file := range files {
-			func() {
-				fileName := filepath.Base(file.Path)
-				dt := fileName[0:strings.LastIndex(fileName, ".")]
-				obj := reflect.New(s.ResourceType[dt]).Interface().(runtime.Device)
-				f, err := os.Open(file.Path)
-				defer f.Close()
-				if err != nil {
-					klog.V(2).InfoS("Failed to open", "file", file.Path, "resource", s.Resource, "err", err)
-					return
-				}
-				if err = json.NewDecoder(f).Decode(obj); err != nil {
-					klog.V(3).InfoS("Failed to unmarshal", "file", file.Path, "resource", s.Resource, "err", err)
-					return
-				}
-				ret = append(ret, obj)
-			}()
+			fileName := filepath.Base(file.Path)
+			data, err := s.client.Get(filepath.Join(s.Resource, fileName))
+			if err != nil {
+				klog.V(2).InfoS("Failed to open", "file", file.Path, "resource", s.Resource, "err", err)
+				continue
+			}
+			obj, err := s.Decode(fileName, data.([]byte))
+			if err != nil {
+				klog.V(3).InfoS("Failed to unmarshal", "file", file.Path, "resource", s.Resource, "err", err)
+				continue
+			}
+			ret = append(ret, obj)
 		}
 	}
 	return ret, nil
 }
 
+// Watch the changes of resources after the revision, the data of event is decoded by Decode
+func (s *Store) Watch(stopCh <-chan struct{}, rev string) (chan *storage.Event, error) {
+	return s.client.Watch(stopCh, s.Resource, rev)
+}
+
+// Notify publish the change of resource made out of store to watchers
+func (s *Store) Notify(eventType storage.EventType, name string, data []byte) {
+	storage.Notify(storage.StoreGroupFromString[s.Group], eventType, filepath.Join(s.Resource, name), data)
+}
+
+// Decode the resource by the type prefixed to its key, e.g. 'devices/modbus.{id}'
+func (s *Store) Decode(key string, data []byte) (runtime.Device, error) {
+	name := path.Base(filepath.ToSlash(key))
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("unknown type of %s", key)
+	}
+	t, ok := s.ResourceType[name[0:i]]
+	if !ok {
+		return nil, fmt.Errorf("unknown type of %s", key)
+	}
+	obj := reflect.New(t).Interface().(runtime.Device)
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
 func getTypeOfResource(obj runtime.Device) reflect.Type {
 	t := reflect.TypeOf(obj)
 	if t.Kind() != reflect.Ptr {
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"time"
+)
+
+const namespace = "harnsgateway"
+
+// Registry all metrics of gateway are registered in it, exposed by '/metrics'
+var Registry = prometheus.NewRegistry()
+
+var (
+	// PollDuration the duration of polling all frames of device in one cycle
+	PollDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "poll_duration_seconds",
+		Help:      "Duration of polling all data frames of device in one collector cycle.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"device_id", "device_type"})
+
+	// FrameErrors the frames failed after retry
+	FrameErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frame_errors_total",
+		Help:      "Number of data frames failed to read from device after retry.",
+	}, []string{"device_id", "device_type", "frame"})
+
+	// HeartbeatReconnects the attempts to reconnect the unconnected device
+	HeartbeatReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_reconnects_total",
+		Help:      "Number of attempts to reconnect the unconnected device by heartbeat.",
+	}, []string{"device_id", "result"})
+
+	// MqttPublishes the messages published to MQTT
+	MqttPublishes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mqtt_publish_total",
+		Help:      "Number of messages published to MQTT.",
+	}, []string{"topic_type", "result"})
+)
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+const (
+	TopicTypeData  = "data"
+	TopicTypeReply = "reply"
+	TopicTypeAlarm = "alarm"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		PollDuration,
+		FrameErrors,
+		HeartbeatReconnects,
+		MqttPublishes,
+	)
+}
+
+// ObservePoll record the duration of polling since start
+func ObservePoll(deviceId string, deviceType string, start time.Time) {
+	PollDuration.WithLabelValues(deviceId, deviceType).Observe(time.Since(start).Seconds())
+}
+
+// Result convert error to the result label
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// DeleteDevice remove the series of deleted device
+func DeleteDevice(deviceId string) {
+	labels := prometheus.Labels{"device_id": deviceId}
+	PollDuration.DeletePartialMatch(labels)
+	FrameErrors.DeletePartialMatch(labels)
+	HeartbeatReconnects.DeletePartialMatch(labels)
+}
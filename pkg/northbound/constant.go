@@ -0,0 +1,39 @@
+package northbound
+
+import (
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"time"
+)
+
+const (
+	SinkTypeMqtt     = "mqtt"
+	SinkTypeHttp     = "http"
+	SinkTypeFile     = "file"
+	SinkTypeInfluxdb = "influxdb"
+)
+
+// DefaultSinkId the built-in MQTT sink publishing to the topic of device
+const DefaultSinkId = "default"
+
+const (
+	defaultQueueSize     = 1000
+	defaultBatchSize     = 100
+	defaultFlushInterval = 1
+	defaultMaxRetries    = 3
+	defaultTimeout       = 5
+	defaultMaxFileSize   = 64
+	defaultMaxBackups    = 5
+	defaultMeasurement   = "harnsgateway"
+	retryBackoff         = 500 * time.Millisecond
+	mqttTimeout          = 1 * time.Second
+	timestampFormat      = "2006-01-02T15:04:05.000Z"
+)
+
+type NewSink func(config *SinkConfig, client mqtt.Client) (Sink, error)
+
+var SinkTypeMap = map[string]NewSink{
+	SinkTypeMqtt:     newMqttSink,
+	SinkTypeHttp:     newHttpSink,
+	SinkTypeFile:     newFileSink,
+	SinkTypeInfluxdb: newInfluxdbSink,
+}
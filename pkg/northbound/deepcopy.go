@@ -0,0 +1,43 @@
+package northbound
+
+import "harnsgateway/pkg/runtime"
+
+func (in *SinkConfig) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+
+	if in.Devices != nil {
+		out.Devices = make([]string, len(in.Devices))
+		copy(out.Devices, in.Devices)
+	}
+	if in.Mqtt != nil {
+		o := *in.Mqtt
+		out.Mqtt = &o
+	}
+	if in.Http != nil {
+		o := *in.Http
+		if in.Http.Headers != nil {
+			o.Headers = make(map[string]string, len(in.Http.Headers))
+			for k, v := range in.Http.Headers {
+				o.Headers[k] = v
+			}
+		}
+		out.Http = &o
+	}
+	if in.File != nil {
+		o := *in.File
+		out.File = &o
+	}
+	if in.Influxdb != nil {
+		o := *in.Influxdb
+		out.Influxdb = &o
+	}
+	if in.Status != nil {
+		o := *in.Status
+		out.Status = &o
+	}
+
+	return &out
+}
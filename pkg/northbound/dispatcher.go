@@ -0,0 +1,158 @@
+package northbound
+
+import (
+	"context"
+	"errors"
+	"k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+// dispatcher buffers messages of one sink and writes them in batches,
+// so that a slow or unreachable destination never blocks the collection.
+type dispatcher struct {
+	config *SinkConfig
+	sink   Sink
+	queue  chan *Message
+	exitCh chan struct{}
+	doneCh chan struct{}
+	mux    *sync.RWMutex
+	status *SinkStatus
+}
+
+func newDispatcher(config *SinkConfig, sink Sink) *dispatcher {
+	return &dispatcher{
+		config: config,
+		sink:   sink,
+		queue:  make(chan *Message, config.QueueSize),
+		exitCh: make(chan struct{}, 0),
+		doneCh: make(chan struct{}, 0),
+		mux:    &sync.RWMutex{},
+		status: &SinkStatus{Healthy: true},
+	}
+}
+
+func (d *dispatcher) offer(message *Message) {
+	select {
+	case d.queue <- message:
+	default:
+		d.mux.Lock()
+		d.status.Dropped++
+		d.mux.Unlock()
+		klog.V(4).InfoS("Dropped message because of the sink queue is full", "sinkId", d.config.ID, "deviceId", message.DeviceId)
+	}
+}
+
+func (d *dispatcher) run() {
+	defer close(d.doneCh)
+	ticker := time.NewTicker(time.Duration(d.config.FlushInterval) * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]*Message, 0, d.config.BatchSize)
+	for {
+		select {
+		case <-d.exitCh:
+			for {
+				select {
+				case message := <-d.queue:
+					batch = append(batch, message)
+				default:
+					if len(batch) > 0 {
+						d.flush(batch)
+					}
+					return
+				}
+			}
+		case message := <-d.queue:
+			batch = append(batch, message)
+			if len(batch) >= d.config.BatchSize {
+				d.flush(batch)
+				batch = make([]*Message, 0, d.config.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				d.flush(batch)
+				batch = make([]*Message, 0, d.config.BatchSize)
+			}
+		}
+	}
+}
+
+// flush write the batch with retries, the messages written before failing are not retried
+func (d *dispatcher) flush(batch []*Message) {
+	var err error
+	pending, skipped := batch, 0
+retry:
+	for i := 0; ; i++ {
+		err = d.sink.Write(context.Background(), pending)
+		var we *WriteError
+		if errors.As(err, &we) {
+			pending, skipped, err = pending[we.Written:], skipped+we.Skipped, we.Err
+		} else if err == nil {
+			pending = nil
+		}
+		if err == nil || len(pending) == 0 || i >= d.config.MaxRetries {
+			break
+		}
+		klog.V(3).InfoS("Failed to write sink", "sinkId", d.config.ID, "retry", i, "pending", len(pending), "err", err)
+		select {
+		case <-d.exitCh:
+			// do not retry when exiting
+			break retry
+		case <-time.After(retryBackoff * time.Duration(i+1)):
+		}
+	}
+
+	now := time.Now()
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.status.Sent += uint64(len(batch) - len(pending) - skipped)
+	d.status.Failed += uint64(len(pending) + skipped)
+	if len(batch) > len(pending)+skipped {
+		d.status.LastSentTime = &now
+	}
+	switch {
+	case err != nil:
+		klog.V(2).InfoS("Failed to write sink after retry", "sinkId", d.config.ID, "count", len(pending), "err", err)
+		d.status.Healthy = false
+		d.status.LastError = err.Error()
+		d.status.LastErrorTime = &now
+	case skipped > 0:
+		// the destination is healthy, the messages can not be encoded
+		d.status.Healthy = true
+		d.status.LastError = (&WriteError{Skipped: skipped}).Error()
+		d.status.LastErrorTime = &now
+	default:
+		d.status.Healthy = true
+	}
+}
+
+// stop flush the messages in queue until ctx is done, the sink is closed after the dispatcher exits
+func (d *dispatcher) stop(ctx context.Context) {
+	close(d.exitCh)
+	select {
+	case <-d.doneCh:
+		d.close()
+	case <-ctx.Done():
+		klog.V(2).InfoS("Timeout to flush sink", "sinkId", d.config.ID, "backlog", len(d.queue))
+		// the sink may be still writing
+		go func() {
+			<-d.doneCh
+			d.close()
+		}()
+	}
+}
+
+func (d *dispatcher) close() {
+	if err := d.sink.Close(); err != nil {
+		klog.V(2).InfoS("Failed to close sink", "sinkId", d.config.ID, "err", err)
+	}
+}
+
+func (d *dispatcher) getStatus() *SinkStatus {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	status := *d.status
+	status.Backlog = len(d.queue)
+	return &status
+}
@@ -0,0 +1,92 @@
+package northbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeSink fails at the message of failAt once, records the written messages
+type fakeSink struct {
+	failAt  int
+	written []*Message
+	closed  bool
+}
+
+func (s *fakeSink) Write(ctx context.Context, messages []*Message) error {
+	for i, message := range messages {
+		if i == s.failAt {
+			s.failAt = -1
+			return &WriteError{Written: i, Err: errors.New("unreachable")}
+		}
+		s.written = append(s.written, message)
+	}
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func newMessage(deviceId string, value interface{}) *Message {
+	return &Message{DeviceId: deviceId, Data: &runtime.PublishData{Payload: runtime.Payload{Data: []runtime.TimeSeriesData{{
+		Values: []runtime.PointData{{DataPointId: "current", Value: value}},
+	}}}}}
+}
+
+func TestDispatcherFlushPartial(t *testing.T) {
+	sink := &fakeSink{failAt: 2}
+	d := newDispatcher(&SinkConfig{QueueSize: 10, BatchSize: 10, FlushInterval: 1, MaxRetries: 3}, sink)
+	batch := []*Message{newMessage("1", 1), newMessage("2", 2), newMessage("3", 3), newMessage("4", 4)}
+	d.flush(batch)
+
+	// the messages written before failing are not written again
+	if len(sink.written) != 4 {
+		t.Fatalf("expected 4 messages written once, got %d", len(sink.written))
+	}
+	for i, message := range sink.written {
+		if message != batch[i] {
+			t.Errorf("message %d = %s, want %s", i, message.DeviceId, batch[i].DeviceId)
+		}
+	}
+	if status := d.getStatus(); status.Sent != 4 || status.Failed != 0 || !status.Healthy {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	go d.run()
+	d.stop(context.Background())
+	if !sink.closed {
+		t.Errorf("expected sink closed after dispatcher exits")
+	}
+}
+
+func TestHttpSinkSkipUnencodable(t *testing.T) {
+	var received []*Message
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+	sink, _ := newHttpSink(&SinkConfig{Http: &v1.HttpSinkOption{Url: server.URL}}, nil)
+
+	err := sink.Write(context.Background(), []*Message{newMessage("1", 1), newMessage("2", math.NaN()), newMessage("3", 3)})
+	var we *WriteError
+	if !errors.As(err, &we) || we.Written != 3 || we.Skipped != 1 || we.Err != nil {
+		t.Fatalf("expected message of NaN skipped, got %v", err)
+	}
+	if len(received) != 2 || received[0].DeviceId != "1" || received[1].DeviceId != "3" {
+		t.Errorf("expected encodable messages written, got %v", received)
+	}
+
+	d := newDispatcher(&SinkConfig{QueueSize: 10, BatchSize: 10, FlushInterval: 1, MaxRetries: 3}, sink)
+	d.flush([]*Message{newMessage("1", 1), newMessage("2", math.Inf(1))})
+	if status := d.getStatus(); status.Sent != 1 || status.Failed != 1 || !status.Healthy || len(status.LastError) == 0 {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
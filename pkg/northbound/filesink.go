@@ -0,0 +1,151 @@
+package northbound
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Sink = (*fileSink)(nil)
+
+const (
+	fileFormatJsonLines = "jsonl"
+	fileFormatCsv       = "csv"
+)
+
+// fileSink appends messages to local file and rotates it by size.
+// The jsonl format writes one message per line,
+// the csv format writes one point per line with columns timestamp,deviceId,dataPointId,value.
+type fileSink struct {
+	mux    *sync.Mutex
+	option *v1.FileSinkOption
+	path   string
+	file   *os.File
+	size   int64
+}
+
+func newFileSink(config *SinkConfig, _ mqtt.Client) (Sink, error) {
+	option := *config.File
+	if len(option.Format) == 0 {
+		option.Format = fileFormatJsonLines
+	}
+	if option.MaxSize == 0 {
+		option.MaxSize = defaultMaxFileSize
+	}
+	if option.MaxBackups == 0 {
+		option.MaxBackups = defaultMaxBackups
+	}
+	if err := os.MkdirAll(option.Directory, 0755); err != nil {
+		return nil, err
+	}
+	s := &fileSink{
+		mux:    &sync.Mutex{},
+		option: &option,
+		path:   filepath.Join(option.Directory, fmt.Sprintf("%s.%s", config.ID, option.Format)),
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileSink) Write(ctx context.Context, messages []*Message) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	builder := &strings.Builder{}
+	skipped := 0
+	switch s.option.Format {
+	case fileFormatCsv:
+		w := csv.NewWriter(builder)
+		for _, message := range messages {
+			for _, tsd := range message.Data.Payload.Data {
+				for _, pd := range tsd.Values {
+					_ = w.Write([]string{tsd.Timestamp, message.DeviceId, pd.DataPointId, fmt.Sprint(pd.Value)})
+				}
+			}
+		}
+		w.Flush()
+	default:
+		var lines []byte
+		if lines, skipped = encodeMessages(messages, '\n'); len(lines) > 0 {
+			builder.Write(lines)
+			builder.WriteByte('\n')
+		}
+	}
+
+	n, err := s.file.WriteString(builder.String())
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.size >= int64(s.option.MaxSize)*1024*1024 {
+		if err := s.rotate(); err != nil {
+			// the messages are written, only the rotation is failed
+			return &WriteError{Written: len(messages), Skipped: skipped, Err: err}
+		}
+	}
+	return writeResult(len(messages), skipped, nil)
+}
+
+func (s *fileSink) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *fileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.file = f
+	s.size = info.Size()
+	return nil
+}
+
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	ext := filepath.Ext(s.path)
+	backup := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(s.path, ext), time.Now().Format("20060102T150405.000"), ext)
+	if err := os.Rename(s.path, backup); err != nil {
+		return err
+	}
+
+	backups, _ := filepath.Glob(fmt.Sprintf("%s-*%s", strings.TrimSuffix(s.path, ext), ext))
+	sort.Strings(backups)
+	for i := 0; i < len(backups)-int(s.option.MaxBackups); i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			klog.V(2).InfoS("Failed to remove sink backup file", "file", backups[i], "err", err)
+		}
+	}
+	return s.open()
+}
@@ -0,0 +1,58 @@
+package northbound
+
+import (
+	"bytes"
+	"context"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	v1 "harnsgateway/pkg/v1"
+	"net/http"
+	"time"
+)
+
+var _ Sink = (*httpSink)(nil)
+
+// httpSink posts a batch of messages as JSON array to webhook
+type httpSink struct {
+	client *http.Client
+	option *v1.HttpSinkOption
+}
+
+func newHttpSink(config *SinkConfig, _ mqtt.Client) (Sink, error) {
+	timeout := config.Http.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &httpSink{
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		option: config.Http,
+	}, nil
+}
+
+func (s *httpSink) Write(ctx context.Context, messages []*Message) error {
+	body, skipped := encodeMessages(messages, ',')
+	if skipped == len(messages) {
+		return writeResult(len(messages), skipped, nil)
+	}
+	body = append(append([]byte{'['}, body...), ']')
+	method := s.option.Method
+	if len(method) == 0 {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.option.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.option.Headers {
+		req.Header.Set(k, v)
+	}
+	if err := doRequest(s.client, req); err != nil {
+		return err
+	}
+	return writeResult(len(messages), skipped, nil)
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
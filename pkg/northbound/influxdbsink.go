@@ -0,0 +1,118 @@
+package northbound
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	v1 "harnsgateway/pkg/v1"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var _ Sink = (*influxdbSink)(nil)
+
+var (
+	tagEscaper   = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+	fieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxdbSink writes messages in InfluxDB line protocol
+// measurement,gateway={gatewayId},device={deviceId} {dataPointId}={value} {timestamp}
+type influxdbSink struct {
+	client *http.Client
+	option *v1.InfluxdbOption
+}
+
+func newInfluxdbSink(config *SinkConfig, _ mqtt.Client) (Sink, error) {
+	timeout := config.Influxdb.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &influxdbSink{
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+		option: config.Influxdb,
+	}, nil
+}
+
+func (s *influxdbSink) Write(ctx context.Context, messages []*Message) error {
+	measurement := s.option.Measurement
+	if len(measurement) == 0 {
+		measurement = defaultMeasurement
+	}
+
+	buf := &bytes.Buffer{}
+	for _, message := range messages {
+		for _, tsd := range message.Data.Payload.Data {
+			fields := make([]string, 0, len(tsd.Values))
+			for _, pd := range tsd.Values {
+				if field, ok := formatField(pd.Value); ok {
+					fields = append(fields, tagEscaper.Replace(pd.DataPointId)+"="+field)
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			ts := time.Now()
+			if t, err := time.Parse(timestampFormat, tsd.Timestamp); err == nil {
+				ts = t
+			}
+			_, _ = fmt.Fprintf(buf, "%s,gateway=%s,device=%s %s %d\n", tagEscaper.Replace(measurement),
+				tagEscaper.Replace(message.GatewayId), tagEscaper.Replace(message.DeviceId), strings.Join(fields, ","), ts.UnixNano())
+		}
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.option.Url, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if len(s.option.Token) > 0 {
+		req.Header.Set("Authorization", "Token "+s.option.Token)
+	}
+	return doRequest(s.client, req)
+}
+
+func (s *influxdbSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+func formatField(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v), true
+	case int16, int32, int64, uint16, int, uint, uint32, uint64:
+		return fmt.Sprintf("%di", v), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return `"` + fieldEscaper.Replace(v) + `"`, true
+	case nil:
+		return "", false
+	default:
+		return `"` + fieldEscaper.Replace(fmt.Sprint(v)) + `"`, true
+	}
+}
+
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,64 @@
+package northbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/klog/v2"
+)
+
+// Sink the northbound destination of collected data
+type Sink interface {
+	// Write writes a batch of messages, the caller retries the whole batch when an error is returned unless it is
+	// a *WriteError, which tells the messages handled before failing
+	Write(ctx context.Context, messages []*Message) error
+	Close() error
+}
+
+// WriteError the batch is written partially, the messages before Written are handled and the others are retried.
+// The handled messages include the skipped messages, which can never be written, e.g. failed to encode.
+type WriteError struct {
+	Written int
+	Skipped int
+	// Err the error of writing the message at Written, nil if all messages are handled
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("skipped %d messages failed to encode", e.Skipped)
+	}
+	return fmt.Sprintf("written %d messages: %v", e.Written, e.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// writeResult the error of sink which handled the messages before written and skipped some of them
+func writeResult(written int, skipped int, err error) error {
+	if err == nil && skipped == 0 {
+		return nil
+	}
+	return &WriteError{Written: written, Skipped: skipped, Err: err}
+}
+
+// encodeMessages encode the messages in JSON separated by sep, the messages failed to encode are skipped
+func encodeMessages(messages []*Message, sep byte) ([]byte, int) {
+	buf := &bytes.Buffer{}
+	skipped := 0
+	for _, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			klog.V(2).InfoS("Failed to encode message", "deviceId", message.DeviceId, "err", err)
+			skipped++
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte(sep)
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), skipped
+}
@@ -0,0 +1,329 @@
+package northbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/gateway"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Option func(*Manager)
+
+// WithDefaultMqtt set the QoS and retain flag of the built-in MQTT sink
+func WithDefaultMqtt(qos byte, retain bool) Option {
+	return func(m *Manager) {
+		m.defaultMqtt = &v1.MqttSinkOption{Qos: qos, Retain: retain}
+	}
+}
+
+// Manager routes the data of devices to all matched sinks
+type Manager struct {
+	gatewayMeta *gateway.GatewayMeta
+	mqttClient  mqtt.Client
+	defaultMqtt *v1.MqttSinkOption
+	mu          *sync.RWMutex
+	sinks       map[string]*SinkConfig
+	dispatchers map[string]*dispatcher
+	client      storage.Storage
+	stopCh      <-chan struct{}
+}
+
+func NewManager(mqttClient mqtt.Client, gatewayMeta *gateway.GatewayMeta, stop <-chan struct{}, opts ...Option) *Manager {
+	m := &Manager{
+		gatewayMeta: gatewayMeta,
+		mqttClient:  mqttClient,
+		defaultMqtt: &v1.MqttSinkOption{Qos: 1},
+		mu:          &sync.RWMutex{},
+		sinks:       make(map[string]*SinkConfig, 0),
+		dispatchers: make(map[string]*dispatcher, 0),
+		stopCh:      stop,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Manager) Init() {
+	m.client = storage.NewClient(storage.StoreGroupNorthbound)
+
+	defaultSink := &SinkConfig{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    DefaultSinkId,
+			ID:      DefaultSinkId,
+			Version: "0",
+			ModTime: time.Now(),
+		},
+		SinkType: SinkTypeMqtt,
+		Enabled:  true,
+		Mqtt:     m.defaultMqtt,
+	}
+	setDefaults(defaultSink)
+	defaultSink.BatchSize = 1
+	if err := m.startSink(defaultSink); err != nil {
+		klog.V(1).InfoS("Failed to start default sink", "err", err)
+	}
+
+	objs, _ := m.client.List(storage.Sinks)
+	if files, ok := objs.([]*storage.FileInfo); ok {
+		for _, file := range files {
+			data, err := m.client.Get(filepath.Join(storage.Sinks, filepath.Base(file.Path)))
+			if err != nil {
+				continue
+			}
+			sc := &SinkConfig{}
+			if err = json.NewDecoder(bytes.NewReader(data.([]byte))).Decode(sc); err != nil {
+				klog.V(2).InfoS("Failed to unmarshal sink", "file", file.Path, "err", err)
+				continue
+			}
+			sc.Status = nil
+			if err = m.startSink(sc); err != nil {
+				klog.V(2).InfoS("Failed to start sink", "sinkId", sc.ID, "err", err)
+			}
+		}
+	}
+}
+
+// Route sends the data of device to all enabled sinks, never blocks.
+func (m *Manager) Route(device runtime.Device, data *runtime.PublishData) {
+	message := &Message{
+		GatewayId: m.gatewayMeta.ID,
+		DeviceId:  device.GetID(),
+		Topic:     device.GetTopic(),
+		Data:      data,
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for id, d := range m.dispatchers {
+		if m.sinks[id].MatchDevice(message.DeviceId) {
+			d.offer(message)
+		}
+	}
+}
+
+func (m *Manager) CreateSink(object *v1.Sink) (*SinkConfig, error) {
+	sc := &SinkConfig{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applySink(sc, object)
+	if err := validateSink(sc); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(sinkKey(sc.ID), sc); err != nil {
+		klog.V(2).InfoS("Failed to store sink", "error", err)
+		return nil, err
+	}
+	if err := m.startSink(sc); err != nil {
+		klog.V(2).InfoS("Failed to start sink", "sinkId", sc.ID, "err", err)
+	}
+	return m.GetSinkById(sc.ID)
+}
+
+func (m *Manager) UpdateSinkById(id string, version string, object *v1.Sink) (*SinkConfig, error) {
+	old, err := m.GetSinkById(id)
+	if err != nil {
+		return nil, err
+	}
+	if id == DefaultSinkId {
+		return nil, apis.ErrImmutable
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	sc := old.DeepCopyObject().(*SinkConfig)
+	sc.Status = nil
+	sc.ModTime = time.Now()
+	applySink(sc, object)
+	if err := validateSink(sc); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Update(sinkKey(id), version, sc); err != nil {
+		klog.V(2).InfoS("Failed to update sink", "error", err)
+		return nil, err
+	}
+	m.stopSink(id)
+	if err := m.startSink(sc); err != nil {
+		klog.V(2).InfoS("Failed to start sink", "sinkId", sc.ID, "err", err)
+	}
+	return m.GetSinkById(id)
+}
+
+func (m *Manager) DeleteSink(id string, version string) (*SinkConfig, error) {
+	sc, err := m.GetSinkById(id)
+	if err != nil {
+		return nil, err
+	}
+	if id == DefaultSinkId {
+		return nil, apis.ErrImmutable
+	}
+	if sc.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.client.Delete(sinkKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete sink", "sinkId", id, "err", err)
+		return nil, err
+	}
+	m.stopSink(id)
+	klog.V(2).InfoS("Deleted sink", "sinkId", id)
+	return sc, nil
+}
+
+func (m *Manager) ListSinks() ([]*SinkConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scs := make([]*SinkConfig, 0, len(m.sinks))
+	for id, sc := range m.sinks {
+		scs = append(scs, m.withStatus(id, sc))
+	}
+	return scs, nil
+}
+
+func (m *Manager) GetSinkById(id string) (*SinkConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	sc, ok := m.sinks[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return m.withStatus(id, sc), nil
+}
+
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, d := range m.dispatchers {
+		d.stop(ctx)
+		delete(m.dispatchers, id)
+	}
+	return nil
+}
+
+func (m *Manager) withStatus(id string, sc *SinkConfig) *SinkConfig {
+	copied := sc.DeepCopyObject().(*SinkConfig)
+	if d, ok := m.dispatchers[id]; ok {
+		copied.Status = d.getStatus()
+	}
+	return copied
+}
+
+func (m *Manager) startSink(sc *SinkConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sinks[sc.ID] = sc
+	if !sc.Enabled {
+		return nil
+	}
+	sink, err := SinkTypeMap[sc.SinkType](sc, m.mqttClient)
+	if err != nil {
+		return err
+	}
+	d := newDispatcher(sc, sink)
+	m.dispatchers[sc.ID] = d
+	go d.run()
+	klog.V(2).InfoS("Started sink", "sinkId", sc.ID, "sinkType", sc.SinkType)
+	return nil
+}
+
+func (m *Manager) stopSink(id string) {
+	m.mu.Lock()
+	d, ok := m.dispatchers[id]
+	delete(m.dispatchers, id)
+	delete(m.sinks, id)
+	m.mu.Unlock()
+	if ok {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout*time.Second)
+		defer cancel()
+		d.stop(ctx)
+	}
+}
+
+func applySink(sc *SinkConfig, object *v1.Sink) {
+	sc.Name = object.Name
+	sc.SinkType = object.SinkType
+	sc.Enabled = object.Enabled
+	sc.Devices = object.Devices
+	sc.QueueSize = object.QueueSize
+	sc.BatchSize = object.BatchSize
+	sc.FlushInterval = object.FlushInterval
+	sc.MaxRetries = object.MaxRetries
+	sc.Mqtt = object.Mqtt
+	sc.Http = object.Http
+	sc.File = object.File
+	sc.Influxdb = object.Influxdb
+	setDefaults(sc)
+}
+
+func setDefaults(sc *SinkConfig) {
+	if sc.QueueSize == 0 {
+		sc.QueueSize = defaultQueueSize
+	}
+	if sc.BatchSize == 0 {
+		sc.BatchSize = defaultBatchSize
+	}
+	if sc.FlushInterval == 0 {
+		sc.FlushInterval = defaultFlushInterval
+	}
+	if sc.MaxRetries == 0 {
+		sc.MaxRetries = defaultMaxRetries
+	}
+}
+
+func validateSink(sc *SinkConfig) error {
+	if _, ok := SinkTypeMap[sc.SinkType]; !ok {
+		return response.ErrSinkTypeUnSupported(sc.SinkType)
+	}
+	switch sc.SinkType {
+	case SinkTypeMqtt:
+		if sc.Mqtt == nil {
+			return response.ErrSinkOptionRequired(sc.SinkType)
+		}
+	case SinkTypeHttp:
+		if sc.Http == nil || len(sc.Http.Url) == 0 {
+			return response.ErrSinkOptionRequired(sc.SinkType)
+		}
+	case SinkTypeFile:
+		if sc.File == nil || len(sc.File.Directory) == 0 {
+			return response.ErrSinkOptionRequired(sc.SinkType)
+		}
+		if len(sc.File.Format) > 0 && sc.File.Format != fileFormatJsonLines && sc.File.Format != fileFormatCsv {
+			return response.ErrSinkOptionRequired(fmt.Sprintf("%s.format", sc.SinkType))
+		}
+	case SinkTypeInfluxdb:
+		if sc.Influxdb == nil || len(sc.Influxdb.Url) == 0 {
+			return response.ErrSinkOptionRequired(sc.SinkType)
+		}
+	}
+	for i, id := range sc.Devices {
+		sc.Devices[i] = strings.TrimSpace(id)
+	}
+	return nil
+}
+
+func sinkKey(id string) string {
+	return filepath.Join(storage.Sinks, id)
+}
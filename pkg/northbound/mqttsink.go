@@ -0,0 +1,59 @@
+package northbound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"harnsgateway/pkg/metrics"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+var _ Sink = (*mqttSink)(nil)
+
+var errMqttTimeout = errors.New("publish MQTT timeout")
+
+type mqttSink struct {
+	client mqtt.Client
+	option *v1.MqttSinkOption
+}
+
+func newMqttSink(config *SinkConfig, client mqtt.Client) (Sink, error) {
+	return &mqttSink{
+		client: client,
+		option: config.Mqtt,
+	}, nil
+}
+
+func (s *mqttSink) Write(ctx context.Context, messages []*Message) error {
+	skipped := 0
+	for i, message := range messages {
+		topic := message.Topic
+		if len(s.option.Topic) > 0 {
+			topic = strings.NewReplacer("{gatewayId}", message.GatewayId, "{deviceId}", message.DeviceId).Replace(s.option.Topic)
+		}
+		payload, err := json.Marshal(message.Data)
+		if err != nil {
+			klog.V(2).InfoS("Failed to encode message", "deviceId", message.DeviceId, "err", err)
+			skipped++
+			continue
+		}
+		token := s.client.Publish(topic, s.option.Qos, s.option.Retain, payload)
+		if !token.WaitTimeout(mqttTimeout) {
+			metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeData, metrics.ResultFailure).Inc()
+			return writeResult(i, skipped, errMqttTimeout)
+		}
+		metrics.MqttPublishes.WithLabelValues(metrics.TopicTypeData, metrics.Result(token.Error())).Inc()
+		if token.Error() != nil {
+			return writeResult(i, skipped, token.Error())
+		}
+	}
+	return writeResult(len(messages), skipped, nil)
+}
+
+func (s *mqttSink) Close() error {
+	// the client is shared with gateway
+	return nil
+}
@@ -0,0 +1,127 @@
+package northbound
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/sinks", createSink(mgr))
+	group.DELETE("/sinks/:id", deleteSink(mgr))
+	group.PUT("/sinks/:id", updateSinkById(mgr))
+	group.GET("/sinks", listSinks(mgr))
+	group.GET("/sinks/:id", getSinkById(mgr))
+}
+
+func createSink(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Sink{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse sink", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		sc, err := mgr.CreateSink(object)
+		if err != nil {
+			if response.IsResponseError(err) {
+				c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+			} else {
+				c.Status(http.StatusInternalServerError)
+			}
+			return
+		}
+
+		c.Header(apis.ETag, sc.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, sc.GetID()))
+		c.JSON(http.StatusCreated, sc)
+	}
+}
+
+func deleteSink(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		sc, err := mgr.DeleteSink(id, eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sc)
+	}
+}
+
+func updateSinkById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.Sink{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse sink", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateSinkById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listSinks(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scs, _ := mgr.ListSinks()
+		c.JSON(http.StatusOK, &ResponseModel{Sinks: scs})
+	}
+}
+
+func getSinkById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sc, err := mgr.GetSinkById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, sc.GetVersion())
+		c.JSON(http.StatusOK, sc)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case errors.Is(err, apis.ErrImmutable):
+		c.Status(http.StatusForbidden)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
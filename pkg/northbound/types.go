@@ -0,0 +1,58 @@
+package northbound
+
+import (
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"time"
+)
+
+type SinkConfig struct {
+	runtime.ObjectMeta
+	SinkType      string             `json:"sinkType"`          // mqtt、http、file、influxdb
+	Enabled       bool               `json:"enabled"`           // 是否启用
+	Devices       []string           `json:"devices,omitempty"` // 设备id 为空时发送全部设备数据
+	QueueSize     int                `json:"queueSize"`         // 缓冲队列长度
+	BatchSize     int                `json:"batchSize"`         // 批量发送数量
+	FlushInterval uint               `json:"flushInterval"`     // 批量发送间隔(秒)
+	MaxRetries    int                `json:"maxRetries"`        // 重试次数
+	Mqtt          *v1.MqttSinkOption `json:"mqtt,omitempty"`
+	Http          *v1.HttpSinkOption `json:"http,omitempty"`
+	File          *v1.FileSinkOption `json:"file,omitempty"`
+	Influxdb      *v1.InfluxdbOption `json:"influxdb,omitempty"`
+	Status        *SinkStatus        `json:"status,omitempty"`
+}
+
+func (sc *SinkConfig) MatchDevice(deviceId string) bool {
+	if len(sc.Devices) == 0 {
+		return true
+	}
+	for _, id := range sc.Devices {
+		if id == deviceId {
+			return true
+		}
+	}
+	return false
+}
+
+type SinkStatus struct {
+	Healthy       bool       `json:"healthy"`
+	Backlog       int        `json:"backlog"` // 队列中待发送的消息数量
+	Sent          uint64     `json:"sent"`
+	Failed        uint64     `json:"failed"`
+	Dropped       uint64     `json:"dropped"` // 队列已满时丢弃的消息数量
+	LastSentTime  *time.Time `json:"lastSentTime,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+}
+
+// Message the data of one device collected in one cycle
+type Message struct {
+	GatewayId string               `json:"gatewayId"`
+	DeviceId  string               `json:"deviceId"`
+	Topic     string               `json:"topic"`
+	Data      *runtime.PublishData `json:"data"`
+}
+
+type ResponseModel struct {
+	Sinks interface{} `json:"sinks,omitempty"`
+}
@@ -1,6 +1,7 @@
 package modbus
 
 import (
+	"harnsgateway/pkg/apis/response"
 	modbus "harnsgateway/pkg/protocol/modbus/runtime"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
@@ -58,6 +59,12 @@ func (m *ModbusDeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.De
 	}
 	if len(modbusDevice.Variables) > 0 {
 		for _, variable := range modbusDevice.Variables {
+			if err := variable.Transform.Validate(); err != nil {
+				return nil, response.ErrTransformInvalid(variable.Name, err.Error())
+			}
+			if err := variable.Constraint.Validate(); err != nil {
+				return nil, response.ErrConstraintInvalid(variable.Name, err.Error())
+			}
 			v := &modbus.Variable{
 				DataType:     constant.StringToDataType[variable.DataType],
 				Name:         variable.Name,
@@ -68,6 +75,9 @@ func (m *ModbusDeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.De
 				Amount:       variable.Amount,
 				DefaultValue: variable.DefaultValue,
 				AccessMode:   variable.AccessMode,
+				Transform:    variable.Transform,
+				Constraint:   variable.Constraint,
+				Disabled:     variable.Disabled,
 			}
 			d.Variables = append(d.Variables, v)
 			d.VariablesMap[v.Name] = v
@@ -86,6 +96,19 @@ func (m *ModbusDeviceManager) DeleteDevice(device runtime.Device) (runtime.Devic
 }
 
 func (m *ModbusDeviceManager) UpdateValidation(deviceType v1.DeviceType, device runtime.Device) error {
+	modbusDevice, ok := deviceType.(*v1.ModBusDevice)
+	if !ok {
+		klog.V(2).InfoS("Unsupported device,type not Modbus")
+		return constant.ErrDeviceType
+	}
+	for _, variable := range modbusDevice.Variables {
+		if err := variable.Transform.Validate(); err != nil {
+			return response.ErrTransformInvalid(variable.Name, err.Error())
+		}
+		if err := variable.Constraint.Validate(); err != nil {
+			return response.ErrConstraintInvalid(variable.Name, err.Error())
+		}
+	}
 	return nil
 }
 
@@ -150,6 +173,9 @@ func (m *ModbusDeviceManager) UpdateDevice(id string, deviceType v1.DeviceType,
 			v.Amount = ndv.Amount
 			v.DefaultValue = ndv.DefaultValue
 			v.AccessMode = ndv.AccessMode
+			v.Transform = ndv.Transform
+			v.Constraint = ndv.Constraint
+			v.Disabled = ndv.Disabled
 		} else {
 			v := &modbus.Variable{
 				DataType:     constant.StringToDataType[ndv.DataType],
@@ -161,6 +187,9 @@ func (m *ModbusDeviceManager) UpdateDevice(id string, deviceType v1.DeviceType,
 				Amount:       ndv.Amount,
 				DefaultValue: ndv.DefaultValue,
 				AccessMode:   ndv.AccessMode,
+				Transform:    ndv.Transform,
+				Constraint:   ndv.Constraint,
+				Disabled:     ndv.Disabled,
 			}
 			copyDevice.Variables = append(copyDevice.Variables, v)
 			copyDevice.VariablesMap[v.Name] = v
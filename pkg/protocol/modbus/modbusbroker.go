@@ -3,7 +3,9 @@ package modbus
 import (
 	"context"
 	"errors"
+	"fmt"
 	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/metrics"
 	"harnsgateway/pkg/protocol/modbus/model"
 	modbus "harnsgateway/pkg/protocol/modbus/runtime"
 	"harnsgateway/pkg/runtime"
@@ -29,6 +31,7 @@ tcp报文头(6)  +  地址(1)   +   pdu(253)   +  16位校验(2)  = 262
 
 // ModBusDataFrame 报文对应的数据点位
 var _ runtime.Broker = (*ModbusBroker)(nil)
+var _ runtime.VariableRebuilder = (*ModbusBroker)(nil)
 
 type ModbusBroker struct {
 	NeedCheckTransaction     bool
@@ -39,6 +42,8 @@ type ModbusBroker struct {
 	FunctionCodeDataFrameMap map[uint8][]*modbus.ModBusDataFrame
 	VariableCount            int
 	VariableCh               chan *runtime.ParseVariableResult
+	// mu the data frames are rebuilt between polls
+	mu *sync.RWMutex
 }
 
 func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableResult, error) {
@@ -61,69 +66,9 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 
 	VariableCount := 0
 	functionCodeDataFrameMap := make(map[uint8][]*modbus.ModBusDataFrame, 0)
-	functionCodeVariableMap := make(map[uint8][]*modbus.Variable, 0)
-	for _, variable := range device.Variables {
-		functionCodeVariableMap[variable.FunctionCode] = append(functionCodeVariableMap[variable.FunctionCode], variable)
-	}
-	for code, variables := range functionCodeVariableMap {
+	for code, variables := range groupVariables(device) {
 		VariableCount = VariableCount + len(variables)
-		sort.Sort(modbus.VariableSlice(variables))
-		dfs := make([]*modbus.ModBusDataFrame, 0)
-		firstVariable := variables[0]
-		startOffset := firstVariable.Address - device.PositionAddress
-		startAddress := startOffset
-		var maxDataSize uint = 0
-		vps := make([]*modbus.VariableParse, 0)
-		switch modbus.FunctionCode(code) {
-		case modbus.ReadCoilStatus, modbus.ReadInputStatus:
-			dataFrameDataLength := startAddress + modbus.PerRequestMaxCoil
-			for i := 0; i < len(variables); i++ {
-				variable := variables[i]
-				if variable.Address <= dataFrameDataLength {
-					vp := &modbus.VariableParse{
-						Variable: variable,
-						Start:    variable.Address - startAddress,
-					}
-					vps = append(vps, vp)
-					maxDataSize = variable.Address - startAddress + 1
-				} else {
-					df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
-					dfs = append(dfs, df)
-					vps = vps[:0:0]
-					maxDataSize = 0
-					startAddress = variable.Address
-					dataFrameDataLength = startAddress + modbus.PerRequestMaxCoil
-					i--
-				}
-			}
-		case modbus.ReadHoldRegister, modbus.ReadInputRegister:
-			dataFrameDataLength := startAddress + modbus.PerRequestMaxRegister
-			for i := 0; i < len(variables); i++ {
-				variable := variables[i]
-				if variable.Address+constant.DataTypeWord[variable.DataType] <= dataFrameDataLength {
-					vp := &modbus.VariableParse{
-						Variable: variable,
-						Start:    (variable.Address - startAddress) * 2,
-					}
-					vps = append(vps, vp)
-					maxDataSize = variable.Address - startAddress + constant.DataTypeWord[variable.DataType]
-				} else {
-					df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
-					dfs = append(dfs, df)
-					vps = vps[:0:0]
-					maxDataSize = 0
-					startAddress = variable.Address
-					dataFrameDataLength = startAddress + modbus.PerRequestMaxRegister
-					i--
-				}
-			}
-		}
-		if len(vps) > 0 {
-			df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
-			dfs = append(dfs, df)
-			vps = vps[:0:0]
-		}
-		functionCodeDataFrameMap[code] = append(functionCodeDataFrameMap[code], dfs...)
+		functionCodeDataFrameMap[code] = newDataFrames(device, code, variables)
 	}
 
 	dataFrameCount := 0
@@ -150,10 +95,159 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 		VariableCount:            VariableCount,
 		NeedCheckCrc16Sum:        needCheckCrc16Sum,
 		NeedCheckTransaction:     needCheckTransaction,
+		mu:                       &sync.RWMutex{},
 	}
 	return mtc, mtc.VariableCh, nil
 }
 
+// groupVariables group the enabled variables of device by function code
+func groupVariables(device *modbus.ModBusDevice) map[uint8][]*modbus.Variable {
+	functionCodeVariableMap := make(map[uint8][]*modbus.Variable, 0)
+	for _, variable := range device.Variables {
+		if variable.Disabled {
+			continue
+		}
+		functionCodeVariableMap[variable.FunctionCode] = append(functionCodeVariableMap[variable.FunctionCode], variable)
+	}
+	return functionCodeVariableMap
+}
+
+// newDataFrames generate the read messages of variables of one function code, the adjacent variables are read by one message
+func newDataFrames(device *modbus.ModBusDevice, code uint8, variables []*modbus.Variable) []*modbus.ModBusDataFrame {
+	sort.Sort(modbus.VariableSlice(variables))
+	dfs := make([]*modbus.ModBusDataFrame, 0)
+	firstVariable := variables[0]
+	startOffset := firstVariable.Address - device.PositionAddress
+	startAddress := startOffset
+	var maxDataSize uint = 0
+	vps := make([]*modbus.VariableParse, 0)
+	switch modbus.FunctionCode(code) {
+	case modbus.ReadCoilStatus, modbus.ReadInputStatus:
+		dataFrameDataLength := startAddress + modbus.PerRequestMaxCoil
+		for i := 0; i < len(variables); i++ {
+			variable := variables[i]
+			if variable.Address <= dataFrameDataLength {
+				vp := &modbus.VariableParse{
+					Variable: variable,
+					Start:    variable.Address - startAddress,
+				}
+				vps = append(vps, vp)
+				maxDataSize = variable.Address - startAddress + 1
+			} else {
+				df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
+				dfs = append(dfs, df)
+				vps = vps[:0:0]
+				maxDataSize = 0
+				startAddress = variable.Address
+				dataFrameDataLength = startAddress + modbus.PerRequestMaxCoil
+				i--
+			}
+		}
+	case modbus.ReadHoldRegister, modbus.ReadInputRegister:
+		dataFrameDataLength := startAddress + modbus.PerRequestMaxRegister
+		for i := 0; i < len(variables); i++ {
+			variable := variables[i]
+			if variable.Address+constant.DataTypeWord[variable.DataType] <= dataFrameDataLength {
+				vp := &modbus.VariableParse{
+					Variable: variable,
+					Start:    (variable.Address - startAddress) * 2,
+				}
+				vps = append(vps, vp)
+				maxDataSize = variable.Address - startAddress + constant.DataTypeWord[variable.DataType]
+			} else {
+				df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
+				dfs = append(dfs, df)
+				vps = vps[:0:0]
+				maxDataSize = 0
+				startAddress = variable.Address
+				dataFrameDataLength = startAddress + modbus.PerRequestMaxRegister
+				i--
+			}
+		}
+	}
+	if len(vps) > 0 {
+		df := model.ModbusModelers[device.DeviceModel].GenerateReadMessage(device.Slave, code, startAddress, maxDataSize, vps, device.MemoryLayout)
+		dfs = append(dfs, df)
+	}
+	return dfs
+}
+
+// RebuildVariables rebuild the data frames of function codes which the variables named belonged to or belong to, the
+// data frames of other function codes are kept and parse the values to the variables of latest device.
+func (broker *ModbusBroker) RebuildVariables(d runtime.Device, names []string) error {
+	device, ok := d.(*modbus.ModBusDevice)
+	if !ok {
+		klog.V(2).InfoS("Unsupported device,type not Modbus")
+		return constant.ErrDeviceType
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	variables := make(map[string]*modbus.Variable, len(device.Variables))
+	for _, variable := range device.Variables {
+		variables[variable.Name] = variable
+	}
+	changed := make(map[uint8]bool)
+	for _, name := range names {
+		if v, ok := broker.Device.VariablesMap[name]; ok {
+			changed[v.FunctionCode] = true
+		}
+		if v, ok := variables[name]; ok {
+			changed[v.FunctionCode] = true
+		}
+	}
+
+	variableCount := 0
+	dataFrameCount := 0
+	functionCodeDataFrameMap := make(map[uint8][]*modbus.ModBusDataFrame, 0)
+	for code, vs := range groupVariables(device) {
+		variableCount = variableCount + len(vs)
+		dfs, ok := broker.FunctionCodeDataFrameMap[code]
+		if changed[code] || !ok || !repointVariables(dfs, variables) {
+			dfs = newDataFrames(device, code, vs)
+			klog.V(4).InfoS("Rebuilt Modbus data frames", "deviceId", device.ID, "functionCode", code, "dataFrames", len(dfs))
+		}
+		functionCodeDataFrameMap[code] = dfs
+		dataFrameCount += len(dfs)
+	}
+	if dataFrameCount == 0 {
+		return constant.ErrDeviceEmptyVariable
+	}
+
+	broker.Device = device
+	broker.FunctionCodeDataFrameMap = functionCodeDataFrameMap
+	broker.VariableCount = variableCount
+	return nil
+}
+
+// repointVariables parse the values of kept data frames to the variables of latest device
+func repointVariables(dfs []*modbus.ModBusDataFrame, variables map[string]*modbus.Variable) bool {
+	for _, df := range dfs {
+		for _, vp := range df.Variables {
+			if _, ok := variables[vp.Variable.Name]; !ok {
+				return false
+			}
+		}
+	}
+	for _, df := range dfs {
+		for _, vp := range df.Variables {
+			vp.Variable = variables[vp.Variable.Name]
+		}
+	}
+	return true
+}
+
+// device the latest device collected, the data frames are polled with the device in poll
+func (broker *ModbusBroker) device() *modbus.ModBusDevice {
+	broker.mu.RLock()
+	defer broker.mu.RUnlock()
+	return broker.Device
+}
+
+func (broker *ModbusBroker) PoolStats() (int, int) {
+	return broker.Clients.Stats()
+}
+
 func (broker *ModbusBroker) Destroy(ctx context.Context) {
 	broker.ExitCh <- struct{}{}
 	broker.Clients.Destroy(ctx)
@@ -164,17 +258,20 @@ func (broker *ModbusBroker) Collect(ctx context.Context) {
 	go func() {
 		for {
 			start := time.Now().Unix()
+			pollStart := time.Now()
 			if !broker.poll(ctx) {
 				return
 			}
+			device := broker.device()
+			metrics.ObservePoll(device.ID, device.DeviceType, pollStart)
 			select {
 			case <-broker.ExitCh:
 				return
 			default:
 				end := time.Now().Unix()
 				elapsed := end - start
-				if elapsed < int64(broker.Device.CollectorCycle) {
-					time.Sleep(time.Duration(int64(broker.Device.CollectorCycle)) * time.Second)
+				if elapsed < int64(device.CollectorCycle) {
+					time.Sleep(time.Duration(int64(device.CollectorCycle)) * time.Second)
 				}
 			}
 		}
@@ -182,10 +279,11 @@ func (broker *ModbusBroker) Collect(ctx context.Context) {
 }
 
 func (broker *ModbusBroker) DeliverAction(ctx context.Context, obj map[string]interface{}) error {
+	device := broker.device()
 	action := make([]*modbus.Variable, 0, len(obj))
 
 	for name, value := range obj {
-		vv, _ := broker.Device.GetVariable(name)
+		vv, _ := device.GetVariable(name)
 		variableValue := vv.(*modbus.Variable)
 
 		v := &modbus.Variable{
@@ -261,7 +359,7 @@ func (broker *ModbusBroker) DeliverAction(ctx context.Context, obj map[string]in
 		action = append(action, v)
 	}
 
-	dataBytes := broker.generateActionBytes(broker.Device.MemoryLayout, action)
+	dataBytes := broker.generateActionBytes(device.MemoryLayout, action)
 	dataFrames := make([][]byte, 0, len(dataBytes))
 	for i, dbs := range dataBytes {
 		var bytes []byte
@@ -271,7 +369,7 @@ func (broker *ModbusBroker) DeliverAction(ctx context.Context, obj map[string]in
 			binutil.WriteUint16BigEndian(bytes[2:], 0)
 			binutil.WriteUint16BigEndian(bytes[4:], uint16(1+len(dbs)))
 		}
-		bytes = append(bytes, byte(broker.Device.Slave))
+		bytes = append(bytes, byte(device.Slave))
 		bytes = append(bytes, dbs...)
 		if broker.NeedCheckCrc16Sum {
 			crc16 := make([]byte, 2)
@@ -310,8 +408,8 @@ func (broker *ModbusBroker) DeliverAction(ctx context.Context, obj map[string]in
 		}
 
 		slave := rp[0]
-		if uint(slave) != broker.Device.Slave {
-			klog.V(2).InfoS("Failed to match Modbus slave", "request slave", broker.Device.Slave, "response slave", slave)
+		if uint(slave) != device.Slave {
+			klog.V(2).InfoS("Failed to match Modbus slave", "request slave", device.Slave, "response slave", slave)
 			errs.Add(modbus.ErrMessageSlave)
 			continue
 		}
@@ -335,6 +433,8 @@ func (broker *ModbusBroker) poll(ctx context.Context) bool {
 	case <-broker.ExitCh:
 		return false
 	default:
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
 		sw := &sync.WaitGroup{}
 		dfvCh := make(chan *modbus.ParseVariableResult, 0)
 		for _, DataFrames := range broker.FunctionCodeDataFrameMap {
@@ -383,7 +483,8 @@ func (broker *ModbusBroker) message(ctx context.Context, dataFrame *modbus.ModBu
 		return nil
 	}, messenger, dataFrame); err != nil {
 		klog.V(2).InfoS("Failed to connect modbus server", "error", err)
-		pvrCh <- &modbus.ParseVariableResult{Err: []error{err}}
+		metrics.FrameErrors.WithLabelValues(broker.Device.ID, broker.Device.DeviceType, fmt.Sprintf("%d-%d", dataFrame.FunctionCode, dataFrame.StartAddress)).Inc()
+		pvrCh <- &modbus.ParseVariableResult{Err: []error{err}, VariableSlice: dataFrame.FailedVariables(runtime.ReasonCommFailure)}
 		return
 	}
 
@@ -476,9 +577,9 @@ func (broker *ModbusBroker) rollVariable(ctx context.Context, ch chan *modbus.Pa
 			if !ok {
 				broker.VariableCh <- &runtime.ParseVariableResult{Err: errs, VariableSlice: rvs}
 				return
-			} else if pvr.Err != nil {
-				errs = append(errs, pvr.Err...)
 			} else {
+				// the variables of failed frames are reported with bad quality
+				errs = append(errs, pvr.Err...)
 				for _, variable := range pvr.VariableSlice {
 					rvs = append(rvs, variable)
 				}
@@ -557,12 +658,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 			case constant.INT16:
 				fc = byte(modbus.WriteSingleRegister)
 
-				var value int16
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = int16((variable.Value.(float64)) * variable.Rate)
-				} else {
-					value = variable.Value.(int16)
-				}
+				value := variable.Value.(int16)
 				switch memoryLayout {
 				case constant.ABCD, constant.CDAB:
 					dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(value))...)
@@ -572,12 +668,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 			case constant.UINT16:
 				fc = byte(modbus.WriteSingleRegister)
 
-				var value uint16
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = uint16((variable.Value.(float64)) * variable.Rate)
-				} else {
-					value = variable.Value.(uint16)
-				}
+				value := variable.Value.(uint16)
 				switch memoryLayout {
 				case constant.ABCD, constant.CDAB:
 					dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(value)...)
@@ -590,12 +681,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 				dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(registerAmount))...)
 				dataByte = append(dataByte, byte(2*registerAmount))
 
-				var value int32
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = int32((variable.Value.(float64)) * variable.Rate)
-				} else {
-					value = variable.Value.(int32)
-				}
+				value := variable.Value.(int32)
 				switch memoryLayout {
 				case constant.ABCD:
 					dataByte = append(dataByte, binutil.Uint32ToBytesBigEndian(uint32(value))...)
@@ -613,12 +699,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 				dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(registerAmount))...)
 				dataByte = append(dataByte, byte(2*registerAmount))
 
-				var value int64
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = int64((variable.Value.(float64)) * variable.Rate)
-				} else {
-					value = variable.Value.(int64)
-				}
+				value := variable.Value.(int64)
 				switch memoryLayout {
 				case constant.ABCD:
 					dataByte = append(dataByte, binutil.Uint64ToBytesBigEndian(uint64(value))...)
@@ -636,12 +717,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 				dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(registerAmount))...)
 				dataByte = append(dataByte, byte(2*registerAmount))
 
-				var value float32
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = float32((variable.Value.(float64)) * variable.Rate)
-				} else {
-					value = variable.Value.(float32)
-				}
+				value := variable.Value.(float32)
 				switch memoryLayout {
 				case constant.ABCD:
 					dataByte = append(dataByte, binutil.Float32ToBytesBigEndian(value)...)
@@ -659,12 +735,7 @@ func (broker *ModbusBroker) generateActionBytes(memoryLayout constant.MemoryLayo
 				dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(registerAmount))...)
 				dataByte = append(dataByte, byte(2*registerAmount))
 
-				var value float64
-				if variable.Rate != 0 && variable.Rate != 1 {
-					value = (variable.Value.(float64)) * variable.Rate
-				} else {
-					value = variable.Value.(float64)
-				}
+				value := variable.Value.(float64)
 				switch memoryLayout {
 				case constant.ABCD:
 					dataByte = append(dataByte, binutil.Float64ToBytesBigEndian(value)...)
@@ -0,0 +1,57 @@
+package modbus
+
+import (
+	modbus "harnsgateway/pkg/protocol/modbus/runtime"
+	"harnsgateway/pkg/runtime/constant"
+	"sync"
+	"testing"
+)
+
+func newTestDevice(variables ...*modbus.Variable) *modbus.ModBusDevice {
+	d := &modbus.ModBusDevice{Slave: 1, MemoryLayout: constant.ABCD, Variables: variables}
+	d.DeviceModel = "modbusTcp"
+	d.IndexDevice()
+	return d
+}
+
+func TestRebuildVariables(t *testing.T) {
+	device := newTestDevice(
+		&modbus.Variable{Name: "switch", DataType: constant.BOOL, Address: 0, FunctionCode: 1},
+		&modbus.Variable{Name: "voltage", DataType: constant.FLOAT32, Address: 0, FunctionCode: 3},
+		&modbus.Variable{Name: "current", DataType: constant.FLOAT32, Address: 2, FunctionCode: 3},
+	)
+	broker := &ModbusBroker{Device: device, FunctionCodeDataFrameMap: make(map[uint8][]*modbus.ModBusDataFrame), mu: &sync.RWMutex{}}
+	for code, variables := range groupVariables(device) {
+		broker.FunctionCodeDataFrameMap[code] = newDataFrames(device, code, variables)
+	}
+	coils := broker.FunctionCodeDataFrameMap[1][0]
+
+	// disable the variable of holding registers, the data frame of coils is kept
+	updated := newTestDevice(
+		&modbus.Variable{Name: "switch", DataType: constant.BOOL, Address: 0, FunctionCode: 1},
+		&modbus.Variable{Name: "voltage", DataType: constant.FLOAT32, Address: 0, FunctionCode: 3, Disabled: true},
+		&modbus.Variable{Name: "current", DataType: constant.FLOAT32, Address: 2, FunctionCode: 3},
+	)
+	if err := broker.RebuildVariables(updated, []string{"voltage"}); err != nil {
+		t.Fatalf("RebuildVariables() = %v", err)
+	}
+	if broker.FunctionCodeDataFrameMap[1][0] != coils {
+		t.Errorf("expected the data frame of coils kept")
+	}
+	if coils.Variables[0].Variable != updated.VariablesMap["switch"] {
+		t.Errorf("expected the kept data frame parsed to the variable of latest device")
+	}
+	registers := broker.FunctionCodeDataFrameMap[3]
+	if len(registers) != 1 || len(registers[0].Variables) != 1 || registers[0].Variables[0].Variable.Name != "current" {
+		t.Errorf("expected the data frame of registers rebuilt without disabled variable, got %v", registers)
+	}
+	if broker.VariableCount != 2 || broker.Device != updated {
+		t.Errorf("expected 2 variables of latest device, got %d", broker.VariableCount)
+	}
+
+	// nothing is left to collect
+	empty := newTestDevice(&modbus.Variable{Name: "switch", DataType: constant.BOOL, Address: 0, FunctionCode: 1, Disabled: true})
+	if err := broker.RebuildVariables(empty, []string{"switch", "current"}); err != constant.ErrDeviceEmptyVariable {
+		t.Errorf("expected empty variable, got %v", err)
+	}
+}
@@ -4,10 +4,15 @@ import (
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
 	"harnsgateway/pkg/utils/binutil"
+	"time"
 )
 
 var _ runtime.Device = (*ModBusDevice)(nil)
 var _ runtime.VariableValue = (*Variable)(nil)
+var _ runtime.Transformer = (*Variable)(nil)
+var _ runtime.Constrainer = (*Variable)(nil)
+var _ runtime.Qualifier = (*Variable)(nil)
+var _ runtime.Disabler = (*Variable)(nil)
 
 type Variable struct {
 	DataType     constant.DataType   `json:"dataType"`               // bool、int16、float32、float64、int32、int64、uint16
@@ -20,6 +25,11 @@ type Variable struct {
 	DefaultValue interface{}         `json:"defaultValue,omitempty"` // 默认值
 	Value        interface{}         `json:"value,omitempty"`        // 值
 	AccessMode   constant.AccessMode `json:"accessMode"`             // 读写属性
+	Transform    *runtime.Transform  `json:"transform,omitempty"`    // 转换
+	Constraint   *runtime.Constraint `json:"constraint,omitempty"`   // 写入约束
+	Disabled     bool                `json:"disabled,omitempty"`     // 禁用 不采集
+
+	runtime.ValueQuality // 质量与源时间戳
 }
 
 func (v *Variable) GetVariableAccessMode() constant.AccessMode {
@@ -42,6 +52,22 @@ func (v *Variable) SetVariableName(name string) {
 	v.Name = name
 }
 
+func (v *Variable) GetTransform() *runtime.Transform {
+	return v.Transform.WithRate(v.Rate)
+}
+
+func (v *Variable) GetDataType() constant.DataType {
+	return v.DataType
+}
+
+func (v *Variable) GetConstraint() *runtime.Constraint {
+	return v.Constraint
+}
+
+func (v *Variable) IsDisabled() bool {
+	return v.Disabled
+}
+
 type ModBusDevice struct {
 	runtime.DeviceMeta
 	CollectorCycle   uint                  `json:"collectorCycle"`                    // 采集周期
@@ -125,6 +151,7 @@ func (df *ModBusDataFrame) WriteTransactionId() {
 }
 
 func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
+	quality := runtime.GoodQuality(time.Now())
 	vvs := make([]*Variable, 0, len(df.Variables))
 	for _, vp := range df.Variables {
 		var value interface{}
@@ -167,11 +194,7 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.BADC, constant.DCBA:
 					v = int16(binutil.ParseUint16LittleEndian(vpData))
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = int16((v.(float64)) * vp.Variable.Rate)
-				} else {
-					value = v
-				}
+				value = v
 			case constant.UINT16:
 				var v interface{}
 				switch df.MemoryLayout {
@@ -180,11 +203,7 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.BADC, constant.DCBA:
 					v = binutil.ParseUint16LittleEndian(vpData)
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = uint16((v.(float64)) * vp.Variable.Rate)
-				} else {
-					value = v
-				}
+				value = v
 			case constant.INT32:
 				var v interface{}
 				switch df.MemoryLayout {
@@ -198,11 +217,7 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.DCBA:
 					v = int32(binutil.ParseUint32LittleEndian(vpData))
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = int32((v.(float64)) * vp.Variable.Rate)
-				} else {
-					value = v
-				}
+				value = v
 			case constant.INT64:
 				var v interface{}
 				switch df.MemoryLayout {
@@ -215,11 +230,7 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.DCBA:
 					v = int64(binutil.ParseUint64LittleEndian(vpData))
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = int64((v.(float64)) * vp.Variable.Rate)
-				} else {
-					value = v
-				}
+				value = v
 			case constant.FLOAT32:
 				var v interface{}
 				switch df.MemoryLayout {
@@ -232,11 +243,7 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.DCBA:
 					v = binutil.ParseFloat32LittleEndian(vpData)
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = float32((v.(float64)) * vp.Variable.Rate)
-				} else {
-					value = v
-				}
+				value = v
 			case constant.FLOAT64:
 				var v interface{}
 				switch df.MemoryLayout {
@@ -249,15 +256,12 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 				case constant.DCBA:
 					v = binutil.ParseFloat64LittleEndian(vpData)
 				}
-				if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-					value = (v.(float64)) * vp.Variable.Rate
-				} else {
-					value = v
-				}
+				value = v
 			}
 		}
 
 		vp.Variable.SetValue(value)
+		vp.Variable.SetQuality(quality)
 		vvs = append(vvs, &Variable{
 			DataType:     vp.Variable.DataType,
 			Name:         vp.Variable.Name,
@@ -268,6 +272,28 @@ func (df *ModBusDataFrame) ParseVariableValue(data []byte) []*Variable {
 			Amount:       vp.Variable.Amount,
 			DefaultValue: vp.Variable.DefaultValue,
 			Value:        vp.Variable.Value,
+			ValueQuality: quality,
+		})
+	}
+	return vvs
+}
+
+// FailedVariables the variables of data frame failed to collect with bad quality, the values of device are kept
+func (df *ModBusDataFrame) FailedVariables(reason string) []*Variable {
+	quality := runtime.BadQuality(reason, time.Now())
+	vvs := make([]*Variable, 0, len(df.Variables))
+	for _, vp := range df.Variables {
+		vp.Variable.SetQuality(quality)
+		vvs = append(vvs, &Variable{
+			DataType:     vp.Variable.DataType,
+			Name:         vp.Variable.Name,
+			Address:      vp.Variable.Address,
+			Bits:         vp.Variable.Bits,
+			FunctionCode: vp.Variable.FunctionCode,
+			Rate:         vp.Variable.Rate,
+			Amount:       vp.Variable.Amount,
+			DefaultValue: vp.Variable.DefaultValue,
+			ValueQuality: quality,
 		})
 	}
 	return vvs
@@ -1,6 +1,7 @@
 package opcua
 
 import (
+	"harnsgateway/pkg/apis/response"
 	opcuaruntime "harnsgateway/pkg/protocol/opcua/runtime"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
@@ -52,6 +53,12 @@ func (m *OpcUaDeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.Dev
 	}
 	if len(opcUaDevice.Variables) > 0 {
 		for _, variable := range opcUaDevice.Variables {
+			if err := variable.Transform.Validate(); err != nil {
+				return nil, response.ErrTransformInvalid(variable.Name, err.Error())
+			}
+			if err := variable.Constraint.Validate(); err != nil {
+				return nil, response.ErrConstraintInvalid(variable.Name, err.Error())
+			}
 			d.Variables = append(d.Variables, &opcuaruntime.Variable{
 				DataType:     constant.StringToDataType[variable.DataType],
 				Name:         variable.Name,
@@ -59,6 +66,9 @@ func (m *OpcUaDeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.Dev
 				Namespace:    variable.NameSpace,
 				DefaultValue: variable.DefaultValue,
 				AccessMode:   variable.AccessMode,
+				Transform:    variable.Transform,
+				Constraint:   variable.Constraint,
+				Disabled:     variable.Disabled,
 			})
 		}
 	}
@@ -75,6 +85,19 @@ func (m *OpcUaDeviceManager) DeleteDevice(device runtime.Device) (runtime.Device
 }
 
 func (m *OpcUaDeviceManager) UpdateValidation(deviceType v1.DeviceType, device runtime.Device) error {
+	opcUaDevice, ok := deviceType.(*v1.OpcUaDevice)
+	if !ok {
+		klog.V(2).InfoS("Unsupported device,type not OpcUa")
+		return constant.ErrDeviceType
+	}
+	for _, variable := range opcUaDevice.Variables {
+		if err := variable.Transform.Validate(); err != nil {
+			return response.ErrTransformInvalid(variable.Name, err.Error())
+		}
+		if err := variable.Constraint.Validate(); err != nil {
+			return response.ErrConstraintInvalid(variable.Name, err.Error())
+		}
+	}
 	return nil
 }
 
@@ -130,6 +153,9 @@ func (m *OpcUaDeviceManager) UpdateDevice(id string, deviceType v1.DeviceType, d
 			v.Namespace = ndv.NameSpace
 			v.DefaultValue = ndv.DefaultValue
 			v.AccessMode = ndv.AccessMode
+			v.Transform = ndv.Transform
+			v.Constraint = ndv.Constraint
+			v.Disabled = ndv.Disabled
 		} else {
 			v := &opcuaruntime.Variable{
 				DataType:     constant.StringToDataType[ndv.DataType],
@@ -138,6 +164,9 @@ func (m *OpcUaDeviceManager) UpdateDevice(id string, deviceType v1.DeviceType, d
 				Namespace:    ndv.NameSpace,
 				DefaultValue: ndv.DefaultValue,
 				AccessMode:   ndv.AccessMode,
+				Transform:    ndv.Transform,
+				Constraint:   ndv.Constraint,
+				Disabled:     ndv.Disabled,
 			}
 			copyDevice.Variables = append(copyDevice.Variables, v)
 			copyDevice.VariablesMap[v.Name] = v
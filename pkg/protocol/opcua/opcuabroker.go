@@ -3,14 +3,17 @@ package opcua
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/gopcua/opcua/ua"
 	genericruntime "harnsgateway/pkg/generic/runtime"
+	"harnsgateway/pkg/metrics"
 	"harnsgateway/pkg/protocol/opcua/model"
 	opcuaruntime "harnsgateway/pkg/protocol/opcua/runtime"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
 	"io"
 	"k8s.io/klog/v2"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -23,6 +26,62 @@ type OpuUaDataFrame struct {
 	RequestVariables *ua.ReadRequest
 }
 
+// FailedVariables the variables of data frame failed to collect with bad quality, the values of device are kept
+func (df *OpuUaDataFrame) FailedVariables(reason string) []*opcuaruntime.Variable {
+	quality := runtime.BadQuality(reason, time.Now())
+	variables := make([]*opcuaruntime.Variable, 0, len(df.Variables))
+	for _, variable := range df.Variables {
+		variable.SetQuality(quality)
+		variables = append(variables, &opcuaruntime.Variable{
+			DataType:     variable.DataType,
+			Name:         variable.Name,
+			Address:      variable.Address,
+			Namespace:    variable.Namespace,
+			DefaultValue: variable.DefaultValue,
+			ValueQuality: quality,
+		})
+	}
+	return variables
+}
+
+// dataValueQuality map the status code and timestamps of data value to quality,
+// the source timestamp is preferred, then the server timestamp and the time received.
+func dataValueQuality(dv *ua.DataValue, received time.Time) runtime.ValueQuality {
+	timestamp := dv.SourceTimestamp
+	if timestamp.IsZero() {
+		timestamp = dv.ServerTimestamp
+	}
+	if timestamp.IsZero() {
+		timestamp = received
+	}
+	quality := runtime.GoodQuality(timestamp)
+	switch {
+	case dv.Status&ua.StatusBad != 0:
+		quality.Quality = runtime.QualityBad
+	case dv.Status&ua.StatusUncertain != 0:
+		quality.Quality = runtime.QualityUncertain
+	default:
+		return quality
+	}
+	// the lower 16 bits are the info bits
+	code := dv.Status & 0xFFFF0000
+	switch code {
+	case ua.StatusBadCommunicationError, ua.StatusBadNoCommunication:
+		quality.Reason = runtime.ReasonCommFailure
+	case ua.StatusBadOutOfRange, ua.StatusUncertainEngineeringUnitsExceeded:
+		quality.Reason = runtime.ReasonOutOfRange
+	case ua.StatusUncertainLastUsableValue:
+		quality.Reason = runtime.ReasonStale
+	default:
+		if desc, ok := ua.StatusCodes[code]; ok {
+			quality.Reason = desc.Name
+		} else {
+			quality.Reason = fmt.Sprintf("0x%X", uint32(code))
+		}
+	}
+	return quality
+}
+
 type OpcUaBroker struct {
 	ExitCh                     chan struct{}
 	Device                     *opcuaruntime.OpcUaDevice
@@ -39,7 +98,13 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 		return nil, nil, constant.ErrDeviceType
 	}
 
-	groupOf := genericruntime.VariablesInGroupOf[*opcuaruntime.Variable](device.Variables, 1000)
+	variables := make([]*opcuaruntime.Variable, 0, len(device.Variables))
+	for _, variable := range device.Variables {
+		if !variable.Disabled {
+			variables = append(variables, variable)
+		}
+	}
+	groupOf := genericruntime.VariablesInGroupOf[*opcuaruntime.Variable](variables, 1000)
 	namespaceVariableDataFrame := make([]*OpuUaDataFrame, 0, 0)
 
 	for _, variables := range groupOf {
@@ -78,12 +143,16 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 		ExitCh:                     make(chan struct{}, 0),
 		NamespaceVariableDataFrame: namespaceVariableDataFrame,
 		VariableCh:                 make(chan *runtime.ParseVariableResult, 1),
-		VariableCount:              len(device.Variables),
+		VariableCount:              len(variables),
 		Clients:                    clients,
 	}
 	return mtc, mtc.VariableCh, nil
 }
 
+func (broker *OpcUaBroker) PoolStats() (int, int) {
+	return broker.Clients.Stats()
+}
+
 func (broker *OpcUaBroker) Destroy(ctx context.Context) {
 	broker.ExitCh <- struct{}{}
 	broker.Clients.Destroy(ctx)
@@ -94,9 +163,11 @@ func (broker *OpcUaBroker) Collect(ctx context.Context) {
 	go func() {
 		for {
 			start := time.Now().Unix()
+			pollStart := time.Now()
 			if !broker.poll(ctx) {
 				return
 			}
+			metrics.ObservePoll(broker.Device.ID, broker.Device.DeviceType, pollStart)
 			select {
 			case <-broker.ExitCh:
 				return
@@ -123,9 +194,9 @@ func (broker *OpcUaBroker) poll(ctx context.Context) bool {
 	default:
 		sw := &sync.WaitGroup{}
 		dfvCh := make(chan *opcuaruntime.ParseVariableResult, 0)
-		for _, dataFrames := range broker.NamespaceVariableDataFrame {
+		for i, dataFrames := range broker.NamespaceVariableDataFrame {
 			sw.Add(1)
-			go broker.message(ctx, dataFrames, dfvCh, sw)
+			go broker.message(ctx, strconv.Itoa(i), dataFrames, dfvCh, sw)
 		}
 		go broker.rollVariable(ctx, dfvCh)
 		sw.Wait()
@@ -135,11 +206,12 @@ func (broker *OpcUaBroker) poll(ctx context.Context) bool {
 
 }
 
-func (broker *OpcUaBroker) message(ctx context.Context, dataFrame *OpuUaDataFrame, pvrCh chan *opcuaruntime.ParseVariableResult, sw *sync.WaitGroup) {
+func (broker *OpcUaBroker) message(ctx context.Context, frameName string, dataFrame *OpuUaDataFrame, pvrCh chan *opcuaruntime.ParseVariableResult, sw *sync.WaitGroup) {
 	defer sw.Done()
 	messenger, err := broker.Clients.GetMessenger(ctx)
 	if err != nil {
-		pvrCh <- &opcuaruntime.ParseVariableResult{Err: []error{err}}
+		pvrCh <- &opcuaruntime.ParseVariableResult{Err: []error{err}, VariableSlice: dataFrame.FailedVariables(runtime.ReasonCommFailure)}
+		return
 	}
 	defer broker.Clients.ReleaseMessenger(messenger)
 
@@ -149,7 +221,8 @@ func (broker *OpcUaBroker) message(ctx context.Context, dataFrame *OpuUaDataFram
 		return err
 	}, messenger, dataFrame); err != nil {
 		klog.V(2).InfoS("Failed to connect opc ua server by retry three times")
-		pvrCh <- &opcuaruntime.ParseVariableResult{Err: []error{err}}
+		metrics.FrameErrors.WithLabelValues(broker.Device.ID, broker.Device.DeviceType, frameName).Inc()
+		pvrCh <- &opcuaruntime.ParseVariableResult{Err: []error{err}, VariableSlice: dataFrame.FailedVariables(runtime.ReasonCommFailure)}
 		return
 	}
 
@@ -158,19 +231,25 @@ func (broker *OpcUaBroker) message(ctx context.Context, dataFrame *OpuUaDataFram
 		return
 	}
 
+	received := time.Now()
 	variables := make([]*opcuaruntime.Variable, 0, len(dataFrame.Variables))
 	for i, variable := range dataFrame.Variables {
-		if response.Results[i].Status == ua.StatusOK {
+		quality := dataValueQuality(response.Results[i], received)
+		variable.SetQuality(quality)
+		collected := &opcuaruntime.Variable{
+			DataType:     variable.DataType,
+			Name:         variable.Name,
+			Address:      variable.Address,
+			Namespace:    variable.Namespace,
+			DefaultValue: variable.DefaultValue,
+			ValueQuality: quality,
+		}
+		// the value of bad quality is not usable, the value of device is kept
+		if quality.Quality != runtime.QualityBad && response.Results[i].Value != nil {
 			variable.SetValue(response.Results[i].Value.Value())
-			variables = append(variables, &opcuaruntime.Variable{
-				DataType:     variable.DataType,
-				Name:         variable.Name,
-				Address:      variable.Address,
-				Namespace:    variable.Namespace,
-				DefaultValue: variable.DefaultValue,
-				Value:        variable.Value,
-			})
+			collected.Value = variable.Value
 		}
+		variables = append(variables, collected)
 	}
 
 	pvrCh <- &opcuaruntime.ParseVariableResult{Err: nil, VariableSlice: variables}
@@ -225,9 +304,9 @@ func (broker *OpcUaBroker) rollVariable(ctx context.Context, ch chan *opcuarunti
 			if !ok {
 				broker.VariableCh <- &runtime.ParseVariableResult{Err: errs, VariableSlice: rvs}
 				return
-			} else if pvr.Err != nil {
-				errs = append(errs, pvr.Err...)
 			} else {
+				// the variables of failed frames are reported with bad quality
+				errs = append(errs, pvr.Err...)
 				for _, variable := range pvr.VariableSlice {
 					rvs = append(rvs, variable)
 				}
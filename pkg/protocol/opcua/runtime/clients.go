@@ -120,6 +120,13 @@ func (cs *Clients) ReleaseMessenger(messenger Messenger) {
 	}
 }
 
+// Stats returns the size of pool and the number of idle messengers
+func (cs *Clients) Stats() (int, int) {
+	cs.Mux.Lock()
+	defer cs.Mux.Unlock()
+	return cs.Max, cs.Idle
+}
+
 func (cs *Clients) Destroy(ctx context.Context) {
 	cs.Mux.Lock()
 	defer cs.Mux.Unlock()
@@ -1,6 +1,7 @@
 package s7
 
 import (
+	"harnsgateway/pkg/apis/response"
 	s7runtime "harnsgateway/pkg/protocol/s7/runtime"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/runtime/constant"
@@ -53,6 +54,12 @@ func (m *S7DeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.Device
 	}
 	if len(s7Device.Variables) > 0 {
 		for _, variable := range s7Device.Variables {
+			if err := variable.Transform.Validate(); err != nil {
+				return nil, response.ErrTransformInvalid(variable.Name, err.Error())
+			}
+			if err := variable.Constraint.Validate(); err != nil {
+				return nil, response.ErrConstraintInvalid(variable.Name, err.Error())
+			}
 			v := &s7runtime.Variable{
 				DataType:     constant.StringToDataType[variable.DataType],
 				Name:         variable.Name,
@@ -60,6 +67,9 @@ func (m *S7DeviceManager) CreateDevice(deviceType v1.DeviceType) (runtime.Device
 				Rate:         variable.Rate,
 				DefaultValue: variable.DefaultValue,
 				AccessMode:   variable.AccessMode,
+				Transform:    variable.Transform,
+				Constraint:   variable.Constraint,
+				Disabled:     variable.Disabled,
 			}
 			d.Variables = append(d.Variables, v)
 			d.VariablesMap[v.Name] = v
@@ -78,6 +88,19 @@ func (m *S7DeviceManager) DeleteDevice(device runtime.Device) (runtime.Device, e
 }
 
 func (m *S7DeviceManager) UpdateValidation(deviceType v1.DeviceType, device runtime.Device) error {
+	s7Device, ok := deviceType.(*v1.S7Device)
+	if !ok {
+		klog.V(2).InfoS("Unsupported device,type not S7")
+		return constant.ErrDeviceType
+	}
+	for _, variable := range s7Device.Variables {
+		if err := variable.Transform.Validate(); err != nil {
+			return response.ErrTransformInvalid(variable.Name, err.Error())
+		}
+		if err := variable.Constraint.Validate(); err != nil {
+			return response.ErrConstraintInvalid(variable.Name, err.Error())
+		}
+	}
 	return nil
 }
 
@@ -133,6 +156,9 @@ func (m *S7DeviceManager) UpdateDevice(id string, deviceType v1.DeviceType, devi
 			v.Rate = ndv.Rate
 			v.DefaultValue = ndv.DefaultValue
 			v.AccessMode = ndv.AccessMode
+			v.Transform = ndv.Transform
+			v.Constraint = ndv.Constraint
+			v.Disabled = ndv.Disabled
 		} else {
 			v := &s7runtime.Variable{
 				DataType:     constant.StringToDataType[ndv.DataType],
@@ -141,6 +167,9 @@ func (m *S7DeviceManager) UpdateDevice(id string, deviceType v1.DeviceType, devi
 				Rate:         ndv.Rate,
 				DefaultValue: ndv.DefaultValue,
 				AccessMode:   ndv.AccessMode,
+				Transform:    ndv.Transform,
+				Constraint:   ndv.Constraint,
+				Disabled:     ndv.Disabled,
 			}
 			copyDevice.Variables = append(copyDevice.Variables, v)
 			copyDevice.VariablesMap[v.Name] = v
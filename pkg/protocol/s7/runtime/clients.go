@@ -81,6 +81,13 @@ func (t *Clients) ReleaseMessenger(messenger Messenger) {
 	}
 }
 
+// Stats returns the size of pool and the number of idle messengers
+func (t *Clients) Stats() (int, int) {
+	t.Mux.Lock()
+	defer t.Mux.Unlock()
+	return t.Max, t.Idle
+}
+
 func (t *Clients) Destroy(ctx context.Context) {
 	t.Mux.Lock()
 	defer t.Mux.Unlock()
@@ -10,6 +10,10 @@ import (
 
 var _ runtime.Device = (*S7Device)(nil)
 var _ runtime.VariableValue = (*Variable)(nil)
+var _ runtime.Transformer = (*Variable)(nil)
+var _ runtime.Constrainer = (*Variable)(nil)
+var _ runtime.Qualifier = (*Variable)(nil)
+var _ runtime.Disabler = (*Variable)(nil)
 
 type Variable struct {
 	DataType     constant.DataType   `json:"dataType"`               // bool、int16、float32、float64、int32、int64、uint16
@@ -19,6 +23,11 @@ type Variable struct {
 	DefaultValue interface{}         `json:"defaultValue,omitempty"` // 默认值
 	Value        interface{}         `json:"value,omitempty"`        // 值
 	AccessMode   constant.AccessMode `json:"accessMode"`             // 读写属性
+	Transform    *runtime.Transform  `json:"transform,omitempty"`    // 转换
+	Constraint   *runtime.Constraint `json:"constraint,omitempty"`   // 写入约束
+	Disabled     bool                `json:"disabled,omitempty"`     // 禁用 不采集
+
+	runtime.ValueQuality // 质量与源时间戳
 }
 
 func (v *Variable) GetVariableAccessMode() constant.AccessMode {
@@ -41,6 +50,22 @@ func (v *Variable) SetVariableName(name string) {
 	v.Name = name
 }
 
+func (v *Variable) GetTransform() *runtime.Transform {
+	return v.Transform.WithRate(v.Rate)
+}
+
+func (v *Variable) GetDataType() constant.DataType {
+	return v.DataType
+}
+
+func (v *Variable) GetConstraint() *runtime.Constraint {
+	return v.Constraint
+}
+
+func (v *Variable) IsDisabled() bool {
+	return v.Disabled
+}
+
 func (v *Variable) DataRequestLength(area S7StoreArea) uint16 {
 	switch area {
 	// 以byte形式读取 发送的一个item占12个字节    返回的一个item至少占5个字节
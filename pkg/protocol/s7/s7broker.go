@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/metrics"
 	"harnsgateway/pkg/protocol/s7/model"
 	s7runtime "harnsgateway/pkg/protocol/s7/runtime"
 	"harnsgateway/pkg/runtime"
@@ -18,6 +19,7 @@ import (
 )
 
 var _ runtime.Broker = (*S7Broker)(nil)
+var _ runtime.VariableRebuilder = (*S7Broker)(nil)
 
 type S7Item struct {
 	RequestData  []byte
@@ -53,6 +55,7 @@ func (df *S7DataFrame) ValidateMessage(least int) ([]byte, error) {
 }
 
 func (df *S7DataFrame) ParseVariableValue(data []byte) s7runtime.VariableSlice {
+	quality := runtime.GoodQuality(time.Now())
 	vvs := make([]*s7runtime.Variable, 0, len(df.Variables))
 	for _, vp := range df.Variables {
 		var value interface{}
@@ -64,62 +67,27 @@ func (df *S7DataFrame) ParseVariableValue(data []byte) s7runtime.VariableSlice {
 		case constant.STRING:
 			// todo
 		case constant.UINT16:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = binutil.ParseUint16BigEndian(vpData)
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = uint16((v.(float64)) * vp.Variable.Rate)
-			} else {
-				value = v
-			}
+			value = binutil.ParseUint16BigEndian(vpData)
 		case constant.INT16:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = int16(binutil.ParseUint16BigEndian(vpData))
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = int16((v.(float64)) * vp.Variable.Rate)
-			} else {
-				value = v
-			}
+			value = int16(binutil.ParseUint16BigEndian(vpData))
 		case constant.INT32:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = int32(binutil.ParseUint32BigEndian(vpData))
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = int32((v.(float64)) * vp.Variable.Rate)
-			} else {
-				value = v
-			}
+			value = int32(binutil.ParseUint32BigEndian(vpData))
 		case constant.FLOAT32:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = binutil.ParseFloat32BigEndian(vpData)
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = float32((v.(float64)) * vp.Variable.Rate)
-			} else {
-				value = v
-			}
+			value = binutil.ParseFloat32BigEndian(vpData)
 		case constant.INT64:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = int64(binutil.ParseUint64BigEndian(vpData))
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = int64((v.(float64)) * vp.Variable.Rate)
-			} else {
-				value = v
-			}
+			value = int64(binutil.ParseUint64BigEndian(vpData))
 		case constant.FLOAT64:
-			var v interface{}
 			vpData := data[vp.StartAddress+4:]
-			v = binutil.ParseFloat64BigEndian(vpData)
-			if vp.Variable.Rate != 0 && vp.Variable.Rate != 1 {
-				value = (v.(float64)) * vp.Variable.Rate
-			} else {
-				value = v
-			}
+			value = binutil.ParseFloat64BigEndian(vpData)
 		}
 
 		vp.Variable.SetValue(value)
+		vp.Variable.SetQuality(quality)
 		vvs = append(vvs, &s7runtime.Variable{
 			DataType:     vp.Variable.DataType,
 			Name:         vp.Variable.Name,
@@ -127,6 +95,25 @@ func (df *S7DataFrame) ParseVariableValue(data []byte) s7runtime.VariableSlice {
 			Rate:         vp.Variable.Rate,
 			DefaultValue: vp.Variable.DefaultValue,
 			Value:        vp.Variable.Value,
+			ValueQuality: quality,
+		})
+	}
+	return vvs
+}
+
+// FailedVariables the variables of data frame failed to collect with bad quality, the values of device are kept
+func (df *S7DataFrame) FailedVariables(reason string) s7runtime.VariableSlice {
+	quality := runtime.BadQuality(reason, time.Now())
+	vvs := make([]*s7runtime.Variable, 0, len(df.Variables))
+	for _, vp := range df.Variables {
+		vp.Variable.SetQuality(quality)
+		vvs = append(vvs, &s7runtime.Variable{
+			DataType:     vp.Variable.DataType,
+			Name:         vp.Variable.Name,
+			Address:      vp.Variable.Address,
+			Rate:         vp.Variable.Rate,
+			DefaultValue: vp.Variable.DefaultValue,
+			ValueQuality: quality,
 		})
 	}
 	return vvs
@@ -147,6 +134,9 @@ type S7Broker struct {
 	VariableCount            int
 	VariableCh               chan *runtime.ParseVariableResult
 	Endpoint                 string
+	MaxPduLength             uint16
+	// mu the data frames are rebuilt between polls
+	mu *sync.RWMutex
 }
 
 func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableResult, error) {
@@ -161,69 +151,9 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 		return nil, nil, constant.ErrConnectDevice
 	}
 
-	variableCount := 0
-	storeAddressVariableMap := make(map[s7runtime.S7StoreArea][]*s7runtime.Variable)
-	for _, variable := range device.Variables {
-		zone := variable.Zone()
-		storeAddressVariableMap[zone] = append(storeAddressVariableMap[zone], variable)
-	}
-
 	storeAddressDataFrameMap := make(map[s7runtime.S7StoreArea][]*S7DataFrame)
-	for key, variables := range storeAddressVariableMap {
-		variableCount = variableCount + len(variables)
-		sort.Sort(s7runtime.VariableSlice(variables))
-		maxPdu := maxPduLength
-		dataFrames := make([]*S7DataFrame, 0)
-		// 请求报文19个字节 + item 每个item12个字节 返回的报文 cotp占19个字节 header2个字节
-		maxItemPerDataFrame := (maxPdu - 19) / 12
-		itemMap := make(map[string]*S7Item, 0)
-		items := make([]*S7Item, 0)
-		variableParses := make([]*VariableParse, 0)
-		startAddressOffset := 0
-		for _, variable := range variables {
-			zone, blockSize, startAddress, bitAddress := variable.ParseVariableAddress()
-			offset := int(4 + variable.DataResponseLength(key))
-			addressKey := fmt.Sprintf("%s.%d.%d", s7runtime.StoreAddressToString[zone], blockSize, startAddress)
-			if item, exist := itemMap[addressKey]; !exist {
-				it := &S7Item{
-					RequestData:  newS7COMMReadParameterItem(s7runtime.StoreAreaTransportSize[key], variable.DataRequestLength(key), uint16(blockSize), s7runtime.StoreAreaCode[key], startAddress, bitAddress),
-					StartAddress: uint(startAddressOffset),
-				}
-				startAddressOffset = startAddressOffset + offset
-				itemMap[addressKey] = it
-				items = append(items, it)
-				vp := &VariableParse{
-					Variable:           variable,
-					StartAddress:       it.StartAddress,
-					BitAddressOrLength: bitAddress,
-					BlockSize:          blockSize,
-				}
-				variableParses = append(variableParses, vp)
-			} else {
-				vp := &VariableParse{
-					Variable:           variable,
-					StartAddress:       item.StartAddress,
-					BitAddressOrLength: bitAddress,
-					BlockSize:          blockSize,
-				}
-				variableParses = append(variableParses, vp)
-			}
-
-			if uint16(len(items)) == maxItemPerDataFrame {
-				frame := newS7DataFrame(key, variableParses, items, startAddressOffset, maxPdu)
-				dataFrames = append(dataFrames, frame)
-
-				itemMap = make(map[string]*S7Item, 0)
-				items = make([]*S7Item, 0)
-				variableParses = make([]*VariableParse, 0)
-				startAddressOffset = 0
-			}
-		}
-		if len(items) > 0 {
-			frame := newS7DataFrame(key, variableParses, items, startAddressOffset, maxPdu)
-			dataFrames = append(dataFrames, frame)
-		}
-		storeAddressDataFrameMap[key] = dataFrames
+	for key, variables := range groupVariables(device) {
+		storeAddressDataFrameMap[key] = newDataFrames(key, variables, maxPduLength)
 	}
 
 	dataFrameCount := 0
@@ -249,10 +179,155 @@ func NewBroker(d runtime.Device) (runtime.Broker, chan *runtime.ParseVariableRes
 		VariableCh:               make(chan *runtime.ParseVariableResult, 1),
 		VariableCount:            len(device.Variables),
 		Clients:                  clients,
+		MaxPduLength:             maxPduLength,
+		mu:                       &sync.RWMutex{},
 	}
 	return s7c, s7c.VariableCh, nil
 }
 
+// groupVariables group the enabled variables of device by store area
+func groupVariables(device *s7runtime.S7Device) map[s7runtime.S7StoreArea][]*s7runtime.Variable {
+	storeAddressVariableMap := make(map[s7runtime.S7StoreArea][]*s7runtime.Variable)
+	for _, variable := range device.Variables {
+		if variable.Disabled {
+			continue
+		}
+		zone := variable.Zone()
+		storeAddressVariableMap[zone] = append(storeAddressVariableMap[zone], variable)
+	}
+	return storeAddressVariableMap
+}
+
+// newDataFrames generate the read messages of variables of one store area, the items of one message are limited by pdu
+func newDataFrames(key s7runtime.S7StoreArea, variables []*s7runtime.Variable, maxPdu uint16) []*S7DataFrame {
+	sort.Sort(s7runtime.VariableSlice(variables))
+	dataFrames := make([]*S7DataFrame, 0)
+	// 请求报文19个字节 + item 每个item12个字节 返回的报文 cotp占19个字节 header2个字节
+	maxItemPerDataFrame := (maxPdu - 19) / 12
+	itemMap := make(map[string]*S7Item, 0)
+	items := make([]*S7Item, 0)
+	variableParses := make([]*VariableParse, 0)
+	startAddressOffset := 0
+	for _, variable := range variables {
+		zone, blockSize, startAddress, bitAddress := variable.ParseVariableAddress()
+		offset := int(4 + variable.DataResponseLength(key))
+		addressKey := fmt.Sprintf("%s.%d.%d", s7runtime.StoreAddressToString[zone], blockSize, startAddress)
+		if item, exist := itemMap[addressKey]; !exist {
+			it := &S7Item{
+				RequestData:  newS7COMMReadParameterItem(s7runtime.StoreAreaTransportSize[key], variable.DataRequestLength(key), uint16(blockSize), s7runtime.StoreAreaCode[key], startAddress, bitAddress),
+				StartAddress: uint(startAddressOffset),
+			}
+			startAddressOffset = startAddressOffset + offset
+			itemMap[addressKey] = it
+			items = append(items, it)
+			vp := &VariableParse{
+				Variable:           variable,
+				StartAddress:       it.StartAddress,
+				BitAddressOrLength: bitAddress,
+				BlockSize:          blockSize,
+			}
+			variableParses = append(variableParses, vp)
+		} else {
+			vp := &VariableParse{
+				Variable:           variable,
+				StartAddress:       item.StartAddress,
+				BitAddressOrLength: bitAddress,
+				BlockSize:          blockSize,
+			}
+			variableParses = append(variableParses, vp)
+		}
+
+		if uint16(len(items)) == maxItemPerDataFrame {
+			frame := newS7DataFrame(key, variableParses, items, startAddressOffset, maxPdu)
+			dataFrames = append(dataFrames, frame)
+
+			itemMap = make(map[string]*S7Item, 0)
+			items = make([]*S7Item, 0)
+			variableParses = make([]*VariableParse, 0)
+			startAddressOffset = 0
+		}
+	}
+	if len(items) > 0 {
+		frame := newS7DataFrame(key, variableParses, items, startAddressOffset, maxPdu)
+		dataFrames = append(dataFrames, frame)
+	}
+	return dataFrames
+}
+
+// RebuildVariables rebuild the data frames of store areas which the variables named belonged to or belong to, the
+// data frames of other store areas are kept and parse the values to the variables of latest device.
+func (broker *S7Broker) RebuildVariables(d runtime.Device, names []string) error {
+	device, ok := d.(*s7runtime.S7Device)
+	if !ok {
+		klog.V(2).InfoS("Unsupported device,type not S7")
+		return constant.ErrDeviceType
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+
+	variables := make(map[string]*s7runtime.Variable, len(device.Variables))
+	for _, variable := range device.Variables {
+		variables[variable.Name] = variable
+	}
+	changed := make(map[s7runtime.S7StoreArea]bool)
+	for _, name := range names {
+		if v, ok := broker.Device.VariablesMap[name]; ok {
+			changed[v.Zone()] = true
+		}
+		if v, ok := variables[name]; ok {
+			changed[v.Zone()] = true
+		}
+	}
+
+	dataFrameCount := 0
+	storeAddressDataFrameMap := make(map[s7runtime.S7StoreArea][]*S7DataFrame)
+	for key, vs := range groupVariables(device) {
+		dfs, ok := broker.StoreAddressDataFrameMap[key]
+		if changed[key] || !ok || !repointVariables(dfs, variables) {
+			dfs = newDataFrames(key, vs, broker.MaxPduLength)
+			klog.V(4).InfoS("Rebuilt s7 data frames", "deviceId", device.ID, "zone", s7runtime.StoreAddressToString[key], "dataFrames", len(dfs))
+		}
+		storeAddressDataFrameMap[key] = dfs
+		dataFrameCount += len(dfs)
+	}
+	if dataFrameCount == 0 {
+		return constant.ErrDeviceEmptyVariable
+	}
+
+	broker.Device = device
+	broker.StoreAddressDataFrameMap = storeAddressDataFrameMap
+	broker.VariableCount = len(device.Variables)
+	return nil
+}
+
+// repointVariables parse the values of kept data frames to the variables of latest device
+func repointVariables(dfs []*S7DataFrame, variables map[string]*s7runtime.Variable) bool {
+	for _, df := range dfs {
+		for _, vp := range df.Variables {
+			if _, ok := variables[vp.Variable.Name]; !ok {
+				return false
+			}
+		}
+	}
+	for _, df := range dfs {
+		for _, vp := range df.Variables {
+			vp.Variable = variables[vp.Variable.Name]
+		}
+	}
+	return true
+}
+
+// device the latest device collected, the data frames are polled with the device in poll
+func (broker *S7Broker) device() *s7runtime.S7Device {
+	broker.mu.RLock()
+	defer broker.mu.RUnlock()
+	return broker.Device
+}
+
+func (broker *S7Broker) PoolStats() (int, int) {
+	return broker.Clients.Stats()
+}
+
 func (broker *S7Broker) Destroy(ctx context.Context) {
 	broker.ExitCh <- struct{}{}
 	broker.Clients.Destroy(ctx)
@@ -263,17 +338,20 @@ func (broker *S7Broker) Collect(ctx context.Context) {
 	go func() {
 		for {
 			start := time.Now().Unix()
+			pollStart := time.Now()
 			if !broker.poll(ctx) {
 				return
 			}
+			device := broker.device()
+			metrics.ObservePoll(device.ID, device.DeviceType, pollStart)
 			select {
 			case <-broker.ExitCh:
 				return
 			default:
 				end := time.Now().Unix()
 				elapsed := end - start
-				if elapsed < int64(broker.Device.CollectorCycle) {
-					time.Sleep(time.Duration(int64(broker.Device.CollectorCycle)) * time.Second)
+				if elapsed < int64(device.CollectorCycle) {
+					time.Sleep(time.Duration(int64(device.CollectorCycle)) * time.Second)
 				}
 			}
 		}
@@ -281,10 +359,11 @@ func (broker *S7Broker) Collect(ctx context.Context) {
 }
 
 func (broker *S7Broker) DeliverAction(ctx context.Context, obj map[string]interface{}) error {
+	device := broker.device()
 	action := make([]*s7runtime.Variable, 0, len(obj))
 
 	for name, value := range obj {
-		vv, _ := broker.Device.GetVariable(name)
+		vv, _ := device.GetVariable(name)
 		variableValue := vv.(*s7runtime.Variable)
 
 		v := &s7runtime.Variable{
@@ -414,12 +493,14 @@ func (broker *S7Broker) poll(ctx context.Context) bool {
 	case <-broker.ExitCh:
 		return false
 	default:
+		broker.mu.RLock()
+		defer broker.mu.RUnlock()
 		sw := &sync.WaitGroup{}
 		dfvCh := make(chan *s7runtime.ParseVariableResult, 0)
-		for _, dataFrames := range broker.StoreAddressDataFrameMap {
-			for _, frame := range dataFrames {
+		for area, dataFrames := range broker.StoreAddressDataFrameMap {
+			for i, frame := range dataFrames {
 				sw.Add(1)
-				go broker.message(ctx, frame, dfvCh, sw, broker.Clients)
+				go broker.message(ctx, fmt.Sprintf("%v-%d", area, i), frame, dfvCh, sw, broker.Clients)
 			}
 		}
 		go broker.rollVariable(ctx, dfvCh)
@@ -428,7 +509,7 @@ func (broker *S7Broker) poll(ctx context.Context) bool {
 		return true
 	}
 }
-func (broker *S7Broker) message(ctx context.Context, dataFrame *S7DataFrame, pvrCh chan<- *s7runtime.ParseVariableResult, sw *sync.WaitGroup, clients *s7runtime.Clients) {
+func (broker *S7Broker) message(ctx context.Context, frameName string, dataFrame *S7DataFrame, pvrCh chan<- *s7runtime.ParseVariableResult, sw *sync.WaitGroup, clients *s7runtime.Clients) {
 	defer sw.Done()
 	defer func() {
 		if err := recover(); err != nil {
@@ -457,7 +538,8 @@ func (broker *S7Broker) message(ctx context.Context, dataFrame *S7DataFrame, pvr
 		return nil
 	}, messenger, dataFrame); err != nil {
 		klog.V(2).InfoS("Failed to connect s7 server by retry three times")
-		pvrCh <- &s7runtime.ParseVariableResult{Err: []error{err}}
+		metrics.FrameErrors.WithLabelValues(broker.Device.ID, broker.Device.DeviceType, frameName).Inc()
+		pvrCh <- &s7runtime.ParseVariableResult{Err: []error{err}, VariableSlice: dataFrame.FailedVariables(runtime.ReasonCommFailure)}
 		return
 	}
 
@@ -493,9 +575,9 @@ func (broker *S7Broker) rollVariable(ctx context.Context, ch chan *s7runtime.Par
 			if !ok {
 				broker.VariableCh <- &runtime.ParseVariableResult{Err: errs, VariableSlice: rvs}
 				return
-			} else if pvr.Err != nil {
-				errs = append(errs, pvr.Err...)
 			} else {
+				// the variables of failed frames are reported with bad quality
+				errs = append(errs, pvr.Err...)
 				for _, variable := range pvr.VariableSlice {
 					rvs = append(rvs, variable)
 				}
@@ -519,52 +601,22 @@ func (broker *S7Broker) generateActionParameterDataItem(action []*s7runtime.Vari
 				dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(0))...)
 			}
 		case constant.INT16:
-			var value int16
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = int16((variable.Value.(float64)) * variable.Rate)
-			} else {
-				value = variable.Value.(int16)
-			}
+			value := variable.Value.(int16)
 			dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(uint16(value))...)
 		case constant.UINT16:
-			var value uint16
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = uint16((variable.Value.(float64)) * variable.Rate)
-			} else {
-				value = variable.Value.(uint16)
-			}
+			value := variable.Value.(uint16)
 			dataByte = append(dataByte, binutil.Uint16ToBytesBigEndian(value)...)
 		case constant.INT32:
-			var value int32
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = int32((variable.Value.(float64)) * variable.Rate)
-			} else {
-				value = variable.Value.(int32)
-			}
+			value := variable.Value.(int32)
 			dataByte = append(dataByte, binutil.Uint32ToBytesBigEndian(uint32(value))...)
 		case constant.INT64:
-			var value int64
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = int64((variable.Value.(float64)) * variable.Rate)
-			} else {
-				value = variable.Value.(int64)
-			}
+			value := variable.Value.(int64)
 			dataByte = append(dataByte, binutil.Uint64ToBytesBigEndian(uint64(value))...)
 		case constant.FLOAT32:
-			var value float32
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = float32((variable.Value.(float64)) * variable.Rate)
-			} else {
-				value = variable.Value.(float32)
-			}
+			value := variable.Value.(float32)
 			dataByte = append(dataByte, binutil.Float32ToBytesBigEndian(value)...)
 		case constant.FLOAT64:
-			var value float64
-			if variable.Rate != 0 && variable.Rate != 1 {
-				value = (variable.Value.(float64)) * variable.Rate
-			} else {
-				value = variable.Value.(float64)
-			}
+			value := variable.Value.(float64)
 			dataByte = append(dataByte, binutil.Float64ToBytesBigEndian(value)...)
 		}
 		zone, blockSize, startAddress, bitAddress := variable.ParseVariableAddress()
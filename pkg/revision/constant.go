@@ -0,0 +1,28 @@
+package revision
+
+// the operations of revisions
+const (
+	OperationCreate   = "create"
+	OperationUpdate   = "update"
+	OperationRollback = "rollback"
+	// OperationSnapshot the resource found without its latest revision, e.g. created by older gateway or restored
+	OperationSnapshot = "snapshot"
+)
+
+// the sources of changes
+const (
+	SourceApi      = "api"
+	SourceTemplate = "template"
+	SourceImport   = "import"
+	// SourceFile the device file edited on disk
+	SourceFile = "file"
+	// SourceManifest the device manifest applied at startup or by command
+	SourceManifest = "manifest"
+)
+
+// the ops of changes
+const (
+	ChangeAdd     = "add"
+	ChangeRemove  = "remove"
+	ChangeReplace = "replace"
+)
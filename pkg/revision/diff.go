@@ -0,0 +1,78 @@
+package revision
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compare the changes from one JSON document to another, the arrays are compared by index
+func Compare(from, to json.RawMessage) ([]*Change, error) {
+	var v1, v2 interface{}
+	if err := json.Unmarshal(from, &v1); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &v2); err != nil {
+		return nil, err
+	}
+	changes := make([]*Change, 0)
+	compare("", v1, v2, &changes)
+	return changes, nil
+}
+
+func compare(path string, v1, v2 interface{}, changes *[]*Change) {
+	switch o1 := v1.(type) {
+	case map[string]interface{}:
+		if o2, ok := v2.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o1)+len(o2))
+			for key := range o1 {
+				keys = append(keys, key)
+			}
+			for key := range o2 {
+				if _, ok := o1[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				child := path + "/" + escape(key)
+				c1, ok1 := o1[key]
+				c2, ok2 := o2[key]
+				switch {
+				case !ok1:
+					*changes = append(*changes, &Change{Op: ChangeAdd, Path: child, Value: c2})
+				case !ok2:
+					*changes = append(*changes, &Change{Op: ChangeRemove, Path: child, OldValue: c1})
+				default:
+					compare(child, c1, c2, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if a2, ok := v2.([]interface{}); ok {
+			for i := 0; i < len(o1) || i < len(a2); i++ {
+				child := path + "/" + strconv.Itoa(i)
+				switch {
+				case i >= len(o1):
+					*changes = append(*changes, &Change{Op: ChangeAdd, Path: child, Value: a2[i]})
+				case i >= len(a2):
+					*changes = append(*changes, &Change{Op: ChangeRemove, Path: child, OldValue: o1[i]})
+				default:
+					compare(child, o1[i], a2[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(v1, v2) {
+		*changes = append(*changes, &Change{Op: ChangeReplace, Path: path, OldValue: v1, Value: v2})
+	}
+}
+
+// escape the key as reference token of JSON pointer
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,32 @@
+package revision
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	from := []byte(`{"name":"meter","slave":1,"address":{"location":"10.0.0.11"},"variables":[{"name":"current"},{"name":"voltage"}],"a/b":1}`)
+	to := []byte(`{"name":"meter","slave":2,"address":{"location":"10.0.0.11","option":{"port":502}},"variables":[{"name":"current","unit":"A"}]}`)
+	changes, err := Compare(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Change{
+		{Op: ChangeRemove, Path: "/a~1b", OldValue: float64(1)},
+		{Op: ChangeAdd, Path: "/address/option", Value: map[string]interface{}{"port": float64(502)}},
+		{Op: ChangeReplace, Path: "/slave", OldValue: float64(1), Value: float64(2)},
+		{Op: ChangeAdd, Path: "/variables/0/unit", Value: "A"},
+		{Op: ChangeRemove, Path: "/variables/1", OldValue: map[string]interface{}{"name": "voltage"}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		for _, c := range changes {
+			t.Logf("%+v", c)
+		}
+		t.Fatalf("Compare() got %d changes, want %d", len(changes), len(expected))
+	}
+
+	if changes, _ := Compare(from, from); len(changes) != 0 {
+		t.Errorf("Compare() of same documents = %v", changes)
+	}
+}
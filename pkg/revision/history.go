@@ -0,0 +1,203 @@
+package revision
+
+import (
+	"encoding/json"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/uuidutil"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Option func(*Revision)
+
+// WithAuthor record who or what changed the resource
+func WithAuthor(source string, author string) Option {
+	return func(r *Revision) {
+		r.Source = source
+		r.Author = author
+	}
+}
+
+// WithRollback mark the revision as rolling back to the former revision
+func WithRollback(revision int) Option {
+	return func(r *Revision) {
+		r.Operation = OperationRollback
+		r.RollbackOf = revision
+	}
+}
+
+// History the bounded revisions of resources in one store group, the oldest revisions are dropped
+type History struct {
+	mu        *sync.Mutex
+	max       int
+	client    storage.Storage
+	revisions map[string][]*Revision
+}
+
+func NewHistory(group storage.StoreGroup, max int) *History {
+	h := &History{
+		mu:        &sync.Mutex{},
+		max:       max,
+		revisions: make(map[string][]*Revision),
+	}
+	h.client = storage.NewClient(group)
+	h.load()
+	return h
+}
+
+func (h *History) load() {
+	objs, _ := h.client.List(storage.Revisions)
+	files, ok := objs.([]*storage.FileInfo)
+	if !ok {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, file := range files {
+		data, err := h.client.Get(key(filepath.Base(file.Path)))
+		if err != nil {
+			continue
+		}
+		r := &Revision{}
+		if err := json.Unmarshal(data.([]byte), r); err != nil {
+			klog.V(3).InfoS("Failed to unmarshal revision", "file", file.Path, "err", err)
+			continue
+		}
+		h.revisions[r.ResourceId] = append(h.revisions[r.ResourceId], r)
+	}
+	for id, revisions := range h.revisions {
+		sort.Slice(revisions, func(i, j int) bool {
+			return revisions[i].Revision < revisions[j].Revision
+		})
+		h.revisions[id] = h.prune(revisions)
+	}
+}
+
+// Record persist the snapshot of resource as its next revision
+func (h *History) Record(resourceId string, version string, operation string, object interface{}, opts ...Option) (*Revision, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := &Revision{
+		ID:         uuidutil.UUID(),
+		ResourceId: resourceId,
+		Revision:   1,
+		Version:    version,
+		Operation:  operation,
+		Timestamp:  time.Now(),
+		Object:     data,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if revisions := h.revisions[resourceId]; len(revisions) > 0 {
+		r.Revision = revisions[len(revisions)-1].Revision + 1
+	}
+	if _, err := h.client.Create(key(r.ID), r); err != nil {
+		klog.V(2).InfoS("Failed to store revision", "resourceId", resourceId, "err", err)
+		return nil, err
+	}
+	h.revisions[resourceId] = h.prune(append(h.revisions[resourceId], r))
+	return r, nil
+}
+
+// Latest the latest revision of resource, nil if the resource has no revision
+func (h *History) Latest(resourceId string) *Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	revisions := h.revisions[resourceId]
+	if len(revisions) == 0 {
+		return nil
+	}
+	return revisions[len(revisions)-1]
+}
+
+// List the revisions of resource without snapshots, the latest first
+func (h *History) List(resourceId string) []*Revision {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	revisions := h.revisions[resourceId]
+	result := make([]*Revision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		r := *revisions[i]
+		r.Object = nil
+		result = append(result, &r)
+	}
+	return result
+}
+
+// Get the revision of resource with snapshot
+func (h *History) Get(resourceId string, revision int) (*Revision, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.revisions[resourceId] {
+		if r.Revision == revision {
+			return r, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// Diff the changes from the revision to another, the current object is compared if to is zero
+func (h *History) Diff(resourceId string, from int, to int, current interface{}) (*Diff, error) {
+	r1, err := h.Get(resourceId, from)
+	if err != nil {
+		return nil, err
+	}
+	var target json.RawMessage
+	if to == 0 {
+		if target, err = json.Marshal(current); err != nil {
+			return nil, err
+		}
+	} else {
+		r2, err := h.Get(resourceId, to)
+		if err != nil {
+			return nil, err
+		}
+		target = r2.Object
+	}
+	changes, err := Compare(r1.Object, target)
+	if err != nil {
+		return nil, err
+	}
+	return &Diff{From: from, To: to, Changes: changes}, nil
+}
+
+// Delete the revisions of deleted resource
+func (h *History) Delete(resourceId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.revisions[resourceId] {
+		h.delete(r)
+	}
+	delete(h.revisions, resourceId)
+}
+
+// prune must be called with lock held
+func (h *History) prune(revisions []*Revision) []*Revision {
+	if len(revisions) <= h.max {
+		return revisions
+	}
+	expired := len(revisions) - h.max
+	for _, r := range revisions[:expired] {
+		h.delete(r)
+	}
+	return append([]*Revision{}, revisions[expired:]...)
+}
+
+func (h *History) delete(r *Revision) {
+	if _, err := h.client.Delete(key(r.ID), ""); err != nil {
+		klog.V(3).InfoS("Failed to delete revision", "revisionId", r.ID, "err", err)
+	}
+}
+
+func key(id string) string {
+	return filepath.Join(storage.Revisions, id)
+}
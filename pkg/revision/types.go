@@ -0,0 +1,35 @@
+package revision
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Revision the snapshot of resource after it is changed
+type Revision struct {
+	ID         string          `json:"id"`
+	ResourceId string          `json:"resourceId"`
+	Revision   int             `json:"revision"`             // 资源内递增的修订号
+	Version    string          `json:"version"`              // 修订对应的资源版本
+	Operation  string          `json:"operation"`            // create、update、rollback、snapshot
+	RollbackOf int             `json:"rollbackOf,omitempty"` // 回滚的目标修订号
+	Source     string          `json:"source,omitempty"`     // 修改来源 api、template、import
+	Author     string          `json:"author,omitempty"`     // 修改者 客户端地址、模板ID等
+	Timestamp  time.Time       `json:"timestamp"`
+	Object     json.RawMessage `json:"object,omitempty"` // 资源快照 列表中不返回
+}
+
+// Change one difference between two revisions, the path is JSON pointer like JSON patch
+type Change struct {
+	Op       string      `json:"op"` // add、remove、replace
+	Path     string      `json:"path"`
+	OldValue interface{} `json:"oldValue,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+// Diff the changes from one revision to another
+type Diff struct {
+	From    int       `json:"from"`
+	To      int       `json:"to"` // 0表示当前资源
+	Changes []*Change `json:"changes"`
+}
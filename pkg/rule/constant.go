@@ -0,0 +1,22 @@
+package rule
+
+import "time"
+
+// results of rule execution
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultSkipped the condition held but the execution was limited by min interval
+	ResultSkipped = "skipped"
+)
+
+const (
+	StatusEnable  = "enable"
+	StatusDisable = "disable"
+)
+
+const (
+	observationSize  = 1000
+	maxExecutionLogs = 100
+	tickInterval     = 1 * time.Second
+)
@@ -0,0 +1,29 @@
+package rule
+
+import "harnsgateway/pkg/runtime"
+
+func (in *Rule) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Actions != nil {
+		out.Actions = make([]*Action, 0, len(in.Actions))
+		for _, action := range in.Actions {
+			values := make(map[string]interface{}, len(action.Values))
+			for k, v := range action.Values {
+				values[k] = v
+			}
+			out.Actions = append(out.Actions, &Action{DeviceId: action.DeviceId, Values: values})
+		}
+	}
+	if in.Status != nil {
+		status := *in.Status
+		if in.Status.LastExecuteTime != nil {
+			t := *in.Status.LastExecuteTime
+			status.LastExecuteTime = &t
+		}
+		out.Status = &status
+	}
+	return &out
+}
@@ -0,0 +1,109 @@
+package rule
+
+import (
+	"harnsgateway/pkg/expression"
+	"harnsgateway/pkg/utils/convutil"
+	"k8s.io/klog/v2"
+	"time"
+)
+
+// engine keeps the state of one enabled rule. The rule fires once when the condition has held for
+// the duration, and is re-armed after the condition is gone.
+type engine struct {
+	rule *Rule
+	expr *expression.Expression
+	// devices all devices whose variables are referred by condition
+	devices     map[string]struct{}
+	matched     bool
+	since       time.Time
+	fired       bool
+	skipped     bool
+	lastExecute time.Time
+	executions  uint64
+	failures    uint64
+	logs        []*ExecutionLog
+}
+
+func newEngine(rule *Rule, expr *expression.Expression) *engine {
+	e := &engine{rule: rule, expr: expr, devices: make(map[string]struct{}, 0)}
+	for _, ref := range expr.References() {
+		if len(ref.Device) > 0 {
+			e.devices[ref.Device] = struct{}{}
+		} else {
+			e.devices[rule.DeviceId] = struct{}{}
+		}
+	}
+	return e
+}
+
+// refers whether the condition refers the variables of device
+func (e *engine) refers(deviceId string) bool {
+	_, ok := e.devices[deviceId]
+	return ok
+}
+
+// evaluate the condition with the latest values, the state is unchanged if any value is absent
+func (e *engine) evaluate(values func(deviceId string) map[string]interface{}) (bool, bool) {
+	result, err := e.expr.Evaluate(func(ref expression.Reference) (interface{}, bool) {
+		deviceId := ref.Device
+		if len(deviceId) == 0 {
+			deviceId = e.rule.DeviceId
+		}
+		v, ok := values(deviceId)[ref.Variable]
+		return v, ok
+	})
+	if err != nil {
+		return false, false
+	}
+	if b, ok := result.(bool); ok {
+		return b, true
+	}
+	f, ok := convutil.ToFloat64(result)
+	return ok && f != 0, ok
+}
+
+// update the condition state, returns true if the rule should fire. The rule limited by min interval is kept armed
+// and fires once the interval elapsed while the condition holds, the skip is logged once.
+func (e *engine) update(now time.Time, matched bool) bool {
+	if !matched {
+		e.matched, e.fired, e.skipped, e.since = false, false, false, time.Time{}
+		return false
+	}
+	if !e.matched {
+		e.matched, e.since = true, now
+	}
+	if e.fired || now.Sub(e.since) < time.Duration(e.rule.For)*time.Second {
+		return false
+	}
+	if e.limited(now) {
+		if !e.skipped {
+			klog.V(3).InfoS("Skipped rule execution because of min interval", "ruleId", e.rule.ID)
+			e.log(&ExecutionLog{Timestamp: now, Result: ResultSkipped})
+			e.skipped = true
+		}
+		return false
+	}
+	e.fired, e.skipped = true, false
+	return true
+}
+
+// limited whether the execution is limited by min interval
+func (e *engine) limited(now time.Time) bool {
+	return !e.lastExecute.IsZero() && now.Sub(e.lastExecute) < time.Duration(e.rule.MinInterval)*time.Second
+}
+
+func (e *engine) log(log *ExecutionLog) {
+	e.logs = append(e.logs, log)
+	if len(e.logs) > maxExecutionLogs {
+		e.logs = e.logs[len(e.logs)-maxExecutionLogs:]
+	}
+}
+
+func (e *engine) status() *RuleStatus {
+	status := &RuleStatus{Matched: e.matched, Executions: e.executions, Failures: e.failures}
+	if !e.lastExecute.IsZero() {
+		t := e.lastExecute
+		status.LastExecuteTime = &t
+	}
+	return status
+}
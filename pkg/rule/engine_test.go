@@ -0,0 +1,97 @@
+package rule
+
+import (
+	"harnsgateway/pkg/expression"
+	"testing"
+	"time"
+)
+
+func TestEngineFor(t *testing.T) {
+	expr, err := expression.Parse("level > 90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newEngine(&Rule{DeviceId: "tank", For: 5}, expr)
+	now := time.Now()
+	values := map[string]interface{}{"level": 95.0}
+	latest := func(string) map[string]interface{} { return values }
+
+	matched, ok := e.evaluate(latest)
+	if !ok || !matched {
+		t.Fatalf("expected matched, got %v %v", matched, ok)
+	}
+	if e.update(now, matched) {
+		t.Fatal("fired before duration elapsed")
+	}
+	if !e.update(now.Add(5*time.Second), true) {
+		t.Fatal("not fired after duration elapsed")
+	}
+	if e.update(now.Add(10*time.Second), true) {
+		t.Fatal("fired again while condition holds")
+	}
+
+	values["level"] = 80.0
+	matched, _ = e.evaluate(latest)
+	e.update(now.Add(11*time.Second), matched)
+	if e.update(now.Add(12*time.Second), true) {
+		t.Fatal("fired before duration elapsed after re-armed")
+	}
+	if !e.update(now.Add(17*time.Second), true) {
+		t.Fatal("not fired after re-armed")
+	}
+}
+
+func TestEngineAbsentValue(t *testing.T) {
+	expr, err := expression.Parse(`level > 90 && ref("pump", "running")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := newEngine(&Rule{DeviceId: "tank"}, expr)
+	if !e.refers("tank") || !e.refers("pump") {
+		t.Fatal("expected referring tank and pump")
+	}
+	values := map[string]map[string]interface{}{"tank": {"level": 95.0}}
+	if _, ok := e.evaluate(func(id string) map[string]interface{} { return values[id] }); ok {
+		t.Fatal("expected unknown result without values of pump")
+	}
+}
+
+func TestEngineMinInterval(t *testing.T) {
+	expr, _ := expression.Parse("level > 90")
+	e := newEngine(&Rule{DeviceId: "tank", MinInterval: 60}, expr)
+	now := time.Now()
+	if e.limited(now) {
+		t.Fatal("limited before first execution")
+	}
+	e.lastExecute = now
+	if !e.limited(now.Add(30 * time.Second)) {
+		t.Fatal("expected limited within min interval")
+	}
+	if e.limited(now.Add(60 * time.Second)) {
+		t.Fatal("expected not limited after min interval")
+	}
+}
+
+func TestEngineRetryAfterMinInterval(t *testing.T) {
+	expr, _ := expression.Parse("level > 90")
+	e := newEngine(&Rule{DeviceId: "tank", MinInterval: 60}, expr)
+	now := time.Now()
+	e.lastExecute = now.Add(-30 * time.Second)
+
+	if e.update(now, true) {
+		t.Fatal("fired within min interval")
+	}
+	if e.update(now.Add(10*time.Second), true) {
+		t.Fatal("fired within min interval")
+	}
+	if len(e.logs) != 1 || e.logs[0].Result != ResultSkipped {
+		t.Fatalf("expected skipped logged once, got %v", e.logs)
+	}
+	// the condition held past the interval, the rule kept armed fires
+	if !e.update(now.Add(30*time.Second), true) {
+		t.Fatal("not fired after min interval elapsed")
+	}
+	if e.update(now.Add(31*time.Second), true) {
+		t.Fatal("fired again while condition holds")
+	}
+}
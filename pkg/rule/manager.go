@@ -0,0 +1,396 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/device"
+	"harnsgateway/pkg/expression"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeviceController finds the devices referred by rules and writes the values of actions
+type DeviceController interface {
+	GetDeviceById(id string, exploded bool) (runtime.Device, error)
+	DeliverAction(id string, actions []map[string]interface{}, opts ...device.ActionOption) error
+}
+
+type observation struct {
+	deviceId  string
+	timestamp time.Time
+	values    []runtime.PointData
+}
+
+// Manager evaluates the rules with the collected values and executes the actions locally,
+// so the interlocks keep working when the cloud is offline.
+type Manager struct {
+	devices      DeviceController
+	mu           *sync.Mutex
+	rules        map[string]*Rule
+	engines      map[string]*engine
+	values       map[string]map[string]interface{}
+	client       storage.Storage
+	observations chan *observation
+	stopCh       <-chan struct{}
+}
+
+func NewManager(stop <-chan struct{}) *Manager {
+	return &Manager{
+		mu:           &sync.Mutex{},
+		rules:        make(map[string]*Rule, 0),
+		engines:      make(map[string]*engine, 0),
+		values:       make(map[string]map[string]interface{}, 0),
+		observations: make(chan *observation, observationSize),
+		stopCh:       stop,
+	}
+}
+
+func (m *Manager) Init(devices DeviceController) {
+	m.devices = devices
+	m.client = storage.NewClient(storage.StoreGroupRule)
+
+	objs, _ := m.client.List(storage.Rules)
+	if files, ok := objs.([]*storage.FileInfo); ok {
+		for _, file := range files {
+			data, err := m.client.Get(filepath.Join(storage.Rules, filepath.Base(file.Path)))
+			if err != nil {
+				continue
+			}
+			rule := &Rule{}
+			if err := json.NewDecoder(bytes.NewReader(data.([]byte))).Decode(rule); err != nil {
+				klog.V(2).InfoS("Failed to unmarshal rule", "err", err)
+				continue
+			}
+			expr, err := expression.Parse(rule.Condition)
+			if err != nil {
+				klog.V(2).InfoS("Failed to parse condition of rule", "ruleId", rule.ID, "err", err)
+				continue
+			}
+			m.rules[rule.ID] = rule
+			m.engines[rule.ID] = newEngine(rule, expr)
+		}
+	}
+
+	go m.run()
+}
+
+// Observe queues the values of device, the values are dropped if the queue is full.
+func (m *Manager) Observe(device runtime.Device, timestamp time.Time, values []runtime.PointData) {
+	select {
+	case m.observations <- &observation{deviceId: device.GetID(), timestamp: timestamp, values: values}:
+	default:
+		klog.V(3).InfoS("Dropped values of rule evaluation because of full queue", "deviceId", device.GetID())
+	}
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case o := <-m.observations:
+			m.evaluate(o)
+		case now := <-ticker.C:
+			m.tick(now)
+		}
+	}
+}
+
+func (m *Manager) evaluate(o *observation) {
+	values := make(map[string]interface{}, len(o.values))
+	for _, pd := range o.values {
+		values[pd.DataPointId] = pd.Value
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[o.deviceId] = values
+	for _, e := range m.engines {
+		if !e.rule.Enabled || !e.refers(o.deviceId) {
+			continue
+		}
+		matched, ok := e.evaluate(m.latestValues)
+		if !ok {
+			continue
+		}
+		if e.update(o.timestamp, matched) {
+			m.execute(e, o.timestamp)
+		}
+	}
+}
+
+// tick fires the rules whose condition has held for the duration
+func (m *Manager) tick(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.engines {
+		if e.rule.Enabled && e.matched && e.update(now, true) {
+			m.execute(e, now)
+		}
+	}
+}
+
+func (m *Manager) latestValues(deviceId string) map[string]interface{} {
+	return m.values[deviceId]
+}
+
+// execute the actions of rule in background, must be called with lock held
+func (m *Manager) execute(e *engine, now time.Time) {
+	e.lastExecute = now
+	e.executions++
+	actions := e.rule.DeepCopyObject().(*Rule).Actions
+
+	go func() {
+		log := &ExecutionLog{Timestamp: now, Result: ResultSuccess}
+		for _, action := range actions {
+			if err := m.devices.DeliverAction(action.DeviceId, []map[string]interface{}{action.Values}, device.WithRequester(device.ActionSourceRule, e.rule.ID)); err != nil {
+				klog.V(2).InfoS("Failed to execute rule action", "ruleId", e.rule.ID, "deviceId", action.DeviceId, "err", err)
+				log.Result = ResultFailure
+				log.Error = err.Error()
+				break
+			}
+		}
+		klog.V(3).InfoS("Executed rule", "ruleId", e.rule.ID, "result", log.Result)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if log.Result == ResultFailure {
+			e.failures++
+		}
+		e.log(log)
+	}()
+}
+
+func (m *Manager) CreateRule(object *v1.Rule) (*Rule, error) {
+	rule := &Rule{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applyRule(rule, object)
+	expr, err := m.validateRule(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(ruleKey(rule.ID), rule); err != nil {
+		klog.V(2).InfoS("Failed to store rule", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules[rule.ID] = rule
+	m.engines[rule.ID] = newEngine(rule, expr)
+	return m.copyRule(rule), nil
+}
+
+func (m *Manager) UpdateRuleById(id string, version string, object *v1.Rule) (*Rule, error) {
+	old, err := m.GetRuleById(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	rule := old.DeepCopyObject().(*Rule)
+	rule.Status = nil
+	rule.ModTime = time.Now()
+	applyRule(rule, object)
+	expr, err := m.validateRule(rule)
+	if err != nil {
+		return nil, err
+	}
+	return m.updateRule(rule, version, expr)
+}
+
+// SwitchRuleStatus enable or disable the rule
+func (m *Manager) SwitchRuleStatus(id string, status string) (*Rule, error) {
+	old, err := m.GetRuleById(id)
+	if err != nil {
+		return nil, err
+	}
+	if status != StatusEnable && status != StatusDisable {
+		return nil, response.ErrDeviceOperatorUnSupported(status)
+	}
+	rule := old.DeepCopyObject().(*Rule)
+	rule.Status = nil
+	rule.Enabled = status == StatusEnable
+	if rule.Enabled == old.Enabled {
+		return old, nil
+	}
+	rule.ModTime = time.Now()
+	expr, err := expression.Parse(rule.Condition)
+	if err != nil {
+		return nil, response.ErrRuleConditionInvalid(rule.Name, err.Error())
+	}
+	return m.updateRule(rule, old.GetVersion(), expr)
+}
+
+func (m *Manager) updateRule(rule *Rule, version string, expr *expression.Expression) (*Rule, error) {
+	if _, err := m.client.Update(ruleKey(rule.ID), version, rule); err != nil {
+		klog.V(2).InfoS("Failed to update rule", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// the condition may be changed, the rule is re-armed and keeps the execution logs
+	e := newEngine(rule, expr)
+	if old, ok := m.engines[rule.ID]; ok {
+		e.lastExecute, e.executions, e.failures, e.logs = old.lastExecute, old.executions, old.failures, old.logs
+	}
+	m.rules[rule.ID] = rule
+	m.engines[rule.ID] = e
+	return m.copyRule(rule), nil
+}
+
+func (m *Manager) DeleteRule(id string, version string) (*Rule, error) {
+	rule, err := m.GetRuleById(id)
+	if err != nil {
+		return nil, err
+	}
+	if rule.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.client.Delete(ruleKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete rule", "ruleId", id, "err", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.rules, id)
+	delete(m.engines, id)
+	klog.V(2).InfoS("Deleted rule", "ruleId", id)
+	return rule, nil
+}
+
+func (m *Manager) ListRules() ([]*Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rules := make([]*Rule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		rules = append(rules, m.copyRule(rule))
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ModTime.After(rules[j].ModTime) })
+	return rules, nil
+}
+
+func (m *Manager) GetRuleById(id string) (*Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rule, ok := m.rules[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return m.copyRule(rule), nil
+}
+
+// ListExecutionLogs the latest logs first
+func (m *Manager) ListExecutionLogs(id string) ([]*ExecutionLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.engines[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	logs := make([]*ExecutionLog, 0, len(e.logs))
+	for i := len(e.logs) - 1; i >= 0; i-- {
+		log := *e.logs[i]
+		logs = append(logs, &log)
+	}
+	return logs, nil
+}
+
+// copyRule copy the rule with the runtime status, must be called with lock held
+func (m *Manager) copyRule(rule *Rule) *Rule {
+	out := rule.DeepCopyObject().(*Rule)
+	if e, ok := m.engines[rule.ID]; ok {
+		out.Status = e.status()
+	}
+	return out
+}
+
+// validateRule all referred devices and variables should exist, and the variables of actions should be writable
+func (m *Manager) validateRule(rule *Rule) (*expression.Expression, error) {
+	expr, err := expression.Parse(rule.Condition)
+	if err != nil {
+		return nil, response.ErrRuleConditionInvalid(rule.Name, err.Error())
+	}
+	if len(rule.DeviceId) > 0 {
+		if _, err := m.devices.GetDeviceById(rule.DeviceId, true); err != nil {
+			return nil, response.ErrDeviceNotFound(rule.DeviceId)
+		}
+	}
+	for _, ref := range expr.References() {
+		deviceId := ref.Device
+		if len(deviceId) == 0 {
+			if len(rule.DeviceId) == 0 {
+				return nil, response.ErrRuleConditionInvalid(rule.Name, "deviceId is required to refer variable "+ref.Variable)
+			}
+			deviceId = rule.DeviceId
+		}
+		device, err := m.devices.GetDeviceById(deviceId, true)
+		if err != nil {
+			return nil, response.ErrRuleConditionInvalid(rule.Name, "device "+deviceId+" not found")
+		}
+		if !runtime.HasVariable(device, ref.Variable) {
+			return nil, response.ErrRuleConditionInvalid(rule.Name, "variable "+ref.Variable+" not found")
+		}
+	}
+
+	for _, action := range rule.Actions {
+		device, err := m.devices.GetDeviceById(action.DeviceId, true)
+		if err != nil {
+			return nil, response.ErrDeviceNotFound(action.DeviceId)
+		}
+		for name := range action.Values {
+			variable, exist := device.GetVariable(name)
+			if !exist {
+				return nil, response.ErrResourceNotFound(name)
+			}
+			if variable.GetVariableAccessMode() != constant.AccessModeReadWrite {
+				return nil, response.ErrVariableNotWritable(name)
+			}
+		}
+	}
+	return expr, nil
+}
+
+func applyRule(rule *Rule, object *v1.Rule) {
+	rule.Name = object.Name
+	rule.Enabled = object.Enabled
+	rule.DeviceId = object.DeviceId
+	rule.Condition = object.Condition
+	rule.For = object.For
+	rule.MinInterval = object.MinInterval
+	rule.Actions = make([]*Action, 0, len(object.Actions))
+	for _, action := range object.Actions {
+		rule.Actions = append(rule.Actions, &Action{DeviceId: action.DeviceId, Values: action.Values})
+	}
+}
+
+func ruleKey(id string) string {
+	return filepath.Join(storage.Rules, id)
+}
@@ -0,0 +1,145 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/rules", createRule(mgr))
+	group.DELETE("/rules/:id", deleteRule(mgr))
+	group.PUT("/rules/:id", updateRuleById(mgr))
+	group.GET("/rules", listRules(mgr))
+	group.GET("/rules/:id", getRuleById(mgr))
+	group.PUT("/rules/:id/:status", switchRuleStatusById(mgr))
+	group.GET("/rules/:id/logs", listExecutionLogs(mgr))
+}
+
+func createRule(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Rule{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse rule", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		rule, err := mgr.CreateRule(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, rule.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, rule.GetID()))
+		c.JSON(http.StatusCreated, rule)
+	}
+}
+
+func deleteRule(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		rule, err := mgr.DeleteRule(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func updateRuleById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.Rule{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse rule", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateRuleById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func switchRuleStatusById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		updated, err := mgr.SwitchRuleStatus(c.Param("id"), c.Param("status"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listRules(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, _ := mgr.ListRules()
+		c.JSON(http.StatusOK, &ResponseModel{Rules: rules})
+	}
+}
+
+func getRuleById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule, err := mgr.GetRuleById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, rule.GetVersion())
+		c.JSON(http.StatusOK, rule)
+	}
+}
+
+func listExecutionLogs(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logs, err := mgr.ListExecutionLogs(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, &ResponseModel{Logs: logs})
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
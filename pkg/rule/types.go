@@ -0,0 +1,42 @@
+package rule
+
+import (
+	"harnsgateway/pkg/runtime"
+	"time"
+)
+
+// Rule writes values to variables when the condition holds
+type Rule struct {
+	runtime.ObjectMeta
+	Enabled     bool        `json:"enabled"`               // 是否启用
+	DeviceId    string      `json:"deviceId,omitempty"`    // 条件中直接使用变量名时变量所属的设备
+	Condition   string      `json:"condition"`             // 条件表达式
+	For         uint        `json:"for,omitempty"`         // 条件持续满足多久后执行(秒)
+	MinInterval uint        `json:"minInterval,omitempty"` // 两次执行的最小间隔(秒)
+	Actions     []*Action   `json:"actions"`               // 执行的动作
+	Status      *RuleStatus `json:"status,omitempty"`      // 运行状态 不持久化
+}
+
+type Action struct {
+	DeviceId string                 `json:"deviceId"` // 设备id
+	Values   map[string]interface{} `json:"values"`   // 写入的变量与值
+}
+
+type RuleStatus struct {
+	Matched         bool       `json:"matched"`                   // 条件当前是否满足
+	LastExecuteTime *time.Time `json:"lastExecuteTime,omitempty"` // 最近一次执行时间
+	Executions      uint64     `json:"executions"`                // 执行次数
+	Failures        uint64     `json:"failures"`                  // 失败次数
+}
+
+// ExecutionLog the result of one execution, the latest logs of each rule are kept in memory
+type ExecutionLog struct {
+	Timestamp time.Time `json:"timestamp"`
+	Result    string    `json:"result"` // success、failure、skipped
+	Error     string    `json:"error,omitempty"`
+}
+
+type ResponseModel struct {
+	Rules interface{} `json:"rules,omitempty"`
+	Logs  interface{} `json:"logs,omitempty"`
+}
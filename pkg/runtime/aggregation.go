@@ -0,0 +1,291 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"harnsgateway/pkg/utils/convutil"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+	AggregateAvg   = "avg"
+	AggregateLast  = "last"
+	AggregateCount = "count"
+)
+
+const (
+	EmitRaw        = "raw"
+	EmitAggregated = "aggregated"
+	EmitBoth       = "both"
+)
+
+const maxAggregationWindow = 86400
+
+var aggregateFunctions = []string{AggregateMin, AggregateMax, AggregateAvg, AggregateLast, AggregateCount}
+
+// Aggregationer is implemented by the device whose variables are aggregated in windows before publishing
+type Aggregationer interface {
+	GetAggregations() []*Aggregation
+	SetAggregations([]*Aggregation)
+}
+
+// Aggregation aggregates the samples of variables in windows aligned to the step, the aggregated values are
+// published as {variable}_{function} with the timestamp of window end.
+type Aggregation struct {
+	Window    uint     `json:"window"`              // 窗口长度(秒)
+	Step      uint     `json:"step,omitempty"`      // 滑动步长(秒) 为0或等于window时为滚动窗口
+	Functions []string `json:"functions,omitempty"` // min、max、avg、last、count 默认全部
+	Variables []string `json:"variables,omitempty"` // 聚合的变量 为空时聚合其他聚合未包含的全部变量
+	Emit      string   `json:"emit,omitempty"`      // raw、aggregated、both 默认aggregated
+}
+
+// Validate check the window, step, functions and emit
+func (a *Aggregation) Validate() error {
+	if a.Window == 0 || a.Window > maxAggregationWindow {
+		return fmt.Errorf("window should be between 1 and %d", maxAggregationWindow)
+	}
+	if a.Step > a.Window {
+		return errors.New("step should not be greater than window")
+	}
+	for _, f := range a.Functions {
+		if !sets.NewString(aggregateFunctions...).Has(f) {
+			return fmt.Errorf("function %s unsupported", f)
+		}
+	}
+	switch a.Emit {
+	case "", EmitRaw, EmitAggregated, EmitBoth:
+	default:
+		return fmt.Errorf("emit %s unsupported", a.Emit)
+	}
+	return nil
+}
+
+func (a *Aggregation) GetStep() uint {
+	if a.Step == 0 {
+		return a.Window
+	}
+	return a.Step
+}
+
+func (a *Aggregation) GetFunctions() []string {
+	if len(a.Functions) == 0 {
+		return aggregateFunctions
+	}
+	return a.Functions
+}
+
+func (a *Aggregation) GetEmit() string {
+	if len(a.Emit) == 0 {
+		return EmitAggregated
+	}
+	return a.Emit
+}
+
+// ValidateAggregations each variable is aggregated by one aggregation at most, and only one aggregation
+// could aggregate all variables.
+func ValidateAggregations(aggregations []*Aggregation) error {
+	variables := sets.NewString()
+	defaults := 0
+	for _, a := range aggregations {
+		if err := a.Validate(); err != nil {
+			return err
+		}
+		if len(a.Variables) == 0 {
+			defaults++
+		}
+		for _, v := range a.Variables {
+			if variables.Has(v) {
+				return fmt.Errorf("variable %s is aggregated more than once", v)
+			}
+			variables.Insert(v)
+		}
+	}
+	if defaults > 1 {
+		return errors.New("only one aggregation could omit variables")
+	}
+	return nil
+}
+
+type sample struct {
+	timestamp time.Time
+	value     interface{}
+}
+
+type windowState struct {
+	aggregation *Aggregation
+	window      time.Duration
+	step        time.Duration
+	// the end of next window
+	next    time.Time
+	samples map[string][]sample
+}
+
+// WindowAggregator keeps the samples of device and emits the aggregated values when the windows end.
+// The windows are closed by time rather than by samples, so the windows without samples, e.g. when the
+// device is unconnected, are skipped instead of being filled or merged into the next window.
+type WindowAggregator struct {
+	mu      *sync.Mutex
+	windows []*windowState
+	// the explicit variables to window, the other variables go to the default window if exists
+	variables map[string]*windowState
+	defaults  *windowState
+}
+
+func NewWindowAggregator(aggregations []*Aggregation, now time.Time) *WindowAggregator {
+	wa := &WindowAggregator{mu: &sync.Mutex{}, variables: make(map[string]*windowState, 0)}
+	for _, a := range aggregations {
+		step := time.Duration(a.GetStep()) * time.Second
+		w := &windowState{
+			aggregation: a,
+			window:      time.Duration(a.Window) * time.Second,
+			step:        step,
+			next:        now.Truncate(step).Add(step),
+			samples:     make(map[string][]sample, 0),
+		}
+		wa.windows = append(wa.windows, w)
+		if len(a.Variables) == 0 {
+			wa.defaults = w
+		}
+		for _, v := range a.Variables {
+			wa.variables[v] = w
+		}
+	}
+	return wa
+}
+
+func (wa *WindowAggregator) windowOf(variable string) *windowState {
+	if w, ok := wa.variables[variable]; ok {
+		return w
+	}
+	return wa.defaults
+}
+
+// Add keeps the samples of aggregated variables, returns the values to be published as raw series
+func (wa *WindowAggregator) Add(timestamp time.Time, values []PointData) []PointData {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	raw := make([]PointData, 0, len(values))
+	for _, pd := range values {
+		w := wa.windowOf(pd.DataPointId)
+		if w == nil {
+			raw = append(raw, pd)
+			continue
+		}
+		w.samples[pd.DataPointId] = append(w.samples[pd.DataPointId], sample{timestamp: timestamp, value: pd.Value})
+		if w.aggregation.GetEmit() != EmitAggregated {
+			raw = append(raw, pd)
+		}
+	}
+	return raw
+}
+
+// Flush emits the windows ended before now, ordered by the window end
+func (wa *WindowAggregator) Flush(now time.Time) []TimeSeriesData {
+	wa.mu.Lock()
+	defer wa.mu.Unlock()
+	ends := make([]time.Time, 0)
+	values := make(map[time.Time][]PointData, 0)
+	for _, w := range wa.windows {
+		// skip the windows without samples at once, e.g. the device is unconnected for a long time
+		if latest := now.Truncate(w.step); len(w.samples) == 0 && latest.After(w.next) {
+			w.next = latest
+		}
+		for !w.next.After(now) {
+			if pds := w.aggregate(w.next.Add(-w.window), w.next); len(pds) > 0 {
+				if _, ok := values[w.next]; !ok {
+					ends = append(ends, w.next)
+				}
+				values[w.next] = append(values[w.next], pds...)
+			}
+			w.next = w.next.Add(w.step)
+		}
+		w.prune(w.next.Add(-w.window))
+	}
+
+	sort.Slice(ends, func(i, j int) bool { return ends[i].Before(ends[j]) })
+	tsd := make([]TimeSeriesData, 0, len(ends))
+	for _, end := range ends {
+		tsd = append(tsd, TimeSeriesData{Timestamp: end.UTC().Format("2006-01-02T15:04:05.000Z"), Values: values[end]})
+	}
+	return tsd
+}
+
+// aggregate the samples in [start, end)
+func (w *windowState) aggregate(start time.Time, end time.Time) []PointData {
+	pds := make([]PointData, 0)
+	variables := make([]string, 0, len(w.samples))
+	for variable := range w.samples {
+		variables = append(variables, variable)
+	}
+	sort.Strings(variables)
+	for _, variable := range variables {
+		samples := w.samples[variable]
+		var count int
+		var last interface{}
+		var min, max, sum float64
+		numbers := 0
+		for _, s := range samples {
+			if s.timestamp.Before(start) || !s.timestamp.Before(end) {
+				continue
+			}
+			count++
+			last = s.value
+			f, ok := convutil.ToFloat64(s.value)
+			if !ok {
+				continue
+			}
+			if numbers == 0 || f < min {
+				min = f
+			}
+			if numbers == 0 || f > max {
+				max = f
+			}
+			sum += f
+			numbers++
+		}
+		if count == 0 {
+			continue
+		}
+		for _, function := range w.aggregation.GetFunctions() {
+			var value interface{}
+			switch function {
+			case AggregateCount:
+				value = count
+			case AggregateLast:
+				value = last
+			case AggregateMin:
+				value = min
+			case AggregateMax:
+				value = max
+			case AggregateAvg:
+				value = sum / float64(numbers)
+			}
+			// min, max and avg are omitted for the non-numeric variables
+			if numbers == 0 && function != AggregateCount && function != AggregateLast {
+				continue
+			}
+			pds = append(pds, PointData{DataPointId: variable + "_" + function, Value: value})
+		}
+	}
+	return pds
+}
+
+// prune drop the samples before the start of next window
+func (w *windowState) prune(start time.Time) {
+	for variable, samples := range w.samples {
+		i := 0
+		for i < len(samples) && samples[i].timestamp.Before(start) {
+			i++
+		}
+		if i == len(samples) {
+			delete(w.samples, variable)
+			continue
+		}
+		w.samples[variable] = samples[i:]
+	}
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowAggregatorTumbling(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 10, 0, time.UTC)
+	wa := NewWindowAggregator([]*Aggregation{{Window: 60, Variables: []string{"temperature"}}}, start)
+
+	raw := wa.Add(start, []PointData{{DataPointId: "temperature", Value: 20.0}, {DataPointId: "status", Value: true}})
+	if len(raw) != 1 || raw[0].DataPointId != "status" {
+		t.Fatalf("expected the raw value of status only, got %v", raw)
+	}
+	wa.Add(start.Add(20*time.Second), []PointData{{DataPointId: "temperature", Value: int16(30)}})
+	if tsd := wa.Flush(start.Add(40 * time.Second)); len(tsd) != 0 {
+		t.Fatalf("expected no window ended, got %v", tsd)
+	}
+	// the next sample belongs to the next window
+	wa.Add(start.Add(55*time.Second), []PointData{{DataPointId: "temperature", Value: 40.0}})
+
+	tsd := wa.Flush(start.Add(50 * time.Second))
+	if len(tsd) != 1 || tsd[0].Timestamp != "2023-01-01T00:01:00.000Z" {
+		t.Fatalf("expected the window aligned to minute, got %v", tsd)
+	}
+	expected := map[string]interface{}{
+		"temperature_min": 20.0, "temperature_max": 30.0, "temperature_avg": 25.0,
+		"temperature_last": int16(30), "temperature_count": 2,
+	}
+	if len(tsd[0].Values) != len(expected) {
+		t.Fatalf("unexpected values %v", tsd[0].Values)
+	}
+	for _, pd := range tsd[0].Values {
+		if expected[pd.DataPointId] != pd.Value {
+			t.Errorf("expected %s %v, got %v", pd.DataPointId, expected[pd.DataPointId], pd.Value)
+		}
+	}
+
+	// the windows without samples are skipped when the device is unconnected
+	tsd = wa.Flush(start.Add(5 * time.Minute))
+	if len(tsd) != 1 || tsd[0].Timestamp != "2023-01-01T00:02:00.000Z" {
+		t.Fatalf("expected only the window with samples, got %v", tsd)
+	}
+}
+
+func TestWindowAggregatorSliding(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	wa := NewWindowAggregator([]*Aggregation{{Window: 30, Step: 10, Functions: []string{AggregateCount}, Emit: EmitBoth}}, start)
+	for i := 0; i < 30; i++ {
+		raw := wa.Add(start.Add(time.Duration(i)*time.Second), []PointData{{DataPointId: "speed", Value: float32(i)}})
+		if len(raw) != 1 {
+			t.Fatalf("expected raw value emitted, got %v", raw)
+		}
+	}
+	tsd := wa.Flush(start.Add(30 * time.Second))
+	counts := []int{10, 20, 30}
+	if len(tsd) != len(counts) {
+		t.Fatalf("expected %d windows, got %v", len(counts), tsd)
+	}
+	for i, c := range counts {
+		if tsd[i].Values[0].DataPointId != "speed_count" || tsd[i].Values[0].Value != c {
+			t.Errorf("window %d: expected count %d, got %v", i, c, tsd[i].Values)
+		}
+	}
+}
+
+func TestValidateAggregations(t *testing.T) {
+	for name, aggregations := range map[string][]*Aggregation{
+		"window":    {{Window: 0}},
+		"step":      {{Window: 10, Step: 20}},
+		"function":  {{Window: 10, Functions: []string{"median"}}},
+		"emit":      {{Window: 10, Emit: "none"}},
+		"duplicate": {{Window: 10, Variables: []string{"a"}}, {Window: 20, Variables: []string{"a"}}},
+		"defaults":  {{Window: 10}, {Window: 20}},
+	} {
+		if err := ValidateAggregations(aggregations); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package constant
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type StopBits int
 
 const (
@@ -53,3 +58,57 @@ var StringToParity = map[string]Parity{
 	"markParity":  MarkParity,
 	"spaceParity": SpaceParity,
 }
+
+func (sb StopBits) MarshalJSON() ([]byte, error) {
+	if s, ok := StopBitsToString[sb]; ok {
+		return json.Marshal(s)
+	}
+	return nil, fmt.Errorf("unknown stop bits %d", sb)
+}
+
+// UnmarshalJSON the stop bits stored as number before are accepted as well
+func (sb *StopBits) UnmarshalJSON(bytes []byte) error {
+	var n int
+	if err := json.Unmarshal(bytes, &n); err == nil {
+		*sb = StopBits(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		return err
+	}
+
+	v, ok := StringToStopBits[s]
+	if !ok {
+		return fmt.Errorf("unknown stop bits %s", s)
+	}
+	*sb = v
+	return nil
+}
+
+func (p Parity) MarshalJSON() ([]byte, error) {
+	if s, ok := ParityToString[p]; ok {
+		return json.Marshal(s)
+	}
+	return nil, fmt.Errorf("unknown parity %d", p)
+}
+
+// UnmarshalJSON the parity stored as number before is accepted as well
+func (p *Parity) UnmarshalJSON(bytes []byte) error {
+	var n int
+	if err := json.Unmarshal(bytes, &n); err == nil {
+		*p = Parity(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(bytes, &s); err != nil {
+		return err
+	}
+
+	v, ok := StringToParity[s]
+	if !ok {
+		return fmt.Errorf("unknown parity %s", s)
+	}
+	*p = v
+	return nil
+}
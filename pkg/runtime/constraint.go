@@ -1 +1,181 @@
 package runtime
+
+import (
+	"errors"
+	"fmt"
+	"harnsgateway/pkg/runtime/constant"
+	"harnsgateway/pkg/utils/convutil"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Constrainer is implemented by the variable which checks the values written to device
+type Constrainer interface {
+	GetDataType() constant.DataType
+	GetConstraint() *Constraint
+}
+
+// Constraint the limits of values written to variable, checked with engineering value before any frame is built
+type Constraint struct {
+	Min     *float64      `json:"min,omitempty"`     // 写入下限
+	Max     *float64      `json:"max,omitempty"`     // 写入上限
+	Enum    []interface{} `json:"enum,omitempty"`    // 允许写入的值
+	MaxStep *float64      `json:"maxStep,omitempty"` // 相对当前值的最大变化量
+}
+
+// the range of raw values of integer data types
+var integerRanges = map[constant.DataType][2]float64{
+	constant.INT16:  {math.MinInt16, math.MaxInt16},
+	constant.UINT16: {0, math.MaxUint16},
+	constant.INT32:  {math.MinInt32, math.MaxInt32},
+	constant.INT64:  {math.MinInt64, math.MaxInt64},
+}
+
+// Validate check the range, max step and enum values
+func (c *Constraint) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Min != nil && c.Max != nil && *c.Min > *c.Max {
+		return errors.New("min should not be greater than max")
+	}
+	if c.MaxStep != nil && *c.MaxStep <= 0 {
+		return errors.New("max step should be greater than 0")
+	}
+	for _, e := range c.Enum {
+		switch e.(type) {
+		case bool, string, float64:
+		default:
+			return fmt.Errorf("enum value %v should be bool, number or string", e)
+		}
+	}
+	return nil
+}
+
+// Check returns all violations of the value, the max step is ignored if the current value is unknown
+func (c *Constraint) Check(value interface{}, current interface{}) []error {
+	if c == nil {
+		return nil
+	}
+	errs := make([]error, 0)
+	if len(c.Enum) > 0 {
+		allowed := false
+		for _, e := range c.Enum {
+			if enumEqual(e, value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			errs = append(errs, fmt.Errorf("should be one of %v", c.Enum))
+		}
+	}
+	if _, ok := value.(bool); ok {
+		return errs
+	}
+	f, ok := convutil.ToFloat64(value)
+	if !ok {
+		return errs
+	}
+	if c.Min != nil && f < *c.Min {
+		errs = append(errs, fmt.Errorf("should not be less than %v", *c.Min))
+	}
+	if c.Max != nil && f > *c.Max {
+		errs = append(errs, fmt.Errorf("should not be greater than %v", *c.Max))
+	}
+	if c.MaxStep != nil {
+		if _, ok := current.(bool); !ok {
+			if cur, ok := convutil.ToFloat64(current); ok && math.Abs(f-cur) > *c.MaxStep {
+				errs = append(errs, fmt.Errorf("change from current value %v exceeds max step %v", cur, *c.MaxStep))
+			}
+		}
+	}
+	return errs
+}
+
+func enumEqual(e interface{}, value interface{}) bool {
+	if _, ok := e.(bool); ok {
+		return e == value
+	}
+	if _, ok := value.(bool); ok {
+		return false
+	}
+	f1, ok1 := convutil.ToFloat64(e)
+	f2, ok2 := convutil.ToFloat64(value)
+	if ok1 && ok2 {
+		return f1 == f2
+	}
+	return reflect.DeepEqual(e, value)
+}
+
+// Coerce convert the value written to variable by data type, the numeric and boolean strings are accepted.
+// The value of bool is bool, the value of string is string, and the others are float64.
+func Coerce(dataType constant.DataType, value interface{}) (interface{}, error) {
+	switch dataType {
+	case constant.BOOL:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		default:
+			if f, ok := convutil.ToFloat64(v); ok && (f == 0 || f == 1) {
+				return f == 1, nil
+			}
+		}
+		return nil, errors.New("should be bool, 0 or 1")
+	case constant.STRING:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, errors.New("should be string")
+	}
+
+	var f float64
+	switch v := value.(type) {
+	case bool:
+		return nil, fmt.Errorf("should be %s but got bool", constant.DataTypeToString[dataType])
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("should be %s but got string", constant.DataTypeToString[dataType])
+		}
+		f = parsed
+	default:
+		converted, ok := convutil.ToFloat64(v)
+		if !ok {
+			return nil, fmt.Errorf("should be %s", constant.DataTypeToString[dataType])
+		}
+		f = converted
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.New("should be finite number")
+	}
+	if dataType == constant.FLOAT32 && math.Abs(f) > math.MaxFloat32 {
+		return nil, errors.New("out of range of float32")
+	}
+	return f, nil
+}
+
+// CheckRaw check the raw value converted back from engineering value can be encoded to data type
+func CheckRaw(dataType constant.DataType, value interface{}) error {
+	r, ok := integerRanges[dataType]
+	if !ok {
+		return nil
+	}
+	f, ok := convutil.ToFloat64(value)
+	if !ok {
+		return nil
+	}
+	if f != math.Trunc(f) {
+		return fmt.Errorf("raw value %v should be integer of %s", f, constant.DataTypeToString[dataType])
+	}
+	if f < r[0] || f > r[1] {
+		return fmt.Errorf("raw value %v out of range of %s [%v, %v]", f, constant.DataTypeToString[dataType], r[0], r[1])
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"harnsgateway/pkg/runtime/constant"
+	"testing"
+)
+
+func TestCoerce(t *testing.T) {
+	tests := []struct {
+		name     string
+		dataType constant.DataType
+		value    interface{}
+		want     interface{}
+		wantErr  bool
+	}{
+		{"bool", constant.BOOL, true, true, false},
+		{"bool string", constant.BOOL, "false", false, false},
+		{"bool number", constant.BOOL, float64(1), true, false},
+		{"bool invalid number", constant.BOOL, float64(2), nil, true},
+		{"float string", constant.FLOAT32, "12.5", 12.5, false},
+		{"float invalid string", constant.FLOAT32, "abc", nil, true},
+		{"float bool", constant.FLOAT64, true, nil, true},
+		{"float32 overflow", constant.FLOAT32, 1e39, nil, true},
+		{"int", constant.INT16, float64(3), float64(3), false},
+		{"string", constant.STRING, "on", "on", false},
+		{"string number", constant.STRING, float64(1), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Coerce(tt.dataType, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Coerce() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Coerce() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	min, max, step := 0.0, 100.0, 10.0
+	c := &Constraint{Min: &min, Max: &max, MaxStep: &step}
+	if errs := c.Check(float64(50), float64(45)); len(errs) != 0 {
+		t.Errorf("expected no violation, got %v", errs)
+	}
+	if errs := c.Check(float64(150), float64(50)); len(errs) != 2 {
+		t.Errorf("expected max and step violations, got %v", errs)
+	}
+	if errs := c.Check(float64(-1), nil); len(errs) != 1 {
+		t.Errorf("expected min violation only, got %v", errs)
+	}
+
+	enum := &Constraint{Enum: []interface{}{float64(0), float64(1), float64(2)}}
+	if errs := enum.Check(float64(1), nil); len(errs) != 0 {
+		t.Errorf("expected no violation, got %v", errs)
+	}
+	if errs := enum.Check(float64(3), nil); len(errs) != 1 {
+		t.Errorf("expected enum violation, got %v", errs)
+	}
+	if err := (&Constraint{Min: &max, Max: &min}).Validate(); err == nil {
+		t.Errorf("expected min greater than max invalid")
+	}
+}
+
+func TestCheckRaw(t *testing.T) {
+	if err := CheckRaw(constant.INT16, float64(32767)); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+	if err := CheckRaw(constant.INT16, float64(32768)); err == nil {
+		t.Errorf("expected out of range")
+	}
+	if err := CheckRaw(constant.UINT16, float64(-1)); err == nil {
+		t.Errorf("expected out of range")
+	}
+	if err := CheckRaw(constant.INT32, 1.5); err == nil {
+		t.Errorf("expected not integer")
+	}
+	if err := CheckRaw(constant.FLOAT32, 1.5); err != nil {
+		t.Errorf("expected valid, got %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+package runtime
+
+// Disabler is implemented by the variable which is kept in device but not collected
+type Disabler interface {
+	IsDisabled() bool
+}
+
+// IsDisabled whether the variable is disabled, the variables not implemented Disabler are always enabled
+func IsDisabled(v VariableValue) bool {
+	d, ok := v.(Disabler)
+	return ok && d.IsDisabled()
+}
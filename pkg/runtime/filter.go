@@ -2,6 +2,7 @@ package runtime
 
 import (
 	"github.com/mitchellh/mapstructure"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 	"sort"
 	"strings"
@@ -68,14 +69,30 @@ type NameFilterFunc struct {
 }
 
 type DeviceFilter struct {
-	Name       interface{}
-	Id         string
-	DeviceCode string
-	DeviceType string
+	Name          interface{}
+	Id            string
+	DeviceCode    string
+	DeviceType    string
+	DeviceModel   string
+	CollectStatus string
+	// Group 分组及其子分组
+	Group string
+	// LabelSelector 标签选择器 例如 line=3,area in (a,b)
+	LabelSelector string
 }
 
 type predicateType func(d Device) bool
 
+// MatchPredicates the device matches all predicates parsed from filter
+func MatchPredicates(d Device, predicates []predicateType) bool {
+	for _, p := range predicates {
+		if !p(d) {
+			return false
+		}
+	}
+	return true
+}
+
 func ParseTypeFilter(filter *DeviceFilter) []predicateType {
 	predicates := make([]predicateType, 0)
 
@@ -90,6 +107,53 @@ func ParseTypeFilter(filter *DeviceFilter) []predicateType {
 		predicates = append(predicates, p)
 	}
 
+	// deviceCode
+	if len(filter.DeviceCode) > 0 {
+		predicates = append(predicates, func(d Device) bool {
+			return filter.DeviceCode == d.GetDeviceCode()
+		})
+	}
+
+	// deviceType
+	if len(filter.DeviceType) > 0 {
+		predicates = append(predicates, func(d Device) bool {
+			return filter.DeviceType == d.GetDeviceType()
+		})
+	}
+
+	// deviceModel
+	if len(filter.DeviceModel) > 0 {
+		predicates = append(predicates, func(d Device) bool {
+			return filter.DeviceModel == d.GetDeviceModel()
+		})
+	}
+
+	// collectStatus
+	if len(filter.CollectStatus) > 0 {
+		predicates = append(predicates, func(d Device) bool {
+			return filter.CollectStatus == d.GetCollectStatus()
+		})
+	}
+
+	// group
+	if len(filter.Group) > 0 {
+		predicates = append(predicates, func(d Device) bool {
+			return InGroup(d.GetGroup(), filter.Group)
+		})
+	}
+
+	// labelSelector
+	if len(filter.LabelSelector) > 0 {
+		selector, err := ParseLabelSelector(filter.LabelSelector)
+		if err != nil {
+			klog.V(3).InfoS("Failed to parse filter.labelSelector", "err", err)
+			selector = labels.Nothing()
+		}
+		predicates = append(predicates, func(d Device) bool {
+			return selector.Matches(labels.Set(d.GetLabels()))
+		})
+	}
+
 	// name
 	if filter.Name != nil {
 		if name, ok := filter.Name.(string); ok {
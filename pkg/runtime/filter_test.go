@@ -0,0 +1,59 @@
+package runtime
+
+import (
+	"testing"
+)
+
+func TestParseTypeFilter(t *testing.T) {
+	meter := &DeviceMeta{
+		ObjectMeta:    ObjectMeta{Name: "meter 1", ID: "1"},
+		DeviceCode:    "pm-1",
+		DeviceType:    "modbus",
+		DeviceModel:   "PM800",
+		CollectStatus: "collecting",
+		Labels:        map[string]string{"line": "3", "area": "a"},
+		Group:         "plant-a/line-3",
+	}
+	cases := []struct {
+		filter  *DeviceFilter
+		matched bool
+	}{
+		{&DeviceFilter{}, true},
+		{&DeviceFilter{DeviceCode: "pm-1", DeviceType: "modbus", DeviceModel: "PM800"}, true},
+		{&DeviceFilter{DeviceCode: "pm-2"}, false},
+		{&DeviceFilter{DeviceType: "s7"}, false},
+		{&DeviceFilter{CollectStatus: "unconnected"}, false},
+		{&DeviceFilter{Group: "plant-a"}, true},
+		{&DeviceFilter{Group: "plant-a/line-3"}, true},
+		{&DeviceFilter{Group: "plant-a/line"}, false},
+		{&DeviceFilter{LabelSelector: "line=3,area in (a,b)"}, true},
+		{&DeviceFilter{LabelSelector: "line!=3"}, false},
+		{&DeviceFilter{LabelSelector: "!disabled"}, true},
+		{&DeviceFilter{LabelSelector: "line in ("}, false},
+	}
+	for i, c := range cases {
+		if matched := MatchPredicates(meter, ParseTypeFilter(c.filter)); matched != c.matched {
+			t.Errorf("case %d %+v matched = %v, want %v", i, c.filter, matched, c.matched)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"line": "3", "example.com/area": ""}); err != nil {
+		t.Errorf("ValidateLabels() = %v", err)
+	}
+	if err := ValidateLabels(map[string]string{"line 3": "a"}); err == nil {
+		t.Errorf("expected invalid key")
+	}
+	if err := ValidateLabels(map[string]string{"area": "a,b"}); err == nil {
+		t.Errorf("expected invalid value")
+	}
+	if err := ValidateGroup("plant-a/line-3"); err != nil {
+		t.Errorf("ValidateGroup() = %v", err)
+	}
+	for _, group := range []string{"/plant-a", "plant-a//line-3", "plant-a/ line-3"} {
+		if err := ValidateGroup(group); err == nil {
+			t.Errorf("expected group %q invalid", group)
+		}
+	}
+}
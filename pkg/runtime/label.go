@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"strings"
+)
+
+const (
+	// GroupSeparator the separator of group hierarchy, e.g. plant-a/line-3
+	GroupSeparator = "/"
+	maxGroupLength = 256
+	maxGroupDepth  = 8
+)
+
+// Labeler is implemented by the device which is selected by labels and grouped in hierarchy
+type Labeler interface {
+	GetLabels() map[string]string
+	SetLabels(map[string]string)
+	GetGroup() string
+	SetGroup(string)
+}
+
+// ValidateLabels the keys and values are the same as labels of kubernetes, so they can be selected by label selector
+func ValidateLabels(l map[string]string) error {
+	for k, v := range l {
+		if errs := validation.IsQualifiedName(k); len(errs) > 0 {
+			return fmt.Errorf("key %s %s", k, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(v); len(errs) > 0 {
+			return fmt.Errorf("value of %s %s", k, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// ValidateGroup the group is the path of areas from top to bottom separated by slash, e.g. plant-a/line-3
+func ValidateGroup(group string) error {
+	if len(group) == 0 {
+		return nil
+	}
+	if len(group) > maxGroupLength {
+		return fmt.Errorf("must be no more than %d characters", maxGroupLength)
+	}
+	areas := strings.Split(group, GroupSeparator)
+	if len(areas) > maxGroupDepth {
+		return fmt.Errorf("must be no more than %d levels", maxGroupDepth)
+	}
+	for _, area := range areas {
+		if len(area) == 0 || strings.TrimSpace(area) != area || strings.Contains(area, "\\") {
+			return fmt.Errorf("area %q must be non-empty without surrounding spaces and backslash", area)
+		}
+	}
+	return nil
+}
+
+// InGroup the group is the parent group or itself, the devices of sub groups belong to parent group
+func InGroup(group string, parent string) bool {
+	return group == parent || strings.HasPrefix(group, parent+GroupSeparator)
+}
+
+// ParseLabelSelector parse the selector like 'line=3,area in (a,b),!disabled', the empty selector selects everything
+func ParseLabelSelector(selector string) (labels.Selector, error) {
+	return labels.Parse(selector)
+}
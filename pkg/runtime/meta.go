@@ -71,6 +71,19 @@ type Broker interface {
 	DeliverAction(ctx context.Context, obj map[string]interface{}) error
 }
 
+// PoolStatsProvider is implemented by the broker which keeps a messenger pool
+type PoolStatsProvider interface {
+	// PoolStats returns the size of pool and the number of idle messengers
+	PoolStats() (int, int)
+}
+
+// VariableRebuilder is implemented by the broker which rebuilds the data frames of changed variables without reconnecting
+type VariableRebuilder interface {
+	// RebuildVariables collect the device with its latest variables, only the data frames of variables named are rebuilt.
+	// ErrDeviceEmptyVariable is returned if no variable is left to collect.
+	RebuildVariables(device Device, names []string) error
+}
+
 type VariableValue interface {
 	SetValue(value interface{})
 	GetValue() interface{}
@@ -103,11 +116,19 @@ type IndexDevice interface {
 	IndexDevice()
 }
 
+type VirtualVariabler interface {
+	GetVirtualVariables() []*VirtualVariable
+	SetVirtualVariables([]*VirtualVariable)
+}
+
 type Device interface {
 	Object
 	Publisher
 	GetVariabler
 	IndexDevice
+	VirtualVariabler
+	Aggregationer
+	Labeler
 	GetDeviceCode() string
 	SetDeviceCode(string)
 	GetDeviceType() string
@@ -127,7 +148,19 @@ type DeviceMeta struct {
 	DeviceType    string `json:"deviceType"`
 	DeviceModel   string `json:"deviceModel"`
 	CollectStatus string `json:"collectStatus"`
+	// 标签 例如 line: "3"
+	Labels map[string]string `json:"labels,omitempty"`
+	// 分组 以/分隔的区域层级 例如 plant-a/line-3
+	Group string `json:"group,omitempty"`
 	// VariablesMap  map[string]VariableValue `json:"-"`
+	VirtualVariables []*VirtualVariable `json:"virtualVariables,omitempty"`
+	Aggregations     []*Aggregation     `json:"aggregations,omitempty"`
+}
+
+// VirtualVariable the variable computed by expression over other variables after each collection
+type VirtualVariable struct {
+	Name       string `json:"name"`       // 变量名称
+	Expression string `json:"expression"` // 表达式 例如 voltage * current * 0.001
 }
 
 func (d *DeviceMeta) IndexDevice() {
@@ -137,6 +170,38 @@ func (d *DeviceMeta) GetVariable(key string) (rv VariableValue, exist bool) {
 	return
 }
 
+func (d *DeviceMeta) GetVirtualVariables() []*VirtualVariable {
+	return d.VirtualVariables
+}
+
+func (d *DeviceMeta) SetVirtualVariables(vvs []*VirtualVariable) {
+	d.VirtualVariables = vvs
+}
+
+func (d *DeviceMeta) GetAggregations() []*Aggregation {
+	return d.Aggregations
+}
+
+func (d *DeviceMeta) SetAggregations(aggregations []*Aggregation) {
+	d.Aggregations = aggregations
+}
+
+func (d *DeviceMeta) GetLabels() map[string]string {
+	return d.Labels
+}
+
+func (d *DeviceMeta) SetLabels(l map[string]string) {
+	d.Labels = l
+}
+
+func (d *DeviceMeta) GetGroup() string {
+	return d.Group
+}
+
+func (d *DeviceMeta) SetGroup(group string) {
+	d.Group = group
+}
+
 func (d *DeviceMeta) GetDeviceCode() string {
 	return d.DeviceCode
 }
@@ -206,6 +271,19 @@ func Accessor(obj interface{}) (Object, error) {
 	}
 }
 
+// HasVariable whether the device has the collected or virtual variable
+func HasVariable(device Device, name string) bool {
+	if _, exist := device.GetVariable(name); exist {
+		return true
+	}
+	for _, vv := range device.GetVirtualVariables() {
+		if vv.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func AccessorDevice(obj interface{}) (Device, error) {
 	switch t := obj.(type) {
 	case Device:
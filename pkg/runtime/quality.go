@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"time"
+)
+
+// the quality of collected values
+const (
+	QualityGood      = "good"
+	QualityBad       = "bad"
+	QualityUncertain = "uncertain"
+)
+
+// the reasons of bad or uncertain quality
+const (
+	ReasonCommFailure = "commFailure" // 通讯失败
+	ReasonOutOfRange  = "outOfRange"  // 超出范围
+	ReasonStale       = "stale"       // 通讯失败时沿用的上次采集值
+)
+
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+// Qualifier is implemented by the variable carrying the quality and source timestamp of collected value
+type Qualifier interface {
+	GetQuality() ValueQuality
+	SetQuality(ValueQuality)
+}
+
+// ValueQuality the quality and source timestamp of collected value
+type ValueQuality struct {
+	Quality         string `json:"quality,omitempty"`         // 质量 good、bad、uncertain
+	Reason          string `json:"reason,omitempty"`          // 原因 commFailure、outOfRange、stale 或OPC UA状态码
+	SourceTimestamp string `json:"sourceTimestamp,omitempty"` // 源时间戳 OPC UA为SourceTimestamp Modbus、S7为轮询完成时间
+}
+
+func (q *ValueQuality) GetQuality() ValueQuality {
+	return *q
+}
+
+func (q *ValueQuality) SetQuality(quality ValueQuality) {
+	*q = quality
+}
+
+// GoodQuality the quality of value collected at timestamp
+func GoodQuality(timestamp time.Time) ValueQuality {
+	return ValueQuality{Quality: QualityGood, SourceTimestamp: FormatTimestamp(timestamp)}
+}
+
+// BadQuality the quality of value failed to collect at timestamp
+func BadQuality(reason string, timestamp time.Time) ValueQuality {
+	return ValueQuality{Quality: QualityBad, Reason: reason, SourceTimestamp: FormatTimestamp(timestamp)}
+}
+
+// FormatTimestamp format the timestamp in payloads, e.g. 2006-01-02T15:04:05.000Z
+func FormatTimestamp(timestamp time.Time) string {
+	return timestamp.UTC().Format(timestampLayout)
+}
+
+// ParseTimestamp parse the timestamp formatted by FormatTimestamp
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	return time.Parse(timestampLayout, timestamp)
+}
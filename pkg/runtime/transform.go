@@ -0,0 +1,188 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"harnsgateway/pkg/utils/convutil"
+	"math"
+)
+
+// Transformer is implemented by the variable which converts the raw value to engineering value
+type Transformer interface {
+	GetTransform() *Transform
+}
+
+// Transform the pipeline converting raw value to engineering value, applied in order:
+// rate -> linear scaling -> offset -> unit conversion -> clamp -> rounding.
+// Writes are converted back by the inverse of rate, linear scaling, offset and unit conversion.
+type Transform struct {
+	Rate     float64  `json:"-"`                  // 比率 兼容变量的rate
+	Scaling  *Scaling `json:"scaling,omitempty"`  // 线性缩放
+	Offset   float64  `json:"offset,omitempty"`   // 偏移量
+	FromUnit string   `json:"fromUnit,omitempty"` // 原始单位
+	ToUnit   string   `json:"toUnit,omitempty"`   // 工程单位
+	Min      *float64 `json:"min,omitempty"`      // 下限
+	Max      *float64 `json:"max,omitempty"`      // 上限
+	Decimals *int     `json:"decimals,omitempty"` // 保留小数位数
+}
+
+// Scaling map [RawMin, RawMax] to [EngMin, EngMax] linearly
+type Scaling struct {
+	RawMin float64 `json:"rawMin"` // 原始值下限
+	RawMax float64 `json:"rawMax"` // 原始值上限
+	EngMin float64 `json:"engMin"` // 工程值下限
+	EngMax float64 `json:"engMax"` // 工程值上限
+}
+
+type unit struct {
+	dimension string
+	// base = value * factor + offset
+	factor float64
+	offset float64
+}
+
+var units = map[string]unit{
+	"C":   {dimension: "temperature", factor: 1},
+	"F":   {dimension: "temperature", factor: 5.0 / 9, offset: -160.0 / 9},
+	"K":   {dimension: "temperature", factor: 1, offset: -273.15},
+	"Pa":  {dimension: "pressure", factor: 1},
+	"kPa": {dimension: "pressure", factor: 1e3},
+	"MPa": {dimension: "pressure", factor: 1e6},
+	"bar": {dimension: "pressure", factor: 1e5},
+	"psi": {dimension: "pressure", factor: 6894.757293168},
+	"mm":  {dimension: "length", factor: 1e-3},
+	"cm":  {dimension: "length", factor: 1e-2},
+	"m":   {dimension: "length", factor: 1},
+	"km":  {dimension: "length", factor: 1e3},
+	"in":  {dimension: "length", factor: 0.0254},
+	"ft":  {dimension: "length", factor: 0.3048},
+	"g":   {dimension: "mass", factor: 1e-3},
+	"kg":  {dimension: "mass", factor: 1},
+	"t":   {dimension: "mass", factor: 1e3},
+	"lb":  {dimension: "mass", factor: 0.45359237},
+	"L":   {dimension: "volume", factor: 1},
+	"m3":  {dimension: "volume", factor: 1e3},
+	"gal": {dimension: "volume", factor: 3.785411784},
+	"W":   {dimension: "power", factor: 1},
+	"kW":  {dimension: "power", factor: 1e3},
+	"MW":  {dimension: "power", factor: 1e6},
+	"hp":  {dimension: "power", factor: 745.6998715822702},
+	"Wh":  {dimension: "energy", factor: 1},
+	"kWh": {dimension: "energy", factor: 1e3},
+	"MWh": {dimension: "energy", factor: 1e6},
+	"J":   {dimension: "energy", factor: 1.0 / 3600},
+	"ms":  {dimension: "time", factor: 1e-3},
+	"s":   {dimension: "time", factor: 1},
+	"min": {dimension: "time", factor: 60},
+	"h":   {dimension: "time", factor: 3600},
+}
+
+// Validate check the scaling range, units and clamp range
+func (t *Transform) Validate() error {
+	if t == nil {
+		return nil
+	}
+	if t.Scaling != nil && (t.Scaling.RawMin == t.Scaling.RawMax || t.Scaling.EngMin == t.Scaling.EngMax) {
+		return errors.New("range of scaling should not be empty")
+	}
+	if len(t.FromUnit) > 0 || len(t.ToUnit) > 0 {
+		from, ok := units[t.FromUnit]
+		if !ok {
+			return fmt.Errorf("unit %s unsupported", t.FromUnit)
+		}
+		to, ok := units[t.ToUnit]
+		if !ok {
+			return fmt.Errorf("unit %s unsupported", t.ToUnit)
+		}
+		if from.dimension != to.dimension {
+			return fmt.Errorf("can not convert %s to %s", t.FromUnit, t.ToUnit)
+		}
+	}
+	if t.Min != nil && t.Max != nil && *t.Min > *t.Max {
+		return errors.New("min should not be greater than max")
+	}
+	if t.Decimals != nil && (*t.Decimals < 0 || *t.Decimals > 15) {
+		return errors.New("decimals should be between 0 and 15")
+	}
+	return nil
+}
+
+// WithRate returns the transform applied the rate firstly, the rate 0 and 1 are ignored
+func (t *Transform) WithRate(rate float64) *Transform {
+	if rate == 0 || rate == 1 {
+		return t
+	}
+	out := &Transform{}
+	if t != nil {
+		*out = *t
+	}
+	out.Rate = rate
+	return out
+}
+
+// Apply convert the raw value to engineering value, the value is returned unchanged if not numeric
+func (t *Transform) Apply(value interface{}) interface{} {
+	v, _ := t.ApplyWithRange(value)
+	return v
+}
+
+// ApplyWithRange convert the raw value to engineering value, and reports whether the value is out of range and clamped
+func (t *Transform) ApplyWithRange(value interface{}) (interface{}, bool) {
+	if t == nil {
+		return value, false
+	}
+	if _, ok := value.(bool); ok {
+		return value, false
+	}
+	f, ok := convutil.ToFloat64(value)
+	if !ok {
+		return value, false
+	}
+
+	if t.Rate != 0 {
+		f *= t.Rate
+	}
+	if s := t.Scaling; s != nil {
+		f = (f-s.RawMin)*(s.EngMax-s.EngMin)/(s.RawMax-s.RawMin) + s.EngMin
+	}
+	f += t.Offset
+	if len(t.FromUnit) > 0 {
+		from, to := units[t.FromUnit], units[t.ToUnit]
+		f = (f*from.factor + from.offset - to.offset) / to.factor
+	}
+	clamped := false
+	if t.Min != nil && f < *t.Min {
+		f = *t.Min
+		clamped = true
+	}
+	if t.Max != nil && f > *t.Max {
+		f = *t.Max
+		clamped = true
+	}
+	if t.Decimals != nil {
+		p := math.Pow(10, float64(*t.Decimals))
+		f = math.Round(f*p) / p
+	}
+	return f, clamped
+}
+
+// Inverse convert the engineering value written to device back to raw value,
+// clamp and rounding are not reversible and ignored.
+func (t *Transform) Inverse(f float64) float64 {
+	if t == nil {
+		return f
+	}
+	if len(t.FromUnit) > 0 {
+		from, to := units[t.FromUnit], units[t.ToUnit]
+		f = (f*to.factor + to.offset - from.offset) / from.factor
+	}
+	f -= t.Offset
+	if s := t.Scaling; s != nil {
+		f = (f-s.EngMin)*(s.RawMax-s.RawMin)/(s.EngMax-s.EngMin) + s.RawMin
+	}
+	if t.Rate != 0 {
+		f /= t.Rate
+	}
+	// drop the error of floating point, e.g. 12.3/0.1 = 122.99999999999999
+	return math.Round(f*1e9) / 1e9
+}
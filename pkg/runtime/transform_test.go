@@ -0,0 +1,91 @@
+package runtime
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransformApplyAndInverse(t *testing.T) {
+	min, max, decimals := 0.0, 100.0, 2
+	tests := []struct {
+		name      string
+		transform *Transform
+		raw       interface{}
+		eng       float64
+	}{
+		{"rate", (*Transform)(nil).WithRate(0.1), int16(1234), 123.4},
+		{"scaling", &Transform{Scaling: &Scaling{RawMin: 4000, RawMax: 20000, EngMin: 0, EngMax: 10}}, uint16(12000), 5},
+		{"offset", &Transform{Offset: -2.5}, float32(20), 17.5},
+		{"unit", &Transform{FromUnit: "C", ToUnit: "F"}, int32(100), 212},
+		{"pipeline", (&Transform{Scaling: &Scaling{RawMin: 0, RawMax: 27648, EngMin: 0, EngMax: 1}, FromUnit: "MPa", ToUnit: "kPa", Min: &min, Max: &max, Decimals: &decimals}).WithRate(1), int16(27648), 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.transform.Apply(tt.raw).(float64)
+			if math.Abs(got-tt.eng) > 1e-6 {
+				t.Errorf("Apply() = %v, want %v", got, tt.eng)
+			}
+		})
+	}
+
+	rate := (*Transform)(nil).WithRate(0.1)
+	if got := rate.Inverse(12.3); got != 123 {
+		t.Errorf("Inverse() = %v, want 123", got)
+	}
+	unit := &Transform{Scaling: &Scaling{RawMin: 4000, RawMax: 20000, EngMin: 0, EngMax: 10}, FromUnit: "C", ToUnit: "F"}
+	if got := unit.Inverse(unit.Apply(8000).(float64)); got != 8000 {
+		t.Errorf("Inverse() = %v, want 8000", got)
+	}
+}
+
+func TestTransformApplyNonNumeric(t *testing.T) {
+	transform := &Transform{Offset: 1}
+	if got := transform.Apply(true); got != true {
+		t.Errorf("Apply() = %v, want true", got)
+	}
+	if got := transform.Apply("on"); got != "on" {
+		t.Errorf("Apply() = %v, want on", got)
+	}
+	var identity *Transform
+	if got := identity.Apply(int16(7)); got != int16(7) {
+		t.Errorf("Apply() = %v, want 7", got)
+	}
+}
+
+func TestTransformValidate(t *testing.T) {
+	min, max := 10.0, 0.0
+	invalid := []*Transform{
+		{Scaling: &Scaling{RawMin: 1, RawMax: 1, EngMin: 0, EngMax: 10}},
+		{FromUnit: "C", ToUnit: "kPa"},
+		{FromUnit: "C"},
+		{Min: &min, Max: &max},
+	}
+	for _, transform := range invalid {
+		if err := transform.Validate(); err == nil {
+			t.Errorf("Validate(%+v) should fail", transform)
+		}
+	}
+	if err := (*Transform)(nil).Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestTransformApplyWithRange(t *testing.T) {
+	min, max := 0.0, 100.0
+	transform := &Transform{Rate: 0.1, Min: &min, Max: &max}
+	cases := []struct {
+		raw     interface{}
+		value   float64
+		clamped bool
+	}{
+		{int16(500), 50, false},
+		{int16(1200), 100, true},
+		{int16(-10), 0, true},
+	}
+	for _, c := range cases {
+		got, clamped := transform.ApplyWithRange(c.raw)
+		if got != c.value || clamped != c.clamped {
+			t.Errorf("ApplyWithRange(%v) = %v %v, want %v %v", c.raw, got, clamped, c.value, c.clamped)
+		}
+	}
+}
@@ -12,7 +12,14 @@ type LabeledCloser struct {
 }
 
 type ResponseModel struct {
-	Devices interface{} `json:"devices,omitempty"`
+	Devices    interface{} `json:"devices,omitempty"`
+	Actions    interface{} `json:"actions,omitempty"`
+	Results    interface{} `json:"results,omitempty"`
+	Revisions  interface{} `json:"revisions,omitempty"`
+	Rejections interface{} `json:"rejections,omitempty"`
+	Variables  interface{} `json:"variables,omitempty"`
+	// Continue 续查下一页的令牌 最后一页为空
+	Continue string `json:"continue,omitempty"`
 }
 
 type ParseVariableResult struct {
@@ -42,6 +49,7 @@ type TimeSeriesData struct {
 type PointData struct {
 	DataPointId string      `json:"dataPointId"`
 	Value       interface{} `json:"value"`
+	ValueQuality
 }
 
 type CreateOptions struct {
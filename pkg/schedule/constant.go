@@ -0,0 +1,20 @@
+package schedule
+
+import "time"
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultMissed the one-shot schedule was not executed because the gateway was not running
+	ResultMissed = "missed"
+)
+
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+const (
+	defaultReadbackTimeout = 10 * time.Second
+	maxExecutions          = 1000
+)
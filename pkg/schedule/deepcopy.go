@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+)
+
+func (in *Recipe) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	out.Items = copyActionSets(in.Items)
+	return &out
+}
+
+func (in *Schedule) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.At != nil {
+		t := *in.At
+		out.At = &t
+	}
+	if in.NextTime != nil {
+		t := *in.NextTime
+		out.NextTime = &t
+	}
+	out.Actions = copyActionSets(in.Actions)
+	return &out
+}
+
+func (in *Execution) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.EndTime != nil {
+		t := *in.EndTime
+		out.EndTime = &t
+	}
+	if in.Errors != nil {
+		out.Errors = make([]string, len(in.Errors))
+		copy(out.Errors, in.Errors)
+	}
+	return &out
+}
+
+func copyActionSets(in []*v1.ActionSet) []*v1.ActionSet {
+	if in == nil {
+		return nil
+	}
+	out := make([]*v1.ActionSet, 0, len(in))
+	for _, set := range in {
+		actions := make([]*v1.Action, 0, len(set.Actions))
+		for _, action := range set.Actions {
+			a := *action
+			actions = append(actions, &a)
+		}
+		out = append(out, &v1.ActionSet{DeviceId: set.DeviceId, Actions: actions})
+	}
+	return out
+}
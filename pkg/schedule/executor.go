@@ -0,0 +1,137 @@
+package schedule
+
+import (
+	"context"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/device"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"time"
+)
+
+// DeviceController writes and reads back the values of devices
+type DeviceController interface {
+	GetDeviceById(id string, exploded bool) (runtime.Device, error)
+	DeliverAction(id string, actions []map[string]interface{}, opts ...device.ActionOption) error
+	VerifyAction(ctx context.Context, id string, values map[string]interface{}, tolerance float64, since time.Time) error
+	GetLatestValue(id string, name string) (interface{}, bool)
+}
+
+// options of applying action sets
+type applyOptions struct {
+	readback  bool
+	tolerance float64
+	timeout   time.Duration
+	rollback  bool
+}
+
+// apply writes the action sets as atomically as possible: all devices and variables are checked before
+// writing, and the written values are restored if any write or readback failed when rollback is enabled.
+func (m *Manager) apply(sets []*v1.ActionSet, opts applyOptions, execution *Execution) {
+	m.execMu.Lock()
+	defer m.execMu.Unlock()
+
+	if errs := m.check(sets, true); len(errs) > 0 {
+		execution.Result = ResultFailure
+		for _, err := range errs {
+			execution.Errors = append(execution.Errors, err.Error())
+		}
+		return
+	}
+
+	// the values before writing, used to restore
+	previous := make([]map[string]interface{}, 0, len(sets))
+	for _, set := range sets {
+		values := make(map[string]interface{}, len(set.Actions))
+		for _, action := range set.Actions {
+			if v, ok := m.devices.GetLatestValue(set.DeviceId, action.Name); ok {
+				values[action.Name] = v
+			}
+		}
+		previous = append(previous, values)
+	}
+
+	requester := device.WithRequester(device.ActionSourceSchedule, execution.ScheduleId)
+	if len(execution.ScheduleId) == 0 {
+		requester = device.WithRequester(device.ActionSourceSchedule, execution.RecipeId)
+	}
+	written := 0
+	var err error
+	for _, set := range sets {
+		if err = m.devices.DeliverAction(set.DeviceId, []map[string]interface{}{toValues(set)}, requester); err != nil {
+			break
+		}
+		written++
+	}
+	if err == nil && opts.readback {
+		// the values collected before all sets are written are not read back
+		since := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		for _, set := range sets {
+			if err = m.devices.VerifyAction(ctx, set.DeviceId, toValues(set), opts.tolerance, since); err != nil {
+				break
+			}
+		}
+		cancel()
+	}
+	if err == nil {
+		execution.Result = ResultSuccess
+		return
+	}
+
+	execution.Result = ResultFailure
+	execution.Errors = append(execution.Errors, err.Error())
+	if !opts.rollback {
+		return
+	}
+	// a failed write may have changed the values partially, restore it as well
+	if written < len(sets) {
+		written++
+	}
+	execution.RolledBack = true
+	for i := written - 1; i >= 0; i-- {
+		if len(previous[i]) == 0 {
+			continue
+		}
+		if err := m.devices.DeliverAction(sets[i].DeviceId, []map[string]interface{}{previous[i]}, requester); err != nil {
+			klog.V(2).InfoS("Failed to restore values", "deviceId", sets[i].DeviceId, "err", err)
+			execution.RolledBack = false
+			execution.Errors = append(execution.Errors, err.Error())
+		}
+	}
+}
+
+// check the variables are writable, and the devices are connected if required
+func (m *Manager) check(sets []*v1.ActionSet, connected bool) []error {
+	errs := make([]error, 0)
+	for _, set := range sets {
+		device, err := m.devices.GetDeviceById(set.DeviceId, true)
+		if err != nil {
+			errs = append(errs, response.ErrDeviceNotFound(set.DeviceId))
+			continue
+		}
+		if connected && device.GetCollectStatus() == runtime.CollectStatusToString[runtime.Unconnected] {
+			errs = append(errs, response.ErrDeviceNotConnect(set.DeviceId))
+			continue
+		}
+		for _, action := range set.Actions {
+			variable, exist := device.GetVariable(action.Name)
+			if !exist {
+				errs = append(errs, response.ErrResourceNotFound(action.Name))
+			} else if variable.GetVariableAccessMode() != constant.AccessModeReadWrite {
+				errs = append(errs, response.ErrVariableNotWritable(action.Name))
+			}
+		}
+	}
+	return errs
+}
+
+func toValues(set *v1.ActionSet) map[string]interface{} {
+	values := make(map[string]interface{}, len(set.Actions))
+	for _, action := range set.Actions {
+		values[action.Name] = action.Value
+	}
+	return values
+}
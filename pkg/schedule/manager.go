@@ -0,0 +1,600 @@
+package schedule
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/robfig/cron/v3"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Manager applies recipes and executes schedules, the executions are persisted as history.
+type Manager struct {
+	devices    DeviceController
+	mu         *sync.Mutex
+	execMu     *sync.Mutex
+	recipes    map[string]*Recipe
+	schedules  map[string]*Schedule
+	executions map[string]*Execution
+	cron       *cron.Cron
+	entries    map[string]cron.EntryID
+	timers     map[string]*time.Timer
+	client     storage.Storage
+	stopCh     <-chan struct{}
+}
+
+func NewManager(stop <-chan struct{}) *Manager {
+	return &Manager{
+		mu:         &sync.Mutex{},
+		execMu:     &sync.Mutex{},
+		recipes:    make(map[string]*Recipe, 0),
+		schedules:  make(map[string]*Schedule, 0),
+		executions: make(map[string]*Execution, 0),
+		cron:       cron.New(),
+		entries:    make(map[string]cron.EntryID, 0),
+		timers:     make(map[string]*time.Timer, 0),
+		stopCh:     stop,
+	}
+}
+
+func (m *Manager) Init(devices DeviceController) {
+	m.devices = devices
+	m.client = storage.NewClient(storage.StoreGroupSchedule)
+
+	for _, data := range m.load(storage.Recipes) {
+		recipe := &Recipe{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(recipe); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal recipe", "err", err)
+			continue
+		}
+		m.recipes[recipe.ID] = recipe
+	}
+	for _, data := range m.load(storage.Executions) {
+		execution := &Execution{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(execution); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal execution", "err", err)
+			continue
+		}
+		m.executions[execution.ID] = execution
+	}
+
+	m.mu.Lock()
+	for _, data := range m.load(storage.Schedules) {
+		schedule := &Schedule{}
+		if err := json.NewDecoder(bytes.NewReader(data)).Decode(schedule); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal schedule", "err", err)
+			continue
+		}
+		m.schedules[schedule.ID] = schedule
+		// the one-shot time passed when the gateway was not running
+		if schedule.Enabled && schedule.At != nil && !schedule.At.After(time.Now()) {
+			now := time.Now()
+			m.record(&Execution{
+				ObjectMeta: runtime.ObjectMeta{Name: schedule.Name},
+				ScheduleId: schedule.ID,
+				RecipeId:   schedule.RecipeId,
+				Trigger:    TriggerSchedule,
+				StartTime:  *schedule.At,
+				EndTime:    &now,
+				Result:     ResultMissed,
+			})
+			m.disable(schedule)
+			continue
+		}
+		if err := m.arm(schedule); err != nil {
+			klog.V(2).InfoS("Failed to arm schedule", "scheduleId", schedule.ID, "err", err)
+		}
+	}
+	m.mu.Unlock()
+
+	m.cron.Start()
+	go func() {
+		<-m.stopCh
+		m.cron.Stop()
+	}()
+}
+
+// arm the enabled schedule, must be called with lock held
+func (m *Manager) arm(schedule *Schedule) error {
+	if !schedule.Enabled {
+		return nil
+	}
+	id := schedule.ID
+	if schedule.At != nil {
+		m.timers[id] = time.AfterFunc(time.Until(*schedule.At), func() { m.fire(id) })
+		return nil
+	}
+	entry, err := m.cron.AddFunc(schedule.Cron, func() { m.fire(id) })
+	if err != nil {
+		return err
+	}
+	m.entries[id] = entry
+	return nil
+}
+
+// disarm stop the timer or cron entry of schedule, must be called with lock held
+func (m *Manager) disarm(id string) {
+	if timer, ok := m.timers[id]; ok {
+		timer.Stop()
+		delete(m.timers, id)
+	}
+	if entry, ok := m.entries[id]; ok {
+		m.cron.Remove(entry)
+		delete(m.entries, id)
+	}
+}
+
+// disable the one-shot schedule after executed, must be called with lock held
+func (m *Manager) disable(schedule *Schedule) {
+	version := schedule.GetVersion()
+	schedule.Enabled = false
+	schedule.ModTime = time.Now()
+	if _, err := m.client.Update(scheduleKey(schedule.ID), version, schedule); err != nil {
+		klog.V(2).InfoS("Failed to update schedule", "scheduleId", schedule.ID, "err", err)
+	}
+}
+
+// fire executes the schedule triggered by cron or timer
+func (m *Manager) fire(id string) {
+	m.mu.Lock()
+	schedule, ok := m.schedules[id]
+	if !ok || !schedule.Enabled {
+		m.mu.Unlock()
+		return
+	}
+	schedule = schedule.DeepCopyObject().(*Schedule)
+	m.mu.Unlock()
+
+	execution := m.execute(schedule, TriggerSchedule)
+	klog.V(3).InfoS("Executed schedule", "scheduleId", id, "result", execution.Result)
+
+	if schedule.At != nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if s, ok := m.schedules[id]; ok {
+			delete(m.timers, id)
+			m.disable(s)
+		}
+	}
+}
+
+// RunSchedule executes the schedule at once
+func (m *Manager) RunSchedule(id string) (*Execution, error) {
+	schedule, err := m.GetScheduleById(id)
+	if err != nil {
+		return nil, err
+	}
+	return m.execute(schedule, TriggerManual), nil
+}
+
+// ApplyRecipe applies the recipe at once
+func (m *Manager) ApplyRecipe(id string) (*Execution, error) {
+	recipe, err := m.GetRecipeById(id)
+	if err != nil {
+		return nil, err
+	}
+	execution := m.newExecution(recipe.Name, TriggerManual)
+	execution.RecipeId = id
+	m.apply(recipe.Items, recipeOptions(recipe), execution)
+	return m.finish(execution), nil
+}
+
+func (m *Manager) execute(schedule *Schedule, trigger string) *Execution {
+	execution := m.newExecution(schedule.Name, trigger)
+	execution.ScheduleId = schedule.ID
+	if len(schedule.RecipeId) == 0 {
+		m.apply(schedule.Actions, applyOptions{}, execution)
+		return m.finish(execution)
+	}
+
+	execution.RecipeId = schedule.RecipeId
+	recipe, err := m.GetRecipeById(schedule.RecipeId)
+	if err != nil {
+		execution.Result = ResultFailure
+		execution.Errors = []string{"recipe " + schedule.RecipeId + " not found"}
+		return m.finish(execution)
+	}
+	m.apply(recipe.Items, recipeOptions(recipe), execution)
+	return m.finish(execution)
+}
+
+func (m *Manager) newExecution(name string, trigger string) *Execution {
+	return &Execution{
+		ObjectMeta: runtime.ObjectMeta{Name: name},
+		Trigger:    trigger,
+		StartTime:  time.Now(),
+	}
+}
+
+func (m *Manager) finish(execution *Execution) *Execution {
+	now := time.Now()
+	execution.EndTime = &now
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.record(execution)
+	return execution.DeepCopyObject().(*Execution)
+}
+
+// record persist the execution and keep the latest executions only, must be called with lock held
+func (m *Manager) record(execution *Execution) {
+	execution.ID = uuidutil.UUID()
+	execution.Version = strconv.FormatUint(randutil.Uint64n(), 10)
+	execution.ModTime = time.Now()
+	if _, err := m.client.Create(executionKey(execution.ID), execution); err != nil {
+		klog.V(2).InfoS("Failed to store execution", "err", err)
+	}
+	m.executions[execution.ID] = execution
+	if len(m.executions) <= maxExecutions {
+		return
+	}
+	executions := make([]*Execution, 0, len(m.executions))
+	for _, e := range m.executions {
+		executions = append(executions, e)
+	}
+	sort.Slice(executions, func(i, j int) bool { return executions[i].StartTime.Before(executions[j].StartTime) })
+	for _, e := range executions[:len(executions)-maxExecutions] {
+		delete(m.executions, e.ID)
+		if _, err := m.client.Delete(executionKey(e.ID), ""); err != nil {
+			klog.V(2).InfoS("Failed to delete execution", "executionId", e.ID, "err", err)
+		}
+	}
+}
+
+func (m *Manager) CreateRecipe(object *v1.Recipe) (*Recipe, error) {
+	recipe := &Recipe{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applyRecipe(recipe, object)
+	if err := m.validateActionSets(recipe.Items); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(recipeKey(recipe.ID), recipe); err != nil {
+		klog.V(2).InfoS("Failed to store recipe", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recipes[recipe.ID] = recipe
+	return recipe.DeepCopyObject().(*Recipe), nil
+}
+
+func (m *Manager) UpdateRecipeById(id string, version string, object *v1.Recipe) (*Recipe, error) {
+	old, err := m.GetRecipeById(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	recipe := old.DeepCopyObject().(*Recipe)
+	recipe.ModTime = time.Now()
+	applyRecipe(recipe, object)
+	if err := m.validateActionSets(recipe.Items); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Update(recipeKey(id), version, recipe); err != nil {
+		klog.V(2).InfoS("Failed to update recipe", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recipes[id] = recipe
+	return recipe.DeepCopyObject().(*Recipe), nil
+}
+
+func (m *Manager) DeleteRecipe(id string, version string) (*Recipe, error) {
+	recipe, err := m.GetRecipeById(id)
+	if err != nil {
+		return nil, err
+	}
+	if recipe.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, schedule := range m.schedules {
+		if schedule.RecipeId == id {
+			return nil, response.ErrScheduleInvalid(schedule.Name, "recipe "+recipe.Name+" is referred")
+		}
+	}
+	if _, err := m.client.Delete(recipeKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete recipe", "recipeId", id, "err", err)
+		return nil, err
+	}
+	delete(m.recipes, id)
+	klog.V(2).InfoS("Deleted recipe", "recipeId", id)
+	return recipe, nil
+}
+
+func (m *Manager) ListRecipes() ([]*Recipe, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recipes := make([]*Recipe, 0, len(m.recipes))
+	for _, recipe := range m.recipes {
+		recipes = append(recipes, recipe.DeepCopyObject().(*Recipe))
+	}
+	sort.Slice(recipes, func(i, j int) bool { return recipes[i].ModTime.After(recipes[j].ModTime) })
+	return recipes, nil
+}
+
+func (m *Manager) GetRecipeById(id string) (*Recipe, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	recipe, ok := m.recipes[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return recipe.DeepCopyObject().(*Recipe), nil
+}
+
+func (m *Manager) CreateSchedule(object *v1.Schedule) (*Schedule, error) {
+	schedule := &Schedule{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applySchedule(schedule, object)
+	if err := m.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(scheduleKey(schedule.ID), schedule); err != nil {
+		klog.V(2).InfoS("Failed to store schedule", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedules[schedule.ID] = schedule
+	if err := m.arm(schedule); err != nil {
+		klog.V(2).InfoS("Failed to arm schedule", "scheduleId", schedule.ID, "err", err)
+	}
+	return m.copySchedule(schedule), nil
+}
+
+func (m *Manager) UpdateScheduleById(id string, version string, object *v1.Schedule) (*Schedule, error) {
+	old, err := m.GetScheduleById(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	schedule := old.DeepCopyObject().(*Schedule)
+	schedule.NextTime = nil
+	schedule.ModTime = time.Now()
+	applySchedule(schedule, object)
+	if err := m.validateSchedule(schedule); err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Update(scheduleKey(id), version, schedule); err != nil {
+		klog.V(2).InfoS("Failed to update schedule", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disarm(id)
+	m.schedules[id] = schedule
+	if err := m.arm(schedule); err != nil {
+		klog.V(2).InfoS("Failed to arm schedule", "scheduleId", id, "err", err)
+	}
+	return m.copySchedule(schedule), nil
+}
+
+func (m *Manager) DeleteSchedule(id string, version string) (*Schedule, error) {
+	schedule, err := m.GetScheduleById(id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.client.Delete(scheduleKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete schedule", "scheduleId", id, "err", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.disarm(id)
+	delete(m.schedules, id)
+	klog.V(2).InfoS("Deleted schedule", "scheduleId", id)
+	return schedule, nil
+}
+
+func (m *Manager) ListSchedules() ([]*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedules := make([]*Schedule, 0, len(m.schedules))
+	for _, schedule := range m.schedules {
+		schedules = append(schedules, m.copySchedule(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ModTime.After(schedules[j].ModTime) })
+	return schedules, nil
+}
+
+func (m *Manager) GetScheduleById(id string) (*Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedule, ok := m.schedules[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return m.copySchedule(schedule), nil
+}
+
+// ListExecutions the latest executions first
+func (m *Manager) ListExecutions(filter *ExecutionFilter) ([]*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	executions := make([]*Execution, 0)
+	for _, execution := range m.executions {
+		if len(filter.ScheduleId) > 0 && execution.ScheduleId != filter.ScheduleId {
+			continue
+		}
+		if len(filter.RecipeId) > 0 && execution.RecipeId != filter.RecipeId {
+			continue
+		}
+		executions = append(executions, execution.DeepCopyObject().(*Execution))
+	}
+	sort.Slice(executions, func(i, j int) bool { return executions[i].StartTime.After(executions[j].StartTime) })
+	return executions, nil
+}
+
+func (m *Manager) GetExecutionById(id string) (*Execution, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	execution, ok := m.executions[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return execution.DeepCopyObject().(*Execution), nil
+}
+
+// copySchedule copy the schedule with the next time, must be called with lock held
+func (m *Manager) copySchedule(schedule *Schedule) *Schedule {
+	out := schedule.DeepCopyObject().(*Schedule)
+	if entry, ok := m.entries[schedule.ID]; ok {
+		if next := m.cron.Entry(entry).Next; !next.IsZero() {
+			out.NextTime = &next
+		} else if s, err := cron.ParseStandard(schedule.Cron); err == nil {
+			// the cron has not started
+			next = s.Next(time.Now())
+			out.NextTime = &next
+		}
+	} else if _, ok := m.timers[schedule.ID]; ok {
+		next := *schedule.At
+		out.NextTime = &next
+	}
+	return out
+}
+
+func (m *Manager) validateSchedule(schedule *Schedule) error {
+	if (len(schedule.Cron) == 0) == (schedule.At == nil) {
+		return response.ErrScheduleInvalid(schedule.Name, "one of cron and at is required")
+	}
+	if len(schedule.Cron) > 0 {
+		if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+			return response.ErrScheduleInvalid(schedule.Name, err.Error())
+		}
+	}
+	if schedule.At != nil && schedule.Enabled && !schedule.At.After(time.Now()) {
+		return response.ErrScheduleInvalid(schedule.Name, "at should be in the future")
+	}
+	if (len(schedule.RecipeId) == 0) == (len(schedule.Actions) == 0) {
+		return response.ErrScheduleInvalid(schedule.Name, "one of recipeId and actions is required")
+	}
+	if len(schedule.RecipeId) > 0 {
+		if _, err := m.GetRecipeById(schedule.RecipeId); err != nil {
+			return response.ErrScheduleInvalid(schedule.Name, "recipe "+schedule.RecipeId+" not found")
+		}
+		return nil
+	}
+	return m.validateActionSets(schedule.Actions)
+}
+
+// validateActionSets the devices and the variables should exist, the connection is checked when applying
+func (m *Manager) validateActionSets(sets []*v1.ActionSet) error {
+	devices := make(map[string]struct{}, len(sets))
+	for _, set := range sets {
+		if _, exist := devices[set.DeviceId]; exist {
+			return response.ErrScheduleInvalid(set.DeviceId, "device is repeated")
+		}
+		devices[set.DeviceId] = struct{}{}
+		if errs := m.check([]*v1.ActionSet{set}, false); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+	return nil
+}
+
+func (m *Manager) load(resource string) [][]byte {
+	result := make([][]byte, 0)
+	objs, _ := m.client.List(resource)
+	files, ok := objs.([]*storage.FileInfo)
+	if !ok {
+		return result
+	}
+	for _, file := range files {
+		data, err := m.client.Get(filepath.Join(resource, filepath.Base(file.Path)))
+		if err != nil {
+			continue
+		}
+		result = append(result, data.([]byte))
+	}
+	return result
+}
+
+func recipeOptions(recipe *Recipe) applyOptions {
+	opts := applyOptions{
+		readback:  recipe.Readback,
+		tolerance: recipe.Tolerance,
+		timeout:   time.Duration(recipe.Timeout) * time.Second,
+		rollback:  recipe.Rollback,
+	}
+	if opts.timeout == 0 {
+		opts.timeout = defaultReadbackTimeout
+	}
+	return opts
+}
+
+func applyRecipe(recipe *Recipe, object *v1.Recipe) {
+	recipe.Name = object.Name
+	recipe.Description = object.Description
+	recipe.Items = object.Items
+	recipe.Readback = object.Readback
+	recipe.Tolerance = object.Tolerance
+	recipe.Timeout = object.Timeout
+	recipe.Rollback = object.Rollback
+}
+
+func applySchedule(schedule *Schedule, object *v1.Schedule) {
+	schedule.Name = object.Name
+	schedule.Enabled = object.Enabled
+	schedule.Cron = object.Cron
+	schedule.At = object.At
+	schedule.RecipeId = object.RecipeId
+	schedule.Actions = object.Actions
+}
+
+func recipeKey(id string) string {
+	return filepath.Join(storage.Recipes, id)
+}
+
+func scheduleKey(id string) string {
+	return filepath.Join(storage.Schedules, id)
+}
+
+func executionKey(id string) string {
+	return filepath.Join(storage.Executions, id)
+}
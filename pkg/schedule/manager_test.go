@@ -0,0 +1,183 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"harnsgateway/pkg/device"
+	modbus "harnsgateway/pkg/protocol/modbus/runtime"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+	"harnsgateway/pkg/storage"
+	v1 "harnsgateway/pkg/v1"
+	"testing"
+	"time"
+)
+
+// fakeDevices writable devices recording the delivered values, the delivering to failing device fails
+type fakeDevices struct {
+	failing   string
+	delivered []string
+	restored  map[string]map[string]interface{}
+}
+
+func (d *fakeDevices) GetDeviceById(id string, exploded bool) (runtime.Device, error) {
+	if id == "missing" {
+		return nil, errors.New("device not found")
+	}
+	object := &modbus.ModBusDevice{
+		DeviceMeta: runtime.DeviceMeta{
+			ObjectMeta:    runtime.ObjectMeta{ID: id},
+			CollectStatus: runtime.CollectStatusToString[runtime.Collecting],
+		},
+		Variables: []*modbus.Variable{
+			{Name: "setpoint", AccessMode: constant.AccessModeReadWrite},
+			{Name: "current", AccessMode: constant.AccessModeReadOnly},
+		},
+	}
+	object.IndexDevice()
+	return object, nil
+}
+
+func (d *fakeDevices) DeliverAction(id string, actions []map[string]interface{}, opts ...device.ActionOption) error {
+	if value := actions[0]["setpoint"]; value == "previous" {
+		d.restored[id] = actions[0]
+		return nil
+	}
+	d.delivered = append(d.delivered, id)
+	if id == d.failing {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func (d *fakeDevices) VerifyAction(ctx context.Context, id string, values map[string]interface{}, tolerance float64, since time.Time) error {
+	return nil
+}
+
+func (d *fakeDevices) GetLatestValue(id string, name string) (interface{}, bool) {
+	return "previous", true
+}
+
+func actionSets(ids ...string) []*v1.ActionSet {
+	sets := make([]*v1.ActionSet, 0, len(ids))
+	for _, id := range ids {
+		sets = append(sets, &v1.ActionSet{DeviceId: id, Actions: []*v1.Action{{Name: "setpoint", Value: 1}}})
+	}
+	return sets
+}
+
+func TestApplyRollback(t *testing.T) {
+	devices := &fakeDevices{failing: "d2", restored: make(map[string]map[string]interface{})}
+	m := NewManager(make(chan struct{}))
+	m.devices = devices
+
+	execution := &Execution{}
+	m.apply(actionSets("d1", "d2", "d3"), applyOptions{rollback: true}, execution)
+	if execution.Result != ResultFailure || !execution.RolledBack {
+		t.Fatalf("expected failure rolled back, got %+v", execution)
+	}
+	if len(devices.delivered) != 2 {
+		t.Errorf("expected writing stopped at failed device, got %v", devices.delivered)
+	}
+	// the failed device may be written partially, the devices not written are left alone
+	for id, restored := range map[string]bool{"d1": true, "d2": true, "d3": false} {
+		if _, ok := devices.restored[id]; ok != restored {
+			t.Errorf("expected device %s restored %t", id, restored)
+		}
+	}
+
+	// the values are not restored without rollback
+	devices = &fakeDevices{failing: "d1", restored: make(map[string]map[string]interface{})}
+	m.devices = devices
+	execution = &Execution{}
+	m.apply(actionSets("d1", "d2"), applyOptions{}, execution)
+	if execution.Result != ResultFailure || execution.RolledBack || len(devices.restored) != 0 {
+		t.Errorf("expected failure not rolled back, got %+v, %v", execution, devices.restored)
+	}
+}
+
+func TestApplyCheck(t *testing.T) {
+	devices := &fakeDevices{restored: make(map[string]map[string]interface{})}
+	m := NewManager(make(chan struct{}))
+	m.devices = devices
+
+	sets := append(actionSets("d1", "missing"), &v1.ActionSet{DeviceId: "d2", Actions: []*v1.Action{{Name: "current", Value: 1}}})
+	execution := &Execution{}
+	m.apply(sets, applyOptions{rollback: true}, execution)
+	if execution.Result != ResultFailure || len(execution.Errors) != 2 {
+		t.Errorf("expected missing device and readonly variable failed, got %+v", execution)
+	}
+	if len(devices.delivered) != 0 {
+		t.Errorf("expected nothing written when check failed, got %v", devices.delivered)
+	}
+}
+
+func TestInitMissed(t *testing.T) {
+	storage.SetPath(t.TempDir())
+	at := time.Now().Add(-time.Hour).Truncate(time.Second)
+	client := storage.NewClient(storage.StoreGroupSchedule)
+	schedules := []*Schedule{
+		{ObjectMeta: runtime.ObjectMeta{ID: "passed", Name: "passed", Version: "1"}, Enabled: true, At: &at, Actions: actionSets("d1")},
+		{ObjectMeta: runtime.ObjectMeta{ID: "disabled", Name: "disabled", Version: "1"}, At: &at, Actions: actionSets("d1")},
+	}
+	for _, schedule := range schedules {
+		if _, err := client.Create(scheduleKey(schedule.ID), schedule); err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+	}
+
+	m := NewManager(make(chan struct{}))
+	m.Init(&fakeDevices{})
+	executions, _ := m.ListExecutions(&ExecutionFilter{})
+	if len(executions) != 1 {
+		t.Fatalf("expected passed one-shot recorded once, got %d", len(executions))
+	}
+	if e := executions[0]; e.Result != ResultMissed || e.ScheduleId != "passed" || !e.StartTime.Equal(at) {
+		t.Errorf("expected missed execution of passed schedule, got %+v", e)
+	}
+	if schedule, _ := m.GetScheduleById("passed"); schedule.Enabled {
+		t.Errorf("expected missed one-shot disabled")
+	}
+	if _, ok := m.timers["passed"]; ok {
+		t.Errorf("expected missed one-shot not armed")
+	}
+
+	// the disabled schedule is persisted, the missed one-shot is not recorded again after restarting
+	m = NewManager(make(chan struct{}))
+	m.Init(&fakeDevices{})
+	if executions, _ = m.ListExecutions(&ExecutionFilter{}); len(executions) != 1 {
+		t.Errorf("expected missed one-shot recorded once after restarting, got %d", len(executions))
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	m := NewManager(make(chan struct{}))
+	m.devices = &fakeDevices{}
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		valid    bool
+	}{
+		{"cron", &Schedule{Cron: "0 8 * * *", Actions: actionSets("d1")}, true},
+		{"at", &Schedule{Enabled: true, At: &future, Actions: actionSets("d1")}, true},
+		{"disabled passed at", &Schedule{At: &past, Actions: actionSets("d1")}, true},
+		{"enabled passed at", &Schedule{Enabled: true, At: &past, Actions: actionSets("d1")}, false},
+		{"neither cron nor at", &Schedule{Actions: actionSets("d1")}, false},
+		{"both cron and at", &Schedule{Cron: "0 8 * * *", At: &future, Actions: actionSets("d1")}, false},
+		{"invalid cron", &Schedule{Cron: "0 8 * *", Actions: actionSets("d1")}, false},
+		{"neither recipe nor actions", &Schedule{Cron: "0 8 * * *"}, false},
+		{"both recipe and actions", &Schedule{Cron: "0 8 * * *", RecipeId: "r1", Actions: actionSets("d1")}, false},
+		{"recipe not found", &Schedule{Cron: "0 8 * * *", RecipeId: "r1"}, false},
+		{"device repeated", &Schedule{Cron: "0 8 * * *", Actions: actionSets("d1", "d1")}, false},
+		{"device not found", &Schedule{Cron: "0 8 * * *", Actions: actionSets("missing")}, false},
+		{"variable not writable", &Schedule{Cron: "0 8 * * *", Actions: []*v1.ActionSet{{DeviceId: "d1", Actions: []*v1.Action{{Name: "current", Value: 1}}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.validateSchedule(tt.schedule); (err == nil) != tt.valid {
+				t.Errorf("validateSchedule() = %v, expected valid %t", err, tt.valid)
+			}
+		})
+	}
+}
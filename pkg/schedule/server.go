@@ -0,0 +1,259 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/recipes", createRecipe(mgr))
+	group.DELETE("/recipes/:id", deleteRecipe(mgr))
+	group.PUT("/recipes/:id", updateRecipeById(mgr))
+	group.GET("/recipes", listRecipes(mgr))
+	group.GET("/recipes/:id", getRecipeById(mgr))
+	group.POST("/recipes/:id/apply", applyRecipeById(mgr))
+	group.POST("/schedules", createSchedule(mgr))
+	group.DELETE("/schedules/:id", deleteSchedule(mgr))
+	group.PUT("/schedules/:id", updateScheduleById(mgr))
+	group.GET("/schedules", listSchedules(mgr))
+	group.GET("/schedules/:id", getScheduleById(mgr))
+	group.POST("/schedules/:id/run", runScheduleById(mgr))
+	group.GET("/executions", listExecutions(mgr))
+	group.GET("/executions/:id", getExecutionById(mgr))
+}
+
+func createRecipe(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Recipe{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse recipe", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		recipe, err := mgr.CreateRecipe(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, recipe.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, recipe.GetID()))
+		c.JSON(http.StatusCreated, recipe)
+	}
+}
+
+func deleteRecipe(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		recipe, err := mgr.DeleteRecipe(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+func updateRecipeById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.Recipe{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse recipe", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateRecipeById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listRecipes(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipes, _ := mgr.ListRecipes()
+		c.JSON(http.StatusOK, &ResponseModel{Recipes: recipes})
+	}
+}
+
+func getRecipeById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recipe, err := mgr.GetRecipeById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, recipe.GetVersion())
+		c.JSON(http.StatusOK, recipe)
+	}
+}
+
+func createSchedule(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Schedule{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse schedule", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		schedule, err := mgr.CreateSchedule(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, schedule.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, schedule.GetID()))
+		c.JSON(http.StatusCreated, schedule)
+	}
+}
+
+func deleteSchedule(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		schedule, err := mgr.DeleteSchedule(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, schedule)
+	}
+}
+
+func updateScheduleById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.Schedule{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse schedule", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateScheduleById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listSchedules(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schedules, _ := mgr.ListSchedules()
+		c.JSON(http.StatusOK, &ResponseModel{Schedules: schedules})
+	}
+}
+
+func getScheduleById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schedule, err := mgr.GetScheduleById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, schedule.GetVersion())
+		c.JSON(http.StatusOK, schedule)
+	}
+}
+
+// applyRecipeById applies the recipe synchronously, the failed execution is returned with 200 as well
+func applyRecipeById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		execution, err := mgr.ApplyRecipe(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, execution)
+	}
+}
+
+func runScheduleById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		execution, err := mgr.RunSchedule(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, execution)
+	}
+}
+
+func listExecutions(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		executions, _ := mgr.ListExecutions(&ExecutionFilter{
+			ScheduleId: c.Query("scheduleId"),
+			RecipeId:   c.Query("recipeId"),
+		})
+		c.JSON(http.StatusOK, &ResponseModel{Executions: executions})
+	}
+}
+
+func getExecutionById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		execution, err := mgr.GetExecutionById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, execution)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,54 @@
+package schedule
+
+import (
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"time"
+)
+
+// Recipe a named set of variable values across devices
+type Recipe struct {
+	runtime.ObjectMeta
+	Description string          `json:"description,omitempty"` // 描述
+	Items       []*v1.ActionSet `json:"items"`                 // 配方内容
+	Readback    bool            `json:"readback,omitempty"`    // 写入后回读校验
+	Tolerance   float64         `json:"tolerance,omitempty"`   // 回读校验的数值容差
+	Timeout     uint            `json:"timeout,omitempty"`     // 回读校验超时时间(秒)
+	Rollback    bool            `json:"rollback,omitempty"`    // 失败时恢复写入前的值
+}
+
+// Schedule executes the recipe or the actions on cron expression or at one-shot time
+type Schedule struct {
+	runtime.ObjectMeta
+	Enabled  bool            `json:"enabled"`            // 是否启用 单次执行后自动停用
+	Cron     string          `json:"cron,omitempty"`     // cron表达式
+	At       *time.Time      `json:"at,omitempty"`       // 单次执行时间
+	RecipeId string          `json:"recipeId,omitempty"` // 执行的配方
+	Actions  []*v1.ActionSet `json:"actions,omitempty"`  // 执行的动作
+	NextTime *time.Time      `json:"nextTime,omitempty"` // 下次执行时间 不持久化
+}
+
+// Execution the history of applying recipe or executing schedule
+type Execution struct {
+	runtime.ObjectMeta
+	ScheduleId string     `json:"scheduleId,omitempty"`
+	RecipeId   string     `json:"recipeId,omitempty"`
+	Trigger    string     `json:"trigger"` // schedule、manual
+	StartTime  time.Time  `json:"startTime"`
+	EndTime    *time.Time `json:"endTime,omitempty"`
+	Result     string     `json:"result"`               // success、failure、missed
+	RolledBack bool       `json:"rolledBack,omitempty"` // 失败后已恢复写入前的值
+	Errors     []string   `json:"errors,omitempty"`
+}
+
+type ResponseModel struct {
+	Recipes    interface{} `json:"recipes,omitempty"`
+	Schedules  interface{} `json:"schedules,omitempty"`
+	Executions interface{} `json:"executions,omitempty"`
+}
+
+// ExecutionFilter filter executions by schedule and recipe, empty means all
+type ExecutionFilter struct {
+	ScheduleId string
+	RecipeId   string
+}
@@ -0,0 +1,411 @@
+package script
+
+import (
+	"errors"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// binaryFunction charges the result of binary operator before it is computed, returns the result
+	binaryFunction = "__binary__"
+	// allocFunction calls the builtin with the rest args, the allocating builtins are charged before called and the
+	// others are charged by the value returned
+	allocFunction = "__alloc__"
+	// growFunction charges the operand appended by augmented assignment, returns the operand
+	growFunction = "__grow__"
+	// repeatFunction charges the repetition of augmented assignment, returns the count
+	repeatFunction = "__repeat__"
+	budgetKey      = "budget"
+)
+
+var errMemoryLimit = errors.New("memory limit exceeded")
+
+// budget the bytes allocated by one execution, estimated by the values produced by operators, builtins and prints
+// which may allocate a lot in one step, the others are bounded by the max steps
+type budget struct {
+	used uint64
+	max  uint64
+}
+
+func (b *budget) charge(size uint64) error {
+	b.used += size
+	if b.used > b.max {
+		return errMemoryLimit
+	}
+	return nil
+}
+
+// remaining the bytes can be allocated before the budget is exceeded
+func (b *budget) remaining() uint64 {
+	if b.used > b.max {
+		return 0
+	}
+	return b.max - b.used
+}
+
+func chargeThread(thread *starlark.Thread, size uint64) error {
+	if b, ok := thread.Local(budgetKey).(*budget); ok {
+		return b.charge(size)
+	}
+	return nil
+}
+
+// binaryOperators the operators charged before computing, the others never allocate more than their operands
+var binaryOperators = map[string]syntax.Token{
+	"+": syntax.PLUS,
+	"*": syntax.STAR,
+	"%": syntax.PERCENT,
+	"|": syntax.PIPE,
+}
+
+var (
+	binaryBuiltin = starlark.NewBuiltin(binaryFunction, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		op, x, y := binaryOperators[string(args[0].(starlark.String))], args[1], args[2]
+		size := sizeOf(x) + sizeOf(y)
+		if _, ok := x.(starlark.String); ok && op == syntax.PERCENT {
+			// the operands are formatted into the result
+			size = sizeOf(x) + textSize(y, remaining(thread))
+		}
+		if op == syntax.STAR {
+			if n, err := starlark.AsInt32(x); err == nil && n > 0 {
+				size = sizeOf(y) * uint64(n)
+			} else if n, err := starlark.AsInt32(y); err == nil && n > 0 {
+				size = sizeOf(x) * uint64(n)
+			}
+		}
+		if err := chargeThread(thread, size); err != nil {
+			return nil, err
+		}
+		return starlark.Binary(op, x, y)
+	})
+	allocBuiltin = starlark.NewBuiltin(allocFunction, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		fn, args := args[0], args[1:]
+		size, estimated := estimate(fn, args, kwargs, remaining(thread))
+		if estimated {
+			if err := chargeThread(thread, size); err != nil {
+				return nil, err
+			}
+		}
+		result, err := starlark.Call(thread, fn, args, kwargs)
+		if err != nil || estimated {
+			return result, err
+		}
+		return result, chargeThread(thread, sizeOf(result))
+	})
+	growBuiltin = starlark.NewBuiltin(growFunction, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		return args[1], chargeThread(thread, sizeOf(args[1]))
+	})
+	repeatBuiltin = starlark.NewBuiltin(repeatFunction, func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, _ []starlark.Tuple) (starlark.Value, error) {
+		if n, err := starlark.AsInt32(args[1]); err == nil && n > 1 {
+			return args[1], chargeThread(thread, sizeOf(args[0])*uint64(n-1))
+		}
+		return args[1], nil
+	})
+)
+
+// remaining the bytes can be allocated by thread, the estimating stops once it is exceeded
+func remaining(thread *starlark.Thread) uint64 {
+	if b, ok := thread.Local(budgetKey).(*budget); ok {
+		return b.remaining()
+	}
+	return math.MaxUint64
+}
+
+// estimate the bytes allocated by calling the builtins whose result may be much larger than their operands, so that
+// the call over the budget is rejected before allocating. The estimating stops once the size exceeds limit.
+func estimate(fn starlark.Value, args starlark.Tuple, kwargs []starlark.Tuple, limit uint64) (uint64, bool) {
+	b, ok := fn.(*starlark.Builtin)
+	if !ok {
+		return 0, false
+	}
+	if b.Receiver() == nil {
+		switch b.Name() {
+		case "str":
+			// the string is returned as it is
+			if len(args) == 1 {
+				if _, ok := args[0].(starlark.String); ok {
+					return 0, true
+				}
+			}
+			return textSize(args, limit), true
+		case "repr", "print", "json.encode", "json.indent":
+			return textSize(args, limit) + textSize(kwargsOf(kwargs), limit), true
+		case "list", "tuple", "sorted", "reversed":
+			return lenOf(args, 0) * 16, true
+		case "set":
+			return lenOf(args, 0) * 32, true
+		case "dict":
+			return (lenOf(args, 0) + uint64(len(kwargs))) * 32, true
+		case "enumerate":
+			return lenOf(args, 0) * 48, true
+		case "zip":
+			n := uint64(0)
+			for i := range args {
+				if l := lenOf(args, i); i == 0 || l < n {
+					n = l
+				}
+			}
+			return n * uint64(16+16*len(args)), true
+		}
+		return 0, false
+	}
+	recv, ok := b.Receiver().(starlark.String)
+	if !ok {
+		return 0, false
+	}
+	str := string(recv)
+	switch b.Name() {
+	case "join":
+		size := uint64(0)
+		iter := starlark.Iterate(argOf(args, 0))
+		if iter == nil {
+			return size, true
+		}
+		defer iter.Done()
+		var x starlark.Value
+		for size <= limit && iter.Next(&x) {
+			// the call fails on the element not string
+			s, ok := x.(starlark.String)
+			if !ok {
+				break
+			}
+			size += uint64(len(s) + len(str))
+		}
+		return size, true
+	case "replace":
+		old, _ := starlark.AsString(argOf(args, 0))
+		new, _ := starlark.AsString(argOf(args, 1))
+		if len(new) <= len(old) {
+			return uint64(len(str)), true
+		}
+		n := strings.Count(str, old)
+		if len(args) > 2 {
+			if count, err := starlark.AsInt32(args[2]); err == nil && count >= 0 && count < n {
+				n = count
+			}
+		}
+		return uint64(len(str) + n*(len(new)-len(old))), true
+	case "split", "rsplit":
+		// the parts share the bytes of string
+		if sep, ok := starlark.AsString(argOf(args, 0)); ok && len(sep) > 0 {
+			return uint64(strings.Count(str, sep)+1) * 16, true
+		}
+		return uint64(len(str)/2+1) * 16, true
+	case "splitlines":
+		return uint64(strings.Count(str, "\n")+1) * 16, true
+	case "format":
+		return uint64(len(str)) + textSize(args, limit) + textSize(kwargsOf(kwargs), limit), true
+	}
+	return 0, false
+}
+
+// argOf the i-th arg, nil if absent
+func argOf(args starlark.Tuple, i int) starlark.Value {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// lenOf the length of the i-th arg, the value without length is charged by the call result
+func lenOf(args starlark.Tuple, i int) uint64 {
+	if n := starlark.Len(argOf(args, i)); n > 0 {
+		return uint64(n)
+	}
+	return 0
+}
+
+func kwargsOf(kwargs []starlark.Tuple) starlark.Tuple {
+	values := make(starlark.Tuple, 0, len(kwargs))
+	for _, kwarg := range kwargs {
+		values = append(values, kwarg[1])
+	}
+	return values
+}
+
+// textSize the estimated bytes of the text formatted from value, the elements of containers are counted until limit
+// is exceeded
+func textSize(v starlark.Value, limit uint64) uint64 {
+	return textSizeOf(v, limit, make(map[starlark.Value]struct{}))
+}
+
+func textSizeOf(v starlark.Value, limit uint64, visited map[starlark.Value]struct{}) uint64 {
+	switch value := v.(type) {
+	case nil:
+		return 0
+	case starlark.String:
+		return uint64(len(value)) + 2
+	case starlark.Bytes:
+		return uint64(len(value)) + 3
+	case starlark.Int:
+		if _, ok := value.Int64(); ok {
+			return 20
+		}
+		return uint64(value.BigInt().BitLen()/3) + 1
+	case *starlark.List, *starlark.Dict, *starlark.Set:
+		// the container referring itself is formatted as [...]
+		if _, ok := visited[v]; ok {
+			return 5
+		}
+		visited[v] = struct{}{}
+		defer delete(visited, v)
+	case starlark.Tuple:
+	default:
+		return 24
+	}
+	iter := starlark.Iterate(v)
+	if iter == nil {
+		return 2
+	}
+	defer iter.Done()
+	mapping, _ := v.(starlark.Mapping)
+	size := uint64(2)
+	var x starlark.Value
+	for size <= limit && iter.Next(&x) {
+		size += textSizeOf(x, limit-size, visited) + 2
+		if mapping == nil || size > limit {
+			continue
+		}
+		if value, found, _ := mapping.Get(x); found {
+			size += textSizeOf(value, limit-size, visited)
+		}
+	}
+	return size
+}
+
+// sizeOf the estimated bytes of value, the elements of containers are not counted and the lazy ranges are free
+func sizeOf(v starlark.Value) uint64 {
+	switch value := v.(type) {
+	case starlark.String:
+		return uint64(len(value))
+	case starlark.Bytes:
+		return uint64(len(value))
+	case starlark.Int:
+		if _, ok := value.Int64(); ok {
+			return 0
+		}
+		return uint64(value.BigInt().BitLen() / 8)
+	case *starlark.List:
+		return uint64(value.Len()) * 16
+	case starlark.Tuple:
+		return uint64(value.Len()) * 16
+	case *starlark.Dict:
+		return uint64(value.Len()) * 32
+	case *starlark.Set:
+		return uint64(value.Len()) * 32
+	}
+	return 0
+}
+
+// instrument rewrite the script to charge the operators, augmented assignments and builtins to the budget of thread
+func instrument(f *syntax.File) {
+	f.Stmts = instrumentStmts(f.Stmts)
+}
+
+func instrumentStmts(stmts []syntax.Stmt) []syntax.Stmt {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *syntax.AssignStmt:
+			s.RHS = instrumentExpr(s.RHS)
+			if s.Op == syntax.EQ {
+				continue
+			}
+			ident, ok := s.LHS.(*syntax.Ident)
+			switch {
+			case !ok:
+				// the target is evaluated once, so the operand is charged only
+				s.RHS = charge(allocFunction, s.RHS)
+			case s.Op == syntax.STAR_EQ:
+				s.RHS = charge(repeatFunction, &syntax.Ident{NamePos: ident.NamePos, Name: ident.Name}, s.RHS)
+			default:
+				s.RHS = charge(growFunction, &syntax.Ident{NamePos: ident.NamePos, Name: ident.Name}, s.RHS)
+			}
+		case *syntax.DefStmt:
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.ExprStmt:
+			s.X = instrumentExpr(s.X)
+		case *syntax.ForStmt:
+			s.X = instrumentExpr(s.X)
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.WhileStmt:
+			s.Cond = instrumentExpr(s.Cond)
+			s.Body = instrumentStmts(s.Body)
+		case *syntax.IfStmt:
+			s.Cond = instrumentExpr(s.Cond)
+			s.True = instrumentStmts(s.True)
+			s.False = instrumentStmts(s.False)
+		case *syntax.ReturnStmt:
+			s.Result = instrumentExpr(s.Result)
+		}
+	}
+	return stmts
+}
+
+func instrumentExpr(expr syntax.Expr) syntax.Expr {
+	switch e := expr.(type) {
+	case *syntax.BinaryExpr:
+		e.X, e.Y = instrumentExpr(e.X), instrumentExpr(e.Y)
+		if op := e.Op.String(); binaryOperators[op] == e.Op {
+			return charge(binaryFunction, &syntax.Literal{Token: syntax.STRING, TokenPos: e.OpPos, Raw: strconv.Quote(op), Value: op}, e.X, e.Y)
+		}
+	case *syntax.CallExpr:
+		e.Fn = instrumentExpr(e.Fn)
+		instrumentExprs(e.Args)
+		// the functions defined by script are charged by their own operators
+		if ident, ok := e.Fn.(*syntax.Ident); !ok || starlark.Universe.Has(ident.Name) {
+			e.Args = append([]syntax.Expr{e.Fn}, e.Args...)
+			e.Fn = &syntax.Ident{NamePos: syntax.Start(e.Fn), Name: allocFunction}
+		}
+	case *syntax.Comprehension:
+		e.Body = instrumentExpr(e.Body)
+		for _, clause := range e.Clauses {
+			switch c := clause.(type) {
+			case *syntax.ForClause:
+				c.X = instrumentExpr(c.X)
+			case *syntax.IfClause:
+				c.Cond = instrumentExpr(c.Cond)
+			}
+		}
+	case *syntax.CondExpr:
+		e.Cond, e.True, e.False = instrumentExpr(e.Cond), instrumentExpr(e.True), instrumentExpr(e.False)
+	case *syntax.DictExpr:
+		for _, entry := range e.List {
+			if de, ok := entry.(*syntax.DictEntry); ok {
+				de.Key, de.Value = instrumentExpr(de.Key), instrumentExpr(de.Value)
+			}
+		}
+	case *syntax.DotExpr:
+		e.X = instrumentExpr(e.X)
+	case *syntax.IndexExpr:
+		e.X, e.Y = instrumentExpr(e.X), instrumentExpr(e.Y)
+	case *syntax.LambdaExpr:
+		e.Body = instrumentExpr(e.Body)
+	case *syntax.ListExpr:
+		instrumentExprs(e.List)
+	case *syntax.TupleExpr:
+		instrumentExprs(e.List)
+	case *syntax.ParenExpr:
+		e.X = instrumentExpr(e.X)
+	case *syntax.SliceExpr:
+		e.X, e.Lo, e.Hi, e.Step = instrumentExpr(e.X), instrumentExpr(e.Lo), instrumentExpr(e.Hi), instrumentExpr(e.Step)
+	case *syntax.UnaryExpr:
+		e.X = instrumentExpr(e.X)
+	}
+	return expr
+}
+
+func instrumentExprs(exprs []syntax.Expr) {
+	for i := range exprs {
+		exprs[i] = instrumentExpr(exprs[i])
+	}
+}
+
+// charge call the charging function with args at the position of the last arg
+func charge(function string, args ...syntax.Expr) syntax.Expr {
+	start, end := syntax.Start(args[len(args)-1]), syntax.End(args[len(args)-1])
+	return &syntax.CallExpr{Fn: &syntax.Ident{NamePos: start, Name: function}, Lparen: start, Args: args, Rparen: end}
+}
@@ -0,0 +1,14 @@
+package script
+
+import "time"
+
+const (
+	// processFunction the function defined by script, called with the points and the device after each collection
+	processFunction = "process"
+	// default limits of each execution
+	defaultMaxSteps  = 1000000
+	defaultTimeout   = 100 * time.Millisecond
+	defaultMaxMemory = 16 << 20
+	// maxPoints the max points returned by script
+	maxPoints = 10000
+)
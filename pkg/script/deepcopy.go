@@ -0,0 +1,23 @@
+package script
+
+import "harnsgateway/pkg/runtime"
+
+func (in *Script) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.DeviceIds != nil {
+		out.DeviceIds = make([]string, len(in.DeviceIds))
+		copy(out.DeviceIds, in.DeviceIds)
+	}
+	if in.Status != nil {
+		status := *in.Status
+		if in.Status.LastErrorTime != nil {
+			t := *in.Status.LastErrorTime
+			status.LastErrorTime = &t
+		}
+		out.Status = &status
+	}
+	return &out
+}
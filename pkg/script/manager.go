@@ -0,0 +1,314 @@
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/storage"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeviceGetter finds the devices attached to scripts
+type DeviceGetter interface {
+	GetDeviceById(id string, exploded bool) (runtime.Device, error)
+}
+
+// Manager compiles the scripts and processes the collected points of the attached devices,
+// each device is attached to one script at most.
+type Manager struct {
+	devices  DeviceGetter
+	mu       *sync.RWMutex
+	scripts  map[string]*Script
+	programs map[string]*program
+	statuses map[string]*ScriptStatus
+	// attached device id to script id
+	attached map[string]string
+	client   storage.Storage
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		mu:       &sync.RWMutex{},
+		scripts:  make(map[string]*Script, 0),
+		programs: make(map[string]*program, 0),
+		statuses: make(map[string]*ScriptStatus, 0),
+		attached: make(map[string]string, 0),
+	}
+}
+
+func (m *Manager) Init(devices DeviceGetter) {
+	m.devices = devices
+	m.client = storage.NewClient(storage.StoreGroupScript)
+
+	objs, _ := m.client.List(storage.Scripts)
+	files, ok := objs.([]*storage.FileInfo)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, file := range files {
+		data, err := m.client.Get(filepath.Join(storage.Scripts, filepath.Base(file.Path)))
+		if err != nil {
+			continue
+		}
+		script := &Script{}
+		if err := json.NewDecoder(bytes.NewReader(data.([]byte))).Decode(script); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal script", "err", err)
+			continue
+		}
+		p, err := compile(script.Name, script.Source, newLimits(script.MaxSteps, script.Timeout, script.MaxMemory))
+		if err != nil {
+			klog.V(2).InfoS("Failed to compile script", "scriptId", script.ID, "err", err)
+		}
+		m.put(script, p)
+	}
+}
+
+// Process executes the script attached to device, the points are returned unchanged if the script failed.
+func (m *Manager) Process(device runtime.Device, points []runtime.PointData) []runtime.PointData {
+	m.mu.RLock()
+	id, ok := m.attached[device.GetID()]
+	p := m.programs[id]
+	m.mu.RUnlock()
+	if !ok || p == nil {
+		return points
+	}
+
+	result, _, err := p.run(device, points)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status, ok := m.statuses[id]
+	if !ok {
+		return points
+	}
+	status.Executions++
+	if err != nil {
+		now := time.Now()
+		status.Failures++
+		status.LastError = err.Error()
+		status.LastErrorTime = &now
+		klog.V(3).InfoS("Failed to execute script", "scriptId", id, "deviceId", device.GetID(), "err", err)
+		return points
+	}
+	return result
+}
+
+// DryRun executes the script against the sample points, the runtime error is returned in the result
+func (m *Manager) DryRun(object *v1.ScriptDryRun) (*DryRunResult, error) {
+	var device runtime.Device
+	if len(object.DeviceId) > 0 {
+		d, err := m.devices.GetDeviceById(object.DeviceId, false)
+		if err != nil {
+			return nil, response.ErrDeviceNotFound(object.DeviceId)
+		}
+		device = d
+	}
+	p, err := compile("dry-run", object.Source, newLimits(object.MaxSteps, object.Timeout, object.MaxMemory))
+	if err != nil {
+		return nil, response.ErrScriptInvalid("dry-run", err.Error())
+	}
+
+	points, exec, err := p.run(device, object.Points)
+	result := &DryRunResult{Points: points}
+	if exec != nil {
+		result.Prints = exec.prints
+		result.Steps = exec.steps
+		result.Duration = float64(exec.duration.Microseconds()) / 1000
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, nil
+}
+
+func (m *Manager) CreateScript(object *v1.Script) (*Script, error) {
+	script := &Script{
+		ObjectMeta: runtime.ObjectMeta{
+			Name:    object.Name,
+			ID:      uuidutil.UUID(),
+			Version: strconv.FormatUint(randutil.Uint64n(), 10),
+			ModTime: time.Now(),
+		},
+	}
+	applyScript(script, object)
+	p, err := m.validateScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Create(scriptKey(script.ID), script); err != nil {
+		klog.V(2).InfoS("Failed to store script", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(script, p)
+	return m.copyScript(script), nil
+}
+
+func (m *Manager) UpdateScriptById(id string, version string, object *v1.Script) (*Script, error) {
+	old, err := m.GetScriptById(id)
+	if err != nil {
+		return nil, err
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	script := old.DeepCopyObject().(*Script)
+	script.Status = nil
+	script.ModTime = time.Now()
+	applyScript(script, object)
+	p, err := m.validateScript(script)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.client.Update(scriptKey(id), version, script); err != nil {
+		klog.V(2).InfoS("Failed to update script", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	m.put(script, p)
+	return m.copyScript(script), nil
+}
+
+func (m *Manager) DeleteScript(id string, version string) (*Script, error) {
+	script, err := m.GetScriptById(id)
+	if err != nil {
+		return nil, err
+	}
+	if script.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.client.Delete(scriptKey(id), version); err != nil {
+		klog.V(2).InfoS("Failed to delete script", "scriptId", id, "err", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.remove(id)
+	klog.V(2).InfoS("Deleted script", "scriptId", id)
+	return script, nil
+}
+
+func (m *Manager) ListScripts() ([]*Script, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	scripts := make([]*Script, 0, len(m.scripts))
+	for _, script := range m.scripts {
+		scripts = append(scripts, m.copyScript(script))
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].ModTime.After(scripts[j].ModTime) })
+	return scripts, nil
+}
+
+func (m *Manager) GetScriptById(id string) (*Script, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	script, ok := m.scripts[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return m.copyScript(script), nil
+}
+
+// put the script and attach the devices if enabled, must be called with lock held
+func (m *Manager) put(script *Script, p *program) {
+	m.scripts[script.ID] = script
+	m.statuses[script.ID] = &ScriptStatus{}
+	if p == nil {
+		return
+	}
+	m.programs[script.ID] = p
+	if !script.Enabled {
+		return
+	}
+	for _, deviceId := range script.DeviceIds {
+		m.attached[deviceId] = script.ID
+	}
+}
+
+// remove the script and detach the devices, must be called with lock held
+func (m *Manager) remove(id string) {
+	for deviceId, scriptId := range m.attached {
+		if scriptId == id {
+			delete(m.attached, deviceId)
+		}
+	}
+	delete(m.scripts, id)
+	delete(m.programs, id)
+	delete(m.statuses, id)
+}
+
+// copyScript copy the script with the runtime status, must be called with lock held
+func (m *Manager) copyScript(script *Script) *Script {
+	out := script.DeepCopyObject().(*Script)
+	if status, ok := m.statuses[script.ID]; ok {
+		// LastErrorTime is replaced rather than modified, it is safe to share
+		s := *status
+		out.Status = &s
+	}
+	return out
+}
+
+// validateScript compile the script, the attached devices should exist and not be attached to other scripts
+func (m *Manager) validateScript(script *Script) (*program, error) {
+	p, err := compile(script.Name, script.Source, newLimits(script.MaxSteps, script.Timeout, script.MaxMemory))
+	if err != nil {
+		return nil, response.ErrScriptInvalid(script.Name, err.Error())
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, deviceId := range script.DeviceIds {
+		if _, err := m.devices.GetDeviceById(deviceId, false); err != nil {
+			return nil, response.ErrDeviceNotFound(deviceId)
+		}
+		for id, other := range m.scripts {
+			if id == script.ID {
+				continue
+			}
+			for _, attached := range other.DeviceIds {
+				if attached == deviceId {
+					return nil, response.ErrScriptInvalid(script.Name, "device "+deviceId+" is attached to script "+other.Name)
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+func applyScript(script *Script, object *v1.Script) {
+	script.Name = object.Name
+	script.Description = object.Description
+	script.Enabled = object.Enabled
+	script.Source = object.Source
+	script.DeviceIds = object.DeviceIds
+	script.MaxSteps = object.MaxSteps
+	script.Timeout = object.Timeout
+	script.MaxMemory = object.MaxMemory
+}
+
+func scriptKey(id string) string {
+	return filepath.Join(storage.Scripts, id)
+}
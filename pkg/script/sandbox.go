@@ -0,0 +1,310 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/lib/math"
+	"go.starlark.net/lib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"harnsgateway/pkg/runtime"
+	"reflect"
+	gotime "time"
+)
+
+// predeclared the modules available in scripts and the functions charging the budget of executions, load
+// statements are not supported
+var predeclared = starlark.StringDict{
+	"json":         json.Module,
+	"math":         math.Module,
+	"time":         time.Module,
+	binaryFunction: binaryBuiltin,
+	allocFunction:  allocBuiltin,
+	growFunction:   growBuiltin,
+	repeatFunction: repeatBuiltin,
+}
+
+type limits struct {
+	maxSteps  uint64
+	timeout   gotime.Duration
+	maxMemory uint64
+}
+
+func newLimits(maxSteps uint64, timeout uint, maxMemory uint64) limits {
+	l := limits{maxSteps: maxSteps, timeout: gotime.Duration(timeout) * gotime.Millisecond, maxMemory: maxMemory}
+	if l.maxSteps == 0 {
+		l.maxSteps = defaultMaxSteps
+	}
+	if l.timeout == 0 {
+		l.timeout = defaultTimeout
+	}
+	if l.maxMemory == 0 {
+		l.maxMemory = defaultMaxMemory
+	}
+	return l
+}
+
+// program the compiled script, the globals are frozen so no state is kept between executions
+type program struct {
+	name    string
+	process starlark.Callable
+	params  int
+	limits  limits
+}
+
+// execution the outputs of one execution
+type execution struct {
+	prints   []string
+	steps    uint64
+	duration gotime.Duration
+}
+
+func compile(name string, source string, l limits) (*program, error) {
+	f, err := syntax.LegacyFileOptions().Parse(name+".star", source, 0)
+	if err != nil {
+		return nil, err
+	}
+	instrument(f)
+	prog, err := starlark.FileProgram(f, predeclared.Has)
+	if err != nil {
+		return nil, err
+	}
+	var globals starlark.StringDict
+	if _, err := execute(name, l, func(thread *starlark.Thread) error {
+		globals, err = prog.Init(thread, predeclared)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	globals.Freeze()
+
+	p := &program{name: name, limits: l, params: 2}
+	fn, ok := globals[processFunction].(*starlark.Function)
+	if !ok {
+		return nil, fmt.Errorf("function %s not defined", processFunction)
+	}
+	if fn.NumParams() < 1 || fn.NumParams() > 2 {
+		return nil, fmt.Errorf("function %s should accept (points) or (points, device)", processFunction)
+	}
+	p.process, p.params = fn, fn.NumParams()
+	return p, nil
+}
+
+// run calls process with the points and the device, returns the points returned by process
+func (p *program) run(device runtime.Device, points []runtime.PointData) ([]runtime.PointData, *execution, error) {
+	args := make(starlark.Tuple, 0, 2)
+	list := make([]starlark.Value, 0, len(points))
+	for _, pd := range points {
+		value, err := toStarlark(pd.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("point %s: %v", pd.DataPointId, err)
+		}
+		point := starlark.NewDict(5)
+		_ = point.SetKey(starlark.String("dataPointId"), starlark.String(pd.DataPointId))
+		_ = point.SetKey(starlark.String("value"), value)
+		setQuality(point, pd.ValueQuality)
+		list = append(list, point)
+	}
+	args = append(args, starlark.NewList(list))
+	if p.params == 2 {
+		info := starlark.NewDict(4)
+		if device != nil {
+			_ = info.SetKey(starlark.String("id"), starlark.String(device.GetID()))
+			_ = info.SetKey(starlark.String("name"), starlark.String(device.GetName()))
+			_ = info.SetKey(starlark.String("code"), starlark.String(device.GetDeviceCode()))
+			_ = info.SetKey(starlark.String("type"), starlark.String(device.GetDeviceType()))
+		}
+		args = append(args, info)
+	}
+
+	var result starlark.Value
+	exec, err := execute(p.name, p.limits, func(thread *starlark.Thread) (err error) {
+		result, err = starlark.Call(thread, p.process, args, nil)
+		return err
+	})
+	if err != nil {
+		return nil, exec, err
+	}
+	pds, err := toPoints(result)
+	return pds, exec, err
+}
+
+// execute runs fn in a new thread within the limits of steps, time and the memory budget of the thread
+func execute(name string, l limits, fn func(thread *starlark.Thread) error) (*execution, error) {
+	exec := &execution{}
+	b := &budget{max: l.maxMemory}
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			if err := b.charge(uint64(len(msg))); err != nil {
+				thread.Cancel(err.Error())
+				return
+			}
+			exec.prints = append(exec.prints, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(l.maxSteps)
+	thread.SetLocal(budgetKey, b)
+
+	timer := gotime.AfterFunc(l.timeout, func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+
+	now := gotime.Now()
+	err := fn(thread)
+	exec.duration = gotime.Since(now)
+	exec.steps = thread.ExecutionSteps()
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		err = errors.New(evalErr.Backtrace())
+	}
+	return exec, err
+}
+
+func toPoints(result starlark.Value) ([]runtime.PointData, error) {
+	iterable, ok := result.(starlark.Indexable)
+	if !ok {
+		return nil, fmt.Errorf("%s should return a list of points, got %s", processFunction, result.Type())
+	}
+	if iterable.Len() > maxPoints {
+		return nil, fmt.Errorf("%s returned more than %d points", processFunction, maxPoints)
+	}
+	pds := make([]runtime.PointData, 0, iterable.Len())
+	ids := make(map[string]struct{}, iterable.Len())
+	for i := 0; i < iterable.Len(); i++ {
+		point, ok := iterable.Index(i).(*starlark.Dict)
+		if !ok {
+			return nil, fmt.Errorf("point %d should be a dict, got %s", i, iterable.Index(i).Type())
+		}
+		id, found, _ := point.Get(starlark.String("dataPointId"))
+		name, isString := starlark.AsString(id)
+		if !found || !isString || len(name) == 0 {
+			return nil, fmt.Errorf("point %d: dataPointId should be a non-empty string", i)
+		}
+		if _, exist := ids[name]; exist {
+			return nil, fmt.Errorf("point %d: dataPointId %s is repeated", i, name)
+		}
+		ids[name] = struct{}{}
+		v, _, _ := point.Get(starlark.String("value"))
+		value, err := fromStarlark(v)
+		if err != nil {
+			return nil, fmt.Errorf("point %s: %v", name, err)
+		}
+		pd := runtime.PointData{DataPointId: name, Value: value}
+		// the quality is optional, the points without quality are good
+		for key, field := range map[string]*string{"quality": &pd.Quality, "reason": &pd.Reason, "sourceTimestamp": &pd.SourceTimestamp} {
+			if v, found, _ := point.Get(starlark.String(key)); found {
+				*field, _ = starlark.AsString(v)
+			}
+		}
+		pds = append(pds, pd)
+	}
+	return pds, nil
+}
+
+func setQuality(point *starlark.Dict, quality runtime.ValueQuality) {
+	if len(quality.Quality) > 0 {
+		_ = point.SetKey(starlark.String("quality"), starlark.String(quality.Quality))
+	}
+	if len(quality.Reason) > 0 {
+		_ = point.SetKey(starlark.String("reason"), starlark.String(quality.Reason))
+	}
+	if len(quality.SourceTimestamp) > 0 {
+		_ = point.SetKey(starlark.String("sourceTimestamp"), starlark.String(quality.SourceTimestamp))
+	}
+}
+
+func toStarlark(v interface{}) (starlark.Value, error) {
+	if v == nil {
+		return starlark.None, nil
+	}
+	switch value := v.(type) {
+	case starlark.Value:
+		return value, nil
+	case []byte:
+		return starlark.Bytes(value), nil
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(value))
+		for k, item := range value {
+			sv, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			_ = dict.SetKey(starlark.String(k), sv)
+		}
+		return dict, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return starlark.Bool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(rv.Float()), nil
+	case reflect.String:
+		return starlark.String(rv.String()), nil
+	case reflect.Slice, reflect.Array:
+		list := make([]starlark.Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			sv, err := toStarlark(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, sv)
+		}
+		return starlark.NewList(list), nil
+	}
+	return nil, fmt.Errorf("unsupported value type %T", v)
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch value := v.(type) {
+	case nil, starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(value), nil
+	case starlark.Int:
+		if i, ok := value.Int64(); ok {
+			return i, nil
+		}
+		if u, ok := value.Uint64(); ok {
+			return u, nil
+		}
+		return float64(value.Float()), nil
+	case starlark.Float:
+		return float64(value), nil
+	case starlark.String:
+		return string(value), nil
+	case starlark.Bytes:
+		return []byte(value), nil
+	case *starlark.Dict:
+		result := make(map[string]interface{}, value.Len())
+		for _, item := range value.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("key of dict should be string, got %s", item[0].Type())
+			}
+			fv, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			result[k] = fv
+		}
+		return result, nil
+	case starlark.Indexable:
+		result := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			fv, err := fromStarlark(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, fv)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unsupported value type %s", v.Type())
+}
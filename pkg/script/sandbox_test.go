@@ -0,0 +1,196 @@
+package script
+
+import (
+	"harnsgateway/pkg/runtime"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgramRun(t *testing.T) {
+	source := `
+def process(points, device):
+    result = []
+    for p in points:
+        if p["dataPointId"] == "status":
+            result.append({"dataPointId": "running", "value": p["value"] & 0x01 == 1})
+            result.append({"dataPointId": "fault", "value": (p["value"] >> 1) & 0x07})
+        else:
+            result.append(p)
+    print(len(result))
+    return result
+`
+	p, err := compile("bits", source, newLimits(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, exec, err := p.run(nil, []runtime.PointData{
+		{DataPointId: "status", Value: uint16(0x0B)},
+		{DataPointId: "temperature", Value: float32(26.5)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points, got %v", points)
+	}
+	if points[0].Value != true || points[1].Value != int64(5) || points[2].Value != 26.5 {
+		t.Fatalf("unexpected points %v", points)
+	}
+	if len(exec.prints) != 1 || exec.prints[0] != "3" {
+		t.Fatalf("unexpected prints %v", exec.prints)
+	}
+}
+
+func TestProgramLimits(t *testing.T) {
+	for name, c := range map[string]struct {
+		source string
+		limits limits
+		err    string
+	}{
+		"steps": {
+			source: "def process(points):\n    for i in range(100000000):\n        pass\n    return points\n",
+			limits: newLimits(1000, 0, 0),
+			err:    "too many steps",
+		},
+		"memory": {
+			source: "def process(points):\n    s = 'x'\n    for i in range(30):\n        s = s + s\n    return points\n",
+			limits: newLimits(0, 10000, 1<<20),
+			err:    "memory limit exceeded",
+		},
+		"repeat": {
+			source: "def process(points):\n    s = 'x' * (1 << 29)\n    return points\n",
+			limits: newLimits(0, 10000, 1<<20),
+			err:    "memory limit exceeded",
+		},
+		"augmented": {
+			source: "def process(points):\n    s = ['x']\n    for i in range(30):\n        s += s\n    return points\n",
+			limits: newLimits(0, 10000, 1<<20),
+			err:    "memory limit exceeded",
+		},
+		"builtin": {
+			source: "def process(points):\n    s = 'x'\n    for i in range(30):\n        s = ''.join([s, s])\n    return points\n",
+			limits: newLimits(0, 10000, 1<<20),
+			err:    "memory limit exceeded",
+		},
+		"repeated": {
+			source: "def process(points):\n    return points + [{'dataPointId': 'current', 'value': 1}]\n",
+			limits: newLimits(0, 0, 0),
+			err:    "dataPointId current is repeated",
+		},
+		"load": {
+			source: "load('x.star', 'y')\ndef process(points):\n    return points\n",
+			limits: newLimits(0, 0, 0),
+			err:    "load",
+		},
+		"undefined": {
+			source: "def handle(points):\n    return points\n",
+			limits: newLimits(0, 0, 0),
+			err:    "function process not defined",
+		},
+	} {
+		p, err := compile(name, c.source, c.limits)
+		if err == nil {
+			_, _, err = p.run(nil, []runtime.PointData{{DataPointId: "current", Value: 1.5}})
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected error %q, got %v", name, c.err, err)
+		}
+	}
+}
+
+func TestProgramBudget(t *testing.T) {
+	// the augmented assignments keep their semantics, += extends the list in place and *= creates a new list
+	source := `
+def process(points):
+    a = []
+    b = a
+    b += [1]
+    b *= 2
+    s = "%s-%d" % ("x", len(a))
+    return [{"dataPointId": s, "value": b}]
+`
+	p, err := compile("inplace", source, newLimits(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, _, err := p.run(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].DataPointId != "x-1" || len(points[0].Value.([]interface{})) != 2 {
+		t.Fatalf("unexpected points %v", points)
+	}
+
+	// the executions are charged to their own budgets, so the concurrent executions within the limit never fail
+	p, err = compile("concurrent", "def process(points):\n    s = 'x' * 600000\n    return points\n", newLimits(0, 10000, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := p.run(nil, nil); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("expected concurrent execution within limit, got %v", err)
+	}
+}
+
+func TestProgramAllocatingBuiltins(t *testing.T) {
+	for name, source := range map[string]string{
+		"join":    "s = 'a' * 1000000\nl = [s] * 300\n''.join(l)",
+		"replace": "s = 'a' * 1000000\ns.replace('a', s)",
+		"repr":    "s = 'a' * 1000000\nl = [s] * 300\nrepr(l)",
+		"str":     "s = 'a' * 1000000\nl = [s] * 300\nstr({'l': l})",
+		"format":  "s = 'a' * 1000000\nl = [s] * 300\n'{}'.format(l)",
+		"percent": "s = 'a' * 1000000\nl = [s] * 300\n'%s' % l",
+		"json":    "s = 'a' * 1000000\nl = [s] * 300\njson.encode(l)",
+		"sorted":  "sorted(range(1 << 30))",
+		"list":    "list(range(1 << 30))",
+	} {
+		source = "def process(points):\n    " + strings.ReplaceAll(source, "\n", "\n    ") + "\n    return points\n"
+		p, err := compile(name, source, newLimits(0, 10000, 0))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var before, after goruntime.MemStats
+		goruntime.ReadMemStats(&before)
+		_, _, err = p.run(nil, nil)
+		goruntime.ReadMemStats(&after)
+		if err == nil || !strings.Contains(err.Error(), "memory limit exceeded") {
+			t.Errorf("%s: expected memory limit exceeded, got %v", name, err)
+		}
+		// the call over the budget is rejected before allocating
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+			t.Errorf("%s: expected rejected before allocating, allocated %d bytes", name, allocated)
+		}
+	}
+
+	// the calls within the budget are not changed
+	source := `
+def process(points):
+    s = ",".join(["a", "b"]).replace(",", "-")
+    return [{"dataPointId": "%s %s" % (s, str(1)), "value": len(sorted(range(3))) + len(s.split("-"))}]
+`
+	p, err := compile("within", source, newLimits(0, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	points, _, err := p.run(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].DataPointId != "a-b 1" || points[0].Value != int64(5) {
+		t.Fatalf("unexpected points %v", points)
+	}
+}
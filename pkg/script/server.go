@@ -0,0 +1,141 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/scripts", createScript(mgr))
+	group.POST("/scripts/dry-run", dryRunScript(mgr))
+	group.DELETE("/scripts/:id", deleteScript(mgr))
+	group.PUT("/scripts/:id", updateScriptById(mgr))
+	group.GET("/scripts", listScripts(mgr))
+	group.GET("/scripts/:id", getScriptById(mgr))
+}
+
+func createScript(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Script{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse script", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		script, err := mgr.CreateScript(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, script.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, script.GetID()))
+		c.JSON(http.StatusCreated, script)
+	}
+}
+
+func dryRunScript(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.ScriptDryRun{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse script dry run", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		result, err := mgr.DryRun(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+func deleteScript(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		script, err := mgr.DeleteScript(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, script)
+	}
+}
+
+func updateScriptById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+
+		object := &v1.Script{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse script", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateScriptById(c.Param("id"), eTag, object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listScripts(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scripts, _ := mgr.ListScripts()
+		c.JSON(http.StatusOK, &ResponseModel{Scripts: scripts})
+	}
+}
+
+func getScriptById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		script, err := mgr.GetScriptById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, script.GetVersion())
+		c.JSON(http.StatusOK, script)
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,39 @@
+package script
+
+import (
+	"harnsgateway/pkg/runtime"
+	"time"
+)
+
+// Script processes the collected points of the attached devices
+type Script struct {
+	runtime.ObjectMeta
+	Description string        `json:"description,omitempty"` // 描述
+	Enabled     bool          `json:"enabled"`               // 是否启用
+	Source      string        `json:"source"`                // Starlark脚本
+	DeviceIds   []string      `json:"deviceIds,omitempty"`   // 采集后执行脚本的设备
+	MaxSteps    uint64        `json:"maxSteps,omitempty"`    // 单次执行的最大步数
+	Timeout     uint          `json:"timeout,omitempty"`     // 单次执行的超时时间(毫秒)
+	MaxMemory   uint64        `json:"maxMemory,omitempty"`   // 单次执行的最大分配内存(字节)
+	Status      *ScriptStatus `json:"status,omitempty"`      // 运行状态 不持久化
+}
+
+type ScriptStatus struct {
+	Executions    uint64     `json:"executions"`              // 执行次数
+	Failures      uint64     `json:"failures"`                // 失败次数 失败时发布原始数据
+	LastError     string     `json:"lastError,omitempty"`     // 最近一次失败原因
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"` // 最近一次失败时间
+}
+
+// DryRunResult the result of executing script against the sample points
+type DryRunResult struct {
+	Points   []runtime.PointData `json:"points,omitempty"`
+	Prints   []string            `json:"prints,omitempty"` // print输出
+	Steps    uint64              `json:"steps"`
+	Duration float64             `json:"duration"` // 执行耗时(毫秒)
+	Error    string              `json:"error,omitempty"`
+}
+
+type ResponseModel struct {
+	Scripts interface{} `json:"scripts,omitempty"`
+}
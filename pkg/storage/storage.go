@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -9,16 +10,34 @@ type StoreGroup byte
 const (
 	StoreGroupDevice StoreGroup = iota
 	StoreGroupGateway
+	StoreGroupNorthbound
+	StoreGroupAlarm
+	StoreGroupRule
+	StoreGroupScript
+	StoreGroupSchedule
+	StoreGroupTemplate
 )
 
 var (
 	StoreGroupToString = map[StoreGroup]string{
-		StoreGroupDevice:  "device",
-		StoreGroupGateway: "gateway",
+		StoreGroupDevice:     "device",
+		StoreGroupGateway:    "gateway",
+		StoreGroupNorthbound: "northbound",
+		StoreGroupAlarm:      "alarm",
+		StoreGroupRule:       "rule",
+		StoreGroupScript:     "script",
+		StoreGroupSchedule:   "schedule",
+		StoreGroupTemplate:   "template",
 	}
 	StoreGroupFromString = map[string]StoreGroup{
-		"device":  StoreGroupDevice,
-		"gateway": StoreGroupGateway,
+		"device":     StoreGroupDevice,
+		"gateway":    StoreGroupGateway,
+		"northbound": StoreGroupNorthbound,
+		"alarm":      StoreGroupAlarm,
+		"rule":       StoreGroupRule,
+		"script":     StoreGroupScript,
+		"schedule":   StoreGroupSchedule,
+		"template":   StoreGroupTemplate,
 	}
 )
 
@@ -26,7 +45,25 @@ var (
 const (
 	// device
 	Devices = "devices"
+	Actions = "actions"
 	Gateway = "gateway"
+	// northbound
+	Sinks = "sinks"
+	// alarm
+	AlarmDefinitions = "definitions"
+	Alarms           = "alarms"
+	// rule
+	Rules = "rules"
+	// script
+	Scripts = "scripts"
+	// schedule
+	Recipes    = "recipes"
+	Schedules  = "schedules"
+	Executions = "executions"
+	// template
+	Templates = "templates"
+	// device and gateway
+	Revisions = "revisions"
 )
 
 type Getter interface {
@@ -49,9 +86,11 @@ type Deleter interface {
 	Delete(key, version string) (interface{}, error)
 }
 
-// type Watcher interface {
-// 	Watch(stopCh <-chan struct{}, key string, rev string) (chan *Event, error)
-// }
+// Watcher watch the changes of objects under key after the revision, or after now if the revision is empty.
+// The channel is closed when stopped or the watcher can not keep up with the changes.
+type Watcher interface {
+	Watch(stopCh <-chan struct{}, key string, rev string) (chan *Event, error)
+}
 
 type Storage interface {
 	Getter
@@ -59,7 +98,50 @@ type Storage interface {
 	Creater
 	Updater
 	Deleter
-	// Watcher
+	Watcher
+}
+
+// backends
+const (
+	// BackendFs one JSON file per object under store path
+	BackendFs = "fs"
+	// BackendBolt the embedded bolt database with ACID transactions
+	BackendBolt = "bolt"
+)
+
+var backend = BackendFs
+
+// SetBackend select the backend of clients, must be called before any client is created
+func SetBackend(name string) error {
+	switch name {
+	case BackendFs, BackendBolt:
+		backend = name
+		return nil
+	default:
+		return fmt.Errorf("unsupported storage backend %q, must be one of %q, %q", name, BackendFs, BackendBolt)
+	}
+}
+
+// SetPath change the root directory of all store groups, must be called before any client is created
+func SetPath(path string) {
+	storePath = path
+}
+
+// Backend the selected backend of clients
+func Backend() string {
+	return backend
+}
+
+// NewClient the client of store group on the selected backend
+func NewClient(sg StoreGroup) Storage {
+	if backend == BackendBolt {
+		client := &BoltClient{}
+		client.Init(sg)
+		return client
+	}
+	client := &FsClient{}
+	client.Init(sg)
+	return client
 }
 
 type EventType int8
@@ -79,8 +161,10 @@ func (et EventType) String() string {
 }
 
 type Event struct {
-	Type EventType
-	Data interface{}
+	Type     EventType
+	Key      string      // 对象相对存储组的路径
+	Revision string      // 变更的修订号 进程内递增
+	Data     interface{} // 对象的JSON 删除时为删除前的对象
 }
 
 type FileInfo struct {
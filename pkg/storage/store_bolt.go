@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/runtime"
+	"io/fs"
+	"k8s.io/klog/v2"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// databaseName the bolt database under store path, each store group is one bucket
+	databaseName = "harnsgateway.db"
+	// openTimeout the database is locked by the running gateway
+	openTimeout = time.Second
+)
+
+// BoltClient keep the objects in buckets of the embedded bolt database, the key is the relative path like file layout.
+// Each operation is one ACID transaction, the version is compared and renewed within the transaction.
+type BoltClient struct {
+	db     *bolt.DB
+	group  string
+	bucket []byte
+}
+
+var (
+	_ Storage = (*BoltClient)(nil)
+
+	dbOnce sync.Once
+	db     *bolt.DB
+	dbErr  error
+)
+
+// DatabasePath the file of bolt database
+func DatabasePath() string {
+	return filepath.Join(storePath, databaseName)
+}
+
+// openDatabase open the bolt database once, it is shared by all store groups
+func openDatabase() (*bolt.DB, error) {
+	dbOnce.Do(func() {
+		if dbErr = os.MkdirAll(storePath, 0711); dbErr != nil {
+			return
+		}
+		db, dbErr = bolt.Open(DatabasePath(), 0600, &bolt.Options{Timeout: openTimeout})
+		if errors.Is(dbErr, bolt.ErrTimeout) {
+			dbErr = fmt.Errorf("%s is locked by another process", DatabasePath())
+		}
+	})
+	return db, dbErr
+}
+
+func (bc *BoltClient) Init(sg StoreGroup) {
+	d, err := openDatabase()
+	if err != nil {
+		klog.Fatalf("%s: %v", DatabasePath(), err)
+	}
+	if err := bc.init(d, sg); err != nil {
+		klog.Fatalf("%s: %v", DatabasePath(), err)
+	}
+}
+
+func (bc *BoltClient) init(d *bolt.DB, sg StoreGroup) error {
+	group, ok := StoreGroupToString[sg]
+	if !ok {
+		return fmt.Errorf("unsupported store group %d", sg)
+	}
+	bc.db = d
+	bc.group = group
+	bc.bucket = []byte(group)
+	return d.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bc.bucket)
+		return err
+	})
+}
+
+func (bc *BoltClient) Create(key string, obj interface{}) (interface{}, error) {
+	data, err := encode(obj)
+	if err != nil {
+		klog.V(2).InfoS("Failed to encode", "err", err)
+		return nil, err
+	}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bc.bucket)
+		k := boltKey(key)
+		if b.Get(k) != nil {
+			return &os.PathError{Op: "create", Path: key, Err: os.ErrExist}
+		}
+		return b.Put(k, data)
+	})
+	if err != nil {
+		klog.V(2).InfoS("Failed to create", "key", key, "err", err)
+		return nil, err
+	}
+	events.publish(bc.group, Create, key, data)
+	return obj, nil
+}
+
+func (bc *BoltClient) Get(key string) (interface{}, error) {
+	var data []byte
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bc.bucket).Get(boltKey(key))
+		if v == nil {
+			return &os.PathError{Op: "get", Path: key, Err: os.ErrNotExist}
+		}
+		data = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		klog.V(2).InfoS("Failed to read", "err", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// List the objects under key, the path is like the file path of FsClient to get the name by filepath.Base
+func (bc *BoltClient) List(key string) (interface{}, error) {
+	var files []*FileInfo
+	prefix := boltPrefix(key)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bc.bucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			files = append(files, &FileInfo{
+				Path: filepath.Join(storePath, bc.group, filepath.FromSlash(string(k))),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		klog.V(2).InfoS("Failed to list", "err", err)
+	}
+	return files, nil
+}
+
+func (bc *BoltClient) Delete(key, version string) (interface{}, error) {
+	var data []byte
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bc.bucket)
+		k := boltKey(key)
+		v := b.Get(k)
+		if v != nil {
+			data = append([]byte{}, v...)
+		}
+		// version is not required when cascading delete
+		if len(version) == 0 {
+			return b.Delete(k)
+		}
+		if v == nil {
+			return os.ErrNotExist
+		}
+		var target struct {
+			runtime.ObjectMeta
+		}
+		if err := json.Unmarshal(v, &target); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal", "err", err)
+			return apis.ErrInternal
+		}
+		if target.Version != version {
+			return apis.ErrMismatch
+		}
+		return b.Delete(k)
+	})
+	if err != nil {
+		klog.V(2).InfoS("Failed to delete", "key", key, "err", err)
+		return nil, err
+	}
+	if data != nil {
+		events.publish(bc.group, Remove, key, data)
+	}
+	return nil, nil
+}
+
+func (bc *BoltClient) Update(key, version string, obj interface{}) (interface{}, error) {
+	accessor, err := runtime.Accessor(obj)
+	if err != nil {
+		klog.V(2).InfoS("Failed to get accessor", "err", err)
+		return nil, apis.ErrInternal
+	}
+	previous := accessor.GetVersion()
+	var data []byte
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bc.bucket)
+		k := boltKey(key)
+		v := b.Get(k)
+		if v == nil {
+			return os.ErrNotExist
+		}
+		var old struct {
+			runtime.ObjectMeta
+		}
+		if err := json.Unmarshal(v, &old); err != nil {
+			klog.V(2).InfoS("Failed to unmarshal", "err", err)
+			return apis.ErrInternal
+		}
+		if version != old.Version {
+			return apis.ErrMismatch
+		}
+		ver, _ := strconv.ParseUint(version, 10, 64)
+		accessor.SetVersion(strconv.FormatUint(ver+uint64(rand.Intn(100))+1, 10))
+		encoded, err := encode(obj)
+		if err != nil {
+			klog.V(2).InfoS("Failed to marshal", "err", err)
+			return apis.ErrInternal
+		}
+		data = encoded
+		return b.Put(k, data)
+	})
+	if err != nil {
+		// the version is not renewed if the transaction is rolled back
+		accessor.SetVersion(previous)
+		klog.V(2).InfoS("Failed to update", "key", key, "err", err)
+		return nil, err
+	}
+	events.publish(bc.group, Update, key, data)
+	return obj, nil
+}
+
+func (bc *BoltClient) Watch(stopCh <-chan struct{}, key string, rev string) (chan *Event, error) {
+	return events.watch(stopCh, bc.group, key, rev)
+}
+
+// Migrate copy the objects of file layout under store path into the bolt database in one transaction, the files are
+// kept. The database must be empty unless overwrite, then the existing objects are dropped.
+func Migrate(overwrite bool) (int, error) {
+	d, err := openDatabase()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = d.Update(func(tx *bolt.Tx) error {
+		for _, group := range StoreGroupToString {
+			dir := filepath.Join(storePath, group)
+			if _, err := os.Stat(dir); os.IsNotExist(err) {
+				continue
+			}
+			if overwrite {
+				if err := tx.DeleteBucket([]byte(group)); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+					return err
+				}
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(group))
+			if err != nil {
+				return err
+			}
+			if k, _ := b.Cursor().First(); k != nil {
+				return fmt.Errorf("store group %s of %s is not empty", group, DatabasePath())
+			}
+			n, err := putFiles(b, dir, "", true)
+			if err != nil {
+				return err
+			}
+			count += n
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Export write the objects of bolt database into dir in the file layout of FsClient
+func Export(dir string) error {
+	d, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	return d.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				p := filepath.Join(dir, string(name), filepath.FromSlash(string(k)))
+				if err := os.MkdirAll(filepath.Dir(p), 0711); err != nil {
+					return err
+				}
+				return os.WriteFile(p, v, 0640)
+			})
+		})
+	})
+}
+
+// Replace replace the objects directly under each directory, e.g. "device/devices", with the files of the same
+// directory under dir in one transaction, the nested objects are kept
+func Replace(dir string, dirs []string) error {
+	d, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	return d.Update(func(tx *bolt.Tx) error {
+		for _, p := range dirs {
+			group, resource, _ := strings.Cut(p, "/")
+			b, err := tx.CreateBucketIfNotExists([]byte(group))
+			if err != nil {
+				return err
+			}
+			prefix := boltPrefix(resource)
+			var keys [][]byte
+			c := b.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				if !bytes.ContainsRune(k[len(prefix):], '/') {
+					keys = append(keys, append([]byte{}, k...))
+				}
+			}
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			if _, err := putFiles(b, filepath.Join(dir, filepath.FromSlash(p)), resource, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// putFiles put the regular files under dir into bucket with keys prefixed by the resource
+func putFiles(b *bolt.Bucket, dir string, resource string, recursive bool) (int, error) {
+	count := 0
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if p != dir && (!recursive || strings.HasPrefix(entry.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(boltKey(path.Join(resource, filepath.ToSlash(rel))), data); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+func encode(obj interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(obj); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func boltKey(key string) []byte {
+	return []byte(filepath.ToSlash(key))
+}
+
+func boltPrefix(key string) []byte {
+	if len(key) == 0 {
+		return []byte{}
+	}
+	return []byte(strings.TrimSuffix(filepath.ToSlash(key), "/") + "/")
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"errors"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/runtime"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type object struct {
+	runtime.ObjectMeta `json:",inline"`
+}
+
+func (o *object) DeepCopyObject() runtime.RunObject {
+	c := *o
+	return &c
+}
+
+func TestBoltClient(t *testing.T) {
+	d, err := bolt.Open(filepath.Join(t.TempDir(), databaseName), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	client := &BoltClient{}
+	if err := client.init(d, StoreGroupDevice); err != nil {
+		t.Fatal(err)
+	}
+
+	key := filepath.Join(Devices, "modbus.1")
+	obj := &object{ObjectMeta: runtime.ObjectMeta{ID: "1", Name: "meter", Version: "1"}}
+	if _, err := client.Create(key, obj); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Create(key, obj); !os.IsExist(err) {
+		t.Errorf("Create() of existing key err = %v", err)
+	}
+	if _, err := client.Create(filepath.Join(Actions, "1"), obj); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, _ := client.List(Devices)
+	if files := objs.([]*FileInfo); len(files) != 1 || filepath.Base(files[0].Path) != "modbus.1" {
+		t.Errorf("List() = %v", files)
+	}
+
+	if _, err := client.Update(key, "0", &object{ObjectMeta: runtime.ObjectMeta{ID: "1"}}); !errors.Is(err, apis.ErrMismatch) {
+		t.Errorf("Update() of mismatched version err = %v", err)
+	}
+	updated := &object{ObjectMeta: runtime.ObjectMeta{ID: "1", Name: "meter2", Version: "1"}}
+	if _, err := client.Update(key, "1", updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Version == "1" {
+		t.Errorf("Update() version is not renewed")
+	}
+	if _, err := client.Delete(key, "1"); !errors.Is(err, apis.ErrMismatch) {
+		t.Errorf("Delete() of mismatched version err = %v", err)
+	}
+	if _, err := client.Delete(key, updated.Version); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(key); !os.IsNotExist(err) {
+		t.Errorf("Get() of deleted key err = %v", err)
+	}
+}
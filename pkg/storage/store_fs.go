@@ -9,6 +9,7 @@ import (
 	"harnsgateway/pkg/apis"
 	"harnsgateway/pkg/runtime"
 	"harnsgateway/pkg/utils/fileutil"
+	"io"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/klog/v2"
 	"math/rand"
@@ -19,6 +20,7 @@ import (
 )
 
 type FsClient struct {
+	group     string
 	storePath string
 }
 
@@ -28,6 +30,11 @@ var (
 	doOnce sync.Once
 )
 
+// Path the root directory of all store groups
+func Path() string {
+	return storePath
+}
+
 func (fc *FsClient) Init(sg StoreGroup) {
 	_, err := os.Stat(storePath)
 	if err != nil {
@@ -45,16 +52,47 @@ func (fc *FsClient) Init(sg StoreGroup) {
 	case StoreGroupDevice:
 		dirs = []string{
 			Devices,
+			Actions,
+			Revisions,
 		}
 	case StoreGroupGateway:
 		dirs = []string{
 			"",
+			Revisions,
+		}
+	case StoreGroupNorthbound:
+		dirs = []string{
+			Sinks,
+		}
+	case StoreGroupAlarm:
+		dirs = []string{
+			AlarmDefinitions,
+			Alarms,
+		}
+	case StoreGroupRule:
+		dirs = []string{
+			Rules,
+		}
+	case StoreGroupScript:
+		dirs = []string{
+			Scripts,
+		}
+	case StoreGroupSchedule:
+		dirs = []string{
+			Recipes,
+			Schedules,
+			Executions,
+		}
+	case StoreGroupTemplate:
+		dirs = []string{
+			Templates,
 		}
 	default:
 		klog.Fatalf("Unsupported store group %d", sg)
 	}
 
-	fc.storePath = filepath.Join(storePath, StoreGroupToString[sg])
+	fc.group = StoreGroupToString[sg]
+	fc.storePath = filepath.Join(storePath, fc.group)
 
 	for _, m := range dirs {
 		p := filepath.Join(fc.storePath, m)
@@ -84,11 +122,16 @@ func (fc *FsClient) Create(key string, obj interface{}) (interface{}, error) {
 		return nil, err
 	}
 	defer f.Close()
-	err = json.NewEncoder(f).Encode(obj)
+	data, err := encode(obj)
 	if err != nil {
 		klog.V(2).InfoS("Failed to encode", "err", err)
 		return nil, err
 	}
+	if _, err = f.Write(data); err != nil {
+		klog.V(2).InfoS("Failed to write", "err", err)
+		return nil, err
+	}
+	events.publish(fc.group, Create, key, data)
 	return obj, nil
 }
 
@@ -120,6 +163,7 @@ func (fc *FsClient) List(key string) (interface{}, error) {
 func (fc *FsClient) Delete(key, version string) (interface{}, error) {
 	// version is not required when cascading delete
 	if len(version) == 0 {
+		data, _ := os.ReadFile(filepath.Join(fc.storePath, key))
 		c, cancel := context.WithCancel(context.Background())
 		wait.UntilWithContext(c, func(ctx context.Context) {
 			if err := os.Remove(filepath.Join(fc.storePath, key)); !isEphemeralError(err) {
@@ -129,6 +173,9 @@ func (fc *FsClient) Delete(key, version string) (interface{}, error) {
 				cancel()
 			}
 		}, 0)
+		if data != nil {
+			events.publish(fc.group, Remove, key, data)
+		}
 		return nil, nil
 	}
 
@@ -151,10 +198,15 @@ func (fc *FsClient) Delete(key, version string) (interface{}, error) {
 	}
 	defer lock.Release()
 
+	data, err := io.ReadAll(f)
+	if err != nil {
+		klog.V(2).InfoS("Failed to read", "err", err)
+		return nil, apis.ErrInternal
+	}
 	var target struct {
 		runtime.ObjectMeta
 	}
-	err = json.NewDecoder(f).Decode(&target)
+	err = json.Unmarshal(data, &target)
 	if err != nil {
 		klog.V(2).InfoS("Failed to unmarshal", "err", err)
 		return nil, apis.ErrInternal
@@ -169,6 +221,7 @@ func (fc *FsClient) Delete(key, version string) (interface{}, error) {
 		klog.V(2).InfoS("Failed to remove", "err", err)
 		return nil, apis.ErrInternal
 	}
+	events.publish(fc.group, Remove, key, data)
 	return nil, nil
 }
 
@@ -219,11 +272,20 @@ func (fc *FsClient) Update(key, version string, obj interface{}) (interface{}, e
 		klog.V(2).InfoS("Failed to seek", "err", err)
 		return nil, apis.ErrInternal
 	}
-	err = json.NewEncoder(f).Encode(obj)
+	data, err := encode(obj)
 	if err != nil {
 		klog.V(2).InfoS("Failed to marshal", "err", err)
 		return nil, apis.ErrInternal
 	}
+	if _, err = f.Write(data); err != nil {
+		klog.V(2).InfoS("Failed to write", "err", err)
+		return nil, apis.ErrInternal
+	}
+	events.publish(fc.group, Update, key, data)
 
 	return obj, nil
 }
+
+func (fc *FsClient) Watch(stopCh <-chan struct{}, key string, rev string) (chan *Event, error) {
+	return events.watch(stopCh, fc.group, key, rev)
+}
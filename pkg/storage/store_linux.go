@@ -1,6 +1,6 @@
 package storage
 
-const (
+var (
 	storePath = "/var/lib/harnsgateway"
 )
 
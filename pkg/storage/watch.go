@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// watchCacheSize the latest events kept to resume watching from a revision
+	watchCacheSize = 256
+	// watchChanSize the events buffered for each watcher, the slow watcher is closed when the buffer is full
+	watchChanSize = 64
+)
+
+// ErrRevisionExpired the events after the revision are not cached any more, the watcher has to list again
+var ErrRevisionExpired = errors.New("revision expired")
+
+type watcher struct {
+	group  string
+	prefix string
+	ch     chan *Event
+}
+
+func (w *watcher) match(group string, key string) bool {
+	return w.group == group && strings.HasPrefix(key, w.prefix)
+}
+
+type cachedEvent struct {
+	group string
+	event *Event
+}
+
+// broadcaster publish the changes of all clients in process, the revision increases by each change of any group
+type broadcaster struct {
+	mu       *sync.Mutex
+	revision uint64
+	// oldest the oldest revision can be resumed from
+	oldest   uint64
+	events   []*cachedEvent
+	watchers map[*watcher]struct{}
+}
+
+var events = &broadcaster{
+	mu:       &sync.Mutex{},
+	watchers: make(map[*watcher]struct{}),
+}
+
+// Revision the revision of the latest change, watching from it receives the changes after it
+func Revision() string {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	return strconv.FormatUint(events.revision, 10)
+}
+
+// ResetWatches close all watchers and drop the cached events, e.g. after the store is replaced by restoring,
+// the watchers have to list again
+func ResetWatches() {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	for w := range events.watchers {
+		events.remove(w)
+	}
+	events.events = nil
+	events.oldest = events.revision
+}
+
+// Notify publish the change made out of clients, e.g. the file edited on disk and reloaded
+func Notify(sg StoreGroup, eventType EventType, key string, data []byte) {
+	events.publish(StoreGroupToString[sg], eventType, key, data)
+}
+
+func (b *broadcaster) publish(group string, eventType EventType, key string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.revision++
+	key = filepath.ToSlash(key)
+	event := &Event{
+		Type:     eventType,
+		Key:      key,
+		Revision: strconv.FormatUint(b.revision, 10),
+		Data:     data,
+	}
+	b.events = append(b.events, &cachedEvent{group: group, event: event})
+	if len(b.events) > watchCacheSize {
+		b.events = b.events[len(b.events)-watchCacheSize:]
+		b.oldest = b.revision - watchCacheSize
+	}
+	for w := range b.watchers {
+		if !w.match(group, key) {
+			continue
+		}
+		select {
+		case w.ch <- event:
+		default:
+			b.remove(w)
+		}
+	}
+}
+
+func (b *broadcaster) watch(stopCh <-chan struct{}, group string, key string, rev string) (chan *Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := &watcher{
+		group: group,
+		ch:    make(chan *Event, watchChanSize),
+	}
+	if len(key) > 0 {
+		w.prefix = strings.TrimSuffix(filepath.ToSlash(key), "/") + "/"
+	}
+
+	if len(rev) > 0 {
+		from, err := strconv.ParseUint(rev, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		// the revision of former process is expired as well
+		if from < b.oldest || from > b.revision {
+			return nil, ErrRevisionExpired
+		}
+		replayed := make([]*Event, 0)
+		for _, e := range b.events {
+			if r, _ := strconv.ParseUint(e.event.Revision, 10, 64); r > from && w.match(e.group, e.event.Key) {
+				replayed = append(replayed, e.event)
+			}
+		}
+		w.ch = make(chan *Event, watchChanSize+len(replayed))
+		for _, e := range replayed {
+			w.ch <- e
+		}
+	}
+	b.watchers[w] = struct{}{}
+
+	go func() {
+		<-stopCh
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(w)
+	}()
+	return w.ch, nil
+}
+
+// remove must be called with lock held
+func (b *broadcaster) remove(w *watcher) {
+	if _, ok := b.watchers[w]; ok {
+		delete(b.watchers, w)
+		close(w.ch)
+	}
+}
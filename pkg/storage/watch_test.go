@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestBroadcasterWatch(t *testing.T) {
+	b := &broadcaster{mu: &sync.Mutex{}, watchers: make(map[*watcher]struct{})}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	ch, err := b.watch(stopCh, "device", Devices, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.publish("device", Create, "devices/modbus.1", []byte(`{}`))
+	b.publish("device", Create, "actions/1", []byte(`{}`))
+	b.publish("template", Create, "devices/modbus.1", []byte(`{}`))
+	b.publish("device", Remove, "devices/modbus.1", []byte(`{}`))
+	if e := <-ch; e.Type != Create || e.Revision != "1" || e.Key != "devices/modbus.1" {
+		t.Errorf("watch() got %+v", e)
+	}
+	if e := <-ch; e.Type != Remove || e.Revision != "4" {
+		t.Errorf("watch() got %+v", e)
+	}
+
+	replayed, err := b.watch(stopCh, "device", Devices, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 1 {
+		t.Errorf("watch() from revision 1 replayed %d events, want 1", len(replayed))
+	}
+	if _, err := b.watch(stopCh, "device", Devices, "5"); !errors.Is(err, ErrRevisionExpired) {
+		t.Errorf("watch() from future revision err = %v", err)
+	}
+
+	for i := 0; i < watchChanSize+1; i++ {
+		b.publish("device", Update, "devices/modbus.1", []byte(`{}`))
+	}
+	// the slow watcher is closed
+	for range ch {
+	}
+}
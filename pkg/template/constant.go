@@ -0,0 +1,15 @@
+package template
+
+import "harnsgateway/pkg/runtime"
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// TemplateTypeObjectMap the templates are stored by device type like devices
+var TemplateTypeObjectMap = map[string]runtime.Device{
+	"modbus": &Template{},
+	"opcUa":  &Template{},
+	"s7":     &Template{},
+}
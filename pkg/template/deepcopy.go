@@ -0,0 +1,59 @@
+package template
+
+import "harnsgateway/pkg/runtime"
+
+func (in *Template) DeepCopyObject() runtime.RunObject {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Parameters != nil {
+		out.Parameters = make([]*Parameter, len(in.Parameters))
+		for i, p := range in.Parameters {
+			param := *p
+			param.Default = deepCopyValue(p.Default)
+			out.Parameters[i] = &param
+		}
+	}
+	if in.Spec != nil {
+		out.Spec = deepCopyValue(in.Spec).(map[string]interface{})
+	}
+	if in.Instances != nil {
+		out.Instances = make([]*Instance, len(in.Instances))
+		for i, instance := range in.Instances {
+			out.Instances[i] = instance.DeepCopy()
+		}
+	}
+	return &out
+}
+
+func (in *Instance) DeepCopy() *Instance {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Parameters != nil {
+		out.Parameters = deepCopyValue(in.Parameters).(map[string]interface{})
+	}
+	return &out
+}
+
+// deepCopyValue copy the value decoded from JSON
+func deepCopyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			out[key] = deepCopyValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = deepCopyValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,264 @@
+package template
+
+import (
+	"fmt"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/utils/randutil"
+	"harnsgateway/pkg/utils/uuidutil"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeviceController creates and updates the devices of templates
+type DeviceController interface {
+	CreateDevice(object v1.DeviceType, opts ...revision.Option) (runtime.Device, error)
+	UpdateDeviceById(id string, version string, object v1.DeviceType, opts ...revision.Option) (runtime.Device, error)
+	GetDeviceById(id string, exploded bool) (runtime.Device, error)
+	// RecollectDevice restart collecting the updated device if it was collecting
+	RecollectDevice(device runtime.Device)
+}
+
+// Manager keeps the templates and the devices created from them
+type Manager struct {
+	devices   DeviceController
+	store     *generic.Store
+	mu        *sync.Mutex
+	templates map[string]*Template
+}
+
+func NewManager(store *generic.Store) *Manager {
+	return &Manager{
+		store:     store,
+		mu:        &sync.Mutex{},
+		templates: make(map[string]*Template, 0),
+	}
+}
+
+func (m *Manager) Init(devices DeviceController) {
+	m.devices = devices
+	objs, _ := m.store.LoadResource()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, obj := range objs {
+		if t, ok := obj.(*Template); ok {
+			m.templates[t.ID] = t
+		}
+	}
+}
+
+func (m *Manager) CreateTemplate(object *v1.Template) (*Template, error) {
+	t := &Template{
+		DeviceMeta: runtime.DeviceMeta{
+			ObjectMeta: runtime.ObjectMeta{
+				Name:    object.Name,
+				ID:      uuidutil.UUID(),
+				Version: strconv.FormatUint(randutil.Uint64n(), 10),
+				ModTime: time.Now(),
+			},
+		},
+		Generation: 1,
+	}
+	applyTemplate(t, object)
+	if err := validateTemplate(t); err != nil {
+		return nil, response.ErrTemplateInvalid(t.Name, err.Error())
+	}
+
+	if _, err := m.store.Create(t); err != nil {
+		klog.V(2).InfoS("Failed to store template", "error", err)
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.templates[t.ID] = t
+	return t.DeepCopyObject().(*Template), nil
+}
+
+// UpdateTemplateById update the template, and update the devices created from template if propagate.
+// The devices failed to update keep the previous generation with the error.
+func (m *Manager) UpdateTemplateById(id string, version string, object *v1.Template, propagate bool) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.templates[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if old.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+	if object.DeviceType != old.DeviceType {
+		return nil, response.ErrTemplateInvalid(old.Name, "device type can not be changed")
+	}
+
+	t := old.DeepCopyObject().(*Template)
+	t.ModTime = time.Now()
+	t.Generation++
+	applyTemplate(t, object)
+	if err := validateTemplate(t); err != nil {
+		return nil, response.ErrTemplateInvalid(t.Name, err.Error())
+	}
+
+	if propagate {
+		objects := make([]v1.DeviceType, len(t.Instances))
+		for i, instance := range t.Instances {
+			o, err := newDevice(t, instance.Name, instance.Parameters)
+			if err != nil {
+				return nil, response.ErrTemplateInvalid(t.Name, fmt.Sprintf("device %s: %v", instance.Name, err))
+			}
+			objects[i] = o
+		}
+		t.Instances = m.propagate(t, objects)
+	}
+
+	if _, err := m.store.Update(t); err != nil {
+		klog.V(2).InfoS("Failed to update template", "templateId", id, "err", err)
+		return nil, err
+	}
+	m.templates[id] = t
+	return t.DeepCopyObject().(*Template), nil
+}
+
+// propagate update the devices of template, the deleted devices are unlinked, must be called with lock held
+func (m *Manager) propagate(t *Template, objects []v1.DeviceType) []*Instance {
+	instances := make([]*Instance, 0, len(t.Instances))
+	for i, instance := range t.Instances {
+		d, err := m.devices.GetDeviceById(instance.DeviceId, false)
+		if err != nil {
+			klog.V(3).InfoS("Unlinked deleted device from template", "templateId", t.ID, "deviceId", instance.DeviceId)
+			continue
+		}
+		updated, err := m.devices.UpdateDeviceById(instance.DeviceId, d.GetVersion(), objects[i], revision.WithAuthor(revision.SourceTemplate, t.ID))
+		if err != nil {
+			klog.V(2).InfoS("Failed to update device from template", "templateId", t.ID, "deviceId", instance.DeviceId, "err", err)
+			instance.Error = err.Error()
+		} else {
+			m.devices.RecollectDevice(updated)
+			instance.Generation = t.Generation
+			instance.Error = ""
+		}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// Instantiate create the devices from template, all devices are validated before any is created
+func (m *Manager) Instantiate(id string, object *v1.TemplateInstantiation) ([]*InstanceResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.templates[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	errs := &response.MultiError{}
+	objects := make([]v1.DeviceType, len(object.Devices))
+	for i, d := range object.Devices {
+		o, err := newDevice(old, d.Name, d.Parameters)
+		if err != nil {
+			errs.Add(response.ErrTemplateInvalid(old.Name, fmt.Sprintf("device %s: %v", d.Name, err)))
+			continue
+		}
+		objects[i] = o
+	}
+	if errs.Len() > 0 {
+		return nil, errs
+	}
+
+	t := old.DeepCopyObject().(*Template)
+	results := make([]*InstanceResult, 0, len(object.Devices))
+	for i, d := range object.Devices {
+		result := &InstanceResult{Name: d.Name, Result: ResultSuccess}
+		created, err := m.devices.CreateDevice(objects[i], revision.WithAuthor(revision.SourceTemplate, id))
+		if err != nil {
+			klog.V(2).InfoS("Failed to create device from template", "templateId", id, "name", d.Name, "err", err)
+			result.Result = ResultFailure
+			result.Error = err.Error()
+		} else {
+			result.DeviceId = created.GetID()
+			t.Instances = append(t.Instances, &Instance{
+				DeviceId:   created.GetID(),
+				Name:       d.Name,
+				Parameters: d.Parameters,
+				Generation: t.Generation,
+			})
+		}
+		results = append(results, result)
+	}
+
+	if len(t.Instances) == len(old.Instances) {
+		return results, nil
+	}
+	if _, err := m.store.Update(t); err != nil {
+		klog.V(2).InfoS("Failed to update template", "templateId", id, "err", err)
+		return nil, err
+	}
+	m.templates[id] = t
+	return results, nil
+}
+
+// DeleteTemplate delete the template, the devices created from template are kept
+func (m *Manager) DeleteTemplate(id string, version string) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.templates[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if t.GetVersion() != version {
+		return nil, apis.ErrMismatch
+	}
+
+	if _, err := m.store.Delete(t); err != nil {
+		klog.V(2).InfoS("Failed to delete template", "templateId", id, "err", err)
+		return nil, err
+	}
+	delete(m.templates, id)
+	klog.V(2).InfoS("Deleted template", "templateId", id)
+	return t.DeepCopyObject().(*Template), nil
+}
+
+func (m *Manager) ListTemplates() ([]*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	templates := make([]*Template, 0, len(m.templates))
+	for _, t := range m.templates {
+		templates = append(templates, t.DeepCopyObject().(*Template))
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ModTime.After(templates[j].ModTime) })
+	return templates, nil
+}
+
+func (m *Manager) GetTemplateById(id string) (*Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.templates[id]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return t.DeepCopyObject().(*Template), nil
+}
+
+func applyTemplate(t *Template, object *v1.Template) {
+	t.Name = object.Name
+	t.Description = object.Description
+	t.DeviceType = object.DeviceType
+	t.DeviceModel = object.DeviceModel
+	t.Spec = object.Spec
+	t.Parameters = make([]*Parameter, 0, len(object.Parameters))
+	for _, p := range object.Parameters {
+		t.Parameters = append(t.Parameters, &Parameter{
+			Name:        p.Name,
+			Description: p.Description,
+			Default:     p.Default,
+		})
+	}
+}
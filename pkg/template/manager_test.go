@@ -0,0 +1,56 @@
+package template
+
+import (
+	"errors"
+	modbus "harnsgateway/pkg/protocol/modbus/runtime"
+	"harnsgateway/pkg/revision"
+	"harnsgateway/pkg/runtime"
+	v1 "harnsgateway/pkg/v1"
+	"os"
+	"sync"
+	"testing"
+)
+
+// fakeDevices updates the devices in memory and records the recollected devices
+type fakeDevices struct {
+	devices     map[string]runtime.Device
+	recollected []runtime.Device
+}
+
+func (f *fakeDevices) CreateDevice(object v1.DeviceType, opts ...revision.Option) (runtime.Device, error) {
+	return nil, errors.New("unsupported")
+}
+
+func (f *fakeDevices) UpdateDeviceById(id string, version string, object v1.DeviceType, opts ...revision.Option) (runtime.Device, error) {
+	d := &modbus.ModBusDevice{}
+	d.ID, d.Version = id, version+"1"
+	f.devices[id] = d
+	return d, nil
+}
+
+func (f *fakeDevices) GetDeviceById(id string, exploded bool) (runtime.Device, error) {
+	if d, ok := f.devices[id]; ok {
+		return d, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeDevices) RecollectDevice(device runtime.Device) {
+	f.recollected = append(f.recollected, device)
+}
+
+func TestPropagate(t *testing.T) {
+	d := &modbus.ModBusDevice{}
+	d.ID, d.Version = "1", "1"
+	devices := &fakeDevices{devices: map[string]runtime.Device{"1": d}}
+	m := &Manager{devices: devices, mu: &sync.Mutex{}}
+	tmpl := &Template{Generation: 2, Instances: []*Instance{{DeviceId: "1"}, {DeviceId: "2"}}}
+
+	instances := m.propagate(tmpl, []v1.DeviceType{&v1.ModBusDevice{}, &v1.ModBusDevice{}})
+	if len(instances) != 1 || instances[0].DeviceId != "1" || instances[0].Generation != 2 {
+		t.Fatalf("expected deleted device unlinked, got %v", instances)
+	}
+	if len(devices.recollected) != 1 || devices.recollected[0] != devices.devices["1"] {
+		t.Errorf("expected updated device recollected, got %v", devices.recollected)
+	}
+}
@@ -0,0 +1,133 @@
+package template
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin/binding"
+	"harnsgateway/pkg/generic"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"regexp"
+	"strings"
+)
+
+var (
+	parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	placeholder   = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+// placeholders the names of parameters referenced by the value
+func placeholders(value interface{}, names sets.String) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, e := range v {
+			placeholders(e, names)
+		}
+	case []interface{}:
+		for _, e := range v {
+			placeholders(e, names)
+		}
+	case string:
+		for _, match := range placeholder.FindAllStringSubmatch(v, -1) {
+			names.Insert(match[1])
+		}
+	}
+}
+
+// render replace the placeholders by the parameter values, the string consisting of one placeholder only
+// is replaced by the value as is, e.g. "${slaveId}" is rendered to number 1 rather than string "1".
+func render(value interface{}, values map[string]interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, e := range v {
+			out[key] = render(e, values)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = render(e, values)
+		}
+		return out
+	case string:
+		if match := placeholder.FindStringSubmatch(v); match != nil && match[0] == v {
+			return values[match[1]]
+		}
+		return placeholder.ReplaceAllStringFunc(v, func(s string) string {
+			return fmt.Sprint(values[strings.TrimSuffix(strings.TrimPrefix(s, "${"), "}")])
+		})
+	default:
+		return v
+	}
+}
+
+// resolveParameters the values of all parameters, the default value is used if not given
+func resolveParameters(parameters []*Parameter, given map[string]interface{}) (map[string]interface{}, error) {
+	declared := sets.NewString()
+	values := make(map[string]interface{}, len(parameters))
+	for _, p := range parameters {
+		declared.Insert(p.Name)
+		if v, ok := given[p.Name]; ok && v != nil {
+			values[p.Name] = v
+		} else if p.Default != nil {
+			values[p.Name] = p.Default
+		} else {
+			return nil, fmt.Errorf("parameter %s is required", p.Name)
+		}
+	}
+	for name := range given {
+		if !declared.Has(name) {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	return values, nil
+}
+
+// validateTemplate the parameters should be unique, and the placeholders in spec should be declared
+func validateTemplate(t *Template) error {
+	if _, ok := generic.DeviceTypeMap[t.DeviceType]; !ok {
+		return fmt.Errorf("unsupported device type %s", t.DeviceType)
+	}
+	declared := sets.NewString()
+	for _, p := range t.Parameters {
+		if !parameterName.MatchString(p.Name) {
+			return fmt.Errorf("parameter name %s should consist of letters, digits and underscores", p.Name)
+		}
+		if declared.Has(p.Name) {
+			return fmt.Errorf("duplicated parameter %s", p.Name)
+		}
+		declared.Insert(p.Name)
+	}
+	referenced := sets.NewString()
+	placeholders(t.Spec, referenced)
+	if undeclared := referenced.Difference(declared); undeclared.Len() > 0 {
+		return fmt.Errorf("undeclared parameters %v", undeclared.List())
+	}
+	return nil
+}
+
+// newDevice render the spec of template into the device object, which is validated like creating device
+func newDevice(t *Template, name string, given map[string]interface{}) (v1.DeviceType, error) {
+	values, err := resolveParameters(t.Parameters, given)
+	if err != nil {
+		return nil, err
+	}
+	rendered := render(t.Spec, values).(map[string]interface{})
+	rendered["name"] = name
+	rendered["deviceType"] = t.DeviceType
+	rendered["deviceModel"] = t.DeviceModel
+
+	data, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+	object := generic.DeviceTypeMap[t.DeviceType]()
+	if err := json.Unmarshal(data, object); err != nil {
+		return nil, err
+	}
+	if err := binding.Validator.ValidateStruct(object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
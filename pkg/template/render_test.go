@@ -0,0 +1,62 @@
+package template
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	spec := map[string]interface{}{
+		"slave":   "${slaveId}",
+		"address": "${host}:${port}",
+		"variables": []interface{}{
+			map[string]interface{}{"name": "current", "address": "${base}"},
+		},
+		"deviceCode": "meter",
+	}
+	values := map[string]interface{}{"slaveId": float64(3), "host": "10.0.0.1", "port": float64(502), "base": float64(100)}
+	expected := map[string]interface{}{
+		"slave":   float64(3),
+		"address": "10.0.0.1:502",
+		"variables": []interface{}{
+			map[string]interface{}{"name": "current", "address": float64(100)},
+		},
+		"deviceCode": "meter",
+	}
+	if got := render(spec, values); !reflect.DeepEqual(got, expected) {
+		t.Errorf("render() = %v, want %v", got, expected)
+	}
+}
+
+func TestResolveParameters(t *testing.T) {
+	parameters := []*Parameter{{Name: "slaveId"}, {Name: "port", Default: float64(502)}}
+	values, err := resolveParameters(parameters, map[string]interface{}{"slaveId": float64(1)})
+	if err != nil || values["port"] != float64(502) || values["slaveId"] != float64(1) {
+		t.Errorf("resolveParameters() = %v %v", values, err)
+	}
+	if _, err := resolveParameters(parameters, nil); err == nil {
+		t.Error("resolveParameters() should fail without required parameter")
+	}
+	if _, err := resolveParameters(parameters, map[string]interface{}{"slaveId": float64(1), "unit": "A"}); err == nil {
+		t.Error("resolveParameters() should fail with unknown parameter")
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	template := &Template{
+		Parameters: []*Parameter{{Name: "slaveId"}},
+		Spec:       map[string]interface{}{"slave": "${slaveId}", "port": "${port}"},
+	}
+	template.DeviceType = "modbus"
+	if err := validateTemplate(template); err == nil {
+		t.Error("validateTemplate() should fail with undeclared parameter")
+	}
+	template.Parameters = append(template.Parameters, &Parameter{Name: "port"})
+	if err := validateTemplate(template); err != nil {
+		t.Errorf("validateTemplate() = %v", err)
+	}
+	template.Parameters = append(template.Parameters, &Parameter{Name: "port"})
+	if err := validateTemplate(template); err == nil {
+		t.Error("validateTemplate() should fail with duplicated parameter")
+	}
+}
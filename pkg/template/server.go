@@ -0,0 +1,146 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"harnsgateway/pkg/apis"
+	"harnsgateway/pkg/apis/response"
+	v1 "harnsgateway/pkg/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+func InstallHandler(group *gin.RouterGroup, mgr *Manager) {
+	group.POST("/templates", createTemplate(mgr))
+	group.DELETE("/templates/:id", deleteTemplate(mgr))
+	group.PUT("/templates/:id", updateTemplateById(mgr))
+	group.GET("/templates", listTemplates(mgr))
+	group.GET("/templates/:id", getTemplateById(mgr))
+	group.POST("/templates/:id/instantiate", instantiateTemplate(mgr))
+}
+
+func createTemplate(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.Template{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(2).InfoS("Failed to parse template", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		t, err := mgr.CreateTemplate(object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, t.GetVersion())
+		c.Header(apis.Location, fmt.Sprintf("https://%s%s/%s", c.Request.Host, c.Request.RequestURI, t.GetID()))
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+func deleteTemplate(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		t, err := mgr.DeleteTemplate(c.Param("id"), eTag)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+func updateTemplateById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		eTag := c.GetHeader(apis.IfMatch)
+		if len(eTag) == 0 {
+			c.Status(http.StatusPreconditionRequired)
+			return
+		}
+		propagate, _ := strconv.ParseBool(c.Query("propagate"))
+
+		object := &v1.Template{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse template", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		updated, err := mgr.UpdateTemplateById(c.Param("id"), eTag, object, propagate)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header(apis.ETag, updated.GetVersion())
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+func listTemplates(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templates, _ := mgr.ListTemplates()
+		c.JSON(http.StatusOK, &ResponseModel{Templates: templates})
+	}
+}
+
+func getTemplateById(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, err := mgr.GetTemplateById(c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.Header(apis.ETag, t.GetVersion())
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+func instantiateTemplate(mgr *Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer c.Request.Body.Close()
+
+		object := &v1.TemplateInstantiation{}
+		if err := c.ShouldBindJSON(object); err != nil {
+			klog.V(3).InfoS("Failed to parse template instantiation", "err", err)
+			c.JSON(http.StatusBadRequest, response.NewMultiError(response.ErrMalformedJSON))
+			return
+		}
+
+		results, err := mgr.Instantiate(c.Param("id"), object)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, &ResponseModel{Results: results})
+	}
+}
+
+func writeError(c *gin.Context, err error) {
+	var errs *response.MultiError
+	switch {
+	case os.IsNotExist(err):
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, apis.ErrMismatch):
+		c.Status(http.StatusPreconditionFailed)
+	case errors.As(err, &errs):
+		c.JSON(http.StatusBadRequest, errs)
+	case response.IsResponseError(err):
+		c.JSON(http.StatusBadRequest, response.NewMultiError(err))
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+}
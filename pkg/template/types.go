@@ -0,0 +1,46 @@
+package template
+
+import (
+	"harnsgateway/pkg/runtime"
+)
+
+var _ runtime.Device = (*Template)(nil)
+
+// Template the device type, model and variables shared by identical devices,
+// the devices are created from template with the parameters such as slave id or DB number.
+type Template struct {
+	runtime.DeviceMeta
+	Description string                 `json:"description,omitempty"` // 描述
+	Parameters  []*Parameter           `json:"parameters,omitempty"`  // 参数定义
+	Spec        map[string]interface{} `json:"spec"`                  // 设备定义 字符串中可使用${参数名}
+	Generation  int64                  `json:"generation"`            // 设备定义的版本 每次更新加1
+	Instances   []*Instance            `json:"instances,omitempty"`   // 由模板创建的设备
+}
+
+type Parameter struct {
+	Name        string      `json:"name"`                  // 参数名称
+	Description string      `json:"description,omitempty"` // 描述
+	Default     interface{} `json:"default,omitempty"`     // 默认值 为空时创建设备必须指定
+}
+
+// Instance the device created from template
+type Instance struct {
+	DeviceId   string                 `json:"deviceId"`
+	Name       string                 `json:"name"`                 // 设备名称
+	Parameters map[string]interface{} `json:"parameters,omitempty"` // 参数值
+	Generation int64                  `json:"generation"`           // 设备对应的模板版本
+	Error      string                 `json:"error,omitempty"`      // 最近一次同步失败原因
+}
+
+// InstanceResult the result of creating one device from template
+type InstanceResult struct {
+	Name     string `json:"name"`
+	DeviceId string `json:"deviceId,omitempty"`
+	Result   string `json:"result"` // success、failure
+	Error    string `json:"error,omitempty"`
+}
+
+type ResponseModel struct {
+	Templates interface{} `json:"templates,omitempty"`
+	Results   interface{} `json:"results,omitempty"`
+}
@@ -0,0 +1,260 @@
+package xlsxutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSheet the workbook has no worksheet
+var ErrNoSheet = errors.New("no worksheet in workbook")
+
+const (
+	contentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	rootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	workbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	workbookFormat = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+)
+
+// Write writes the rows as the only worksheet of workbook, all cells are written as inline strings
+func Write(w io.Writer, sheet string, rows [][]string) error {
+	zw := zip.NewWriter(w)
+	name := &bytes.Buffer{}
+	_ = xml.EscapeText(name, []byte(sheet))
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", contentTypes},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", fmt.Sprintf(workbookFormat, name.String())},
+		{"xl/_rels/workbook.xml.rels", workbookRels},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		fmt.Fprintf(buf, `<row r="%d">`, i+1)
+		for j, cell := range row {
+			if len(cell) == 0 {
+				continue
+			}
+			fmt.Fprintf(buf, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">`, ColumnName(j), i+1)
+			_ = xml.EscapeText(buf, []byte(cell))
+			buf.WriteString(`</t></is></c>`)
+		}
+		buf.WriteString(`</row>`)
+	}
+	buf.WriteString(`</sheetData></worksheet>`)
+	if _, err := buf.WriteTo(f); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+type relationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type workbook struct {
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type richText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt *richText) String() string {
+	if len(rt.R) == 0 {
+		return rt.T
+	}
+	sb := strings.Builder{}
+	for _, r := range rt.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+type sharedStrings struct {
+	Items []richText `xml:"si"`
+}
+
+type worksheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R  string    `xml:"r,attr"`
+			T  string    `xml:"t,attr"`
+			V  string    `xml:"v"`
+			Is *richText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// Read reads the rows of the first worksheet, the shared strings, inline strings and the raw values are supported,
+// the formulas are read as the cached values.
+func Read(r io.ReaderAt, size int64) ([][]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared sharedStrings
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decode(f, &shared); err != nil {
+			return nil, err
+		}
+	}
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, ErrNoSheet
+	}
+	var ws worksheet
+	if err := decode(f, &ws); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	for i, row := range ws.Rows {
+		index := row.R - 1
+		if index < 0 {
+			index = i
+		}
+		for len(rows) <= index {
+			rows = append(rows, nil)
+		}
+		cells := make([]string, 0, len(row.Cells))
+		for j, c := range row.Cells {
+			column := j
+			if len(c.R) > 0 {
+				if column, err = ColumnIndex(c.R); err != nil {
+					return nil, err
+				}
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			switch c.T {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("invalid shared string %s of cell %s", c.V, c.R)
+				}
+				cells[column] = shared.Items[n].String()
+			case "inlineStr":
+				if c.Is != nil {
+					cells[column] = c.Is.String()
+				}
+			case "b":
+				cells[column] = strconv.FormatBool(c.V == "1")
+			default:
+				cells[column] = c.V
+			}
+		}
+		rows[index] = cells
+	}
+	return rows, nil
+}
+
+func firstSheet(files map[string]*zip.File) (string, error) {
+	var wb workbook
+	var rels relationships
+	wf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", ErrNoSheet
+	}
+	if err := decode(wf, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", ErrNoSheet
+	}
+	if rf, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		if err := decode(rf, &rels); err != nil {
+			return "", err
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID == wb.Sheets[0].ID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// ColumnName the name of column by zero based index, e.g. 0 is A and 26 is AA
+func ColumnName(index int) string {
+	name := ""
+	for index += 1; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// ColumnIndex the zero based index of column by cell reference, e.g. B3 is 1
+func ColumnIndex(ref string) (int, error) {
+	index := 0
+	for i, ch := range ref {
+		if ch >= 'A' && ch <= 'Z' {
+			index = index*26 + int(ch-'A'+1)
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		return index - 1, nil
+	}
+	return 0, fmt.Errorf("invalid cell reference %s", ref)
+}
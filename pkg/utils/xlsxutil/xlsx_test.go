@@ -0,0 +1,38 @@
+package xlsxutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	rows := [][]string{
+		{"deviceCode", "variable.name", "variable.address"},
+		{"pm-1", "current", "40001"},
+		{"pm-1", "", "<&>"},
+	}
+	buf := &bytes.Buffer{}
+	if err := Write(buf, "devices", rows); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{rows[0], rows[1], {"pm-1", "", "<&>"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Read() = %v, want %v", got, expected)
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for index, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := ColumnName(index); got != name {
+			t.Errorf("ColumnName(%d) = %s, want %s", index, got, name)
+		}
+		if got, err := ColumnIndex(name + "12"); err != nil || got != index {
+			t.Errorf("ColumnIndex(%s12) = %d %v, want %d", name, got, err, index)
+		}
+	}
+}
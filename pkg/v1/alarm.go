@@ -0,0 +1,26 @@
+package v1
+
+// alarm
+type AlarmDefinition struct {
+	Name         string   `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	DeviceId     string   `json:"deviceId" binding:"required"`                                         // 设备id
+	Variable     string   `json:"variable" binding:"required"`                                         // 变量名称
+	AlarmType    string   `json:"alarmType" binding:"required,oneof=limit boolean rateOfChange stale"` // limit、boolean、rateOfChange、stale
+	Severity     string   `json:"severity,omitempty" binding:"omitempty,oneof=critical major minor warning"`
+	Enabled      bool     `json:"enabled"`                                       // 是否启用
+	HighHigh     *float64 `json:"highHigh,omitempty"`                            // 高高限
+	High         *float64 `json:"high,omitempty"`                                // 高限
+	Low          *float64 `json:"low,omitempty"`                                 // 低限
+	LowLow       *float64 `json:"lowLow,omitempty"`                              // 低低限
+	AlarmOn      *bool    `json:"alarmOn,omitempty"`                             // 布尔报警 值等于alarmOn时报警
+	RateLimit    float64  `json:"rateLimit,omitempty" binding:"gte=0"`           // 变化率上限(每秒)
+	StaleTimeout uint     `json:"staleTimeout,omitempty"`                        // 值未变化的超时时间(秒)
+	Deadband     float64  `json:"deadband,omitempty" binding:"gte=0"`            // 死区 恢复时需要越过限值的幅度
+	OnDelay      uint     `json:"onDelay,omitempty"`                             // 条件持续满足多久后报警(秒)
+	OffDelay     uint     `json:"offDelay,omitempty"`                            // 条件持续不满足多久后恢复(秒)
+	Message      string   `json:"message,omitempty" binding:"omitempty,max=256"` // 报警信息
+}
+
+type AlarmAcknowledgement struct {
+	Comment string `json:"comment,omitempty" binding:"omitempty,max=256"` // 确认备注
+}
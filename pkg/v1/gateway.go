@@ -0,0 +1,6 @@
+package v1
+
+// gateway
+type GatewayMeta struct {
+	Name string `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"` // 网关名称
+}
@@ -1,6 +1,9 @@
 package v1
 
-import "harnsgateway/pkg/runtime/constant"
+import (
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+)
 
 // modbus
 type ModbusVariable struct {
@@ -12,7 +15,10 @@ type ModbusVariable struct {
 	Rate         float64             `json:"rate,omitempty"`                                                // 比率
 	Amount       uint                `json:"amount,omitempty"`                                              // 数量
 	DefaultValue interface{}         `json:"defaultValue,omitempty"`                                        // 默认值
-	AccessMode   constant.AccessMode `json:"accessMode" binding:"required"`                                 // 读写属性
+	AccessMode   constant.AccessMode `json:"accessMode"`                                                    // 读写属性
+	Transform    *runtime.Transform  `json:"transform,omitempty"`                                           // 转换
+	Constraint   *runtime.Constraint `json:"constraint,omitempty"`                                          // 写入约束
+	Disabled     bool                `json:"disabled,omitempty"`                                            // 禁用 不采集
 }
 
 type ModBusDevice struct {
@@ -1,6 +1,9 @@
 package v1
 
-import "harnsgateway/pkg/runtime/constant"
+import (
+	"harnsgateway/pkg/runtime"
+	"harnsgateway/pkg/runtime/constant"
+)
 
 // opcua
 type OpcUaVariable struct {
@@ -9,7 +12,10 @@ type OpcUaVariable struct {
 	Address      interface{}         `json:"address" binding:"required"`                                    // 变量地址
 	NameSpace    uint16              `json:"Namespace" binding:"required"`                                  // 命名空间
 	DefaultValue interface{}         `json:"defaultValue,omitempty"`                                        // 默认值
-	AccessMode   constant.AccessMode `json:"accessMode" binding:"required"`                                 // 读写属性
+	AccessMode   constant.AccessMode `json:"accessMode"`                                                    // 读写属性
+	Transform    *runtime.Transform  `json:"transform,omitempty"`                                           // 转换
+	Constraint   *runtime.Constraint `json:"constraint,omitempty"`                                          // 写入约束
+	Disabled     bool                `json:"disabled,omitempty"`                                            // 禁用 不采集
 }
 
 type OpcUaDevice struct {
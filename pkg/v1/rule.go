@@ -0,0 +1,17 @@
+package v1
+
+// rule
+type Rule struct {
+	Name        string        `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	Enabled     bool          `json:"enabled"`                                     // 是否启用
+	DeviceId    string        `json:"deviceId,omitempty"`                          // 条件中直接使用变量名时变量所属的设备
+	Condition   string        `json:"condition" binding:"required,min=1,max=1024"` // 条件表达式
+	For         uint          `json:"for,omitempty"`                               // 条件持续满足多久后执行(秒)
+	MinInterval uint          `json:"minInterval,omitempty"`                       // 两次执行的最小间隔(秒)
+	Actions     []*RuleAction `json:"actions" binding:"required,min=1,dive"`       // 执行的动作
+}
+
+type RuleAction struct {
+	DeviceId string                 `json:"deviceId" binding:"required"`     // 设备id
+	Values   map[string]interface{} `json:"values" binding:"required,min=1"` // 写入的变量与值
+}
@@ -0,0 +1,30 @@
+package v1
+
+import "time"
+
+// ActionSet the values written to one device
+type ActionSet struct {
+	DeviceId string    `json:"deviceId" binding:"required"`           // 设备id
+	Actions  []*Action `json:"actions" binding:"required,min=1,dive"` // 写入的变量与值
+}
+
+// recipe
+type Recipe struct {
+	Name        string       `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	Description string       `json:"description,omitempty" binding:"omitempty,max=256"` // 描述
+	Items       []*ActionSet `json:"items" binding:"required,min=1,dive"`               // 配方内容
+	Readback    bool         `json:"readback,omitempty"`                                // 写入后回读校验
+	Tolerance   float64      `json:"tolerance,omitempty" binding:"gte=0"`               // 回读校验的数值容差
+	Timeout     uint         `json:"timeout,omitempty" binding:"omitempty,max=300"`     // 回读校验超时时间(秒)
+	Rollback    bool         `json:"rollback,omitempty"`                                // 失败时恢复写入前的值
+}
+
+// schedule
+type Schedule struct {
+	Name     string       `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	Enabled  bool         `json:"enabled"`                                    // 是否启用
+	Cron     string       `json:"cron,omitempty" binding:"omitempty,max=64"`  // cron表达式 与at二选一
+	At       *time.Time   `json:"at,omitempty"`                               // 单次执行时间 与cron二选一
+	RecipeId string       `json:"recipeId,omitempty"`                         // 执行的配方 与actions二选一
+	Actions  []*ActionSet `json:"actions,omitempty" binding:"omitempty,dive"` // 执行的动作
+}
@@ -0,0 +1,25 @@
+package v1
+
+import "harnsgateway/pkg/runtime"
+
+// script
+type Script struct {
+	Name        string   `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	Description string   `json:"description,omitempty" binding:"omitempty,max=256"`     // 描述
+	Enabled     bool     `json:"enabled"`                                               // 是否启用
+	Source      string   `json:"source" binding:"required,min=1,max=65536"`             // Starlark脚本 需定义process(points, device)函数
+	DeviceIds   []string `json:"deviceIds,omitempty" binding:"omitempty,dive,min=1"`    // 采集后执行脚本的设备
+	MaxSteps    uint64   `json:"maxSteps,omitempty" binding:"omitempty,max=100000000"`  // 单次执行的最大步数
+	Timeout     uint     `json:"timeout,omitempty" binding:"omitempty,max=10000"`       // 单次执行的超时时间(毫秒)
+	MaxMemory   uint64   `json:"maxMemory,omitempty" binding:"omitempty,max=268435456"` // 单次执行的最大分配内存(字节)
+}
+
+// ScriptDryRun executes the script against the sample points without attaching it to devices
+type ScriptDryRun struct {
+	Source    string              `json:"source" binding:"required,min=1,max=65536"`
+	MaxSteps  uint64              `json:"maxSteps,omitempty" binding:"omitempty,max=100000000"`
+	Timeout   uint                `json:"timeout,omitempty" binding:"omitempty,max=10000"`
+	MaxMemory uint64              `json:"maxMemory,omitempty" binding:"omitempty,max=268435456"`
+	DeviceId  string              `json:"deviceId,omitempty"` // 可选 设备信息传入脚本
+	Points    []runtime.PointData `json:"points" binding:"required"`
+}
@@ -0,0 +1,44 @@
+package v1
+
+// northbound
+type Sink struct {
+	Name          string          `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	SinkType      string          `json:"sinkType" binding:"required,oneof=mqtt http file influxdb"` // mqtt、http、file、influxdb
+	Enabled       bool            `json:"enabled"`                                                   // 是否启用
+	Devices       []string        `json:"devices,omitempty"`                                         // 设备id 为空时发送全部设备数据
+	QueueSize     int             `json:"queueSize,omitempty" binding:"gte=0"`                       // 缓冲队列长度
+	BatchSize     int             `json:"batchSize,omitempty" binding:"gte=0"`                       // 批量发送数量
+	FlushInterval uint            `json:"flushInterval,omitempty"`                                   // 批量发送间隔(秒)
+	MaxRetries    int             `json:"maxRetries,omitempty" binding:"gte=0"`                      // 重试次数
+	Mqtt          *MqttSinkOption `json:"mqtt,omitempty"`
+	Http          *HttpSinkOption `json:"http,omitempty"`
+	File          *FileSinkOption `json:"file,omitempty"`
+	Influxdb      *InfluxdbOption `json:"influxdb,omitempty"`
+}
+
+type MqttSinkOption struct {
+	Topic  string `json:"topic,omitempty"`           // topic模板 支持{gatewayId} {deviceId} 为空时使用设备topic
+	Qos    byte   `json:"qos" binding:"gte=0,lte=2"` // 0、1、2
+	Retain bool   `json:"retain"`                    // 是否保留消息
+}
+
+type HttpSinkOption struct {
+	Url     string            `json:"url" binding:"required,url"` // webhook地址
+	Method  string            `json:"method,omitempty"`           // 请求方法 默认POST
+	Headers map[string]string `json:"headers,omitempty"`          // 请求头
+	Timeout uint              `json:"timeout,omitempty"`          // 超时时间(秒)
+}
+
+type FileSinkOption struct {
+	Directory  string `json:"directory" binding:"required"`               // 文件目录
+	Format     string `json:"format" binding:"omitempty,oneof=jsonl csv"` // jsonl、csv 默认jsonl
+	MaxSize    uint   `json:"maxSize,omitempty"`                          // 单个文件大小上限(MB)
+	MaxBackups uint   `json:"maxBackups,omitempty"`                       // 保留的历史文件数量
+}
+
+type InfluxdbOption struct {
+	Url         string `json:"url" binding:"required,url"` // line protocol写入地址 例如http://127.0.0.1:8086/api/v2/write?org=harns&bucket=gateway&precision=ns
+	Token       string `json:"token,omitempty"`            // 认证token
+	Measurement string `json:"measurement,omitempty"`      // measurement 默认harnsgateway
+	Timeout     uint   `json:"timeout,omitempty"`          // 超时时间(秒)
+}
@@ -0,0 +1,27 @@
+package v1
+
+// template
+type Template struct {
+	Name        string                 `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"`
+	Description string                 `json:"description,omitempty" binding:"omitempty,max=256"`                    // 描述
+	DeviceType  string                 `json:"deviceType" binding:"required,min=1,max=32,excludesall=\u002F\u005C"`  // 设备类型
+	DeviceModel string                 `json:"deviceModel" binding:"required,min=1,max=32,excludesall=\u002F\u005C"` // 设备型号
+	Parameters  []*TemplateParameter   `json:"parameters,omitempty" binding:"omitempty,max=64,dive"`                 // 参数定义
+	Spec        map[string]interface{} `json:"spec" binding:"required"`                                              // 设备定义 与创建设备的请求体一致 字符串中可使用${参数名}
+}
+
+type TemplateParameter struct {
+	Name        string      `json:"name" binding:"required,min=1,max=64"`              // 参数名称 字母、数字、下划线
+	Description string      `json:"description,omitempty" binding:"omitempty,max=256"` // 描述
+	Default     interface{} `json:"default,omitempty"`                                 // 默认值 为空时创建设备必须指定
+}
+
+// TemplateInstantiation creates devices from template
+type TemplateInstantiation struct {
+	Devices []*TemplateInstance `json:"devices" binding:"required,min=1,max=500,dive"`
+}
+
+type TemplateInstance struct {
+	Name       string                 `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"` // 设备名称
+	Parameters map[string]interface{} `json:"parameters,omitempty"`                                          // 参数值
+}
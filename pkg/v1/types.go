@@ -1,7 +1,14 @@
 package v1
 
+import "harnsgateway/pkg/runtime"
+
 type DeviceType interface {
 	GetDeviceType() string
+	GetDeviceCode() string
+	GetLabels() map[string]string
+	GetGroup() string
+	GetVirtualVariables() []*VirtualVariable
+	GetAggregations() []*runtime.Aggregation
 }
 
 type DeviceMeta struct {
@@ -10,6 +17,19 @@ type DeviceMeta struct {
 	DeviceCode  string `json:"deviceCode" binding:"required,min=1,max=32,excludesall=\u002F\u005C"`
 	DeviceType  string `json:"deviceType" binding:"required,min=1,max=32,excludesall=\u002F\u005C"`
 	DeviceModel string `json:"deviceModel" binding:"required,min=1,max=32,excludesall=\u002F\u005C"`
+	// 标签 例如 line: "3"
+	Labels map[string]string `json:"labels,omitempty"`
+	// 分组 以/分隔的区域层级 例如 plant-a/line-3
+	Group string `json:"group,omitempty"`
+	// 虚拟变量 由表达式计算
+	VirtualVariables []*VirtualVariable `json:"virtualVariables,omitempty" binding:"omitempty,dive"`
+	// 聚合窗口 发布前按窗口聚合变量
+	Aggregations []*runtime.Aggregation `json:"aggregations,omitempty"`
+}
+
+type VirtualVariable struct {
+	Name       string `json:"name" binding:"required,min=1,max=64,excludesall=\u002F\u005C"` // 变量名称
+	Expression string `json:"expression" binding:"required,min=1,max=1024"`                  // 表达式
 }
 
 type PublishMeta struct {
@@ -19,3 +39,23 @@ type PublishMeta struct {
 func (d *DeviceMeta) GetDeviceType() string {
 	return d.DeviceType
 }
+
+func (d *DeviceMeta) GetDeviceCode() string {
+	return d.DeviceCode
+}
+
+func (d *DeviceMeta) GetLabels() map[string]string {
+	return d.Labels
+}
+
+func (d *DeviceMeta) GetGroup() string {
+	return d.Group
+}
+
+func (d *DeviceMeta) GetVirtualVariables() []*VirtualVariable {
+	return d.VirtualVariables
+}
+
+func (d *DeviceMeta) GetAggregations() []*runtime.Aggregation {
+	return d.Aggregations
+}
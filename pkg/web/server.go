@@ -5,11 +5,20 @@ import (
 	"crypto/tls"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"harnsgateway/cmd/gateway/config"
 	"harnsgateway/cmd/gateway/options"
+	"harnsgateway/pkg/alarm"
+	"harnsgateway/pkg/backup"
 	"harnsgateway/pkg/device"
 	"harnsgateway/pkg/gateway"
 	"harnsgateway/pkg/generic"
+	"harnsgateway/pkg/metrics"
+	"harnsgateway/pkg/northbound"
+	"harnsgateway/pkg/rule"
+	"harnsgateway/pkg/schedule"
+	"harnsgateway/pkg/script"
+	"harnsgateway/pkg/template"
 	"k8s.io/klog/v2"
 	"net/http"
 )
@@ -40,9 +49,20 @@ func NewServer(router *gin.Engine, o *options.Options, config *config.Config) (*
 }
 
 func (s *Server) InstallHandlers() {
+	metrics.Registry.MustRegister(gateway.NewCollector(s.Config.GatewayMgr), device.NewCollector(s.Config.DeviceMgr))
+	s.Router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+
 	v1 := s.Router.Group("/api/v1")
 	device.InstallHandler(v1, s.Config.DeviceMgr)
+	v1.GET("/devices/:id/stream", streamDevice(s.Config.DeviceMgr))
 	gateway.InstallHandler(v1, s.Config.GatewayMgr)
+	northbound.InstallHandler(v1, s.Config.SinkMgr)
+	alarm.InstallHandler(v1, s.Config.AlarmMgr)
+	rule.InstallHandler(v1, s.Config.RuleMgr)
+	script.InstallHandler(v1, s.Config.ScriptMgr)
+	schedule.InstallHandler(v1, s.Config.ScheduleMgr)
+	template.InstallHandler(v1, s.Config.TemplateMgr)
+	backup.InstallHandler(v1, s.Config.BackupMgr)
 }
 
 func (s *Server) Serve() (func(ctx context.Context), error) {
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"harnsgateway/pkg/device"
+	"io"
+	"k8s.io/klog/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the stream is consumed by local HMI panel which may be served from other origin
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// streamDevice push the live data and status of device by WebSocket,
+// or by Server-Sent Events when the request is not a WebSocket upgrade.
+// Query 'variables' filters the variables separated by comma,
+// query 'interval' throttles the data events in milliseconds, only the latest one is pushed in each interval.
+func streamDevice(mgr *device.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var variables []string
+		if v := c.Query("variables"); len(v) > 0 {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); len(name) > 0 {
+					variables = append(variables, name)
+				}
+			}
+		}
+		interval, err := strconv.ParseUint(c.DefaultQuery("interval", "0"), 10, 32)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+
+		subscriber, err := mgr.Subscribe(c.Param("id"), variables)
+		if err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		defer mgr.Unsubscribe(subscriber)
+
+		events := throttle(subscriber.Events(), time.Duration(interval)*time.Millisecond, c.Request.Context().Done())
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			serveWebSocket(c, events)
+		} else {
+			serveSSE(c, events)
+		}
+	}
+}
+
+func serveWebSocket(c *gin.Context, events <-chan *device.StreamEvent) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		klog.V(3).InfoS("Failed to upgrade websocket", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// read messages to process control frames, the connection is closed by client when read failed
+	closed := make(chan struct{}, 0)
+	conn.SetReadLimit(512)
+	_ = conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-events:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				klog.V(4).InfoS("Failed to write websocket", "err", err)
+				return
+			}
+		case <-ticker.C:
+			_ = conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func serveSSE(c *gin.Context, events <-chan *device.StreamEvent) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		}
+	})
+}
+
+// throttle forwards status events immediately and merges data events in each interval
+func throttle(in <-chan *device.StreamEvent, interval time.Duration, done <-chan struct{}) <-chan *device.StreamEvent {
+	if interval <= 0 {
+		return in
+	}
+	out := make(chan *device.StreamEvent, 1)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var latest *device.StreamEvent
+		send := func(event *device.StreamEvent) bool {
+			select {
+			case out <- event:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-in:
+				if !ok {
+					return
+				}
+				if event.Type == device.StreamEventData {
+					latest = event
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			case <-ticker.C:
+				if latest != nil {
+					if !send(latest) {
+						return
+					}
+					latest = nil
+				}
+			}
+		}
+	}()
+	return out
+}